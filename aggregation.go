@@ -0,0 +1,130 @@
+// Copyright 2013 Belogik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goes
+
+import (
+	"sort"
+	"strconv"
+)
+
+// Represents the result of an aggregation as returned in the aggregations
+// section of a search response
+type Aggregation map[string]interface{}
+
+// Represents a bucket of a bucket aggregation (terms, histogram, range ...)
+type Bucket struct {
+	Key         interface{}
+	KeyAsString string
+	DocCount    uint64
+
+	// Sub aggregations by name
+	Aggregations map[string]Aggregation
+}
+
+// Buckets returns the buckets of a bucket aggregation. Keyed buckets are
+// sorted by key.
+func (a Aggregation) Buckets() []Bucket {
+	buckets := []Bucket{}
+
+	switch raw := a["buckets"].(type) {
+	case []interface{}:
+		for _, b := range raw {
+			if m, ok := b.(map[string]interface{}); ok {
+				buckets = append(buckets, newBucket(nil, m))
+			}
+		}
+
+	case map[string]interface{}:
+		keys := make([]string, 0, len(raw))
+		for key := range raw {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if m, ok := raw[key].(map[string]interface{}); ok {
+				buckets = append(buckets, newBucket(key, m))
+			}
+		}
+	}
+
+	return buckets
+}
+
+// Value returns the value of a single value metric aggregation (avg, sum,
+// cardinality ...), false if there is none (no documents matched)
+func (a Aggregation) Value() (float64, bool) {
+	return a.Metric("value")
+}
+
+// Metric returns a value of a multi value metric aggregation (min, max, avg,
+// std_deviation for a stats or an extended_stats aggregation ...)
+func (a Aggregation) Metric(name string) (float64, bool) {
+	v, ok := a[name].(float64)
+	return v, ok
+}
+
+// Values returns the values of a percentiles aggregation keyed by percent
+func (a Aggregation) Values() map[string]float64 {
+	values := map[string]float64{}
+
+	if raw, ok := a["values"].(map[string]interface{}); ok {
+		for key, v := range raw {
+			if f, ok := v.(float64); ok {
+				values[key] = f
+			}
+		}
+	}
+
+	return values
+}
+
+// DocCount returns the number of documents of a single bucket aggregation
+// (filter, missing, nested, global ...)
+func (a Aggregation) DocCount() uint64 {
+	v, _ := a["doc_count"].(float64)
+	return uint64(v)
+}
+
+// Aggregation returns the sub aggregation called name, nil if there is none
+func (a Aggregation) Aggregation(name string) Aggregation {
+	m, _ := a[name].(map[string]interface{})
+	return m
+}
+
+// newBucket converts a raw bucket, key is used for keyed buckets
+func newBucket(key interface{}, raw map[string]interface{}) Bucket {
+	b := Bucket{
+		Key:          key,
+		Aggregations: map[string]Aggregation{},
+	}
+
+	for name, v := range raw {
+		switch name {
+		case "key":
+			b.Key = v
+		case "key_as_string":
+			b.KeyAsString, _ = v.(string)
+		case "doc_count":
+			count, _ := v.(float64)
+			b.DocCount = uint64(count)
+		default:
+			if m, ok := v.(map[string]interface{}); ok {
+				b.Aggregations[name] = m
+			}
+		}
+	}
+
+	if b.KeyAsString == "" {
+		switch k := b.Key.(type) {
+		case string:
+			b.KeyAsString = k
+		case float64:
+			b.KeyAsString = strconv.FormatFloat(k, 'f', -1, 64)
+		}
+	}
+
+	return b
+}
@@ -0,0 +1,168 @@
+// Copyright 2013 Belogik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goes
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+const (
+	ALIAS_ACTION_ADD    = "add"
+	ALIAS_ACTION_REMOVE = "remove"
+)
+
+// Aliases applies all the actions atomically, e.g. to move an alias from an
+// index to another one
+func (c *Connection) Aliases(actions []AliasAction) (Response, error) {
+	body := make([]interface{}, 0, len(actions))
+	for _, action := range actions {
+		body = append(body, action.body())
+	}
+
+	r := Request{
+		Conn:   c,
+		Query:  map[string]interface{}{"actions": body},
+		method: "POST",
+		api:    "_aliases",
+	}
+
+	return r.Run()
+}
+
+// AddAlias points the alias to indexes
+func (c *Connection) AddAlias(alias string, indexes []string) (Response, error) {
+	return c.Aliases(aliasActions(ALIAS_ACTION_ADD, alias, indexes))
+}
+
+// RemoveAlias stops pointing the alias to indexes
+func (c *Connection) RemoveAlias(alias string, indexes []string) (Response, error) {
+	return c.Aliases(aliasActions(ALIAS_ACTION_REMOVE, alias, indexes))
+}
+
+// GetAliases returns the sorted aliases of each index of indexList, of all the
+// indices when indexList is empty
+func (c *Connection) GetAliases(indexList []string) (map[string][]string, error) {
+	r := Request{
+		Conn:      c,
+		IndexList: indexList,
+		method:    "GET",
+		api:       "_aliases",
+	}
+
+	raw, err := r.RunRaw()
+	if err != nil {
+		return nil, err
+	}
+
+	indices := map[string]struct {
+		Aliases map[string]interface{}
+	}{}
+	if err := c.decode(raw, &indices); err != nil {
+		return nil, err
+	}
+
+	aliases := make(map[string][]string, len(indices))
+	for index, v := range indices {
+		names := make([]string, 0, len(v.Aliases))
+		for name := range v.Aliases {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		aliases[index] = names
+	}
+
+	return aliases, nil
+}
+
+// aliasActions returns the same action on alias for every index
+func aliasActions(action string, alias string, indexes []string) []AliasAction {
+	actions := make([]AliasAction, 0, len(indexes))
+	for _, index := range indexes {
+		actions = append(actions, AliasAction{Action: action, Index: index, Alias: alias})
+	}
+
+	return actions
+}
+
+// body returns the action as expected by the _aliases API
+func (a AliasAction) body() map[string]interface{} {
+	params := map[string]interface{}{
+		"index": a.Index,
+		"alias": a.Alias,
+	}
+
+	if a.Filter != nil {
+		params["filter"] = a.Filter
+	}
+
+	if a.Routing != "" {
+		params["routing"] = a.Routing
+	}
+
+	return map[string]interface{}{a.Action: params}
+}
+
+// aliasIndices returns the indices an alias points to
+func (c *Connection) aliasIndices(alias string) ([]string, error) {
+	r := Request{
+		Conn:   c,
+		method: "GET",
+		api:    "_alias/" + alias,
+	}
+
+	raw, err := r.RunRaw()
+	if err != nil {
+		return nil, err
+	}
+
+	aliases := map[string]interface{}{}
+	if err := json.Unmarshal(raw, &aliases); err != nil {
+		return nil, err
+	}
+
+	indices := make([]string, 0, len(aliases))
+	for index := range aliases {
+		indices = append(indices, index)
+	}
+	sort.Strings(indices)
+
+	return indices, nil
+}
+
+// Rollover points the alias to a new index when the current one meets any of
+// the conditions (max_age, max_docs ...). The new index is created with
+// definition, the settings, mappings and aliases of a CreateIndex call, which
+// can be nil.
+func (c *Connection) Rollover(alias string, conditions map[string]interface{}, definition map[string]interface{}) (RolloverResult, error) {
+	if err := c.require(FEATURE_ROLLOVER_API); err != nil {
+		return RolloverResult{}, err
+	}
+
+	query := map[string]interface{}{}
+	for key, value := range definition {
+		query[key] = value
+	}
+	query["conditions"] = conditions
+
+	r := Request{
+		Conn:      c,
+		Query:     query,
+		IndexList: []string{alias},
+		method:    "POST",
+		api:       "_rollover",
+	}
+
+	raw, err := r.RunRaw()
+	if err != nil || raw == nil {
+		return RolloverResult{}, err
+	}
+
+	result := RolloverResult{}
+	err = c.decode(raw, &result)
+
+	return result, err
+}
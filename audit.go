@@ -0,0 +1,108 @@
+// Copyright 2013 Belogik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// audit gives the writes of documents to the AuditHook of the connection, if
+// any. The BulkCommand of the documents is used when command is empty.
+func (c *Connection) audit(command string, documents ...Document) error {
+	if c.AuditHook == nil {
+		return nil
+	}
+
+	now := time.Now()
+
+	mutations := make([]Mutation, 0, len(documents))
+	for _, d := range documents {
+		mutation := Mutation{Time: now, Command: command, Document: d}
+		if command == "" {
+			mutation.Command = d.BulkCommand
+		}
+
+		if !c.AuditBodies {
+			mutation.Document.Fields = nil
+			mutation.Document.Script = nil
+		}
+
+		mutations = append(mutations, mutation)
+	}
+
+	return c.AuditHook(mutations)
+}
+
+// bulkDocuments parses a body in the format of the _bulk API sent to index
+// into the documents it writes, for the AuditHook of BulkSendRaw
+func bulkDocuments(index string, body []byte) ([]Document, error) {
+	documents := []Document{}
+
+	lines := bytes.Split(bytes.TrimSpace(body), []byte("\n"))
+	for i := 0; i < len(lines); i++ {
+		if len(bytes.TrimSpace(lines[i])) == 0 {
+			continue
+		}
+
+		var header map[string]struct {
+			Index   interface{} `json:"_index"`
+			Type    string      `json:"_type"`
+			Id      interface{} `json:"_id"`
+			Routing string      `json:"_routing"`
+			Parent  string      `json:"_parent"`
+		}
+		if err := json.Unmarshal(lines[i], &header); err != nil {
+			return nil, fmt.Errorf("bulk line %d: %w", i+1, err)
+		}
+
+		if len(header) != 1 {
+			return nil, fmt.Errorf("bulk line %d is not an action", i+1)
+		}
+
+		for command, metadata := range header {
+			d := Document{
+				Index:       metadata.Index,
+				Type:        metadata.Type,
+				Id:          metadata.Id,
+				BulkCommand: command,
+				Routing:     metadata.Routing,
+				Parent:      metadata.Parent,
+			}
+			if d.Index == nil {
+				d.Index = index
+			}
+
+			// every action but delete is followed by a line of fields
+			if command != BULK_COMMAND_DELETE {
+				i++
+				if i >= len(lines) {
+					return nil, fmt.Errorf("bulk line %d has no source", i)
+				}
+
+				var err error
+				if command == BULK_COMMAND_UPDATE {
+					var update struct {
+						Doc    map[string]interface{}
+						Script interface{}
+					}
+					err = json.Unmarshal(lines[i], &update)
+					d.Fields, d.Script = update.Doc, update.Script
+				} else {
+					err = json.Unmarshal(lines[i], &d.Fields)
+				}
+				if err != nil {
+					return nil, fmt.Errorf("bulk line %d: %w", i+1, err)
+				}
+			}
+
+			documents = append(documents, d)
+		}
+	}
+
+	return documents, nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2013 Belogik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goes
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+)
+
+// CatIndices lists the indices of indexList, every index when empty
+func (c *Connection) CatIndices(indexList []string) ([]CatIndex, error) {
+	indices := []CatIndex{}
+	err := c.cat("indices", indexList, nil, &indices)
+	return indices, err
+}
+
+// CatShards lists the copies of the shards of the indices of indexList, of
+// every index when empty
+func (c *Connection) CatShards(indexList []string) ([]CatShard, error) {
+	shards := []CatShard{}
+	err := c.cat("shards", indexList, nil, &shards)
+	return shards, err
+}
+
+// CatNodes lists the nodes of the cluster
+func (c *Connection) CatNodes() ([]CatNode, error) {
+	nodes := []CatNode{}
+	args := url.Values{"h": {"name,ip,heap.percent,ram.percent,node.role,master"}}
+	err := c.cat("nodes", nil, args, &nodes)
+	return nodes, err
+}
+
+// CatAllocation lists the number of shards and the disk usage of the nodes of
+// nodeList, of every node when empty
+func (c *Connection) CatAllocation(nodeList []string) ([]CatAllocation, error) {
+	allocations := []CatAllocation{}
+	err := c.cat("allocation", nodeList, nil, &allocations)
+	return allocations, err
+}
+
+// CatThreadPool lists the thread pools (search, bulk ...) of every node,
+// every pool when poolList is empty. The layout of _cat/thread_pool is only
+// supported since elasticsearch 5.0.
+func (c *Connection) CatThreadPool(poolList []string) ([]CatThreadPool, error) {
+	pools := []CatThreadPool{}
+	args := url.Values{"h": {"node_name,name,active,queue,rejected"}}
+	err := c.cat("thread_pool", poolList, args, &pools)
+	return pools, err
+}
+
+// cat fetches a _cat API in JSON, with the sizes in bytes, and decodes the
+// rows into v
+func (c *Connection) cat(api string, list []string, args url.Values, v interface{}) error {
+	args = copyValues(args)
+	args.Set("format", "json")
+	args.Set("bytes", "b")
+
+	r := Request{
+		Conn:      c,
+		ExtraArgs: args,
+		method:    "GET",
+		api:       "_cat/" + api,
+	}
+
+	if len(list) > 0 {
+		r.api += "/" + strings.Join(list, ",")
+	}
+
+	raw, err := r.RunRaw()
+	if err != nil || raw == nil {
+		return err
+	}
+
+	return json.Unmarshal(raw, v)
+}
@@ -0,0 +1,230 @@
+// Copyright 2013 Belogik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goes
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	ALLOCATION_INCLUDE = "include"
+	ALLOCATION_EXCLUDE = "exclude"
+	ALLOCATION_REQUIRE = "require"
+)
+
+const (
+	HEALTH_GREEN  = "green"
+	HEALTH_YELLOW = "yellow"
+	HEALTH_RED    = "red"
+)
+
+// NodeAttributes fetches the attributes (rack, zone ...) of the nodes of the
+// cluster by node name
+func (c *Connection) NodeAttributes() (map[string]map[string]string, error) {
+	nodes, err := c.NodesInfo(nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	attributes := make(map[string]map[string]string, len(nodes))
+	for _, node := range nodes {
+		attributes[node.Name] = node.Attributes
+	}
+
+	return attributes, nil
+}
+
+// SetAllocationFilter sets which nodes the shards of an index can be allocated
+// to, using the values of a node attribute. The filter is one of
+// ALLOCATION_INCLUDE, ALLOCATION_EXCLUDE or ALLOCATION_REQUIRE. The filter is
+// removed when values is empty.
+// Shards are relocated in the background, see WaitForRelocation.
+func (c *Connection) SetAllocationFilter(index string, filter string, attribute string, values []string) (Response, error) {
+	var value interface{}
+	if len(values) > 0 {
+		value = strings.Join(values, ",")
+	}
+
+	r := Request{
+		Conn: c,
+		Query: map[string]interface{}{
+			"index.routing.allocation." + filter + "." + attribute: value,
+		},
+		IndexList: []string{index},
+		method:    "PUT",
+		api:       "_settings",
+	}
+
+	return r.Run()
+}
+
+// GetClusterSettings fetches the flat settings (cluster.routing.allocation.enable
+// ...) set on the cluster, the defaults are not returned
+func (c *Connection) GetClusterSettings() (ClusterSettings, error) {
+	r := Request{
+		Conn:      c,
+		ExtraArgs: url.Values{"flat_settings": {"true"}},
+		method:    "GET",
+		api:       "_cluster/settings",
+	}
+
+	raw, err := r.RunRaw()
+	if err != nil || raw == nil {
+		return ClusterSettings{}, err
+	}
+
+	settings := ClusterSettings{}
+	err = c.decode(raw, &settings)
+
+	return settings, err
+}
+
+// PutClusterSettings changes the dynamic settings of the cluster, for example
+// {"cluster.routing.allocation.enable": "none"} in Transient during a rolling
+// restart. Persistent settings survive a full cluster restart. A nil value
+// resets a setting to its default since elasticsearch 5.0.
+func (c *Connection) PutClusterSettings(settings ClusterSettings) (Response, error) {
+	r := Request{
+		Conn:   c,
+		Query:  settings,
+		method: "PUT",
+		api:    "_cluster/settings",
+	}
+
+	return r.Run()
+}
+
+// WaitForRelocation blocks until no shard of the index is relocating anymore,
+// at most for timeout (30s, 5m ...). An error is returned when the timeout
+// expires first.
+func (c *Connection) WaitForRelocation(index string, timeout string) error {
+	args := url.Values{"timeout": {timeout}}
+
+	if ok, _ := c.Supports(FEATURE_WAIT_FOR_NO_RELOCATING_SHARDS); ok {
+		args.Set("wait_for_no_relocating_shards", "true")
+	} else {
+		args.Set("wait_for_relocating_shards", "0")
+	}
+
+	health, err := c.Health([]string{index}, args)
+	if err != nil {
+		return err
+	}
+
+	if health.TimedOut {
+		return fmt.Errorf("%d shards of %s are still relocating after %s", health.RelocatingShards, index, timeout)
+	}
+
+	return nil
+}
+
+// WaitForStatus blocks until the status of the indices in indexList, of the
+// cluster when indexList is empty, is at least status (HEALTH_GREEN,
+// HEALTH_YELLOW ...), at most for timeout (30s, 5m ...). An error is returned
+// when the timeout expires first.
+func (c *Connection) WaitForStatus(indexList []string, status string, timeout string) error {
+	args := url.Values{"wait_for_status": {status}, "timeout": {timeout}}
+
+	health, err := c.Health(indexList, args)
+	if err != nil {
+		return err
+	}
+
+	if health.TimedOut {
+		return fmt.Errorf("status is still %s after %s", health.Status, timeout)
+	}
+
+	return nil
+}
+
+// Health fetches the health of the cluster, or of the indices in indexList
+// only. The params (wait_for_status, timeout, level ...) are sent as URL
+// arguments, TimedOut is set when a wait_for_* condition was not met in time.
+func (c *Connection) Health(indexList []string, params url.Values) (ClusterHealth, error) {
+	api := "_cluster/health"
+	if len(indexList) > 0 {
+		api += "/" + strings.Join(indexList, ",")
+	}
+
+	r := Request{
+		Conn:      c,
+		ExtraArgs: params,
+		method:    "GET",
+		api:       api,
+	}
+
+	// the health is answered with a 408 when a wait_for_* condition is not
+	// met in time
+	raw, err := r.RunRaw()
+	if searchErr, ok := searchError(err); ok && searchErr.StatusCode == 408 {
+		raw, err = []byte(searchErr.Msg), nil
+	}
+	if err != nil {
+		return ClusterHealth{}, err
+	}
+
+	health := ClusterHealth{}
+	err = c.decode(raw, &health)
+
+	return health, err
+}
+
+// ClusterState fetches the state of the cluster, restricted to the metrics
+// (nodes, routing_table, metadata, blocks ...) and to the indices of
+// indexList when they are not empty
+func (c *Connection) ClusterState(metrics []string, indexList []string) (ClusterState, error) {
+	api := "_cluster/state"
+
+	if len(metrics) > 0 {
+		api += "/" + strings.Join(metrics, ",")
+	} else if len(indexList) > 0 {
+		api += "/_all"
+	}
+
+	if len(indexList) > 0 {
+		api += "/" + strings.Join(indexList, ",")
+	}
+
+	r := Request{
+		Conn:   c,
+		method: "GET",
+		api:    api,
+	}
+
+	raw, err := r.RunRaw()
+	if err != nil || raw == nil {
+		return ClusterState{}, err
+	}
+
+	state := ClusterState{}
+	err = c.decode(raw, &state)
+
+	return state, err
+}
+
+// PendingTasks fetches the cluster state changes (index creations, mapping
+// updates ...) queued on the master node, a long queue means the master is
+// overloaded
+func (c *Connection) PendingTasks() ([]PendingTask, error) {
+	r := Request{
+		Conn:   c,
+		method: "GET",
+		api:    "_cluster/pending_tasks",
+	}
+
+	raw, err := r.RunRaw()
+	if err != nil || raw == nil {
+		return nil, err
+	}
+
+	pending := struct {
+		Tasks []PendingTask
+	}{}
+	err = c.decode(raw, &pending)
+
+	return pending.Tasks, err
+}
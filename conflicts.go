@@ -0,0 +1,124 @@
+// Copyright 2013 Belogik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goes
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Finds the field in "failed to parse [age]", "failed to parse field [age] of
+// type [long]" or "mapper [age] of different type"
+var conflictFieldPattern = regexp.MustCompile(`(?:failed to parse(?: field)?|mapper) \[([^\]]+)\]`)
+
+// UnmarshalJSON decodes both the string and the object forms of a bulk error
+func (e *BulkError) UnmarshalJSON(data []byte) error {
+	var reason string
+	if err := json.Unmarshal(data, &reason); err == nil {
+		e.Reason = reason
+		return nil
+	}
+
+	var object struct {
+		Type   string
+		Reason string
+	}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return err
+	}
+
+	e.Type = object.Type
+	e.Reason = object.Reason
+	return nil
+}
+
+// String formats the error like elasticsearch 5.0 and later, type: reason
+func (e BulkError) String() string {
+	if e.Type == "" {
+		return e.Reason
+	}
+
+	return e.Type + ": " + e.Reason
+}
+
+// isMappingConflict checks if a bulk error was caused by a field which does
+// not match the mapping
+func (e BulkError) isMappingConflict() bool {
+	switch e.Type {
+	case "mapper_parsing_exception", "illegal_argument_exception":
+		return true
+	case "":
+		return strings.HasPrefix(e.Reason, "MapperParsingException") ||
+			strings.HasPrefix(e.Reason, "MergeMappingException")
+	}
+
+	return false
+}
+
+// MappingConflicts aggregates the items of a _bulk Response rejected because a
+// field did not match the mapping, by index, type and field
+func (r *Response) MappingConflicts() []MappingConflict {
+	if len(r.Items) == 0 {
+		return nil
+	}
+
+	conflicts := []MappingConflict{}
+	positions := map[[3]string]int{}
+
+	for _, items := range r.Items {
+		for _, item := range items {
+			if !item.Error.isMappingConflict() {
+				continue
+			}
+
+			match := conflictFieldPattern.FindStringSubmatch(item.Error.Reason)
+			if match == nil {
+				continue
+			}
+
+			key := [3]string{item.Index, item.Type, match[1]}
+			if i, ok := positions[key]; ok {
+				conflicts[i].Count++
+				continue
+			}
+
+			positions[key] = len(conflicts)
+			conflicts = append(conflicts, MappingConflict{
+				Index:  item.Index,
+				Type:   item.Type,
+				Field:  match[1],
+				Count:  1,
+				Reason: item.Error.Reason,
+			})
+		}
+	}
+
+	sort.SliceStable(conflicts, func(i, j int) bool {
+		a, b := conflicts[i], conflicts[j]
+		if a.Index != b.Index {
+			return a.Index < b.Index
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.Field < b.Field
+	})
+
+	return conflicts
+}
+
+// reportMappingConflicts passes the mapping conflicts of a _bulk Response to
+// the MappingConflictHook of the connection
+func (c *Connection) reportMappingConflicts(r Response) {
+	if c.MappingConflictHook == nil {
+		return
+	}
+
+	if conflicts := r.MappingConflicts(); len(conflicts) > 0 {
+		c.MappingConflictHook(conflicts)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2013 Belogik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goes
+
+import (
+	"net/url"
+	"sort"
+)
+
+// DescribeIndex fetches the mapping, the settings and the stats of an index and
+// merges them in a single IndexDescriptor
+func (c *Connection) DescribeIndex(name string) (IndexDescriptor, error) {
+	d := IndexDescriptor{Name: name}
+
+	r := Request{
+		Conn:      c,
+		IndexList: []string{name},
+		method:    "GET",
+		api:       "_mapping",
+	}
+
+	raw, err := r.RunRaw()
+	if err != nil {
+		return IndexDescriptor{}, err
+	}
+
+	d.Fields, err = mappingFields(raw)
+	if err != nil {
+		return IndexDescriptor{}, err
+	}
+
+	settings, err := c.GetIndexSettings([]string{name})
+	if err != nil {
+		return IndexDescriptor{}, err
+	}
+
+	// name may be an alias, the response is keyed by the real index name
+	for _, s := range settings {
+		d.Settings = s
+	}
+
+	stats, err := c.Stats([]string{name}, url.Values{})
+	if err != nil {
+		return IndexDescriptor{}, err
+	}
+
+	primaries := stats.All.Primaries
+	d.DocsCount = primaries["docs"].Count
+	d.DocsDeleted = primaries["docs"].Deleted
+	d.SizeInBytes = primaries["store"].SizeInBytes
+
+	return d, nil
+}
+
+// mappingFields lists the fields found in the body of a _mapping response
+// sorted by document type and path
+func mappingFields(raw []byte) ([]FieldDescriptor, error) {
+	indices, err := mappingTypes(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := []FieldDescriptor{}
+	for _, types := range indices {
+		for documentType, mapping := range types {
+			properties, _ := mapping["properties"].(map[string]interface{})
+			fields = append(fields, propertyFields(documentType, "", properties)...)
+		}
+	}
+
+	sort.Slice(fields, func(i, j int) bool {
+		if fields[i].DocumentType != fields[j].DocumentType {
+			return fields[i].DocumentType < fields[j].DocumentType
+		}
+		return fields[i].Path < fields[j].Path
+	})
+
+	return fields, nil
+}
+
+// propertyFields lists the fields of the properties of a mapping, the path of
+// a field is prefixed by the path of its parent object
+func propertyFields(documentType string, prefix string, properties map[string]interface{}) []FieldDescriptor {
+	fields := []FieldDescriptor{}
+
+	for name, p := range properties {
+		property, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		path := prefix + name
+
+		// object and nested fields
+		if sub, ok := property["properties"].(map[string]interface{}); ok {
+			fields = append(fields, propertyFields(documentType, path+".", sub)...)
+			continue
+		}
+
+		subFields, _ := property["fields"].(map[string]interface{})
+
+		// a multi_field (elasticsearch < 1.0) describes its main field as
+		// one of its sub fields
+		if property["type"] == "multi_field" {
+			main, _ := subFields[name].(map[string]interface{})
+			property = main
+			delete(subFields, name)
+		}
+
+		fields = append(fields, fieldDescriptor(documentType, path, property))
+
+		for subName, sub := range subFields {
+			if subProperty, ok := sub.(map[string]interface{}); ok {
+				fields = append(fields, fieldDescriptor(documentType, path+"."+subName, subProperty))
+			}
+		}
+	}
+
+	return fields
+}
+
+// fieldDescriptor builds the FieldDescriptor of a single property
+func fieldDescriptor(documentType string, path string, property map[string]interface{}) FieldDescriptor {
+	str := func(key string) string {
+		s, _ := property[key].(string)
+		return s
+	}
+
+	f := FieldDescriptor{
+		DocumentType:   documentType,
+		Path:           path,
+		Type:           str("type"),
+		Index:          str("index"),
+		Analyzer:       str("analyzer"),
+		IndexAnalyzer:  str("index_analyzer"),
+		SearchAnalyzer: str("search_analyzer"),
+	}
+
+	// fields without an explicit type in the mapping are objects
+	if f.Type == "" {
+		f.Type = "object"
+	}
+
+	return f
+}
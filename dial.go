@@ -0,0 +1,132 @@
+// Copyright 2013 Belogik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goes
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// WarmUp resolves the host of the connection and opens up to connections TCP
+// connections to it, so the first requests do not wait for them. They are kept
+// by the http.Client until they are idle for too long. The host is resolved
+// through Resolver only when it is used, without a Client.
+func (c *Connection) WarmUp(ctx context.Context, connections int) error {
+	if connections < 1 {
+		connections = 1
+	}
+
+	if c.Client == nil && c.Resolver != nil {
+		if _, err := c.Resolver.LookupHost(ctx, c.Host); err != nil {
+			return err
+		}
+	}
+
+	// sent at the same time, each one opens a connection
+	errs := make(chan error, connections)
+	for i := 0; i < connections; i++ {
+		go func() {
+			r := Request{
+				Conn:   c,
+				method: "HEAD",
+				ctx:    ctx,
+			}
+
+			_, err := r.RunRaw()
+			errs <- err
+		}()
+	}
+
+	var firstErr error
+	for i := 0; i < connections; i++ {
+		if err := <-errs; err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// LookupHost returns the cached addresses of host, which is resolved again
+// once they expired. The expired addresses are returned when it fails.
+func (r *CachingResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+
+	now := time.Now()
+
+	r.lock.Lock()
+	cached, ok := r.hosts[host]
+	r.lock.Unlock()
+
+	if ok && now.Before(cached.expires) {
+		return cached.addrs, nil
+	}
+
+	var resolver Resolver = net.DefaultResolver
+	if r.Resolver != nil {
+		resolver = r.Resolver
+	}
+
+	addrs, err := resolver.LookupHost(ctx, host)
+	if err == nil && len(addrs) == 0 {
+		err = fmt.Errorf("no address found for %s", host)
+	}
+	if err != nil {
+		if ok {
+			return cached.addrs, nil
+		}
+		return nil, err
+	}
+
+	ttl := r.TTL
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+
+	r.lock.Lock()
+	if r.hosts == nil {
+		r.hosts = map[string]resolvedHost{}
+	}
+	r.hosts[host] = resolvedHost{addrs: addrs, expires: now.Add(ttl)}
+	r.lock.Unlock()
+
+	return addrs, nil
+}
+
+// resolvingDialer returns a DialContext function of an http.Transport dialing
+// the addresses resolver finds for the host, until one of them answers
+func resolvingDialer(resolver Resolver) func(ctx context.Context, network string, address string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+
+	return func(ctx context.Context, network string, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+
+		addrs, err := resolver.LookupHost(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(addrs) == 0 {
+			return nil, fmt.Errorf("no address found for %s", host)
+		}
+
+		for _, addr := range addrs {
+			var conn net.Conn
+			conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(addr, port))
+			if err == nil {
+				return conn, nil
+			}
+		}
+
+		return nil, err
+	}
+}
@@ -6,7 +6,8 @@ package goes_test
 
 import (
 	"fmt"
-	"goes"
+	"github.com/jackdoe/goes"
+	"github.com/jackdoe/goes/qdsl"
 	"net/url"
 )
 
@@ -36,7 +37,7 @@ func ExampleConnection_CreateIndex() {
 		panic(err)
 	}
 
-	fmt.Printf("%s", resp)
+	fmt.Printf("%v", resp)
 }
 
 func ExampleConnection_DeleteIndex() {
@@ -47,7 +48,7 @@ func ExampleConnection_DeleteIndex() {
 		panic(err)
 	}
 
-	fmt.Printf("%s", resp)
+	fmt.Printf("%v", resp)
 }
 
 func ExampleConnection_RefreshIndex() {
@@ -58,7 +59,7 @@ func ExampleConnection_RefreshIndex() {
 		panic(err)
 	}
 
-	fmt.Printf("%s", resp)
+	fmt.Printf("%v", resp)
 }
 
 func ExampleConnection_Search() {
@@ -93,7 +94,52 @@ func ExampleConnection_Search() {
 		panic(err)
 	}
 
-	fmt.Printf("%s", searchResults)
+	fmt.Printf("%v", searchResults)
+}
+
+func ExampleConnection_Search_qdsl() {
+	conn := goes.NewConnection("localhost", "9200")
+
+	query := qdsl.Search{
+		Query: qdsl.BoolQuery{
+			Must:   []qdsl.Query{qdsl.MatchQuery{Field: "message", Query: "elasticsearch"}},
+			Filter: []qdsl.Query{qdsl.RangeQuery{Field: "somefield", Gt: "some date", Lt: "some date"}},
+		},
+		Size: 100,
+	}
+
+	searchResults, err := conn.Search(query, []string{"someindex"}, []string{""})
+
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("%v", searchResults)
+}
+
+func ExampleConnection_Search_aggregations() {
+	conn := goes.NewConnection("localhost", "9200")
+
+	query := qdsl.Search{
+		Size: qdsl.NO_HITS,
+		Aggs: map[string]qdsl.Aggregation{
+			"users": qdsl.TermsAgg{
+				Field: "user",
+				Aggs:  map[string]qdsl.Aggregation{"avg_price": qdsl.AvgAgg("price")},
+			},
+		},
+	}
+
+	searchResults, err := conn.Search(query, []string{"someindex"}, []string{""})
+
+	if err != nil {
+		panic(err)
+	}
+
+	for _, bucket := range searchResults.Aggregations["users"].Buckets() {
+		avg, _ := bucket.Aggregations["avg_price"].Value()
+		fmt.Printf("%v: %d documents, average price %f\n", bucket.Key, bucket.DocCount, avg)
+	}
 }
 
 func ExampleConnection_Index() {
@@ -117,7 +163,7 @@ func ExampleConnection_Index() {
 		panic(err)
 	}
 
-	fmt.Printf("%s", response)
+	fmt.Printf("%v", response)
 }
 
 func ExampleConnection_Delete() {
@@ -128,7 +174,7 @@ func ExampleConnection_Delete() {
 	d := goes.Document{
 		Index: "twitter",
 		Type:  "tweet",
-		Id: "1",
+		Id:    "1",
 		Fields: map[string]interface{}{
 			"user": "foo",
 		},
@@ -139,5 +185,5 @@ func ExampleConnection_Delete() {
 		panic(err)
 	}
 
-	fmt.Printf("%s", response)
+	fmt.Printf("%v", response)
 }
@@ -0,0 +1,3 @@
+module github.com/jackdoe/goes
+
+go 1.18
@@ -6,304 +6,3065 @@
 package goes
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 const (
 	BULK_COMMAND_INDEX  = "index"
 	BULK_COMMAND_DELETE = "delete"
+	BULK_COMMAND_UPDATE = "update"
+	BULK_COMMAND_CREATE = "create"
+)
+
+const (
+	REFRESH_TRUE  = "true"
+	REFRESH_FALSE = "false"
+
+	// Since elasticsearch 5.0, wait for a refresh instead of forcing one
+	REFRESH_WAIT_FOR = "wait_for"
+)
+
+// Results of a write, as set in Response.Result whatever the version of
+// elasticsearch
+const (
+	RESULT_CREATED   = "created"
+	RESULT_UPDATED   = "updated"
+	RESULT_DELETED   = "deleted"
+	RESULT_NOT_FOUND = "not_found"
+	RESULT_NOOP      = "noop"
+)
+
+// Relations of Hits.Total to the number of matching documents
+const (
+	TOTAL_EQ  = "eq"
+	TOTAL_GTE = "gte"
+)
+
+// Default index.max_result_window, the number of hits which can be paginated
+// with from and size
+const MAX_RESULT_WINDOW = 10000
+
+const (
+	VERSION_TYPE_INTERNAL     = "internal"
+	VERSION_TYPE_EXTERNAL     = "external"
+	VERSION_TYPE_EXTERNAL_GTE = "external_gte"
+	VERSION_TYPE_FORCE        = "force"
+)
+
+const (
+	SEARCH_TYPE_QUERY_THEN_FETCH     = "query_then_fetch"
+	SEARCH_TYPE_QUERY_AND_FETCH      = "query_and_fetch"
+	SEARCH_TYPE_DFS_QUERY_THEN_FETCH = "dfs_query_then_fetch"
+	SEARCH_TYPE_DFS_QUERY_AND_FETCH  = "dfs_query_and_fetch"
+	SEARCH_TYPE_COUNT                = "count"
+	SEARCH_TYPE_SCAN                 = "scan"
+)
+
+const (
+	// The error is returned to the caller as is
+	ERROR_FATAL ErrorClass = iota
+
+	// The request is sent again, up to Connection.MaxRetries times after
+	// Connection.RetryBackoff
+	ERROR_RETRYABLE
+
+	// The error is dropped and a zero Response is returned
+	ERROR_IGNORED
+)
+
+// DefaultErrorPolicy is used by connections without an ErrorPolicy, every
+// error is fatal
+var DefaultErrorPolicy = &StatusErrorPolicy{}
+
+// DefaultTransport is shared by the connections without a Client, it keeps
+// more idle TCP connections per host than http.DefaultTransport so they are
+// reused under load instead of being closed
+var DefaultTransport = newTransport()
+
+// DefaultClient sends the requests of the connections without a Client
+var DefaultClient = &http.Client{Transport: DefaultTransport}
+
+// resolvingClients holds the client sending the requests of the connections
+// with a Resolver and without a Client, one for each Resolver
+var resolvingClients sync.Map
+
+// Most bytes read from a response body which was not read until its end to
+// reuse its TCP connection, it is closed beyond
+const maxDrainBytes = 256 << 10
+
+// Errors matching the status of a SearchError with errors.Is
+var (
+	ErrNotFound        = errors.New("not found")
+	ErrConflict        = errors.New("conflict")
+	ErrTimeout         = errors.New("timeout")
+	ErrTooManyRequests = errors.New("too many requests")
 )
 
 func (err *SearchError) Error() string {
 	return fmt.Sprintf("[%d] %s", err.StatusCode, err.Msg)
 }
 
+// Is matches the sentinel error of the status, like ErrNotFound for a 404
+func (err *SearchError) Is(target error) bool {
+	switch err.StatusCode {
+	case 404:
+		return target == ErrNotFound
+	case 409:
+		return target == ErrConflict
+	case 408, 504:
+		return target == ErrTimeout
+	case 429:
+		return target == ErrTooManyRequests
+	}
+
+	return false
+}
+
+// Unwrap gives access to the ElasticError parsed from the response with
+// errors.As
+func (err *SearchError) Unwrap() error {
+	if err.elastic == nil {
+		return nil
+	}
+	return err.elastic
+}
+
+func (err *ElasticError) Error() string {
+	return fmt.Sprintf("[%d] %s", err.HTTPStatus, err.Msg)
+}
+
+// Unwrap gives access to the error as a SearchError with errors.As
+func (err *ElasticError) Unwrap() error {
+	return &SearchError{Msg: err.Msg, StatusCode: uint64(err.HTTPStatus)}
+}
+
+// Unwrap gives access to the ElasticError, and the SearchError behind it,
+// with errors.As
+func (err *VersionConflictError) Unwrap() error {
+	return err.ElasticError
+}
+
+// Unwrap gives access to the ElasticError, and the SearchError behind it,
+// with errors.As
+func (err *DocumentExistsError) Unwrap() error {
+	return err.ElasticError
+}
+
+// versionConflict turns a 409 ElasticError returned for the document d into a
+// VersionConflictError
+func versionConflict(err error, d Document) error {
+	var elasticErr *ElasticError
+	if !errors.As(err, &elasticErr) || elasticErr.HTTPStatus != 409 {
+		return err
+	}
+
+	return &VersionConflictError{
+		Index:        d.Index,
+		Type:         d.Type,
+		Id:           d.Id,
+		Version:      d.Version,
+		ElasticError: elasticErr,
+	}
+}
+
+// searchError returns the SearchError behind err, if any
+func searchError(err error) (*SearchError, bool) {
+	var searchErr *SearchError
+	ok := errors.As(err, &searchErr)
+
+	return searchErr, ok
+}
+
+// Unmarshal decodes the _source of the hit into v, usually a pointer to a
+// struct describing the documents
+func (h *Hit) Unmarshal(v interface{}) error {
+	return decodeSource(h.RawSource, h.Source, v)
+}
+
+// Unmarshal decodes the _source of a GET Response into v, usually a pointer
+// to a struct describing the documents
+func (r *Response) Unmarshal(v interface{}) error {
+	return decodeSource(r.RawSource, r.Source, v)
+}
+
+// decodeSource decodes a _source into v, from raw or from fields when the
+// response was not decoded by goes. v is left as is when there is none.
+func decodeSource(raw json.RawMessage, fields map[string]interface{}, v interface{}) error {
+	if len(raw) == 0 {
+		if fields == nil {
+			return nil
+		}
+
+		var err error
+		if raw, err = json.Marshal(fields); err != nil {
+			return err
+		}
+	}
+
+	return json.Unmarshal(raw, v)
+}
+
+// shared returns the state of the connection, allocated on first use
+func (c *Connection) shared() *connectionState {
+	if state, ok := c.state.Load().(*connectionState); ok {
+		return state
+	}
+
+	c.state.CompareAndSwap(nil, &connectionState{})
+	return c.state.Load().(*connectionState)
+}
+
 // NewConnection initiates a new Connection to an elasticsearch server
 //
 // This function is pretty useless for now but might be useful in a near future
 // if wee need more features like connection pooling or load balancing.
 func NewConnection(host string, port string) *Connection {
-	return &Connection{host, port}
+	return &Connection{Host: host, Port: port}
 }
 
-// CreateIndex creates a new index represented by a name and a mapping
-func (c *Connection) CreateIndex(name string, mapping interface{}) (Response, error) {
-	r := Request{
-		Conn:      c,
-		Query:     mapping,
-		IndexList: []string{name},
-		method:    "PUT",
+// errorPolicy returns the ErrorPolicy used to classify failed requests
+func (c *Connection) errorPolicy() ErrorPolicy {
+	if c.ErrorPolicy == nil {
+		return DefaultErrorPolicy
 	}
 
-	return r.Run()
+	return c.ErrorPolicy
 }
 
-// DeleteIndex deletes an index represented by a name
-func (c *Connection) DeleteIndex(name string) (Response, error) {
-	r := Request{
-		Conn:      c,
-		IndexList: []string{name},
-		method:    "DELETE",
+// httpClient returns the http.Client sending the requests
+func (c *Connection) httpClient() *http.Client {
+	if c.Client != nil {
+		return c.Client
 	}
 
-	return r.Run()
-}
+	if c.Resolver == nil {
+		return DefaultClient
+	}
 
-// RefreshIndex refreshes an index represented by a name
-func (c *Connection) RefreshIndex(name string) (Response, error) {
-	r := Request{
-		Conn:      c,
-		IndexList: []string{name},
-		method:    "POST",
-		api:       "_refresh",
+	if client, ok := resolvingClients.Load(c.Resolver); ok {
+		return client.(*http.Client)
 	}
 
-	return r.Run()
+	t := newTransport()
+	t.DialContext = resolvingDialer(c.Resolver)
+
+	// another connection may have stored one meanwhile
+	client, _ := resolvingClients.LoadOrStore(c.Resolver, &http.Client{Transport: t})
+	return client.(*http.Client)
 }
 
-// Stats fetches statistics (_stats) for the current elasticsearch server
-func (c *Connection) Stats(indexList []string, extraArgs url.Values) (Response, error) {
-	r := Request{
-		Conn:      c,
-		IndexList: indexList,
-		ExtraArgs: extraArgs,
-		method:    "GET",
-		api:       "_stats",
+// newTransport returns a copy of http.DefaultTransport keeping up to 100 idle
+// connections per host
+func newTransport() *http.Transport {
+	t := &http.Transport{Proxy: http.ProxyFromEnvironment}
+	if defaultTransport, ok := http.DefaultTransport.(*http.Transport); ok {
+		t = defaultTransport.Clone()
 	}
 
-	return r.Run()
+	t.MaxIdleConns = 100
+	t.MaxIdleConnsPerHost = 100
+	return t
 }
 
-// IndexStatus fetches the status (_status) for the indices defined in
-// indexList. Use _all in indexList to get stats for all indices
-func (c *Connection) IndexStatus(indexList []string) (Response, error) {
-	r := Request{
-		Conn:      c,
-		IndexList: indexList,
-		method:    "GET",
-		api:       "_status",
+// closeBody reads what is left of a response body before closing it, the
+// TCP connection is only reused once the body was read until its end
+func closeBody(body io.ReadCloser) {
+	io.CopyN(ioutil.Discard, body, maxDrainBytes)
+	body.Close()
+}
+
+// Classify returns the ErrorClass for a status code and an error message.
+// Statuses and exception names are looked up in this order: Ignored,
+// Retryable. Anything else is fatal.
+func (p *StatusErrorPolicy) Classify(statusCode uint64, msg string) ErrorClass {
+	if matchError(p.Ignored, p.IgnoredExceptions, statusCode, msg) {
+		return ERROR_IGNORED
 	}
 
-	return r.Run()
-}
+	if matchError(p.Retryable, p.RetryableExceptions, statusCode, msg) {
+		return ERROR_RETRYABLE
+	}
 
-// Bulk adds multiple documents in bulk mode to the index for a given type
-func (c *Connection) BulkSend(index string, documents []Document) (Response, error) {
-	// We do not generate a traditionnal JSON here (often a one liner)
-	// Elasticsearch expects one line of JSON per line (EOL = \n)
-	// plus an extra \n at the very end of the document
-	//
-	// More informations about the Bulk JSON format for Elasticsearch:
-	//
-	// - http://www.elasticsearch.org/guide/reference/api/bulk.html
-	//
-	// This is quite annoying for us as we can not use the simple JSON
-	// Marshaler available in Run().
-	//
-	// We have to generate this special JSON by ourselves which leads to
-	// the code below.
-	//
-	// I know it is unreadable I must find an elegant way to fix this.
+	return ERROR_FATAL
+}
 
-	bulkData := []byte{}
-	for _, doc := range documents {
-		header := map[string]interface{}{
-			doc.BulkCommand: map[string]interface{}{
-				"_index": doc.Index,
-				"_type":  doc.Type,
-				"_id":    doc.Id,
-			},
+// matchError checks if statusCode is in statuses or if msg starts with one of
+// the exception names
+func matchError(statuses []uint64, exceptions []string, statusCode uint64, msg string) bool {
+	for _, s := range statuses {
+		if s == statusCode {
+			return true
 		}
+	}
 
-		temp, err := json.Marshal(header)
-		if err != nil {
-			return Response{}, err
+	for _, e := range exceptions {
+		if strings.HasPrefix(msg, e) {
+			return true
 		}
+	}
 
-		temp = append(temp, '\n')
-		bulkData = append(bulkData, temp[:]...)
-
-		if len(doc.Fields) > 0 {
-			fields := map[string]interface{}{}
-			for fieldName, fieldValue := range doc.Fields {
-				fields[fieldName] = fieldValue
-			}
-
-			temp, err = json.Marshal(fields)
-			if err != nil {
-				return Response{}, err
-			}
+	return false
+}
 
-			temp = append(temp, '\n')
-			bulkData = append(bulkData, temp[:]...)
-		}
+// Info fetches the name and the version of the elasticsearch server
+func (c *Connection) Info() (Response, error) {
+	r := Request{
+		Conn:   c,
+		method: "GET",
 	}
 
+	return r.Run()
+}
+
+// CreateIndex creates a new index represented by a name and a mapping
+func (c *Connection) CreateIndex(name string, mapping interface{}) (Response, error) {
 	r := Request{
 		Conn:      c,
-		IndexList: []string{index},
-		method:    "POST",
-		api:       "_bulk",
-		bulkData:  bulkData,
+		Query:     mapping,
+		IndexList: []string{name},
+		method:    "PUT",
 	}
 
 	return r.Run()
 }
 
-// Search executes a search query against an index
-func (c *Connection) Search(query interface{}, indexList []string, typeList []string) (Response, error) {
+// DeleteIndex deletes an index represented by a name
+func (c *Connection) DeleteIndex(name string) (Response, error) {
 	r := Request{
 		Conn:      c,
-		Query:     query,
-		IndexList: indexList,
-		TypeList:  typeList,
-		method:    "POST",
-		api:       "_search",
+		IndexList: []string{name},
+		method:    "DELETE",
 	}
 
 	return r.Run()
 }
 
-// Get a typed document by its id
-func (c *Connection) Get(index string, documentType string, id string, extraArgs url.Values) (Response, error) {
+// IndexExists checks if an index or an alias exists
+func (c *Connection) IndexExists(name string) (bool, error) {
 	r := Request{
 		Conn:      c,
-		IndexList: []string{index},
-		method:    "GET",
-		api:       documentType + "/" + id,
-		ExtraArgs: extraArgs,
+		IndexList: []string{name},
+		method:    "HEAD",
 	}
 
-	return r.Run()
+	return r.exists()
 }
 
-// Index indexes a Document
-// The extraArgs is a list of url.Values that you can send to elasticsearch as
-// URL arguments, for example, to control routing, ttl, version, op_type, etc.
-func (c *Connection) Index(d Document, extraArgs url.Values) (Response, error) {
+// TypeExists checks if a type exists in an index
+func (c *Connection) TypeExists(index string, documentType string) (bool, error) {
 	r := Request{
 		Conn:      c,
-		Query:     d.Fields,
-		IndexList: []string{d.Index.(string)},
-		TypeList:  []string{d.Type},
-		ExtraArgs: extraArgs,
-		method:    "POST",
+		IndexList: []string{index},
+		TypeList:  []string{documentType},
+		method:    "HEAD",
 	}
 
-	if d.Id != nil {
-		r.method = "PUT"
-		r.id = d.Id.(string)
+	// the types exists API moved under _mapping in elasticsearch 5.0
+	if ok, _ := c.Supports(FEATURE_TYPES_EXISTS_API); ok {
+		r.TypeList = nil
+		r.api = "_mapping/" + documentType
 	}
 
-	return r.Run()
+	return r.exists()
 }
 
-// Delete deletes a Document d
-// The extraArgs is a list of url.Values that you can send to elasticsearch as
-// URL arguments, for example, to control routing.
-func (c *Connection) Delete(d Document, extraArgs url.Values) (Response, error) {
+// OpenIndex opens a closed index so that it can be searched and written again
+func (c *Connection) OpenIndex(name string) (Response, error) {
 	r := Request{
 		Conn:      c,
-		IndexList: []string{d.Index.(string)},
-		TypeList:  []string{d.Type},
-		ExtraArgs: extraArgs,
-		method:    "DELETE",
-		id:        d.Id.(string),
+		IndexList: []string{name},
+		method:    "POST",
+		api:       "_open",
 	}
 
 	return r.Run()
 }
 
-// Run executes an elasticsearch Request. It converts data to Json, sends the
-// request and return the Response obtained
-func (req *Request) Run() (Response, error) {
-	postData := []byte{}
-
-	// XXX : refactor this
-	if req.api == "_bulk" {
-		postData = req.bulkData
-	} else {
-		if raw, ok := req.Query.(string); ok {
-			postData = []byte(raw)
-		} else {
-			b, err := json.Marshal(req.Query)
-			if err != nil {
-				return Response{}, err
-			}
-			postData = b
-		}
+// CloseIndex closes an index, its data stays on disk but it can not be
+// searched nor written until it is opened again
+func (c *Connection) CloseIndex(name string) (Response, error) {
+	r := Request{
+		Conn:      c,
+		IndexList: []string{name},
+		method:    "POST",
+		api:       "_close",
 	}
 
-	reader := bytes.NewReader(postData)
+	return r.Run()
+}
 
-	client := http.DefaultClient
+// TruncateIndex deletes all the documents of an index but keeps its mapping
+// and its settings. Depending on the version of elasticsearch, the documents
+// are deleted by query or the index is deleted and created again, the latter
+// is not atomic.
+func (c *Connection) TruncateIndex(name string) (Response, error) {
+	matchAll := map[string]interface{}{
+		"query": map[string]interface{}{
+			"match_all": map[string]interface{}{},
+		},
+	}
 
-	newReq, err := http.NewRequest(req.method, req.Url(), reader)
+	ok, err := c.Supports(FEATURE_DELETE_QUERY_API)
 	if err != nil {
 		return Response{}, err
 	}
 
-	if req.method == "POST" || req.method == "PUT" {
-		newReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if ok {
+		r := Request{
+			Conn:      c,
+			Query:     matchAll,
+			IndexList: []string{name},
+			method:    "DELETE",
+			api:       "_query",
+		}
+
+		return r.Run()
 	}
 
-	resp, err := client.Do(newReq)
-	if err != nil {
-		return Response{}, err
+	if ok, _ := c.Supports(FEATURE_DELETE_BY_QUERY); ok {
+		r := Request{
+			Conn:      c,
+			Query:     matchAll,
+			IndexList: []string{name},
+			ExtraArgs: url.Values{"conflicts": {"proceed"}},
+			method:    "POST",
+			api:       "_delete_by_query",
+		}
+
+		return r.Run()
 	}
 
-	defer resp.Body.Close()
+	return c.recreateIndex(name)
+}
 
-	body, err := ioutil.ReadAll(resp.Body)
+// recreateIndex deletes an index and creates it again with the same settings,
+// mappings and aliases
+func (c *Connection) recreateIndex(name string) (Response, error) {
+	realName, definition, err := c.indexDefinition(name)
 	if err != nil {
 		return Response{}, err
 	}
 
-	if resp.StatusCode > 201 && resp.StatusCode < 400 {
-		return Response{}, errors.New(string(body))
+	if _, err := c.DeleteIndex(realName); err != nil {
+		return Response{}, err
 	}
 
-	esResp := new(Response)
-	err = json.Unmarshal(body, &esResp)
+	return c.CreateIndex(realName, definition)
+}
+
+// indexDefinition fetches the settings, mappings and aliases of an index, in
+// the format expected by CreateIndex. The name of the index is returned as
+// well, name may be an alias.
+func (c *Connection) indexDefinition(name string) (string, map[string]interface{}, error) {
+	r := Request{
+		Conn:      c,
+		IndexList: []string{name},
+		method:    "GET",
+	}
+
+	raw, err := r.RunRaw()
 	if err != nil {
-		return Response{}, err
+		return "", nil, err
 	}
 
-	if esResp.Error != "" {
-		return Response{}, &SearchError{esResp.Error, esResp.Status}
+	indices := map[string]map[string]interface{}{}
+	if err := json.Unmarshal(raw, &indices); err != nil {
+		return "", nil, err
 	}
 
-	return *esResp, nil
-}
+	if len(indices) != 1 {
+		return "", nil, fmt.Errorf("%s matches %d indices", name, len(indices))
+	}
 
-// Url builds a Request for a URL
-func (r *Request) Url() string {
-	path := "/" + strings.Join(r.IndexList, ",")
+	for realName, index := range indices {
+		// settings set by elasticsearch when the index is created
+		settings, _ := index["settings"].(map[string]interface{})
+		if s, ok := settings["index"].(map[string]interface{}); ok {
+			for _, key := range []string{"uuid", "creation_date", "provided_name", "version"} {
+				delete(s, key)
+			}
+		}
 
-	if len(r.TypeList) > 0 {
-		path += "/" + strings.Join(r.TypeList, ",")
-	}
+		definition := map[string]interface{}{
+			"settings": settings,
+			"mappings": index["mappings"],
+			"aliases":  index["aliases"],
+		}
 
-	// XXX : for indexing documents using the normal (non bulk) API
-	if len(r.api) == 0 && len(r.id) > 0 {
-		path += "/" + r.id
+		return realName, definition, nil
 	}
 
-	path += "/" + r.api
+	return "", nil, nil
+}
 
-	u := url.URL{
-		Scheme:   "http",
-		Host:     fmt.Sprintf("%s:%s", r.Conn.Host, r.Conn.Port),
-		Path:     path,
-		RawQuery: r.ExtraArgs.Encode(),
+// CloneIndex creates the index dst with the settings, the mappings and the
+// documents of the index src. The _clone API is used when available, src is
+// then made read only during the operation. Otherwise the documents are copied
+// by the client (scroll and bulk), which is much slower.
+func (c *Connection) CloneIndex(src string, dst string) (Response, error) {
+	ok, err := c.Supports(FEATURE_CLONE_API)
+	if err != nil {
+		return Response{}, err
+	}
+
+	if !ok {
+		return c.copyIndex(src, dst)
+	}
+
+	if _, err := c.setWriteBlock(src, true); err != nil {
+		return Response{}, err
+	}
+
+	r := Request{
+		Conn: c,
+		// the clone inherits the block of src
+		Query: map[string]interface{}{
+			"settings": map[string]interface{}{
+				"index.blocks.write": nil,
+			},
+		},
+		IndexList: []string{src},
+		method:    "POST",
+		api:       "_clone/" + dst,
+	}
+
+	resp, err := r.Run()
+
+	if _, blockErr := c.setWriteBlock(src, false); err == nil && blockErr != nil {
+		return Response{}, blockErr
+	}
+
+	return resp, err
+}
+
+// setWriteBlock makes an index read only or writable again
+func (c *Connection) setWriteBlock(name string, block bool) (Response, error) {
+	var value interface{}
+	if block {
+		value = true
+	}
+
+	return c.UpdateIndexSettings(name, map[string]interface{}{"index.blocks.write": value})
+}
+
+// UpdateIndexSettings changes the dynamic settings of an index, for example
+// {"index.refresh_interval": "-1", "index.number_of_replicas": 0} during a
+// bulk load. A nil value resets a setting to its default.
+func (c *Connection) UpdateIndexSettings(name string, settings map[string]interface{}) (Response, error) {
+	r := Request{
+		Conn:      c,
+		Query:     settings,
+		IndexList: []string{name},
+		method:    "PUT",
+		api:       "_settings",
+	}
+
+	return r.Run()
+}
+
+// GetIndexSettings fetches the flat settings (index.number_of_shards ...) of
+// the indices of indexList, every index when empty, by index name
+func (c *Connection) GetIndexSettings(indexList []string) (map[string]map[string]interface{}, error) {
+	r := Request{
+		Conn:      c,
+		IndexList: indexList,
+		ExtraArgs: url.Values{"flat_settings": {"true"}},
+		method:    "GET",
+		api:       "_settings",
+	}
+
+	raw, err := r.RunRaw()
+	if err != nil {
+		return nil, err
+	}
+
+	indices := map[string]struct {
+		Settings map[string]interface{}
+	}{}
+
+	if err := c.decode(raw, &indices); err != nil {
+		return nil, err
+	}
+
+	settings := make(map[string]map[string]interface{}, len(indices))
+	for name, index := range indices {
+		settings[name] = index.Settings
+	}
+
+	return settings, nil
+}
+
+// copyIndex creates the index dst with the settings and mappings of src and
+// copies every document of src into it
+func (c *Connection) copyIndex(src string, dst string) (Response, error) {
+	_, definition, err := c.indexDefinition(src)
+	if err != nil {
+		return Response{}, err
+	}
+
+	// the aliases would point to both indices
+	delete(definition, "aliases")
+
+	resp, err := c.CreateIndex(dst, definition)
+	if err != nil {
+		return Response{}, err
+	}
+
+	return resp, c.copyDocuments(src, dst, BULK_COMMAND_INDEX)
+}
+
+// copyDocuments copies every document of src into dst with the bulk command
+func (c *Connection) copyDocuments(src string, dst string, command string) error {
+	query := map[string]interface{}{
+		"query": map[string]interface{}{
+			"match_all": map[string]interface{}{},
+		},
+	}
+
+	return c.ScrollAll(query, []string{src}, []string{}, func(hits []Hit) error {
+		docs := make([]Document, 0, len(hits))
+		for _, hit := range hits {
+			docs = append(docs, Document{
+				Index:       dst,
+				Type:        hit.Type,
+				Id:          hit.Id,
+				BulkCommand: command,
+				Fields:      hit.Source,
+			})
+		}
+
+		resp, err := c.BulkSend(dst, docs)
+		if err != nil {
+			return err
+		}
+
+		failed := []BulkItem{}
+		for _, item := range resp.Failed() {
+			// the documents created meanwhile by a Standby are newer
+			if command == BULK_COMMAND_CREATE && item.Status == 409 {
+				continue
+			}
+			failed = append(failed, item)
+		}
+
+		if len(failed) > 0 {
+			return fmt.Errorf("%d documents could not be copied to %s, %s: %s", len(failed), dst, failed[0].Id, failed[0].Error.String())
+		}
+
+		return nil
+	})
+}
+
+// RefreshIndex refreshes an index represented by a name
+func (c *Connection) RefreshIndex(name string) (Response, error) {
+	return c.Refresh([]string{name})
+}
+
+// Refresh refreshes the indices in indexList, all of them when indexList is
+// empty, to make the recent writes searchable
+func (c *Connection) Refresh(indexList []string) (Response, error) {
+	r := Request{
+		Conn:      c,
+		IndexList: indexList,
+		method:    "POST",
+		api:       "_refresh",
+	}
+
+	return r.Run()
+}
+
+// Optimize merges the segments of the indices in indexList, all of them when
+// indexList is empty. The params (max_num_segments, only_expunge_deletes,
+// flush ...) are sent as URL arguments. The _forcemerge API is used from
+// elasticsearch 2.1.
+func (c *Connection) Optimize(indexList []string, params url.Values) (Response, error) {
+	r := Request{
+		Conn:      c,
+		IndexList: indexList,
+		ExtraArgs: params,
+		method:    "POST",
+		api:       "_optimize",
+	}
+
+	if ok, _ := c.Supports(FEATURE_FORCEMERGE_API); ok {
+		r.api = "_forcemerge"
+	}
+
+	return r.Run()
+}
+
+// Flush flushes the indices in indexList, all of them when indexList is
+// empty. Set wait_if_ongoing in extraArgs to wait for a flush already running
+// instead of failing.
+func (c *Connection) Flush(indexList []string, extraArgs url.Values) (Response, error) {
+	r := Request{
+		Conn:      c,
+		IndexList: indexList,
+		ExtraArgs: extraArgs,
+		method:    "POST",
+		api:       "_flush",
+	}
+
+	return r.Run()
+}
+
+// ClearCache clears the caches of the indices in indexList, all of them when
+// indexList is empty. Every cache is cleared unless params selects some of
+// them, e.g. filter (query from elasticsearch 2.0), fielddata or request.
+func (c *Connection) ClearCache(indexList []string, params url.Values) (Response, error) {
+	r := Request{
+		Conn:      c,
+		IndexList: indexList,
+		ExtraArgs: params,
+		method:    "POST",
+		api:       "_cache/clear",
+	}
+
+	return r.Run()
+}
+
+// Stats fetches statistics (_stats) for the current elasticsearch server
+func (c *Connection) Stats(indexList []string, extraArgs url.Values) (Response, error) {
+	r := Request{
+		Conn:      c,
+		IndexList: indexList,
+		ExtraArgs: extraArgs,
+		method:    "GET",
+		api:       "_stats",
+	}
+
+	return r.Run()
+}
+
+// IndexStatus fetches the status (_status) for the indices defined in
+// indexList. Use _all in indexList to get stats for all indices
+func (c *Connection) IndexStatus(indexList []string) (Response, error) {
+	if err := c.require(FEATURE_STATUS_API); err != nil {
+		return Response{}, err
+	}
+
+	r := Request{
+		Conn:      c,
+		IndexList: indexList,
+		method:    "GET",
+		api:       "_status",
+	}
+
+	return r.Run()
+}
+
+// Segments fetches the Lucene segments of every shard copy of the indices in
+// indexList, all of them when indexList is empty, by index. The shards are
+// sorted by number, primaries first.
+func (c *Connection) Segments(indexList []string) (map[string][]ShardSegments, error) {
+	r := Request{
+		Conn:      c,
+		IndexList: indexList,
+		method:    "GET",
+		api:       "_segments",
+	}
+
+	raw, err := r.RunRaw()
+	if err != nil || raw == nil {
+		return nil, err
+	}
+
+	resp := struct {
+		Indices map[string]struct {
+			Shards map[string][]ShardSegments
+		}
+		Shards Shard `json:"_shards"`
+	}{}
+	if err := c.decode(raw, &resp); err != nil {
+		return nil, err
+	}
+
+	segments := make(map[string][]ShardSegments, len(resp.Indices))
+	for index, v := range resp.Indices {
+		shards := []ShardSegments{}
+		for number, copies := range v.Shards {
+			for _, shard := range copies {
+				shard.Shard, _ = strconv.Atoi(number)
+				shards = append(shards, shard)
+			}
+		}
+
+		sort.Slice(shards, func(i, j int) bool {
+			if shards[i].Shard != shards[j].Shard {
+				return shards[i].Shard < shards[j].Shard
+			}
+			return shards[i].Routing.Primary && !shards[j].Routing.Primary
+		})
+
+		segments[index] = shards
+	}
+
+	return segments, nil
+}
+
+// Bulk adds multiple documents in bulk mode to the index for a given type
+// With a Connection.IdGenerator, the ids generated for the documents without
+// one are set in documents. With Connection.BulkItemRetries, the items of the
+// Response are the ones of the last attempt for each document. With
+// Connection.MaxBulkBytes, documents may be sent in several requests whose
+// items are merged.
+func (c *Connection) BulkSend(index string, documents []Document) (Response, error) {
+	// ids are set on the documents so that the caller knows them
+	for i := range documents {
+		switch documents[i].BulkCommand {
+		case BULK_COMMAND_INDEX, BULK_COMMAND_CREATE:
+			c.assignId(&documents[i])
+		}
+	}
+
+	for _, doc := range documents {
+		if doc.TTL != "" {
+			if err := c.require(FEATURE_TTL); err != nil {
+				return Response{}, err
+			}
+			break
+		}
+	}
+
+	for _, doc := range documents {
+		if doc.Parent != "" {
+			if err := c.require(FEATURE_PARENT); err != nil {
+				return Response{}, err
+			}
+			break
+		}
+	}
+
+	if c.ValidateDocuments {
+		for _, doc := range documents {
+			if len(doc.Fields) == 0 {
+				continue
+			}
+
+			docIndex, ok := doc.Index.(string)
+			if !ok {
+				docIndex = index
+			}
+
+			if err := c.validateDocument(docIndex, doc); err != nil {
+				return Response{}, err
+			}
+		}
+	}
+
+	if c.MaxBulkBytes > 0 {
+		chunks, err := splitBulk(documents, c.MaxBulkBytes, c.bulkMetadataPrefix())
+		if err != nil {
+			return Response{}, err
+		}
+
+		if len(chunks) > 1 {
+			return c.bulkSendChunks(index, chunks)
+		}
+	}
+
+	return c.bulkSend(index, documents)
+}
+
+// bulkSendChunks sends each chunk of documents in its own _bulk request and
+// merges the responses. The chunks sent before an error are not rolled back.
+func (c *Connection) bulkSendChunks(index string, chunks [][]Document) (Response, error) {
+	merged := Response{}
+
+	for _, chunk := range chunks {
+		response, err := c.bulkSend(index, chunk)
+		if err != nil {
+			return merged, err
+		}
+
+		merged.Took += response.Took
+		merged.Errors = merged.Errors || response.Errors
+		merged.Items = append(merged.Items, response.Items...)
+	}
+
+	return merged, nil
+}
+
+// splitBulk splits documents in chunks whose _bulk body is at most maxBytes,
+// a document bigger than maxBytes is alone in its chunk
+func splitBulk(documents []Document, maxBytes int, prefix string) ([][]Document, error) {
+	chunks := [][]Document{}
+	start, size := 0, 0
+
+	for i := range documents {
+		counter := &byteCounter{}
+		if err := writeBulk(counter, documents[i:i+1], prefix); err != nil {
+			return nil, err
+		}
+
+		if i > start && size+counter.n > maxBytes {
+			chunks = append(chunks, documents[start:i])
+			start, size = i, 0
+		}
+		size += counter.n
+	}
+
+	return append(chunks, documents[start:]), nil
+}
+
+// bulkSend sends documents in a single _bulk request
+func (c *Connection) bulkSend(index string, documents []Document) (Response, error) {
+	if err := c.audit("", documents...); err != nil {
+		return Response{}, err
+	}
+
+	// the body is encoded while it is sent, see bulkReader
+	r := Request{
+		Conn:          c,
+		IndexList:     []string{index},
+		ExtraArgs:     c.refreshArgs(url.Values{}),
+		method:        "POST",
+		api:           "_bulk",
+		bulkDocuments: documents,
+	}
+
+	response, err := r.Run()
+	if err != nil {
+		return response, err
+	}
+
+	c.reportMappingConflicts(response)
+
+	if c.BulkItemRetries > 0 || c.BulkItemFailed != nil {
+		return c.retryBulkItems(r, documents, response)
+	}
+
+	return response, nil
+}
+
+// BulkSendRaw sends a body already in the format of the _bulk API to index,
+// for example read from a file. The request is only retried if body is an
+// io.Seeker. When AuditHook is set, body is read and parsed first to give it
+// the writes.
+func (c *Connection) BulkSendRaw(index string, body io.Reader) (Response, error) {
+	if c.AuditHook != nil {
+		raw, err := ioutil.ReadAll(body)
+		if err != nil {
+			return Response{}, err
+		}
+
+		documents, err := bulkDocuments(index, raw)
+		if err != nil {
+			return Response{}, err
+		}
+
+		if err := c.audit("", documents...); err != nil {
+			return Response{}, err
+		}
+
+		body = bytes.NewReader(raw)
+	}
+
+	r := Request{
+		Conn:      c,
+		IndexList: []string{index},
+		ExtraArgs: c.refreshArgs(url.Values{}),
+		method:    "POST",
+		api:       "_bulk",
+		bulkBody:  body,
+	}
+
+	response, err := r.Run()
+	if err != nil {
+		return response, err
+	}
+
+	c.reportMappingConflicts(response)
+
+	return response, nil
+}
+
+// bulkMetadataPrefix returns the prefix of the routing, parent, ttl and
+// version metadata of the _bulk lines, elasticsearch 7.0 dropped the
+// underscore
+func (c *Connection) bulkMetadataPrefix() string {
+	if ok, _ := c.Supports(FEATURE_BULK_PLAIN_METADATA); ok {
+		return ""
+	}
+	return "_"
+}
+
+// writeBulk writes documents to w in the format of the _bulk API, a line of
+// metadata followed by a line of fields for each document. prefix is the one
+// of bulkMetadataPrefix.
+func writeBulk(w io.Writer, documents []Document, prefix string) error {
+	// We do not generate a traditionnal JSON here (often a one liner)
+	// Elasticsearch expects one line of JSON per line (EOL = \n)
+	// plus an extra \n at the very end of the document
+	//
+	// More informations about the Bulk JSON format for Elasticsearch:
+	//
+	// - http://www.elasticsearch.org/guide/reference/api/bulk.html
+	//
+	// This is quite annoying for us as we can not use the simple JSON
+	// Marshaler available in Run(), json.Encoder ends each value with
+	// the \n expected by elasticsearch.
+	encoder := json.NewEncoder(w)
+
+	for _, doc := range documents {
+		metadata := map[string]interface{}{
+			"_index": doc.Index,
+			"_type":  doc.Type,
+			"_id":    doc.Id,
+		}
+
+		if doc.Routing != "" {
+			metadata[prefix+"routing"] = doc.Routing
+		}
+
+		if doc.Parent != "" {
+			metadata[prefix+"parent"] = doc.Parent
+		}
+
+		if doc.TTL != "" {
+			metadata[prefix+"ttl"] = doc.TTL
+		}
+
+		if doc.Version != 0 {
+			metadata[prefix+"version"] = doc.Version
+		}
+
+		if doc.VersionType != "" {
+			metadata[prefix+"version_type"] = doc.VersionType
+		}
+
+		if doc.RetryOnConflict != 0 {
+			metadata[prefix+"retry_on_conflict"] = doc.RetryOnConflict
+		}
+
+		if doc.Pipeline != "" {
+			metadata["pipeline"] = doc.Pipeline
+		}
+
+		header := map[string]interface{}{
+			doc.BulkCommand: metadata,
+		}
+
+		if err := encoder.Encode(header); err != nil {
+			return err
+		}
+
+		var payload interface{}
+
+		if doc.BulkCommand == BULK_COMMAND_UPDATE {
+			update := map[string]interface{}{}
+			if len(doc.Fields) > 0 {
+				update["doc"] = doc.Fields
+			}
+			if doc.Script != nil {
+				update["script"] = doc.Script
+			}
+			payload = update
+		} else if len(doc.Fields) > 0 {
+			payload = doc.Fields
+		}
+
+		if payload != nil {
+			if err := encoder.Encode(payload); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// bulkReader returns the body of a _bulk request, documents are encoded as it
+// is read so that big batches are not held in memory twice
+func bulkReader(documents []Document, prefix string) io.ReadCloser {
+	reader, writer := io.Pipe()
+
+	go func() {
+		buffer := bufio.NewWriter(writer)
+
+		err := writeBulk(buffer, documents, prefix)
+		if err == nil {
+			err = buffer.Flush()
+		}
+
+		// the reader gets the error, or io.EOF when err is nil
+		writer.CloseWithError(err)
+	}()
+
+	return reader
+}
+
+// BulkResults pairs the items of a _bulk Response with the documents which
+// were sent, elasticsearch answers in the same order
+func (r *Response) BulkResults(documents []Document) ([]BulkResult, error) {
+	if len(r.Items) != len(documents) {
+		return nil, fmt.Errorf("%d items for %d documents", len(r.Items), len(documents))
+	}
+
+	results := make([]BulkResult, 0, len(documents))
+	for i, doc := range documents {
+		result := BulkResult{Document: doc}
+
+		// each item has a single key, the bulk command
+		for command, item := range r.Items[i] {
+			result.Command = command
+			result.Item = item
+		}
+
+		// elasticsearch 0.90 does not send the status of the items
+		result.Exists = result.Command == BULK_COMMAND_CREATE &&
+			(result.Item.Status == 409 || strings.HasPrefix(result.Item.Error.Reason, "DocumentAlreadyExistsException"))
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// Failed returns the items of a _bulk Response whose command failed, the other
+// commands of the request were executed
+func (r *Response) Failed() []BulkItem {
+	failed := []BulkItem{}
+
+	for position, items := range r.Items {
+		for command, item := range items {
+			// elasticsearch 0.90 only sends the error
+			if item.Status >= 300 || item.Error.Reason != "" {
+				failed = append(failed, BulkItem{Position: position, Command: command, Item: item})
+			}
+		}
+	}
+
+	return failed
+}
+
+// Partial checks if the hits of a search Response are incomplete, because the
+// search timed out or some shards failed
+func (r *Response) Partial() bool {
+	return r.TimedOut || r.Shards.Failed > 0
+}
+
+// Search executes a search query against an index
+func (c *Connection) Search(query interface{}, indexList []string, typeList []string) (Response, error) {
+	r := Request{
+		Conn:      c,
+		Query:     query,
+		IndexList: indexList,
+		TypeList:  typeList,
+		method:    "POST",
+		api:       "_search",
+	}
+
+	return r.Run()
+}
+
+// SearchWithRouting executes a search query against an index, only on the
+// shards the routing values point to
+func (c *Connection) SearchWithRouting(query interface{}, indexList []string, typeList []string, routing []string) (Response, error) {
+	r := Request{
+		Conn:      c,
+		Query:     query,
+		IndexList: indexList,
+		TypeList:  typeList,
+		ExtraArgs: url.Values{"routing": {strings.Join(routing, ",")}},
+		method:    "POST",
+		api:       "_search",
+	}
+
+	return r.Run()
+}
+
+// SearchWithType executes a search query against an index using searchType
+// (SEARCH_TYPE_SCAN, SEARCH_TYPE_COUNT ...).
+// A scan search needs the scroll URL argument in extraArgs, its Response has
+// no hits but only a ScrollId and the total number of hits.
+func (c *Connection) SearchWithType(query interface{}, indexList []string, typeList []string, searchType string, extraArgs url.Values) (Response, error) {
+	if searchType == SEARCH_TYPE_SCAN && extraArgs.Get("scroll") == "" {
+		return Response{}, errors.New("a scan search needs a scroll argument")
+	}
+
+	feature := map[string]string{
+		SEARCH_TYPE_SCAN:  FEATURE_SEARCH_TYPE_SCAN,
+		SEARCH_TYPE_COUNT: FEATURE_SEARCH_TYPE_COUNT,
+	}[searchType]
+
+	if feature != "" {
+		if err := c.require(feature); err != nil {
+			return Response{}, err
+		}
+	}
+
+	args := copyValues(extraArgs)
+	args.Set("search_type", searchType)
+
+	r := Request{
+		Conn:      c,
+		Query:     query,
+		IndexList: indexList,
+		TypeList:  typeList,
+		ExtraArgs: args,
+		method:    "POST",
+		api:       "_search",
+	}
+
+	return r.Run()
+}
+
+// Scroll fetches the next page of hits of a scroll search, scroll is how long
+// the search context is kept alive (1m, 30s ...). Each page has a new ScrollId.
+func (c *Connection) Scroll(scrollId string, scroll string) (Response, error) {
+	r := c.scrollRequest(scrollId, scroll)
+	return r.Run()
+}
+
+// scrollRequest returns the request fetching the next page of a scroll search
+func (c *Connection) scrollRequest(scrollId string, scroll string) Request {
+	r := Request{
+		Conn:      c,
+		Query:     map[string]interface{}{"scroll_id": scrollId, "scroll": scroll},
+		ExtraArgs: url.Values{"scroll": {scroll}},
+		method:    "POST",
+		api:       "_search/scroll",
+	}
+
+	// before 2.0 the body is the bare scroll id
+	if version, err := c.serverVersion(); err == nil && compareVersions(version, "2.0.0") < 0 {
+		r.Query = scrollId
+	}
+
+	return r
+}
+
+// ScrollAll runs a scroll search and calls f with each page of hits until
+// every matching document was seen or f returns an error. The hits are not
+// sorted, scan searches are used when available.
+func (c *Connection) ScrollAll(query interface{}, indexList []string, typeList []string, f func(hits []Hit) error) error {
+	r, scan := c.scrollSearch(query, indexList, typeList)
+
+	return c.scrollPages(scan, func(page int, scrollId string) (string, int, error) {
+		if page > 0 {
+			r = c.scrollRequest(scrollId, "1m")
+		}
+
+		resp, err := r.Run()
+		if err != nil {
+			return "", 0, err
+		}
+
+		if len(resp.Hits.Hits) > 0 {
+			if err := f(resp.Hits.Hits); err != nil {
+				return resp.ScrollId, 0, err
+			}
+		}
+
+		return resp.ScrollId, len(resp.Hits.Hits), nil
+	})
+}
+
+// ScrollStream runs a scroll search like ScrollAll but calls f with each hit
+// as it is decoded, a page is never held in memory. The requests are not sent
+// again on errors.
+func (c *Connection) ScrollStream(query interface{}, indexList []string, typeList []string, f func(hit Hit) error) error {
+	r, scan := c.scrollSearch(query, indexList, typeList)
+
+	return c.scrollPages(scan, func(page int, scrollId string) (string, int, error) {
+		if page > 0 {
+			r = c.scrollRequest(scrollId, "1m")
+		}
+
+		hits := 0
+		resp, err := r.stream(func(hit Hit) error {
+			hits++
+			return f(hit)
+		})
+
+		return resp.ScrollId, hits, err
+	})
+}
+
+// scrollSearch returns the request starting the scroll search of ScrollAll,
+// which is a scan search when scan is true
+func (c *Connection) scrollSearch(query interface{}, indexList []string, typeList []string) (Request, bool) {
+	args := url.Values{"scroll": {"1m"}, "size": {"500"}}
+
+	scan, _ := c.Supports(FEATURE_SEARCH_TYPE_SCAN)
+	if scan {
+		args.Set("search_type", SEARCH_TYPE_SCAN)
+	} else {
+		args.Set("sort", "_doc")
+	}
+
+	r := Request{
+		Conn:      c,
+		Query:     query,
+		IndexList: indexList,
+		TypeList:  typeList,
+		ExtraArgs: args,
+		method:    "POST",
+		api:       "_search",
+	}
+
+	return r, scan
+}
+
+// scrollPages fetches the pages of a scroll search until one has no hits, then
+// frees the search context. fetch gets the scroll id of the previous page and
+// returns the scroll id and the number of hits of the page.
+func (c *Connection) scrollPages(scan bool, fetch func(page int, scrollId string) (string, int, error)) error {
+	// the search context is freed instead of expiring after 1m
+	scrollId := ""
+	defer func() {
+		if scrollId != "" {
+			c.ClearScroll([]string{scrollId})
+		}
+	}()
+
+	for page := 0; ; page++ {
+		nextId, hits, err := fetch(page, scrollId)
+		if nextId != "" {
+			scrollId = nextId
+		}
+		if err != nil {
+			return err
+		}
+
+		// the first page of a scan search has no hits
+		if hits == 0 && !(scan && page == 0) {
+			return nil
+		}
+	}
+}
+
+// ScrollSliced runs a scroll search split in slices scrolled at the same time
+// and calls f with each page of hits until every matching document was seen or
+// f returns an error. f is called from every slice at the same time. The query
+// is decoded to add the slice to it.
+func (c *Connection) ScrollSliced(query interface{}, indexList []string, typeList []string, slices int, f func(hits []Hit) error) error {
+	if slices < 2 {
+		return c.ScrollAll(query, indexList, typeList, f)
+	}
+
+	if err := c.require(FEATURE_SLICED_SCROLL); err != nil {
+		return err
+	}
+
+	body, err := queryMap(query)
+	if err != nil {
+		return err
+	}
+
+	var lock sync.Mutex
+	var firstErr error
+	var running sync.WaitGroup
+
+	for i := 0; i < slices; i++ {
+		sliced := make(map[string]interface{}, len(body)+1)
+		for k, v := range body {
+			sliced[k] = v
+		}
+		sliced["slice"] = map[string]interface{}{"id": i, "max": slices}
+
+		r := Request{
+			Conn:      c,
+			Query:     sliced,
+			IndexList: indexList,
+			TypeList:  typeList,
+			ExtraArgs: url.Values{"scroll": {"1m"}, "size": {"500"}, "sort": {"_doc"}},
+			method:    "POST",
+			api:       "_search",
+		}
+
+		running.Add(1)
+		go func() {
+			defer running.Done()
+
+			err := c.scrollPages(false, func(page int, scrollId string) (string, int, error) {
+				if page > 0 {
+					r = c.scrollRequest(scrollId, "1m")
+				}
+
+				resp, err := r.Run()
+				if err != nil {
+					return "", 0, err
+				}
+
+				// the other slices stop once one failed
+				lock.Lock()
+				failed := firstErr != nil
+				lock.Unlock()
+				if failed {
+					return resp.ScrollId, 0, errSliceStopped
+				}
+
+				if len(resp.Hits.Hits) > 0 {
+					if err := f(resp.Hits.Hits); err != nil {
+						return resp.ScrollId, 0, err
+					}
+				}
+
+				return resp.ScrollId, len(resp.Hits.Hits), nil
+			})
+
+			lock.Lock()
+			if err != nil && err != errSliceStopped && firstErr == nil {
+				firstErr = err
+			}
+			lock.Unlock()
+		}()
+	}
+
+	running.Wait()
+	return firstErr
+}
+
+// errSliceStopped stops a slice of ScrollSliced after another one failed
+var errSliceStopped = errors.New("slice stopped")
+
+// queryMap decodes a query given to a search, nil is an empty query
+func queryMap(query interface{}) (map[string]interface{}, error) {
+	var raw []byte
+
+	switch q := query.(type) {
+	case nil:
+		return map[string]interface{}{}, nil
+	case string:
+		raw = []byte(q)
+	case json.RawMessage:
+		raw = q
+	case []byte:
+		raw = q
+	case io.Reader:
+		b, err := ioutil.ReadAll(q)
+		if err != nil {
+			return nil, err
+		}
+		raw = b
+	default:
+		b, err := json.Marshal(q)
+		if err != nil {
+			return nil, err
+		}
+		raw = b
+	}
+
+	m := map[string]interface{}{}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// ClearScroll frees the search contexts of scroll searches before they expire
+func (c *Connection) ClearScroll(scrollIds []string) (Response, error) {
+	r := Request{
+		Conn:   c,
+		Query:  map[string]interface{}{"scroll_id": scrollIds},
+		method: "DELETE",
+		api:    "_search/scroll",
+	}
+
+	// before 2.0 the body is the bare comma separated scroll ids
+	if version, err := c.serverVersion(); err == nil && compareVersions(version, "2.0.0") < 0 {
+		r.Query = strings.Join(scrollIds, ",")
+	}
+
+	return r.Run()
+}
+
+// SearchAs executes a search query against an index like Connection.Search and
+// decodes the _source of every hit into a T. The _index, _type, _id and
+// _score of the hits are decoded as well, T can have fields tagged
+// json:"_id" or json:"_score" to get them.
+func SearchAs[T any](c *Connection, query interface{}, indexList []string, typeList []string) ([]T, SearchMeta, error) {
+	resp, err := c.Search(query, indexList, typeList)
+	if err != nil {
+		return nil, SearchMeta{}, err
+	}
+
+	return decodeHits[T](resp)
+}
+
+// decodeHits decodes the hits of a search Response into T values
+func decodeHits[T any](resp Response) ([]T, SearchMeta, error) {
+	docs := make([]T, 0, len(resp.Hits.Hits))
+
+	for _, hit := range resp.Hits.Hits {
+		metadata, err := json.Marshal(map[string]interface{}{
+			"_index": hit.Index,
+			"_type":  hit.Type,
+			"_id":    hit.Id,
+			"_score": hit.Score,
+		})
+		if err != nil {
+			return nil, SearchMeta{}, err
+		}
+
+		// the fields of the _source take precedence over the metadata
+		var doc T
+		if err := json.Unmarshal(metadata, &doc); err != nil {
+			return nil, SearchMeta{}, err
+		}
+		if err := hit.Unmarshal(&doc); err != nil {
+			return nil, SearchMeta{}, err
+		}
+
+		docs = append(docs, doc)
+	}
+
+	meta := SearchMeta{
+		Total:         resp.Hits.Total,
+		TotalRelation: resp.Hits.TotalRelation,
+		Took:          resp.Took,
+		TimedOut:      resp.TimedOut,
+		Shards:        resp.Shards,
+		ScrollId:      resp.ScrollId,
+	}
+
+	// max_score is null when sorting on a field
+	meta.MaxScore, _ = resp.Hits.MaxScore.(float64)
+
+	return docs, meta, nil
+}
+
+// Paginate fetches page (starting at 1) of the hits of a search query with
+// perPage hits per page. Elasticsearch refuses to go past MAX_RESULT_WINDOW
+// hits, the pages after it are not counted in Page.Pages and can not be
+// fetched, a scroll has to be used instead. The query is anything Search
+// accepts, the raw ones included.
+func (c *Connection) Paginate(query interface{}, indexList []string, typeList []string, page int, perPage int) (Page, error) {
+	if page < 1 || perPage < 1 {
+		return Page{}, fmt.Errorf("invalid page %d of %d hits", page, perPage)
+	}
+
+	if page*perPage > MAX_RESULT_WINDOW {
+		return Page{}, fmt.Errorf("page %d of %d hits is past the result window of %d hits", page, perPage, MAX_RESULT_WINDOW)
+	}
+
+	// a copy, the query of the caller is left untouched
+	paginated, err := queryMap(query)
+	if err != nil {
+		return Page{}, err
+	}
+	paginated["from"] = (page - 1) * perPage
+	paginated["size"] = perPage
+
+	resp, err := c.Search(paginated, indexList, typeList)
+	if err != nil {
+		return Page{}, err
+	}
+
+	pages := int((resp.Hits.Total + uint64(perPage) - 1) / uint64(perPage))
+	if pages > MAX_RESULT_WINDOW/perPage {
+		pages = MAX_RESULT_WINDOW / perPage
+	}
+
+	return Page{
+		Hits:          resp.Hits.Hits,
+		Total:         resp.Hits.Total,
+		TotalRelation: resp.Hits.TotalRelation,
+		Page:          page,
+		PerPage:       perPage,
+		Pages:         pages,
+		HasNext:       page < pages,
+		HasPrevious:   page > 1,
+		Took:          resp.Took,
+		TimedOut:      resp.TimedOut,
+		Shards:        resp.Shards,
+	}, nil
+}
+
+// SearchContext executes a search query against an index and aborts it when
+// ctx is done. If CancelTasks is set on the Connection, the search tasks still
+// running on the server are cancelled as well.
+func (c *Connection) SearchContext(ctx context.Context, query interface{}, indexList []string, typeList []string) (Response, error) {
+	r := Request{
+		Conn:      c,
+		Query:     query,
+		IndexList: indexList,
+		TypeList:  typeList,
+		method:    "POST",
+		api:       "_search",
+		ctx:       ctx,
+	}
+
+	if c.CancelTasks {
+		// the tasks are found by their X-Opaque-Id header
+		if err := c.requireContext(ctx, FEATURE_OPAQUE_ID); err != nil {
+			return Response{}, err
+		}
+		r.opaqueId = newOpaqueId()
+	}
+
+	resp, err := r.Run()
+	if err != nil && ctx.Err() != nil && r.opaqueId != "" {
+		// best effort, the caller is not interested in the outcome
+		go c.cancelTasks(detachedContext{ctx}, r.opaqueId)
+	}
+
+	return resp, err
+}
+
+// ListTasks fetches the tasks running on the cluster by task id (node:id).
+// The filters (actions, nodes, parent_task_id, detailed ...) are sent as URL
+// arguments, e.g. {"actions": {"*reindex"}, "detailed": {"true"}}.
+func (c *Connection) ListTasks(filters url.Values) (map[string]Task, error) {
+	return c.listTasks(context.Background(), filters)
+}
+
+// listTasks is ListTasks, the requests being sent with ctx
+func (c *Connection) listTasks(ctx context.Context, filters url.Values) (map[string]Task, error) {
+	if err := c.requireContext(ctx, FEATURE_TASKS_API); err != nil {
+		return nil, err
+	}
+
+	r := Request{
+		Conn:      c,
+		ExtraArgs: filters,
+		method:    "GET",
+		api:       "_tasks",
+		ctx:       ctx,
+	}
+
+	resp, err := r.Run()
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := map[string]Task{}
+	for _, node := range resp.Nodes {
+		for taskId, task := range node.Tasks {
+			tasks[taskId] = task
+		}
+	}
+
+	return tasks, nil
+}
+
+// CancelTask cancels a task by its id (node:id), only the Cancellable tasks
+// can be cancelled
+func (c *Connection) CancelTask(taskId string) (Response, error) {
+	return c.cancelTask(context.Background(), taskId)
+}
+
+// cancelTask is CancelTask, the requests being sent with ctx
+func (c *Connection) cancelTask(ctx context.Context, taskId string) (Response, error) {
+	if err := c.requireContext(ctx, FEATURE_TASKS_API); err != nil {
+		return Response{}, err
+	}
+
+	r := Request{
+		Conn:   c,
+		method: "POST",
+		api:    "_tasks/" + taskId + "/_cancel",
+		ctx:    ctx,
+	}
+
+	return r.Run()
+}
+
+// cancelTasks cancels the search tasks started by requests sent with the
+// X-Opaque-Id header set to opaqueId
+func (c *Connection) cancelTasks(ctx context.Context, opaqueId string) error {
+	tasks, err := c.listTasks(ctx, url.Values{"actions": {"*search"}, "detailed": {"true"}})
+	if err != nil {
+		return err
+	}
+
+	for taskId, task := range tasks {
+		if task.Headers["X-Opaque-Id"] != opaqueId || !task.Cancellable {
+			continue
+		}
+
+		if _, err := c.cancelTask(ctx, taskId); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// detachedContext keeps the values of a context but not its cancellation, for
+// the requests cleaning up after a call whose context is done
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// newOpaqueId generates a random id sent as the X-Opaque-Id header
+func newOpaqueId() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Get a typed document by its id
+// Documents indexed with a custom routing need the routing URL argument in
+// extraArgs.
+func (c *Connection) Get(index string, documentType string, id string, extraArgs url.Values) (Response, error) {
+	r := Request{
+		Conn:      c,
+		IndexList: []string{index},
+		method:    "GET",
+		api:       documentType + "/" + id,
+		ExtraArgs: extraArgs,
+	}
+
+	return r.Run()
+}
+
+// GetSource fetches only the _source of a typed document by its id and
+// decodes it into v, a pointer to a map or to a struct describing the
+// documents
+func (c *Connection) GetSource(index string, documentType string, id string, v interface{}, extraArgs url.Values) error {
+	r := Request{
+		Conn:      c,
+		IndexList: []string{index},
+		method:    "GET",
+		api:       documentType + "/" + id + "/_source",
+		ExtraArgs: extraArgs,
+	}
+
+	raw, err := r.RunRaw()
+	if err != nil || raw == nil {
+		return err
+	}
+
+	return json.Unmarshal(raw, v)
+}
+
+// GetWithSourceFilter gets a typed document by its id, returning only the parts
+// of its _source selected by filter
+func (c *Connection) GetWithSourceFilter(index string, documentType string, id string, filter SourceFilter, extraArgs url.Values) (Response, error) {
+	r := Request{
+		Conn:      c,
+		IndexList: []string{index},
+		method:    "GET",
+		api:       documentType + "/" + id,
+		ExtraArgs: filter.values(c, extraArgs),
+	}
+
+	resp, err := r.Run()
+	if err != nil {
+		return resp, err
+	}
+
+	resp.SourceExcluded = filter.Disabled
+	return resp, nil
+}
+
+// MultiGet gets several typed documents by their ids in a single request,
+// returning only the parts of their _source selected by filter. Only the
+// Index, Type, Id and Routing of the documents are used. The documents are found in
+// Response.Docs, in the same order.
+func (c *Connection) MultiGet(documents []Document, filter SourceFilter, extraArgs url.Values) (Response, error) {
+	docs := make([]map[string]interface{}, 0, len(documents))
+	for _, doc := range documents {
+		d := map[string]interface{}{
+			"_index": doc.Index,
+			"_type":  doc.Type,
+			"_id":    doc.Id,
+		}
+
+		if doc.Routing != "" {
+			d["_routing"] = doc.Routing
+		}
+
+		docs = append(docs, d)
+	}
+
+	r := Request{
+		Conn:      c,
+		Query:     map[string]interface{}{"docs": docs},
+		ExtraArgs: filter.values(c, extraArgs),
+		method:    "POST",
+		api:       "_mget",
+	}
+
+	resp, err := r.Run()
+	if err != nil {
+		return resp, err
+	}
+
+	resp.SourceExcluded = filter.Disabled
+	for i := range resp.Docs {
+		resp.Docs[i].SourceExcluded = filter.Disabled
+	}
+
+	return resp, nil
+}
+
+// SearchWithSourceFilter executes a search query against an index, returning
+// only the parts of the hits _source selected by filter
+func (c *Connection) SearchWithSourceFilter(query interface{}, indexList []string, typeList []string, filter SourceFilter) (Response, error) {
+	r := Request{
+		Conn:      c,
+		Query:     query,
+		IndexList: indexList,
+		TypeList:  typeList,
+		ExtraArgs: filter.values(c, nil),
+		method:    "POST",
+		api:       "_search",
+	}
+
+	resp, err := r.Run()
+	if err != nil {
+		return resp, err
+	}
+
+	resp.SourceExcluded = filter.Disabled
+	return resp, nil
+}
+
+// SearchIds executes a search query against an index and returns the ids of
+// the hits only, their _source is neither sent nor decoded
+func (c *Connection) SearchIds(query interface{}, indexList []string, typeList []string) ([]string, error) {
+	r := Request{
+		Conn:      c,
+		Query:     query,
+		IndexList: indexList,
+		TypeList:  typeList,
+		ExtraArgs: c.withoutSource(nil),
+		method:    "POST",
+		api:       "_search",
+	}
+
+	page, err := r.runIds()
+	if err != nil {
+		return nil, err
+	}
+
+	return page.ids(), nil
+}
+
+// ScrollIds runs a scroll search like ScrollAll and calls f with the ids of
+// each page of hits, their _source is neither sent nor decoded
+func (c *Connection) ScrollIds(query interface{}, indexList []string, typeList []string, f func(ids []string) error) error {
+	r, scan := c.scrollSearch(query, indexList, typeList)
+	r.ExtraArgs = c.withoutSource(r.ExtraArgs)
+
+	return c.scrollPages(scan, func(page int, scrollId string) (string, int, error) {
+		if page > 0 {
+			r = c.scrollRequest(scrollId, "1m")
+		}
+
+		resp, err := r.runIds()
+		if err != nil {
+			return "", 0, err
+		}
+
+		ids := resp.ids()
+		if len(ids) > 0 {
+			if err := f(ids); err != nil {
+				return resp.ScrollId, 0, err
+			}
+		}
+
+		return resp.ScrollId, len(ids), nil
+	})
+}
+
+// withoutSource returns a copy of args asking for hits without _source, when
+// the server can leave it out
+func (c *Connection) withoutSource(args url.Values) url.Values {
+	if ok, _ := c.Supports(FEATURE_SOURCE_FILTERING); ok {
+		return SourceFilter{Disabled: true}.values(c, args)
+	}
+
+	return copyValues(args)
+}
+
+// idPage is the part of a search response decoded by SearchIds and ScrollIds
+type idPage struct {
+	ScrollId string `json:"_scroll_id"`
+	Hits     struct {
+		Hits []struct {
+			Id string `json:"_id"`
+		}
+	}
+}
+
+// runIds executes a search Request and decodes the ids of the hits only
+func (req *Request) runIds() (idPage, error) {
+	page := idPage{}
+
+	raw, err := req.RunRaw()
+	if err != nil || len(raw) == 0 {
+		return page, err
+	}
+
+	err = json.Unmarshal(raw, &page)
+	return page, err
+}
+
+// ids returns the ids of the hits of the page
+func (p idPage) ids() []string {
+	ids := make([]string, 0, len(p.Hits.Hits))
+	for _, hit := range p.Hits.Hits {
+		ids = append(ids, hit.Id)
+	}
+
+	return ids
+}
+
+// values returns a copy of args with the URL arguments of the filter added,
+// named as expected by the server of c
+func (f SourceFilter) values(c *Connection, args url.Values) url.Values {
+	v := copyValues(args)
+
+	if f.Disabled {
+		v.Set("_source", "false")
+		return v
+	}
+
+	include, exclude := "_source_include", "_source_exclude"
+	if ok, _ := c.Supports(FEATURE_SOURCE_INCLUDES); ok {
+		include, exclude = "_source_includes", "_source_excludes"
+	}
+
+	if len(f.Includes) > 0 {
+		v.Set(include, strings.Join(f.Includes, ","))
+	}
+
+	if len(f.Excludes) > 0 {
+		v.Set(exclude, strings.Join(f.Excludes, ","))
+	}
+
+	return v
+}
+
+// MoreLikeThis searches for documents similar to the one identified by index,
+// documentType and id using the _mlt API.
+// The params are sent as URL arguments, for example, to control mlt_fields,
+// min_term_freq, min_doc_freq, search_size, etc.
+func (c *Connection) MoreLikeThis(index string, documentType string, id string, params url.Values) (Response, error) {
+	if err := c.require(FEATURE_MORE_LIKE_THIS_API); err != nil {
+		return Response{}, err
+	}
+
+	r := Request{
+		Conn:      c,
+		IndexList: []string{index},
+		ExtraArgs: params,
+		method:    "GET",
+		api:       documentType + "/" + id + "/_mlt",
+	}
+
+	return r.Run()
+}
+
+// TermVectors fetches the term vectors of a typed document identified by its id.
+// The extraArgs is a list of url.Values that you can send to elasticsearch as
+// URL arguments, for example, to control fields, term_statistics, positions,
+// offsets, payloads, etc.
+func (c *Connection) TermVectors(index string, documentType string, id string, extraArgs url.Values) (Response, error) {
+	if err := c.require(FEATURE_TERM_VECTORS); err != nil {
+		return Response{}, err
+	}
+
+	r := Request{
+		Conn:      c,
+		IndexList: []string{index},
+		ExtraArgs: extraArgs,
+		method:    "GET",
+		api:       documentType + "/" + id + "/" + c.termVectorsApi(),
+	}
+
+	return r.Run()
+}
+
+// MultiTermVectors fetches the term vectors of several typed documents of the
+// same index. The term vectors of each document are found in Response.Docs.
+// The extraArgs are applied to every document.
+func (c *Connection) MultiTermVectors(index string, documentType string, ids []string, extraArgs url.Values) (Response, error) {
+	if err := c.require(FEATURE_TERM_VECTORS); err != nil {
+		return Response{}, err
+	}
+
+	r := Request{
+		Conn:      c,
+		Query:     map[string]interface{}{"ids": ids},
+		IndexList: []string{index},
+		TypeList:  []string{documentType},
+		ExtraArgs: extraArgs,
+		method:    "POST",
+		api:       "_mtermvectors",
+	}
+
+	return r.Run()
+}
+
+// termVectorsApi returns the name of the term vectors API, it was singular
+// before elasticsearch 2.0 unlike _mtermvectors
+func (c *Connection) termVectorsApi() string {
+	if version, err := c.serverVersion(); err == nil && compareVersions(version, "2.0.0") < 0 {
+		return "_termvector"
+	}
+
+	return "_termvectors"
+}
+
+// Analyze returns the tokens of text as produced by analyzer. The analyzers,
+// tokenizers and filters defined in the settings of index can be used, index
+// can be empty to use the builtin ones only.
+func (c *Connection) Analyze(index string, analyzer Analyzer, text string) ([]Token, error) {
+	r := Request{
+		Conn:   c,
+		method: "GET",
+		api:    "_analyze",
+	}
+
+	if index != "" {
+		r.IndexList = []string{index}
+	}
+
+	if ok, _ := c.Supports(FEATURE_ANALYZE_BODY); ok {
+		query := map[string]interface{}{"text": text}
+		if analyzer.Analyzer != "" {
+			query["analyzer"] = analyzer.Analyzer
+		}
+		if analyzer.Tokenizer != "" {
+			query["tokenizer"] = analyzer.Tokenizer
+		}
+		if len(analyzer.Filters) > 0 {
+			query["filter"] = analyzer.Filters
+		}
+		if len(analyzer.CharFilters) > 0 {
+			query["char_filter"] = analyzer.CharFilters
+		}
+		if analyzer.Field != "" {
+			query["field"] = analyzer.Field
+		}
+		r.Query = query
+	} else {
+		args := url.Values{"text": {text}}
+		if analyzer.Analyzer != "" {
+			args.Set("analyzer", analyzer.Analyzer)
+		}
+		if analyzer.Tokenizer != "" {
+			args.Set("tokenizer", analyzer.Tokenizer)
+		}
+		if len(analyzer.Filters) > 0 {
+			args.Set("filters", strings.Join(analyzer.Filters, ","))
+		}
+		if len(analyzer.CharFilters) > 0 {
+			args.Set("char_filters", strings.Join(analyzer.CharFilters, ","))
+		}
+		if analyzer.Field != "" {
+			args.Set("field", analyzer.Field)
+		}
+		r.ExtraArgs = args
+	}
+
+	raw, err := r.RunRaw()
+	if err != nil || raw == nil {
+		return nil, err
+	}
+
+	analysis := struct {
+		Tokens []Token
+	}{}
+	err = c.decode(raw, &analysis)
+
+	return analysis.Tokens, err
+}
+
+// Index indexes a Document
+// The extraArgs is a list of url.Values that you can send to elasticsearch as
+// URL arguments, for example, to control ttl, version, op_type, etc.
+func (c *Connection) Index(d Document, extraArgs url.Values) (Response, error) {
+	c.assignId(&d)
+
+	if c.ValidateDocuments {
+		if err := c.validateDocument(d.Index.(string), d); err != nil {
+			return Response{}, err
+		}
+	}
+
+	if d.TTL != "" {
+		if err := c.require(FEATURE_TTL); err != nil {
+			return Response{}, err
+		}
+	}
+
+	command := BULK_COMMAND_INDEX
+	if extraArgs.Get("op_type") == "create" {
+		command = BULK_COMMAND_CREATE
+	}
+
+	if err := c.audit(command, d); err != nil {
+		return Response{}, err
+	}
+
+	r := Request{
+		Conn:      c,
+		Query:     d.Fields,
+		IndexList: []string{d.Index.(string)},
+		TypeList:  []string{d.Type},
+		ExtraArgs: c.refreshArgs(documentArgs(extraArgs, d)),
+		method:    "POST",
+	}
+
+	if d.TTL != "" {
+		r.ExtraArgs.Set("ttl", d.TTL)
+	}
+
+	if d.Pipeline != "" {
+		r.ExtraArgs.Set("pipeline", d.Pipeline)
+	}
+
+	if d.Id != nil {
+		r.method = "PUT"
+		r.id = d.Id.(string)
+	}
+
+	response, err := r.Run()
+
+	// before 5.0 only created is sent (nothing before 1.0), since 6.0 only
+	// result. An ignored error has no response to derive it from.
+	if response.Result == "" && err == nil && response.StatusCode != 0 {
+		if ok, _ := c.Supports(FEATURE_OK_FIELD); !ok {
+			response.Result = RESULT_UPDATED
+			if response.Created {
+				response.Result = RESULT_CREATED
+			}
+		}
+	}
+	response.Created = response.Result == RESULT_CREATED
+
+	return response, versionConflict(err, d)
+}
+
+// Create indexes a Document d only if no document with the same id exists,
+// otherwise a *DocumentExistsError is returned
+func (c *Connection) Create(d Document, extraArgs url.Values) (Response, error) {
+	c.assignId(&d)
+
+	args := copyValues(extraArgs)
+	args.Set("op_type", "create")
+
+	response, err := c.Index(d, args)
+
+	if conflict, ok := err.(*VersionConflictError); ok {
+		return response, &DocumentExistsError{
+			Index:        d.Index,
+			Type:         d.Type,
+			Id:           d.Id,
+			ElasticError: conflict.ElasticError,
+		}
+	}
+
+	return response, err
+}
+
+// Delete deletes a Document d
+// The extraArgs is a list of url.Values that you can send to elasticsearch as
+// URL arguments, for example, to control the version.
+func (c *Connection) Delete(d Document, extraArgs url.Values) (Response, error) {
+	if err := c.audit(BULK_COMMAND_DELETE, d); err != nil {
+		return Response{}, err
+	}
+
+	r := Request{
+		Conn:      c,
+		IndexList: []string{d.Index.(string)},
+		TypeList:  []string{d.Type},
+		ExtraArgs: c.refreshArgs(documentArgs(extraArgs, d)),
+		method:    "DELETE",
+		id:        d.Id.(string),
+	}
+
+	response, err := r.Run()
+
+	// before 5.0 only found is sent, since 6.0 only result. An ignored error
+	// has no response to derive it from.
+	if response.Result == "" && err == nil && response.StatusCode != 0 {
+		response.Result = RESULT_NOT_FOUND
+		if response.Found {
+			response.Result = RESULT_DELETED
+		}
+	}
+	response.Found = response.Result == RESULT_DELETED
+
+	return response, versionConflict(err, d)
+}
+
+// copyValues returns a copy of v which can be modified without altering v
+func copyValues(v url.Values) url.Values {
+	c := make(url.Values, len(v))
+	for key, values := range v {
+		c[key] = append([]string(nil), values...)
+	}
+
+	return c
+}
+
+// documentArgs returns a copy of extraArgs with the routing and parent URL
+// arguments of the document d set
+func documentArgs(extraArgs url.Values, d Document) url.Values {
+	args := copyValues(extraArgs)
+
+	if d.Routing != "" {
+		args.Set("routing", d.Routing)
+	}
+
+	if d.Parent != "" {
+		args.Set("parent", d.Parent)
+	}
+
+	if d.Version != 0 {
+		args.Set("version", strconv.FormatInt(d.Version, 10))
+	}
+
+	if d.VersionType != "" {
+		args.Set("version_type", d.VersionType)
+	}
+
+	return args
+}
+
+// refreshArgs sets the refresh URL argument of a write to
+// Connection.RefreshWrites, unless it is already set
+func (c *Connection) refreshArgs(args url.Values) url.Values {
+	if c.RefreshWrites != "" && args.Get("refresh") == "" {
+		args.Set("refresh", c.RefreshWrites)
+	}
+
+	return args
+}
+
+// Run executes an elasticsearch Request. It converts data to Json, sends the
+// request and return the Response obtained
+func (req *Request) Run() (Response, error) {
+	esResp := Response{}
+
+	err := req.run(func(statusCode int, header http.Header, body []byte) error {
+		var err error
+		esResp, err = decodeResponse(statusCode, body)
+		if err == nil && req.Conn.StrictDecoding {
+			err = decodeStrict(body, &Response{})
+		}
+		if err != nil {
+			return err
+		}
+
+		esResp.StatusCode = statusCode
+		esResp.Header = header
+		return nil
+	})
+
+	return esResp, err
+}
+
+// RunRaw executes an elasticsearch Request like Run but returns the body of
+// the response as is, for APIs whose response does not fit in a Response
+func (req *Request) RunRaw() ([]byte, error) {
+	var raw []byte
+
+	err := req.run(func(statusCode int, header http.Header, body []byte) error {
+		if statusCode >= 400 {
+			_, err := decodeResponse(statusCode, body)
+			if err == nil {
+				err = newSearchError(statusCode, string(body))
+			}
+			return err
+		}
+
+		raw = body
+		return nil
+	})
+
+	return raw, err
+}
+
+// exists executes a HEAD Request and checks if the status is not 404, whatever
+// the ErrorPolicy says about 404
+func (req *Request) exists() (bool, error) {
+	found := false
+
+	err := req.run(func(statusCode int, header http.Header, body []byte) error {
+		if statusCode == 404 {
+			found = false
+			return nil
+		}
+
+		if statusCode >= 400 {
+			return newSearchError(statusCode, string(body))
+		}
+
+		found = true
+		return nil
+	})
+
+	return found, err
+}
+
+// run sends the request, again if the ErrorPolicy says so, and hands the
+// response over to decode
+func (req *Request) run(decode func(statusCode int, header http.Header, body []byte) error) error {
+	postData := []byte{}
+
+	// body sent as is, streamed from the caller
+	rawBody := req.bulkBody
+
+	if req.api != "_bulk" {
+		var err error
+		postData, rawBody, err = req.encodeQuery()
+		if err != nil {
+			return err
+		}
+	}
+
+	// position of a raw body to send it again
+	var bodyStart int64
+	seeker, seekable := rawBody.(io.Seeker)
+	if seekable {
+		start, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		bodyStart = start
+	}
+
+	for attempt := 0; ; attempt++ {
+		var reader io.Reader = bytes.NewReader(postData)
+		if rawBody != nil {
+			if seekable {
+				if _, err := seeker.Seek(bodyStart, io.SeekStart); err != nil {
+					return err
+				}
+			}
+
+			// keeps the transport from closing the body of the caller
+			reader = struct{ io.Reader }{rawBody}
+		} else if req.api == "_bulk" {
+			// encoded again for each attempt
+			reader = bulkReader(req.bulkDocuments, req.Conn.bulkMetadataPrefix())
+		}
+
+		statusCode, header, body, err := req.do(reader)
+		if err == nil {
+			err = decode(statusCode, header, body)
+		}
+
+		if req.ctx != nil && req.ctx.Err() != nil {
+			return err
+		}
+
+		if searchErr, ok := searchError(err); ok {
+			switch req.Conn.errorPolicy().Classify(searchErr.StatusCode, searchErr.Msg) {
+			case ERROR_IGNORED:
+				return nil
+			case ERROR_RETRYABLE:
+				// a raw body can only be read again if it is seekable
+				if attempt < req.Conn.MaxRetries && (rawBody == nil || seekable) && req.sleep(req.Conn.retryBackoff(attempt)) {
+					continue
+				}
+			}
+		}
+
+		return err
+	}
+}
+
+// encodeQuery returns the body of the request, or the reader to stream it from
+// when the query is an io.Reader
+func (req *Request) encodeQuery() ([]byte, io.Reader, error) {
+	switch query := req.Query.(type) {
+	case string:
+		return []byte(query), nil, nil
+	case json.RawMessage:
+		return query, nil, nil
+	case []byte:
+		return query, nil, nil
+	case io.Reader:
+		return nil, query, nil
+	}
+
+	b, err := json.Marshal(req.Query)
+	return b, nil, err
+}
+
+// stream sends the request once and calls f with each hit of the response as
+// it is decoded. The response is returned without its hits.
+func (req *Request) stream(f func(hit Hit) error) (Response, error) {
+	postData, rawBody, err := req.encodeQuery()
+	if err != nil {
+		return Response{}, err
+	}
+
+	var reader io.Reader = bytes.NewReader(postData)
+	if rawBody != nil {
+		// keeps the transport from closing the body of the caller
+		reader = struct{ io.Reader }{rawBody}
+	}
+
+	resp, err := req.send(reader)
+	if err != nil {
+		return Response{}, err
+	}
+
+	defer closeBody(resp.Body)
+
+	var esResp Response
+	if resp.StatusCode < 300 {
+		esResp, err = decodeStream(resp.Body, f)
+		if err != nil {
+			// the scroll id is kept to free the search context
+			return esResp, err
+		}
+	} else {
+		body, readErr := ioutil.ReadAll(resp.Body)
+		if readErr != nil {
+			return Response{}, readErr
+		}
+		esResp, err = decodeResponse(resp.StatusCode, body)
+	}
+	if err != nil {
+		return Response{}, err
+	}
+
+	esResp.StatusCode = resp.StatusCode
+	esResp.Header = resp.Header
+	return esResp, nil
+}
+
+// decodeStream decodes a search response read from r, calling f with each hit
+// instead of keeping it. Everything but the hits is decoded in the Response,
+// only the ScrollId read so far is on errors.
+func decodeStream(r io.Reader, f func(hit Hit) error) (Response, error) {
+	decoder := json.NewDecoder(r)
+
+	fields := map[string]json.RawMessage{}
+	hits := map[string]json.RawMessage{}
+
+	err := decodeObject(decoder, func(key string) error {
+		if key != "hits" {
+			var raw json.RawMessage
+			if err := decoder.Decode(&raw); err != nil {
+				return err
+			}
+			fields[key] = raw
+			return nil
+		}
+
+		return decodeObject(decoder, func(key string) error {
+			if key != "hits" {
+				var raw json.RawMessage
+				if err := decoder.Decode(&raw); err != nil {
+					return err
+				}
+				hits[key] = raw
+				return nil
+			}
+
+			if err := expectDelim(decoder, '['); err != nil {
+				return err
+			}
+			for decoder.More() {
+				var hit Hit
+				if err := decoder.Decode(&hit); err != nil {
+					return err
+				}
+				if err := f(hit); err != nil {
+					return err
+				}
+			}
+			return expectDelim(decoder, ']')
+		})
+	})
+	if err != nil {
+		partial := Response{}
+		json.Unmarshal(fields["_scroll_id"], &partial.ScrollId)
+		return partial, err
+	}
+
+	raw, err := json.Marshal(hits)
+	if err != nil {
+		return Response{}, err
+	}
+	fields["hits"] = raw
+
+	body, err := json.Marshal(fields)
+	if err != nil {
+		return Response{}, err
+	}
+
+	return decodeResponse(200, body)
+}
+
+// decodeObject reads a JSON object from decoder and calls f with each key,
+// f has to read the value
+func decodeObject(decoder *json.Decoder, f func(key string) error) error {
+	if err := expectDelim(decoder, '{'); err != nil {
+		return err
+	}
+
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+
+		if err := f(token.(string)); err != nil {
+			return err
+		}
+	}
+
+	return expectDelim(decoder, '}')
+}
+
+// expectDelim reads the next token of decoder, which has to be delim
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+
+	if token != delim {
+		return fmt.Errorf("expected %v, found %v", delim, token)
+	}
+
+	return nil
+}
+
+// do sends the body read from reader to elasticsearch once and returns the
+// status code, the headers and the body of the response
+func (req *Request) do(reader io.Reader) (int, http.Header, []byte, error) {
+	resp, err := req.send(reader)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	defer closeBody(resp.Body)
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	return resp.StatusCode, resp.Header, body, nil
+}
+
+// send sends the body read from reader to elasticsearch once and returns the
+// response, whose body has to be closed
+func (req *Request) send(reader io.Reader) (*http.Response, error) {
+	newReq, err := http.NewRequest(req.method, req.Url(), reader)
+	if err != nil {
+		// stops the encoding of a streamed body
+		if closer, ok := reader.(io.Closer); ok {
+			closer.Close()
+		}
+		return nil, err
+	}
+
+	if req.ctx != nil {
+		newReq = newReq.WithContext(req.ctx)
+	}
+
+	if req.Query != nil || req.bulkBody != nil || req.bulkDocuments != nil {
+		newReq.Header.Set("Content-Type", req.contentType())
+	}
+
+	if req.opaqueId != "" {
+		newReq.Header.Set("X-Opaque-Id", req.opaqueId)
+	}
+
+	resp, err := req.Conn.httpClient().Do(newReq)
+	if err != nil {
+		return nil, err
+	}
+
+	if hook := req.Conn.DeprecationHook; hook != nil {
+		if warnings := resp.Header.Values("Warning"); len(warnings) > 0 {
+			deprecations := make([]Deprecation, 0, len(warnings))
+			for _, warning := range warnings {
+				deprecations = append(deprecations, Deprecation{
+					Method:  req.method,
+					Url:     req.Url(),
+					Message: warningText(warning),
+				})
+			}
+			hook(deprecations)
+		}
+	}
+
+	return resp, nil
+}
+
+// contentType returns the Content-Type of the body of the request, the _bulk
+// and _msearch APIs take a JSON document per line
+func (req *Request) contentType() string {
+	if strings.HasSuffix(req.api, "_bulk") || strings.HasSuffix(req.api, "_msearch") {
+		return "application/x-ndjson"
+	}
+	return "application/json"
+}
+
+// warningText returns the text of a Warning header, like
+// 299 Elasticsearch-7.10.2-747e1cc "[types removal] ..." "Mon, 01 Feb 2021 ..."
+func warningText(warning string) string {
+	start := strings.IndexByte(warning, '"')
+	if start < 0 {
+		return warning
+	}
+
+	var text strings.Builder
+	for i := start + 1; i < len(warning); i++ {
+		switch warning[i] {
+		case '\\':
+			if i+1 < len(warning) {
+				i++
+			}
+		case '"':
+			return text.String()
+		}
+		text.WriteByte(warning[i])
+	}
+
+	return text.String()
+}
+
+// decodeResponse converts the body of an HTTP response sent by elasticsearch
+// with the given status code to a Response
+func decodeResponse(statusCode int, body []byte) (Response, error) {
+	if statusCode > 201 && statusCode < 400 {
+		return Response{}, errors.New(string(body))
+	}
+
+	// HEAD requests and some proxies answer without a body
+	if len(bytes.TrimSpace(body)) == 0 && statusCode < 300 {
+		return Response{Ok: true}, nil
+	}
+
+	esResp := Response{}
+	err := json.Unmarshal(body, &esResp)
+	if err != nil {
+		// proxies and overloaded nodes may answer with a non JSON body
+		if statusCode >= 400 {
+			return Response{}, newSearchError(statusCode, string(body))
+		}
+		return Response{}, err
+	}
+
+	if esResp.Error != "" {
+		return Response{}, newSearchError(int(esResp.Status), esResp.Error)
+	}
+
+	// ok is not sent since 1.0
+	if statusCode < 300 {
+		esResp.Ok = true
+	}
+
+	return esResp, nil
+}
+
+// decode decodes the body of a RunRaw request into v, strictly when the
+// connection has StrictDecoding
+func (c *Connection) decode(raw []byte, v interface{}) error {
+	if c.StrictDecoding {
+		return decodeStrict(raw, v)
+	}
+
+	return json.Unmarshal(raw, v)
+}
+
+// decodeStrict decodes body into v, failing on the fields v does not have
+func decodeStrict(body []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("strict decoding: %w", err)
+	}
+
+	// the UnmarshalJSON of Response, Hits and Hit do not know the decoding is
+	// strict, their fields are checked on their own
+	switch v.(type) {
+	case *Response:
+		if err := decodeStrict(body, &rawResponse{}); err != nil {
+			return err
+		}
+
+		var response struct {
+			Hits json.RawMessage
+			Docs []json.RawMessage
+		}
+		json.Unmarshal(body, &response)
+
+		for _, doc := range response.Docs {
+			if err := decodeStrict(doc, &Response{}); err != nil {
+				return err
+			}
+		}
+
+		if len(response.Hits) > 0 && string(response.Hits) != "null" {
+			return decodeStrict(response.Hits, &Hits{})
+		}
+	case *Hits:
+		if err := decodeStrict(body, &rawHits{}); err != nil {
+			return err
+		}
+
+		var hits struct {
+			Hits []json.RawMessage
+		}
+		json.Unmarshal(body, &hits)
+
+		for _, hit := range hits.Hits {
+			if err := decodeStrict(hit, &rawHit{}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Matches the errors of elasticsearch before 2.0, like
+// IndexMissingException[[i] missing]
+var legacyErrorRegexp = regexp.MustCompile(`^(\w+)\[(.*)\]$`)
+
+// Matches the index leading the reason of the index errors before 2.0
+var legacyIndexRegexp = regexp.MustCompile(`^\[([^\]]+)\]`)
+
+// newSearchError returns the error of a response with the given status, msg
+// being its body or the error field of a body before 2.0
+func newSearchError(status int, msg string) *SearchError {
+	return &SearchError{
+		Msg:        msg,
+		StatusCode: uint64(status),
+		elastic:    newElasticError(status, msg),
+	}
+}
+
+// newElasticError parses msg, the body of a response with the given status or
+// the error field of a body before 2.0
+func newElasticError(status int, msg string) *ElasticError {
+	elasticErr := &ElasticError{HTTPStatus: status, Msg: msg}
+
+	var body struct {
+		Error json.RawMessage
+	}
+	if err := json.Unmarshal([]byte(msg), &body); err == nil && len(body.Error) > 0 {
+		parseError(elasticErr, body.Error)
+	} else {
+		parseLegacyError(elasticErr, msg)
+	}
+
+	return elasticErr
+}
+
+// UnmarshalJSON decodes a shard failure, whose reason is an error object or a
+// string before 2.0
+func (f *ShardFailure) UnmarshalJSON(data []byte) error {
+	var failure struct {
+		Index  string
+		Shard  int
+		Node   string
+		Reason json.RawMessage
+	}
+	if err := json.Unmarshal(data, &failure); err != nil {
+		return err
+	}
+
+	*f = ShardFailure{Index: failure.Index, Shard: failure.Shard, Node: failure.Node}
+	if len(failure.Reason) > 0 {
+		parseError(&f.Reason, failure.Reason)
+	}
+
+	return nil
+}
+
+// UnmarshalJSON decodes the hits of a search, whose total is a number before
+// 7.0 and an object with its relation to the number of matches since
+func (h *Hits) UnmarshalJSON(data []byte) error {
+	var raw rawHits
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*h = Hits(raw.hitsFields)
+	h.Total, h.TotalRelation = 0, TOTAL_EQ
+
+	if len(raw.Total) == 0 || raw.Total[0] != '{' {
+		if len(raw.Total) > 0 && string(raw.Total) != "null" {
+			return json.Unmarshal(raw.Total, &h.Total)
+		}
+		return nil
+	}
+
+	var total struct {
+		Value    uint64
+		Relation string
+	}
+	if err := json.Unmarshal(raw.Total, &total); err != nil {
+		return err
+	}
+
+	h.Total = total.Value
+	if total.Relation != "" {
+		h.TotalRelation = total.Relation
+	}
+
+	return nil
+}
+
+// hitsFields are the fields of Hits without its UnmarshalJSON
+type hitsFields Hits
+
+// rawHits are the hits of a search with their total as sent
+type rawHits struct {
+	hitsFields
+	Total json.RawMessage
+}
+
+// UnmarshalJSON decodes a hit, keeping its _source as sent in RawSource
+func (h *Hit) UnmarshalJSON(data []byte) error {
+	var raw rawHit
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*h = Hit(raw.hitFields)
+	h.RawSource = sentSource(raw.Source)
+
+	return decodeSource(h.RawSource, nil, &h.Source)
+}
+
+// hitFields are the fields of Hit without its UnmarshalJSON
+type hitFields Hit
+
+// rawHit is a hit with its _source as sent
+type rawHit struct {
+	hitFields
+	Source json.RawMessage `json:"_source"`
+}
+
+// UnmarshalJSON decodes a response, keeping the _source of a GET as sent in
+// RawSource
+func (r *Response) UnmarshalJSON(data []byte) error {
+	var raw rawResponse
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*r = Response(raw.responseFields)
+	r.RawSource = sentSource(raw.Source)
+
+	return decodeSource(r.RawSource, nil, &r.Source)
+}
+
+// responseFields are the fields of Response without its UnmarshalJSON
+type responseFields Response
+
+// rawResponse is a response with its _source as sent
+type rawResponse struct {
+	responseFields
+	Source json.RawMessage `json:"_source"`
+}
+
+// sentSource returns the _source decoded as raw, nil when there is none
+func sentSource(raw json.RawMessage) json.RawMessage {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	return raw
+}
+
+// parseError sets the fields of elasticErr from raw, an error object or a
+// string before 2.0, and its Msg when there is none
+func parseError(elasticErr *ElasticError, raw json.RawMessage) {
+	var legacy string
+	if json.Unmarshal(raw, &legacy) == nil {
+		if elasticErr.Msg == "" {
+			elasticErr.Msg = legacy
+		}
+		parseLegacyError(elasticErr, legacy)
+		return
+	}
+
+	if elasticErr.Msg == "" {
+		elasticErr.Msg = string(raw)
+	}
+	parseErrorCause(elasticErr, raw)
+}
+
+// parseErrorCause sets the fields of elasticErr from an error object, like
+// {"type": ..., "reason": ..., "caused_by": {...}}
+func parseErrorCause(elasticErr *ElasticError, raw json.RawMessage) {
+	var cause struct {
+		Type     string
+		Reason   string
+		Index    string
+		CausedBy json.RawMessage `json:"caused_by"`
+	}
+	if json.Unmarshal(raw, &cause) != nil {
+		return
+	}
+
+	elasticErr.ErrorType = cause.Type
+	elasticErr.Reason = cause.Reason
+	elasticErr.Index = cause.Index
+
+	if len(cause.CausedBy) > 0 {
+		elasticErr.CausedBy = &ElasticError{}
+		parseErrorCause(elasticErr.CausedBy, cause.CausedBy)
+	}
+}
+
+// parseLegacyError sets the fields of elasticErr from an error before 2.0,
+// whose causes are appended like "; nested: Cause[reason]"
+func parseLegacyError(elasticErr *ElasticError, msg string) {
+	current := elasticErr
+
+	for i, part := range strings.Split(strings.TrimRight(msg, "; "), "; nested: ") {
+		match := legacyErrorRegexp.FindStringSubmatch(part)
+		if match == nil {
+			return
+		}
+
+		if i > 0 {
+			current.CausedBy = &ElasticError{}
+			current = current.CausedBy
+		}
+
+		current.ErrorType = match[1]
+		current.Reason = match[2]
+
+		// like IndexMissingException[[i] missing]
+		if strings.HasPrefix(current.ErrorType, "Index") {
+			if index := legacyIndexRegexp.FindStringSubmatch(current.Reason); index != nil {
+				current.Index = index[1]
+			}
+		}
+	}
+}
+
+// Url builds a Request for a URL
+func (r *Request) Url() string {
+	if !cleanPath(r.IndexList) || !cleanPath(r.TypeList) || !cleanPath([]string{r.id, r.api}) {
+		return r.escapedUrl()
+	}
+
+	query := r.ExtraArgs.Encode()
+
+	size := len("http://:") + len(r.Conn.Host) + len(r.Conn.Port) + len(r.id) + len(r.api) + len(query) + 3
+	for _, index := range r.IndexList {
+		size += len(index) + 1
+	}
+	for _, documentType := range r.TypeList {
+		size += len(documentType) + 1
+	}
+
+	var b strings.Builder
+	b.Grow(size)
+
+	b.WriteString("http://")
+	b.WriteString(r.Conn.Host)
+	b.WriteByte(':')
+	b.WriteString(r.Conn.Port)
+	writeList(&b, r.IndexList)
+	writeList(&b, r.TypeList)
+
+	// XXX : for indexing documents using the normal (non bulk) API
+	if len(r.api) == 0 && len(r.id) > 0 {
+		b.WriteByte('/')
+		b.WriteString(r.id)
+	}
+
+	b.WriteByte('/')
+	b.WriteString(r.api)
+
+	if query != "" {
+		b.WriteByte('?')
+		b.WriteString(query)
+	}
+
+	return b.String()
+}
+
+// escapedUrl builds the URL of a Request whose path has characters to escape
+func (r *Request) escapedUrl() string {
+	path := ""
+
+	if len(r.IndexList) > 0 {
+		path += "/" + strings.Join(r.IndexList, ",")
+	}
+
+	if len(r.TypeList) > 0 {
+		path += "/" + strings.Join(r.TypeList, ",")
+	}
+
+	if len(r.api) == 0 && len(r.id) > 0 {
+		path += "/" + r.id
+	}
+
+	path += "/" + r.api
+
+	u := url.URL{
+		Scheme:   "http",
+		Host:     fmt.Sprintf("%s:%s", r.Conn.Host, r.Conn.Port),
+		Path:     path,
+		RawQuery: r.ExtraArgs.Encode(),
 	}
 
 	return u.String()
 }
+
+// writeList writes a comma separated list of names of a path, if any
+func writeList(b *strings.Builder, names []string) {
+	if len(names) == 0 {
+		return
+	}
+
+	b.WriteByte('/')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+	}
+}
+
+// cleanPath checks that the parts of a path have no character escaped by
+// net/url
+func cleanPath(parts []string) bool {
+	for _, part := range parts {
+		for i := 0; i < len(part); i++ {
+			c := part[i]
+			if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' {
+				continue
+			}
+
+			switch c {
+			case '-', '_', '.', '~', '$', '&', '+', ',', '/', ':', ';', '=', '@':
+				continue
+			}
+
+			return false
+		}
+	}
+
+	return true
+}
@@ -5,12 +5,28 @@
 package goes
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
-	. "launchpad.net/gocheck"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/jackdoe/goes/qdsl"
 )
 
 var (
@@ -18,14 +34,7 @@ var (
 	ES_PORT = "9200"
 )
 
-// Hook up gocheck into the gotest runner.
-func Test(t *testing.T) { TestingT(t) }
-
-type GoesTestSuite struct{}
-
-var _ = Suite(&GoesTestSuite{})
-
-func (s *GoesTestSuite) SetUpTest(c *C) {
+func TestMain(m *testing.M) {
 	h := os.Getenv("TEST_ELASTICSEARCH_HOST")
 	if h != "" {
 		ES_HOST = h
@@ -35,14 +44,216 @@ func (s *GoesTestSuite) SetUpTest(c *C) {
 	if p != "" {
 		ES_PORT = p
 	}
+
+	os.Exit(m.Run())
+}
+
+// testConnection returns a Connection to the test server, the test is skipped
+// when the server can not be reached
+func testConnection(t *testing.T) *Connection {
+	t.Helper()
+
+	c, err := net.DialTimeout("tcp", net.JoinHostPort(ES_HOST, ES_PORT), time.Second)
+	if err != nil {
+		t.Skipf("elasticsearch is not reachable: %s", err)
+	}
+	c.Close()
+
+	return NewConnection(ES_HOST, ES_PORT)
+}
+
+// fakeConnection returns a Connection to a fake server answering with handler
+// and pretending to be elasticsearch version
+func fakeConnection(t *testing.T, version string, handler http.HandlerFunc) *Connection {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	u, err := url.Parse(server.URL)
+	assertNoError(t, err)
+
+	conn := NewConnection(u.Hostname(), u.Port())
+	conn.Version = version
+
+	return conn
+}
+
+// fakeServer pretends to be elasticsearch, it answers every request with the
+// status and the response it was last given, and logs the requests as
+// "METHOD /path?query body" with their Content-Type
+type fakeServer struct {
+	lock         sync.Mutex
+	status       int
+	response     string
+	log          []string
+	contentTypes []string
+}
+
+// newFakeServer returns a fakeServer pretending to be elasticsearch version
+// and a Connection to it
+func newFakeServer(t *testing.T, version string) (*fakeServer, *Connection) {
+	t.Helper()
+
+	server := &fakeServer{status: http.StatusOK, log: []string{}, contentTypes: []string{}}
+	return server, fakeConnection(t, version, server.serve)
+}
+
+func (s *fakeServer) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	request := r.Method + " " + r.URL.Path
+	if r.URL.RawQuery != "" {
+		request += "?" + r.URL.RawQuery
+	}
+	if len(body) > 0 {
+		request += " " + string(body)
+	}
+
+	s.lock.Lock()
+	s.log = append(s.log, request)
+	s.contentTypes = append(s.contentTypes, r.Header.Get("Content-Type"))
+	status, response := s.status, s.response
+	s.lock.Unlock()
+
+	w.WriteHeader(status)
+	io.WriteString(w, response)
+}
+
+// answer makes the server answer the next requests with status and response
+func (s *fakeServer) answer(status int, response string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.status, s.response = status, response
+}
+
+// requests returns the requests received since the last call
+func (s *fakeServer) requests() []string {
+	requests, _ := s.take()
+	return requests
+}
+
+// take returns the requests received since the last call and their
+// Content-Type
+func (s *fakeServer) take() ([]string, []string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	requests, contentTypes := s.log, s.contentTypes
+	s.log, s.contentTypes = []string{}, []string{}
+	return requests, contentTypes
+}
+
+// expectedContentType returns the Content-Type of request, logged as
+// "METHOD /path?query body"
+func expectedContentType(request string) string {
+	parts := strings.SplitN(request, " ", 3)
+	if len(parts) < 3 || parts[2] == "null" {
+		return ""
+	}
+
+	path := strings.SplitN(parts[1], "?", 2)[0]
+	if strings.HasSuffix(path, "/_bulk") || strings.HasSuffix(path, "/_msearch") {
+		return "application/x-ndjson"
+	}
+	return "application/json"
+}
+
+// requestCase is an API call checked by testRequests
+type requestCase struct {
+	name string
+
+	// Answer of the fake server to the requests of the call, 200 when status
+	// is 0
+	status   int
+	response string
+
+	call func(t *testing.T, conn *Connection) error
+
+	// Requests sent by the call, as "METHOD /path?query body", and the error
+	// it returns
+	requests []string
+	err      string
+}
+
+// testRequests makes the calls of cases in order with a Connection to a
+// fakeServer pretending to be elasticsearch version, and checks the requests
+// they send and the errors they return
+func testRequests(t *testing.T, version string, cases []requestCase) {
+	t.Helper()
+
+	server, conn := newFakeServer(t, version)
+
+	for _, c := range cases {
+		status := c.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		server.answer(status, c.response)
+		server.requests()
+
+		t.Run(c.name, func(t *testing.T) {
+			err := c.call(t, conn)
+			if c.err == "" {
+				assertNoError(t, err)
+			} else {
+				assertError(t, err)
+				assertEqual(t, err.Error(), c.err)
+			}
+
+			if c.requests == nil {
+				c.requests = []string{}
+			}
+			requests, contentTypes := server.take()
+			assertEqual(t, requests, c.requests)
+
+			for i, request := range requests {
+				if expected := expectedContentType(request); contentTypes[i] != expected {
+					t.Fatalf("%s sent with Content-Type %q, expected %q", request, contentTypes[i], expected)
+				}
+			}
+		})
+	}
+}
+
+func assertEqual(t *testing.T, obtained interface{}, expected interface{}) {
+	t.Helper()
+
+	if !reflect.DeepEqual(obtained, expected) {
+		t.Fatalf("obtained %#v, expected %#v", obtained, expected)
+	}
+}
+
+// withoutHTTP returns r without the status and the headers of its HTTP
+// response, which depend on the server
+func withoutHTTP(r Response) Response {
+	r.StatusCode, r.Header = 0, nil
+	return r
+}
+
+func assertNoError(t *testing.T, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func assertError(t *testing.T, err error) {
+	t.Helper()
+
+	if err == nil {
+		t.Fatal("expected an error")
+	}
 }
 
-func (s *GoesTestSuite) TestNewConnection(c *C) {
+func TestNewConnection(t *testing.T) {
 	conn := NewConnection(ES_HOST, ES_PORT)
-	c.Assert(conn, DeepEquals, &Connection{ES_HOST, ES_PORT})
+	assertEqual(t, conn, &Connection{Host: ES_HOST, Port: ES_PORT})
 }
 
-func (s *GoesTestSuite) TestUrl(c *C) {
+func TestUrl(t *testing.T) {
 	conn := NewConnection(ES_HOST, ES_PORT)
 
 	r := Request{
@@ -54,24 +265,59 @@ func (s *GoesTestSuite) TestUrl(c *C) {
 		api:       "_search",
 	}
 
-	c.Assert(r.Url(), Equals, "http://"+ES_HOST+":"+ES_PORT+"/i/_search")
+	assertEqual(t, r.Url(), "http://"+ES_HOST+":"+ES_PORT+"/i/_search")
 
 	r.IndexList = []string{"a", "b"}
-	c.Assert(r.Url(), Equals, "http://"+ES_HOST+":"+ES_PORT+"/a,b/_search")
+	assertEqual(t, r.Url(), "http://"+ES_HOST+":"+ES_PORT+"/a,b/_search")
 
 	r.TypeList = []string{"c", "d"}
-	c.Assert(r.Url(), Equals, "http://"+ES_HOST+":"+ES_PORT+"/a,b/c,d/_search")
+	assertEqual(t, r.Url(), "http://"+ES_HOST+":"+ES_PORT+"/a,b/c,d/_search")
 
 	r.ExtraArgs = make(url.Values, 1)
 	r.ExtraArgs.Set("version", "1")
-	c.Assert(r.Url(), Equals, "http://"+ES_HOST+":"+ES_PORT+"/a,b/c,d/_search?version=1")
+	assertEqual(t, r.Url(), "http://"+ES_HOST+":"+ES_PORT+"/a,b/c,d/_search?version=1")
 
 	r.id = "1234"
 	r.api = ""
-	c.Assert(r.Url(), Equals, "http://"+ES_HOST+":"+ES_PORT+"/a,b/c,d/1234/?version=1")
+	assertEqual(t, r.Url(), "http://"+ES_HOST+":"+ES_PORT+"/a,b/c,d/1234/?version=1")
+
+	r = Request{
+		Conn:   conn,
+		method: "GET",
+		api:    "_tasks",
+	}
+	assertEqual(t, r.Url(), "http://"+ES_HOST+":"+ES_PORT+"/_tasks")
+
+	// wildcards and date math are escaped
+	r.IndexList = []string{"logs-*", "<logs-{now/d}>"}
+	r.api = "_search/scroll"
+	assertEqual(t, r.Url(), "http://"+ES_HOST+":"+ES_PORT+"/logs-%2A,%3Clogs-%7Bnow/d%7D%3E/_search/scroll")
+
+	r.IndexList = []string{"logs-2013.01.01", "logs-2013.01.02"}
+	r.TypeList = []string{"t"}
+	r.ExtraArgs = url.Values{"routing": {"a b"}, "refresh": {"true"}}
+	assertEqual(t, r.Url(), r.escapedUrl())
+
+	conn.Host, conn.Port = "es.test", "9201"
+	assertEqual(t, r.Url(), "http://es.test:9201/logs-2013.01.01,logs-2013.01.02/t/_search/scroll?refresh=true&routing=a+b")
+}
+
+func TestConnectionCopy(t *testing.T) {
+	server, conn := newFakeServer(t, "")
+	server.answer(200, `{"version":{"number":"7.10.2"}}`)
+
+	ok, err := conn.Supports(FEATURE_CLONE_API)
+	assertNoError(t, err)
+	assertEqual(t, ok, true)
+
+	// the copies share the locks and the caches
+	other := *conn
+	assertEqual(t, other.shared() == conn.shared(), true)
+	assertEqual(t, other.Version, "7.10.2")
+	assertEqual(t, server.requests(), []string{"GET / null"})
 }
 
-func (s *GoesTestSuite) TestEsDown(c *C) {
+func TestEsDown(t *testing.T) {
 	conn := NewConnection("a.b.c.d", "1234")
 
 	var query = map[string]interface{}{"query": "foo"}
@@ -85,11 +331,123 @@ func (s *GoesTestSuite) TestEsDown(c *C) {
 	}
 	_, err := r.Run()
 
-	c.Assert(err.Error(), Equals, "Get http://a.b.c.d:1234/i/_search: lookup a.b.c.d: no such host")
+	urlErr, ok := err.(*url.Error)
+	if !ok {
+		t.Fatalf("expected an *url.Error, obtained %#v", err)
+	}
+	assertEqual(t, urlErr.Op, "Get")
+	assertEqual(t, urlErr.URL, "http://a.b.c.d:1234/i/_search")
+
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) {
+		t.Fatalf("expected a *net.DNSError, obtained %#v", urlErr.Err)
+	}
+	assertEqual(t, dnsErr.Name, "a.b.c.d")
+	assertEqual(t, dnsErr.IsNotFound, true)
 }
 
-func (s *GoesTestSuite) TestRunMissingIndex(c *C) {
-	conn := NewConnection(ES_HOST, ES_PORT)
+func TestConnectionReuse(t *testing.T) {
+	addrs := map[string]bool{}
+	hits := strings.Repeat(`{"_id":"1"},`, 10000)
+
+	conn := fakeConnection(t, "5.6.16", func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		addrs[r.RemoteAddr] = true
+
+		if r.Method == "DELETE" {
+			io.WriteString(w, `{"succeeded":true}`)
+			return
+		}
+		io.WriteString(w, `{"_scroll_id":"s1","hits":{"total":10001,"hits":[`+hits+`{"_id":"2"}]}}`)
+	})
+	conn.Client = &http.Client{Transport: newTransport()}
+
+	// the body of the page left unread is drained
+	err := conn.ScrollStream(nil, []string{"i"}, []string{}, func(hit Hit) error {
+		return errors.New("enough")
+	})
+	assertEqual(t, err.Error(), "enough")
+
+	_, err = conn.Search(nil, []string{"i"}, []string{})
+	assertNoError(t, err)
+
+	assertEqual(t, len(addrs), 1)
+	assertEqual(t, NewConnection("localhost", "9200").httpClient(), DefaultClient)
+}
+
+// fakeResolver resolves every host to 127.0.0.1 until it is broken
+type fakeResolver struct {
+	lookups int
+	broken  bool
+}
+
+func (r *fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.lookups++
+	if r.broken {
+		return nil, errors.New("resolver is down")
+	}
+	return []string{"127.0.0.1"}, nil
+}
+
+func TestWarmUp(t *testing.T) {
+	var lock sync.Mutex
+	requests := []string{}
+
+	conn := fakeConnection(t, "7.10.2", func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+r.Host)
+		lock.Unlock()
+
+		io.WriteString(w, `{}`)
+	})
+
+	resolver := &fakeResolver{}
+	cache := &CachingResolver{Resolver: resolver}
+	conn.Host = "es.test"
+	conn.Resolver = cache
+
+	assertNoError(t, conn.WarmUp(context.Background(), 2))
+	assertEqual(t, resolver.lookups, 1)
+	assertEqual(t, requests, []string{"HEAD / es.test:" + conn.Port, "HEAD / es.test:" + conn.Port})
+
+	_, err := conn.Search(nil, []string{"i"}, []string{})
+	assertNoError(t, err)
+	assertEqual(t, resolver.lookups, 1)
+
+	// the connections with the same resolver share a client
+	other := NewConnection("es.test", conn.Port)
+	other.Resolver = cache
+	assertEqual(t, other.httpClient() == conn.httpClient(), true)
+	assertEqual(t, other.httpClient() == DefaultClient, false)
+
+	// the resolver is ignored with a client
+	other.Host = "127.0.0.1"
+	other.Resolver = resolver
+	other.Client = &http.Client{}
+	assertNoError(t, other.WarmUp(context.Background(), 1))
+	assertEqual(t, resolver.lookups, 1)
+
+	// the expired addresses are used while the host can not be resolved
+	cache.TTL = time.Nanosecond
+	cache.hosts["es.test"] = resolvedHost{addrs: []string{"127.0.0.1"}}
+	resolver.broken = true
+
+	addrs, err := cache.LookupHost(context.Background(), "es.test")
+	assertNoError(t, err)
+	assertEqual(t, addrs, []string{"127.0.0.1"})
+	assertEqual(t, resolver.lookups, 2)
+
+	_, err = cache.LookupHost(context.Background(), "other.test")
+	assertEqual(t, err.Error(), "resolver is down")
+
+	addrs, err = cache.LookupHost(context.Background(), "::1")
+	assertNoError(t, err)
+	assertEqual(t, addrs, []string{"::1"})
+	assertEqual(t, resolver.lookups, 3)
+}
+
+func TestRunMissingIndex(t *testing.T) {
+	conn := testConnection(t)
 
 	var query = map[string]interface{}{"query": "foo"}
 
@@ -102,12 +460,12 @@ func (s *GoesTestSuite) TestRunMissingIndex(c *C) {
 	}
 	_, err := r.Run()
 
-	c.Assert(err.Error(), Equals, "[404] IndexMissingException[[i] missing]")
+	assertEqual(t, err.Error(), "[404] IndexMissingException[[i] missing]")
 }
 
-func (s *GoesTestSuite) TestCreateIndex(c *C) {
+func TestCreateIndex(t *testing.T) {
 	indexName := "testcreateindexgoes"
-	conn := NewConnection(ES_HOST, ES_PORT)
+	conn := testConnection(t)
 
 	mapping := map[string]interface{}{
 		"settings": map[string]interface{}{
@@ -128,63 +486,63 @@ func (s *GoesTestSuite) TestCreateIndex(c *C) {
 
 	resp, err := conn.CreateIndex(indexName, mapping)
 
-	c.Assert(err, IsNil)
-	c.Assert(resp.Ok, Equals, true)
-	c.Assert(resp.Acknowledged, Equals, true)
+	assertNoError(t, err)
+	assertEqual(t, resp.Ok, true)
+	assertEqual(t, resp.Acknowledged, true)
 
 	conn.DeleteIndex(indexName)
 
 	raw, err := json.Marshal(mapping)
-	c.Assert(err, IsNil)
+	assertNoError(t, err)
 
 	resp, err = conn.CreateIndex(indexName, string(raw))
-	c.Assert(resp.Ok, Equals, true)
-	c.Assert(resp.Acknowledged, Equals, true)
+	assertEqual(t, resp.Ok, true)
+	assertEqual(t, resp.Acknowledged, true)
 	conn.DeleteIndex(indexName)
 }
 
-func (s *GoesTestSuite) TestDeleteIndexInexistantIndex(c *C) {
-	conn := NewConnection(ES_HOST, ES_PORT)
+func TestDeleteIndexInexistantIndex(t *testing.T) {
+	conn := testConnection(t)
 	resp, err := conn.DeleteIndex("foobar")
 
-	c.Assert(err.Error(), Equals, "[404] IndexMissingException[[foobar] missing]")
-	c.Assert(resp, DeepEquals, Response{})
+	assertEqual(t, err.Error(), "[404] IndexMissingException[[foobar] missing]")
+	assertEqual(t, resp, Response{})
 }
 
-func (s *GoesTestSuite) TestDeleteIndexExistingIndex(c *C) {
-	conn := NewConnection(ES_HOST, ES_PORT)
+func TestDeleteIndexExistingIndex(t *testing.T) {
+	conn := testConnection(t)
 
 	indexName := "testdeleteindexexistingindex"
 
 	_, err := conn.CreateIndex(indexName, map[string]interface{}{})
 
-	c.Assert(err, IsNil)
+	assertNoError(t, err)
 
 	resp, err := conn.DeleteIndex(indexName)
-	c.Assert(err, IsNil)
+	assertNoError(t, err)
 
 	expectedResponse := Response{}
 	expectedResponse.Ok = true
 	expectedResponse.Acknowledged = true
-	c.Assert(resp, DeepEquals, expectedResponse)
+	assertEqual(t, withoutHTTP(resp), expectedResponse)
 }
 
-func (s *GoesTestSuite) TestRefreshIndex(c *C) {
-	conn := NewConnection(ES_HOST, ES_PORT)
+func TestRefreshIndex(t *testing.T) {
+	conn := testConnection(t)
 	indexName := "testrefreshindex"
 
 	_, err := conn.CreateIndex(indexName, map[string]interface{}{})
-	c.Assert(err, IsNil)
+	assertNoError(t, err)
 
 	resp, err := conn.RefreshIndex(indexName)
-	c.Assert(err, IsNil)
-	c.Assert(resp.Ok, Equals, true)
+	assertNoError(t, err)
+	assertEqual(t, resp.Ok, true)
 
 	_, err = conn.DeleteIndex(indexName)
-	c.Assert(err, IsNil)
+	assertNoError(t, err)
 }
 
-func (s *GoesTestSuite) TestBulkSend(c *C) {
+func TestBulkSend(t *testing.T) {
 	indexName := "testbulkadd"
 	docType := "tweet"
 
@@ -212,10 +570,10 @@ func (s *GoesTestSuite) TestBulkSend(c *C) {
 		},
 	}
 
-	conn := NewConnection(ES_HOST, ES_PORT)
+	conn := testConnection(t)
 
 	_, err := conn.CreateIndex(indexName, nil)
-	c.Assert(err, IsNil)
+	assertNoError(t, err)
 
 	response, err := conn.BulkSend(indexName, tweets)
 	i := Item{
@@ -225,11 +583,11 @@ func (s *GoesTestSuite) TestBulkSend(c *C) {
 		Version: 1,
 		Index:   indexName,
 	}
-	c.Assert(response.Items[0][BULK_COMMAND_INDEX], Equals, i)
-	c.Assert(err, IsNil)
+	assertEqual(t, response.Items[0][BULK_COMMAND_INDEX], i)
+	assertNoError(t, err)
 
 	_, err = conn.RefreshIndex(indexName)
-	c.Assert(err, IsNil)
+	assertNoError(t, err)
 
 	var query = map[string]interface{}{
 		"query": map[string]interface{}{
@@ -238,30 +596,30 @@ func (s *GoesTestSuite) TestBulkSend(c *C) {
 	}
 
 	searchResults, err := conn.Search(query, []string{indexName}, []string{})
-	c.Assert(err, IsNil)
+	assertNoError(t, err)
 
 	var expectedTotal uint64 = 2
-	c.Assert(searchResults.Hits.Total, Equals, expectedTotal)
+	assertEqual(t, searchResults.Hits.Total, expectedTotal)
 
 	searchResultsRaw, err := conn.Search(`{"query":{"match_all":{}}}`, []string{indexName}, []string{})
-	c.Assert(err, IsNil)
-	c.Assert(searchResultsRaw.Hits.Total, Equals, expectedTotal)
+	assertNoError(t, err)
+	assertEqual(t, searchResultsRaw.Hits.Total, expectedTotal)
 
 	extraDocId := ""
 	checked := 0
 	for _, hit := range searchResults.Hits.Hits {
 		if hit.Source["user"] == "foo" {
-			c.Assert(hit.Id, Equals, "123")
+			assertEqual(t, hit.Id, "123")
 			checked++
 		}
 
 		if hit.Source["user"] == "bar" {
-			c.Assert(len(hit.Id) > 0, Equals, true)
+			assertEqual(t, len(hit.Id) > 0, true)
 			extraDocId = hit.Id
 			checked++
 		}
 	}
-	c.Assert(checked, Equals, 2)
+	assertEqual(t, checked, 2)
 
 	docToDelete := []Document{
 		Document{
@@ -286,54 +644,54 @@ func (s *GoesTestSuite) TestBulkSend(c *C) {
 		Version: 2,
 		Index:   indexName,
 	}
-	c.Assert(response.Items[0][BULK_COMMAND_DELETE], Equals, i)
+	assertEqual(t, response.Items[0][BULK_COMMAND_DELETE], i)
 
-	c.Assert(err, IsNil)
+	assertNoError(t, err)
 
 	_, err = conn.RefreshIndex(indexName)
-	c.Assert(err, IsNil)
+	assertNoError(t, err)
 
 	searchResults, err = conn.Search(query, []string{indexName}, []string{})
-	c.Assert(err, IsNil)
+	assertNoError(t, err)
 
 	expectedTotal = 0
-	c.Assert(searchResults.Hits.Total, Equals, expectedTotal)
+	assertEqual(t, searchResults.Hits.Total, expectedTotal)
 
 	_, err = conn.DeleteIndex(indexName)
-	c.Assert(err, IsNil)
+	assertNoError(t, err)
 }
 
-func (s *GoesTestSuite) TestStats(c *C) {
-	conn := NewConnection(ES_HOST, ES_PORT)
+func TestStats(t *testing.T) {
+	conn := testConnection(t)
 	indexName := "teststats"
 
 	conn.DeleteIndex(indexName)
 	_, err := conn.CreateIndex(indexName, map[string]interface{}{})
-	c.Assert(err, IsNil)
+	assertNoError(t, err)
 
 	// we must wait for a bit otherwise ES crashes
 	time.Sleep(1 * time.Second)
 
 	response, err := conn.Stats([]string{indexName}, url.Values{})
-	c.Assert(err, IsNil)
+	assertNoError(t, err)
 
-	c.Assert(response.All.Indices[indexName].Primaries["docs"].Count, Equals, 0)
+	assertEqual(t, response.All.Indices[indexName].Primaries["docs"].Count, 0)
 
 	_, err = conn.DeleteIndex(indexName)
-	c.Assert(err, IsNil)
+	assertNoError(t, err)
 }
 
-func (s *GoesTestSuite) TestIndexIdDefined(c *C) {
+func TestIndexIdDefined(t *testing.T) {
 	indexName := "testindexiddefined"
 	docType := "tweet"
 	docId := "1234"
 
-	conn := NewConnection(ES_HOST, ES_PORT)
+	conn := testConnection(t)
 	// just in case
 	conn.DeleteIndex(indexName)
 
 	_, err := conn.CreateIndex(indexName, map[string]interface{}{})
-	c.Assert(err, IsNil)
+	assertNoError(t, err)
 	defer conn.DeleteIndex(indexName)
 
 	d := Document{
@@ -349,7 +707,7 @@ func (s *GoesTestSuite) TestIndexIdDefined(c *C) {
 	extraArgs := make(url.Values, 1)
 	extraArgs.Set("ttl", "86400000")
 	response, err := conn.Index(d, extraArgs)
-	c.Assert(err, IsNil)
+	assertNoError(t, err)
 
 	expectedResponse := Response{
 		Ok:      true,
@@ -359,19 +717,19 @@ func (s *GoesTestSuite) TestIndexIdDefined(c *C) {
 		Version: 1,
 	}
 
-	c.Assert(response, DeepEquals, expectedResponse)
+	assertEqual(t, withoutHTTP(response), expectedResponse)
 }
 
-func (s *GoesTestSuite) TestIndexIdNotDefined(c *C) {
+func TestIndexIdNotDefined(t *testing.T) {
 	indexName := "testindexidnotdefined"
 	docType := "tweet"
 
-	conn := NewConnection(ES_HOST, ES_PORT)
+	conn := testConnection(t)
 	// just in case
 	conn.DeleteIndex(indexName)
 
 	_, err := conn.CreateIndex(indexName, map[string]interface{}{})
-	c.Assert(err, IsNil)
+	assertNoError(t, err)
 	defer conn.DeleteIndex(indexName)
 
 	d := Document{
@@ -384,26 +742,26 @@ func (s *GoesTestSuite) TestIndexIdNotDefined(c *C) {
 	}
 
 	response, err := conn.Index(d, url.Values{})
-	c.Assert(err, IsNil)
+	assertNoError(t, err)
 
-	c.Assert(response.Ok, Equals, true)
-	c.Assert(response.Index, Equals, indexName)
-	c.Assert(response.Type, Equals, docType)
-	c.Assert(response.Version, Equals, 1)
-	c.Assert(response.Id != "", Equals, true)
+	assertEqual(t, response.Ok, true)
+	assertEqual(t, response.Index, indexName)
+	assertEqual(t, response.Type, docType)
+	assertEqual(t, response.Version, 1)
+	assertEqual(t, response.Id != "", true)
 }
 
-func (s *GoesTestSuite) TestDelete(c *C) {
+func TestDelete(t *testing.T) {
 	indexName := "testdelete"
 	docType := "tweet"
 	docId := "1234"
 
-	conn := NewConnection(ES_HOST, ES_PORT)
+	conn := testConnection(t)
 	// just in case
 	conn.DeleteIndex(indexName)
 
 	_, err := conn.CreateIndex(indexName, map[string]interface{}{})
-	c.Assert(err, IsNil)
+	assertNoError(t, err)
 	defer conn.DeleteIndex(indexName)
 
 	d := Document{
@@ -416,38 +774,40 @@ func (s *GoesTestSuite) TestDelete(c *C) {
 	}
 
 	_, err = conn.Index(d, url.Values{})
-	c.Assert(err, IsNil)
+	assertNoError(t, err)
 
 	response, err := conn.Delete(d, url.Values{})
-	c.Assert(err, IsNil)
+	assertNoError(t, err)
 
 	expectedResponse := Response{
-		Ok:    true,
-		Found: true,
-		Index: indexName,
-		Type:  docType,
-		Id:    docId,
+		Ok:     true,
+		Found:  true,
+		Result: RESULT_DELETED,
+		Index:  indexName,
+		Type:   docType,
+		Id:     docId,
 		// XXX : even after a DELETE the version number seems to be incremented
 		Version: 2,
 	}
-	c.Assert(response, DeepEquals, expectedResponse)
+	assertEqual(t, withoutHTTP(response), expectedResponse)
 
 	response, err = conn.Delete(d, url.Values{})
-	c.Assert(err, IsNil)
+	assertNoError(t, err)
 
 	expectedResponse = Response{
-		Ok:    true,
-		Found: false,
-		Index: indexName,
-		Type:  docType,
-		Id:    docId,
+		Ok:     true,
+		Found:  false,
+		Result: RESULT_NOT_FOUND,
+		Index:  indexName,
+		Type:   docType,
+		Id:     docId,
 		// XXX : even after a DELETE the version number seems to be incremented
 		Version: 3,
 	}
-	c.Assert(response, DeepEquals, expectedResponse)
+	assertEqual(t, withoutHTTP(response), expectedResponse)
 }
 
-func (s *GoesTestSuite) TestGet(c *C) {
+func TestGet(t *testing.T) {
 	indexName := "testget"
 	docType := "tweet"
 	docId := "111"
@@ -456,11 +816,11 @@ func (s *GoesTestSuite) TestGet(c *C) {
 		"f2": "foo",
 	}
 
-	conn := NewConnection(ES_HOST, ES_PORT)
+	conn := testConnection(t)
 	conn.DeleteIndex(indexName)
 
 	_, err := conn.CreateIndex(indexName, map[string]interface{}{})
-	c.Assert(err, IsNil)
+	assertNoError(t, err)
 	defer conn.DeleteIndex(indexName)
 
 	d := Document{
@@ -471,28 +831,35 @@ func (s *GoesTestSuite) TestGet(c *C) {
 	}
 
 	_, err = conn.Index(d, url.Values{})
-	c.Assert(err, IsNil)
+	assertNoError(t, err)
 
 	response, err := conn.Get(indexName, docType, docId, url.Values{})
-	c.Assert(err, IsNil)
+	assertNoError(t, err)
+
+	// the _source is sent back as indexed
+	rawSource, err := json.Marshal(source)
+	assertNoError(t, err)
 
 	expectedResponse := Response{
-		Index:   indexName,
-		Type:    docType,
-		Id:      docId,
-		Version: 1,
-		Exists:  true,
-		Source:  source,
+		Ok:        true,
+		Index:     indexName,
+		Type:      docType,
+		Id:        docId,
+		Version:   1,
+		Exists:    true,
+		Source:    source,
+		RawSource: rawSource,
 	}
 
-	c.Assert(response, DeepEquals, expectedResponse)
+	assertEqual(t, withoutHTTP(response), expectedResponse)
 
 	fields := make(url.Values, 1)
 	fields.Set("fields", "f1")
 	response, err = conn.Get(indexName, docType, docId, fields)
-	c.Assert(err, IsNil)
+	assertNoError(t, err)
 
 	expectedResponse = Response{
+		Ok:      true,
 		Index:   indexName,
 		Type:    docType,
 		Id:      docId,
@@ -503,10 +870,10 @@ func (s *GoesTestSuite) TestGet(c *C) {
 		},
 	}
 
-	c.Assert(response, DeepEquals, expectedResponse)
+	assertEqual(t, withoutHTTP(response), expectedResponse)
 }
 
-func (s *GoesTestSuite) TestSearch(c *C) {
+func TestSearch(t *testing.T) {
 	indexName := "testsearch"
 	docType := "tweet"
 	docId := "1234"
@@ -515,11 +882,11 @@ func (s *GoesTestSuite) TestSearch(c *C) {
 		"message": "bar",
 	}
 
-	conn := NewConnection(ES_HOST, ES_PORT)
+	conn := testConnection(t)
 	conn.DeleteIndex(indexName)
 
 	_, err := conn.CreateIndex(indexName, map[string]interface{}{})
-	c.Assert(err, IsNil)
+	assertNoError(t, err)
 	defer conn.DeleteIndex(indexName)
 
 	d := Document{
@@ -530,10 +897,10 @@ func (s *GoesTestSuite) TestSearch(c *C) {
 	}
 
 	_, err = conn.Index(d, url.Values{})
-	c.Assert(err, IsNil)
+	assertNoError(t, err)
 
 	_, err = conn.RefreshIndex(indexName)
-	c.Assert(err, IsNil)
+	assertNoError(t, err)
 
 	// I can feel my eyes bleeding
 	query := map[string]interface{}{
@@ -549,26 +916,32 @@ func (s *GoesTestSuite) TestSearch(c *C) {
 	}
 	response, err := conn.Search(query, []string{indexName}, []string{docType})
 
+	rawSource, err := json.Marshal(source)
+	assertNoError(t, err)
+
 	expectedHits := Hits{
-		Total:    1,
-		MaxScore: 1.0,
+		Total:         1,
+		TotalRelation: TOTAL_EQ,
+		MaxScore:      1.0,
 		Hits: []Hit{
 			Hit{
-				Index:  indexName,
-				Type:   docType,
-				Id:     docId,
-				Score:  1.0,
-				Source: source,
+				Index:     indexName,
+				Type:      docType,
+				Id:        docId,
+				Score:     1.0,
+				Source:    source,
+				RawSource: rawSource,
 			},
 		},
 	}
 
-	c.Assert(response.Hits, DeepEquals, expectedHits)
+	assertEqual(t, response.Hits, expectedHits)
 }
 
-func (s *GoesTestSuite) TestIndexStatus(c *C) {
+func TestIndexStatus(t *testing.T) {
 	indexName := "testindexstatus"
-	conn := NewConnection(ES_HOST, ES_PORT)
+	conn := testConnection(t)
+	SkipUnlessSupported(t, conn, FEATURE_STATUS_API)
 	conn.DeleteIndex(indexName)
 
 	mapping := map[string]interface{}{
@@ -579,19 +952,19 @@ func (s *GoesTestSuite) TestIndexStatus(c *C) {
 	}
 
 	_, err := conn.CreateIndex(indexName, mapping)
-	c.Assert(err, IsNil)
+	assertNoError(t, err)
 	defer conn.DeleteIndex(indexName)
 
 	// gives ES some time to do its job
 	time.Sleep(1 * time.Second)
 
 	response, err := conn.IndexStatus([]string{"_all"})
-	c.Assert(err, IsNil)
+	assertNoError(t, err)
 
-	c.Assert(response.Ok, Equals, true)
+	assertEqual(t, response.Ok, true)
 
 	expectedShards := Shard{Total: 2, Successful: 1, Failed: 0}
-	c.Assert(response.Shards, Equals, expectedShards)
+	assertEqual(t, response.Shards, expectedShards)
 
 	expectedIndices := map[string]IndexStatus{
 		indexName: IndexStatus{
@@ -634,5 +1007,5906 @@ func (s *GoesTestSuite) TestIndexStatus(c *C) {
 		},
 	}
 
-	c.Assert(response.Indices, DeepEquals, expectedIndices)
+	assertEqual(t, response.Indices, expectedIndices)
+}
+
+func TestMoreLikeThis(t *testing.T) {
+	indexName := "testmorelikethis"
+	docType := "tweet"
+
+	conn := testConnection(t)
+	SkipUnlessSupported(t, conn, FEATURE_MORE_LIKE_THIS_API)
+	conn.DeleteIndex(indexName)
+
+	_, err := conn.CreateIndex(indexName, map[string]interface{}{})
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	docs := map[string]string{
+		"1": "elasticsearch is a search engine",
+		"2": "elasticsearch is a distributed search engine",
+		"3": "gophers like to dig holes",
+	}
+
+	for id, message := range docs {
+		d := Document{
+			Index: indexName,
+			Type:  docType,
+			Id:    id,
+			Fields: map[string]interface{}{
+				"message": message,
+			},
+		}
+
+		_, err = conn.Index(d, url.Values{})
+		assertNoError(t, err)
+	}
+
+	_, err = conn.RefreshIndex(indexName)
+	assertNoError(t, err)
+
+	params := url.Values{}
+	params.Set("mlt_fields", "message")
+	params.Set("min_term_freq", "1")
+	params.Set("min_doc_freq", "1")
+
+	response, err := conn.MoreLikeThis(indexName, docType, "1", params)
+	assertNoError(t, err)
+
+	var expectedTotal uint64 = 1
+	assertEqual(t, response.Hits.Total, expectedTotal)
+	assertEqual(t, response.Hits.Hits[0].Id, "2")
+}
+
+func TestStatusErrorPolicy(t *testing.T) {
+	p := &StatusErrorPolicy{
+		Retryable:         []uint64{503},
+		Ignored:           []uint64{404},
+		IgnoredExceptions: []string{"VersionConflictEngineException"},
+	}
+
+	assertEqual(t, p.Classify(503, "UnavailableShardsException[[i][0] timeout]"), ERROR_RETRYABLE)
+	assertEqual(t, p.Classify(404, "IndexMissingException[[i] missing]"), ERROR_IGNORED)
+	assertEqual(t, p.Classify(409, "VersionConflictEngineException[[i][0] [t][1]: version conflict]"), ERROR_IGNORED)
+	assertEqual(t, p.Classify(400, "SearchPhaseExecutionException[failed]"), ERROR_FATAL)
+
+	assertEqual(t, DefaultErrorPolicy.Classify(404, "IndexMissingException[[i] missing]"), ERROR_FATAL)
+}
+
+func TestRetryBackoff(t *testing.T) {
+	conn := NewConnection(ES_HOST, ES_PORT)
+	assertEqual(t, conn.retryBackoff(0), 100*time.Millisecond)
+	assertEqual(t, conn.retryBackoff(2), 400*time.Millisecond)
+	assertEqual(t, conn.retryBackoff(10), 5*time.Second)
+
+	conn.RetryBackoff = time.Second
+	conn.MaxRetryBackoff = 3 * time.Second
+	assertEqual(t, conn.retryBackoff(1), 2*time.Second)
+	assertEqual(t, conn.retryBackoff(2), 3*time.Second)
+	assertEqual(t, conn.retryBackoff(100), 3*time.Second)
+
+	requests := []time.Time{}
+	conn = fakeConnection(t, "7.10.2", func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, time.Now())
+		w.WriteHeader(503)
+		io.WriteString(w, `{"error":{"type":"unavailable_shards_exception","reason":"timeout"},"status":503}`)
+	})
+	conn.ErrorPolicy = &StatusErrorPolicy{Retryable: []uint64{503}}
+	conn.MaxRetries = 2
+	conn.RetryBackoff = 20 * time.Millisecond
+	conn.MaxRetryBackoff = 30 * time.Millisecond
+
+	_, err := conn.Search(map[string]interface{}{}, []string{"i"}, []string{})
+	assertError(t, err)
+	assertEqual(t, len(requests), 3)
+	assertEqual(t, requests[1].Sub(requests[0]) >= 20*time.Millisecond, true)
+	assertEqual(t, requests[2].Sub(requests[1]) >= 30*time.Millisecond, true)
+
+	// the wait stops with the context of the request
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	conn.RetryBackoff = time.Minute
+	requests = requests[:0]
+
+	_, err = conn.SearchContext(ctx, map[string]interface{}{}, []string{"i"}, []string{})
+	assertError(t, err)
+	assertEqual(t, len(requests), 1)
+}
+
+func TestErrorPolicyIgnored(t *testing.T) {
+	conn := testConnection(t)
+	conn.ErrorPolicy = &StatusErrorPolicy{Ignored: []uint64{404}}
+
+	resp, err := conn.DeleteIndex("foobar")
+	assertNoError(t, err)
+	assertEqual(t, resp, Response{})
+}
+
+func TestElasticError(t *testing.T) {
+	indexName := "testelasticerror"
+
+	conn := testConnection(t)
+	conn.DeleteIndex(indexName)
+
+	_, err := conn.Get(indexName, "tweet", "1", url.Values{})
+	var elasticErr *ElasticError
+	assertEqual(t, errors.As(err, &elasticErr), true)
+	assertEqual(t, elasticErr.HTTPStatus, 404)
+	assertEqual(t, elasticErr.Index, indexName)
+}
+
+func TestElasticErrorRequests(t *testing.T) {
+	responses := []string{
+		`{"error":"IndexMissingException[[i] missing]","status":404}`,
+		`{"error":{"root_cause":[{"type":"index_not_found_exception","reason":"no such index","index":"i"}],` +
+			`"type":"index_not_found_exception","reason":"no such index","index":"i"},"status":404}`,
+		`{"error":"RemoteTransportException[[node][inet[/10.0.0.1:9300]][indices:data/write/index]]; nested: MapperParsingException[failed to parse [age]]; nested: NumberFormatException[For input string: \"x\"]; ","status":400}`,
+		`{"error":{"type":"mapper_parsing_exception","reason":"failed to parse [age]","caused_by":{"type":"number_format_exception","reason":"For input string: \"x\""}},"status":400}`,
+		`<html>Bad Gateway</html>`,
+	}
+
+	conn := fakeConnection(t, "5.6.16", func(w http.ResponseWriter, r *http.Request) {
+		response := responses[0]
+		responses = responses[1:]
+
+		if strings.HasPrefix(response, "<html>") {
+			w.WriteHeader(502)
+		} else if strings.Contains(response, `"status":404`) {
+			w.WriteHeader(404)
+		} else {
+			w.WriteHeader(400)
+		}
+		fmt.Fprint(w, response)
+	})
+
+	_, err := conn.Get("i", "t", "1", url.Values{})
+	var elasticErr *ElasticError
+	assertEqual(t, errors.As(err, &elasticErr), true)
+	assertEqual(t, elasticErr, &ElasticError{
+		HTTPStatus: 404,
+		Msg:        "IndexMissingException[[i] missing]",
+		ErrorType:  "IndexMissingException",
+		Reason:     "[i] missing",
+		Index:      "i",
+	})
+	assertEqual(t, err.Error(), "[404] IndexMissingException[[i] missing]")
+
+	_, err = conn.Get("i", "t", "1", url.Values{})
+	assertEqual(t, errors.As(err, &elasticErr), true)
+	assertEqual(t, elasticErr.HTTPStatus, 404)
+	assertEqual(t, elasticErr.ErrorType, "index_not_found_exception")
+	assertEqual(t, elasticErr.Reason, "no such index")
+	assertEqual(t, elasticErr.Index, "i")
+
+	_, err = conn.Index(Document{Index: "i", Type: "t", Fields: map[string]interface{}{"age": "x"}}, url.Values{})
+	assertEqual(t, errors.As(err, &elasticErr), true)
+	assertEqual(t, elasticErr.ErrorType, "RemoteTransportException")
+	assertEqual(t, elasticErr.CausedBy.ErrorType, "MapperParsingException")
+	assertEqual(t, elasticErr.CausedBy.Reason, "failed to parse [age]")
+	assertEqual(t, elasticErr.CausedBy.CausedBy.ErrorType, "NumberFormatException")
+	assertEqual(t, elasticErr.CausedBy.CausedBy.CausedBy, (*ElasticError)(nil))
+
+	_, err = conn.Index(Document{Index: "i", Type: "t", Fields: map[string]interface{}{"age": "x"}}, url.Values{})
+	assertEqual(t, errors.As(err, &elasticErr), true)
+	assertEqual(t, elasticErr.ErrorType, "mapper_parsing_exception")
+	assertEqual(t, elasticErr.CausedBy, &ElasticError{ErrorType: "number_format_exception", Reason: `For input string: "x"`})
+
+	_, err = conn.Search(map[string]interface{}{}, []string{"i"}, []string{})
+	assertEqual(t, errors.As(err, &elasticErr), true)
+	assertEqual(t, elasticErr, &ElasticError{HTTPStatus: 502, Msg: "<html>Bad Gateway</html>"})
+
+	// the errors are still SearchErrors
+	searchErr, ok := err.(*SearchError)
+	assertEqual(t, ok, true)
+	assertEqual(t, searchErr.Msg, "<html>Bad Gateway</html>")
+	assertEqual(t, searchErr.StatusCode, uint64(502))
+}
+
+func TestSentinelErrors(t *testing.T) {
+	for status, sentinel := range map[uint64]error{
+		404: ErrNotFound,
+		409: ErrConflict,
+		408: ErrTimeout,
+		504: ErrTimeout,
+		429: ErrTooManyRequests,
+	} {
+		err := newSearchError(int(status), "")
+		assertEqual(t, errors.Is(err, sentinel), true)
+		assertEqual(t, errors.Is(&SearchError{StatusCode: status}, sentinel), true)
+
+		for _, other := range []error{ErrNotFound, ErrConflict, ErrTimeout, ErrTooManyRequests} {
+			if other != sentinel {
+				assertEqual(t, errors.Is(err, other), false)
+			}
+		}
+	}
+
+	assertEqual(t, errors.Is(&SearchError{StatusCode: 500}, ErrNotFound), false)
+
+	conflict := &VersionConflictError{ElasticError: &ElasticError{HTTPStatus: 409}}
+	assertEqual(t, errors.Is(conflict, ErrConflict), true)
+	assertEqual(t, errors.Is(fmt.Errorf("indexing: %w", conflict), ErrConflict), true)
+}
+
+func TestSentinelErrorsRequests(t *testing.T) {
+	conn := fakeConnection(t, "5.6.16", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+		fmt.Fprint(w, `{"error":{"type":"index_not_found_exception","reason":"no such index","index":"i"},"status":404}`)
+	})
+
+	_, err := conn.Get("i", "t", "1", url.Values{})
+	assertEqual(t, errors.Is(err, ErrNotFound), true)
+}
+
+func TestSearchContext(t *testing.T) {
+	indexName := "testsearchcontext"
+
+	conn := testConnection(t)
+	conn.CancelTasks = true
+	conn.DeleteIndex(indexName)
+
+	_, err := conn.CreateIndex(indexName, map[string]interface{}{})
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	query := map[string]interface{}{
+		"query": map[string]interface{}{
+			"match_all": map[string]interface{}{},
+		},
+	}
+
+	response, err := conn.SearchContext(context.Background(), query, []string{indexName}, []string{})
+	assertNoError(t, err)
+	assertEqual(t, response.Hits.Total, uint64(0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = conn.SearchContext(ctx, query, []string{indexName}, []string{})
+	assertError(t, err)
+}
+
+func TestSearchContextCancelTasks(t *testing.T) {
+	var lock sync.Mutex
+	requests := []string{}
+	opaqueId := ""
+	started := make(chan struct{})
+	cancelled := make(chan string, 1)
+
+	conn := fakeConnection(t, "7.10.2", func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery)
+		lock.Unlock()
+
+		switch r.URL.Path {
+		case "/i/_search":
+			// the disconnection of the client is noticed once the body is read
+			io.ReadAll(r.Body)
+
+			lock.Lock()
+			opaqueId = r.Header.Get("X-Opaque-Id")
+			lock.Unlock()
+
+			// never answers, the client gives up
+			close(started)
+			<-r.Context().Done()
+		case "/_tasks":
+			lock.Lock()
+			id := opaqueId
+			lock.Unlock()
+
+			fmt.Fprintf(w, `{"nodes":{"n1":{"name":"n1","tasks":{`+
+				`"n1:1":{"node":"n1","id":1,"action":"indices:data/read/search","cancellable":true,"headers":{"X-Opaque-Id":%q}},`+
+				`"n1:2":{"node":"n1","id":2,"action":"indices:data/read/search","cancellable":true,"headers":{"X-Opaque-Id":"other"}},`+
+				`"n1:3":{"node":"n1","id":3,"action":"indices:data/read/search[phase/query]","cancellable":false,"headers":{"X-Opaque-Id":%q}}}}}}`,
+				id, id)
+		default:
+			io.WriteString(w, `{}`)
+			cancelled <- r.Method + " " + r.URL.Path
+		}
+	})
+	conn.CancelTasks = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	_, err := conn.SearchContext(ctx, nil, []string{"i"}, []string{})
+	assertEqual(t, errors.Is(err, context.Canceled), true)
+
+	select {
+	case request := <-cancelled:
+		assertEqual(t, request, "POST /_tasks/n1:1/_cancel")
+	case <-time.After(5 * time.Second):
+		t.Fatal("the search task was not cancelled")
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	assertEqual(t, opaqueId != "", true)
+	assertEqual(t, requests[1:], []string{"GET /_tasks?actions=%2Asearch&detailed=true", "POST /_tasks/n1:1/_cancel?"})
+}
+
+func TestSearchContextOpaqueId(t *testing.T) {
+	server, conn := newFakeServer(t, "6.1.4")
+	conn.CancelTasks = true
+
+	_, err := conn.SearchContext(context.Background(), nil, []string{"i"}, []string{})
+	assertEqual(t, errors.Is(err, ErrUnsupported), true)
+	assertEqual(t, err.Error(), "opaque_id is not supported by elasticsearch 6.1.4")
+	assertEqual(t, server.requests(), []string{})
+}
+
+func TestSearchContextVersion(t *testing.T) {
+	server, conn := newFakeServer(t, "")
+	conn.CancelTasks = true
+
+	// the version is fetched with the context of the search
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := conn.SearchContext(ctx, nil, []string{"i"}, []string{})
+	assertEqual(t, errors.Is(err, context.Canceled), true)
+	assertEqual(t, server.requests(), []string{})
+}
+
+func TestTermVectors(t *testing.T) {
+	indexName := "testtermvectors"
+	docType := "tweet"
+
+	conn := testConnection(t)
+	SkipUnlessSupported(t, conn, FEATURE_TERM_VECTORS)
+	conn.DeleteIndex(indexName)
+
+	_, err := conn.CreateIndex(indexName, map[string]interface{}{})
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	for _, id := range []string{"1", "2"} {
+		d := Document{
+			Index: indexName,
+			Type:  docType,
+			Id:    id,
+			Fields: map[string]interface{}{
+				"message": "foo bar foo",
+			},
+		}
+
+		_, err = conn.Index(d, url.Values{})
+		assertNoError(t, err)
+	}
+
+	_, err = conn.RefreshIndex(indexName)
+	assertNoError(t, err)
+
+	extraArgs := url.Values{}
+	extraArgs.Set("term_statistics", "true")
+
+	response, err := conn.TermVectors(indexName, docType, "1", extraArgs)
+	assertNoError(t, err)
+
+	foo := response.TermVectors["message"].Terms["foo"]
+	assertEqual(t, foo.TermFreq, uint64(2))
+	assertEqual(t, foo.DocFreq, uint64(2))
+	assertEqual(t, foo.Ttf, uint64(4))
+	assertEqual(t, len(foo.Tokens), 2)
+	assertEqual(t, foo.Tokens[1].Position, 2)
+	assertEqual(t, foo.Tokens[1].StartOffset, 8)
+	assertEqual(t, foo.Tokens[1].EndOffset, 11)
+
+	response, err = conn.MultiTermVectors(indexName, docType, []string{"1", "2"}, extraArgs)
+	assertNoError(t, err)
+
+	assertEqual(t, len(response.Docs), 2)
+	for _, doc := range response.Docs {
+		assertEqual(t, doc.TermVectors["message"].Terms["bar"].TermFreq, uint64(1))
+	}
+}
+
+func TestTermVectorsRequests(t *testing.T) {
+	for version, api := range map[string]string{
+		"1.7.5":  "_termvector",
+		"7.10.2": "_termvectors",
+	} {
+		t.Run(version, func(t *testing.T) {
+			server, conn := newFakeServer(t, version)
+			server.answer(200, `{"docs":[]}`)
+
+			_, err := conn.TermVectors("i", "t", "1", url.Values{})
+			assertNoError(t, err)
+			_, err = conn.MultiTermVectors("i", "t", []string{"1", "2"}, url.Values{})
+			assertNoError(t, err)
+
+			// the multi term vectors API was always plural
+			assertEqual(t, server.requests(), []string{
+				"GET /i/t/1/" + api + " null",
+				`POST /i/t/_mtermvectors {"ids":["1","2"]}`,
+			})
+		})
+	}
+}
+
+func TestSourceFilterValues(t *testing.T) {
+	extraArgs := url.Values{}
+	extraArgs.Set("routing", "1")
+
+	conn := &Connection{Version: "1.7.5"}
+
+	f := SourceFilter{Includes: []string{"user", "obj.*"}, Excludes: []string{"obj.big"}}
+	v := f.values(conn, extraArgs)
+	assertEqual(t, v.Encode(), "_source_exclude=obj.big&_source_include=user%2Cobj.%2A&routing=1")
+	assertEqual(t, len(extraArgs), 1)
+
+	v = f.values(&Connection{Version: "7.10.2"}, extraArgs)
+	assertEqual(t, v.Encode(), "_source_excludes=obj.big&_source_includes=user%2Cobj.%2A&routing=1")
+
+	f = SourceFilter{Disabled: true, Includes: []string{"user"}}
+	assertEqual(t, f.values(conn, nil).Encode(), "_source=false")
+
+	assertEqual(t, SourceFilter{}.values(conn, nil).Encode(), "")
+}
+
+func TestSourceFilterRequests(t *testing.T) {
+	status := 200
+
+	conn := fakeConnection(t, "7.10.2", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		if status != 200 {
+			io.WriteString(w, `{"error":{"type":"index_not_found_exception","reason":"no such index [i]"},"status":404}`)
+			return
+		}
+		io.WriteString(w, `{"_index":"i","_id":"1","found":true,"hits":{"total":{"value":0,"relation":"eq"},"hits":[]},"docs":[{"_index":"i","_id":"1","found":true}]}`)
+	})
+
+	disabled := SourceFilter{Disabled: true}
+
+	response, err := conn.GetWithSourceFilter("i", "_doc", "1", disabled, url.Values{})
+	assertNoError(t, err)
+	assertEqual(t, response.SourceExcluded, true)
+	response, err = conn.SearchWithSourceFilter(nil, []string{"i"}, []string{}, disabled)
+	assertNoError(t, err)
+	assertEqual(t, response.SourceExcluded, true)
+	response, err = conn.MultiGet([]Document{{Index: "i", Id: "1"}}, disabled, url.Values{})
+	assertNoError(t, err)
+	assertEqual(t, response.SourceExcluded, true)
+	assertEqual(t, response.Docs[0].SourceExcluded, true)
+
+	// nothing was excluded from a failed request
+	status = 404
+	response, err = conn.GetWithSourceFilter("i", "_doc", "1", disabled, url.Values{})
+	assertError(t, err)
+	assertEqual(t, response.SourceExcluded, false)
+	response, err = conn.SearchWithSourceFilter(nil, []string{"i"}, []string{}, disabled)
+	assertError(t, err)
+	assertEqual(t, response.SourceExcluded, false)
+	response, err = conn.MultiGet([]Document{{Index: "i", Id: "1"}}, disabled, url.Values{})
+	assertError(t, err)
+	assertEqual(t, response.SourceExcluded, false)
+}
+
+func TestSourceFilterArguments(t *testing.T) {
+	filter := SourceFilter{Includes: []string{"user"}, Excludes: []string{"obj.*"}}
+
+	for version, args := range map[string]string{
+		"1.7.5":  "_source_exclude=obj.%2A&_source_include=user",
+		"6.8.23": "_source_excludes=obj.%2A&_source_includes=user",
+		"7.10.2": "_source_excludes=obj.%2A&_source_includes=user",
+	} {
+		t.Run(version, func(t *testing.T) {
+			server, conn := newFakeServer(t, version)
+			server.answer(200, `{"_index":"i","_id":"1","found":true}`)
+
+			_, err := conn.GetWithSourceFilter("i", "t", "1", filter, url.Values{})
+			assertNoError(t, err)
+			_, err = conn.SearchWithSourceFilter(nil, []string{"i"}, []string{}, filter)
+			assertNoError(t, err)
+
+			assertEqual(t, server.requests(), []string{
+				"GET /i/t/1?" + args + " null",
+				"POST /i/_search?" + args + " null",
+			})
+		})
+	}
+}
+
+func TestMultiGetSourceFilter(t *testing.T) {
+	filter := SourceFilter{Includes: []string{"user"}, Excludes: []string{"obj.*"}}
+
+	for version, args := range map[string]string{
+		"1.7.5":  "_source_exclude=obj.%2A&_source_include=user",
+		"7.10.2": "_source_excludes=obj.%2A&_source_includes=user",
+	} {
+		t.Run(version, func(t *testing.T) {
+			server, conn := newFakeServer(t, version)
+			server.answer(200, `{"docs":[{"_index":"i","_id":"1","found":true,"_source":{"user":"foo"}}]}`)
+
+			response, err := conn.MultiGet([]Document{{Index: "i", Type: "t", Id: "1"}}, filter, url.Values{})
+			assertNoError(t, err)
+			assertEqual(t, len(response.Docs), 1)
+			assertEqual(t, response.Docs[0].SourceExcluded, false)
+
+			assertEqual(t, server.requests(), []string{
+				`POST /_mget?` + args + ` {"docs":[{"_id":"1","_index":"i","_type":"t"}]}`,
+			})
+		})
+	}
+}
+
+func TestGetWithSourceFilter(t *testing.T) {
+	indexName := "testgetwithsourcefilter"
+	docType := "tweet"
+	docId := "1"
+
+	conn := testConnection(t)
+	SkipUnlessSupported(t, conn, FEATURE_SOURCE_FILTERING)
+	conn.DeleteIndex(indexName)
+
+	_, err := conn.CreateIndex(indexName, map[string]interface{}{})
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	d := Document{
+		Index: indexName,
+		Type:  docType,
+		Id:    docId,
+		Fields: map[string]interface{}{
+			"user":    "foo",
+			"message": "bar",
+		},
+	}
+
+	_, err = conn.Index(d, url.Values{})
+	assertNoError(t, err)
+
+	response, err := conn.GetWithSourceFilter(indexName, docType, docId, SourceFilter{Includes: []string{"user"}}, url.Values{})
+	assertNoError(t, err)
+	assertEqual(t, response.Source, map[string]interface{}{"user": "foo"})
+	assertEqual(t, response.SourceExcluded, false)
+
+	response, err = conn.GetWithSourceFilter(indexName, docType, docId, SourceFilter{Disabled: true}, url.Values{})
+	assertNoError(t, err)
+	assertEqual(t, response.Source, map[string]interface{}(nil))
+	assertEqual(t, response.SourceExcluded, true)
+
+	_, err = conn.RefreshIndex(indexName)
+	assertNoError(t, err)
+
+	query := map[string]interface{}{
+		"query": map[string]interface{}{
+			"match_all": map[string]interface{}{},
+		},
+	}
+
+	response, err = conn.SearchWithSourceFilter(query, []string{indexName}, []string{docType}, SourceFilter{Excludes: []string{"user"}})
+	assertNoError(t, err)
+	assertEqual(t, response.Hits.Hits[0].Source, map[string]interface{}{"message": "bar"})
+}
+
+// responseCorpus loads the responses found in testdata/responses, the HTTP
+// status is the last part of each file name: <version>-<api>-<status>.json
+func responseCorpus(t testing.TB) map[string]int {
+	files, err := filepath.Glob(filepath.Join("testdata", "responses", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	corpus := make(map[string]int, len(files))
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".json")
+		status, err := strconv.Atoi(name[strings.LastIndex(name, "-")+1:])
+		if err != nil {
+			t.Fatalf("%s: %s", file, err)
+		}
+		corpus[file] = status
+	}
+
+	return corpus
+}
+
+func TestDecodeResponseCorpus(t *testing.T) {
+	for file, status := range responseCorpus(t) {
+		body, err := os.ReadFile(file)
+		assertNoError(t, err)
+
+		response, err := decodeResponse(status, body)
+		if status >= 400 {
+			if err == nil {
+				t.Errorf("%s: expected an error", file)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %s", file, err)
+			continue
+		}
+
+		expected, ok := corpusResponses[filepath.Base(file)]
+		if !ok {
+			t.Errorf("%s: no expected response", file)
+			continue
+		}
+
+		actual := corpusResponse{response.Took, response.Hits.Total, response.Hits.TotalRelation, response.Shards.Total, response.Shards.Successful}
+		if actual != expected {
+			t.Errorf("%s: obtained %+v, expected %+v", file, actual, expected)
+		}
+	}
+}
+
+// corpusResponse is the part of a 2xx corpus response checked once decoded
+type corpusResponse struct {
+	Took             uint64
+	Total            uint64
+	TotalRelation    string
+	Shards           uint64
+	SuccessfulShards uint64
+}
+
+var corpusResponses = map[string]corpusResponse{
+	"0.90-bulk-200.json":        {Took: 7},
+	"0.90-search-200.json":      {3, 1, TOTAL_EQ, 5, 5},
+	"0.90-stats-200.json":       {Shards: 10, SuccessfulShards: 5},
+	"1.7-bulk-200.json":         {Took: 30},
+	"1.7-search-200.json":       {2, 2, TOTAL_EQ, 5, 5},
+	"1.7-stats-200.json":        {Shards: 10, SuccessfulShards: 5},
+	"5.6-bulk-200.json":         {Took: 12},
+	"6.8-search-200.json":       {1, 1, TOTAL_EQ, 5, 4},
+	"7.10-search-200.json":      {5, 10000, TOTAL_GTE, 1, 1},
+	"regression-empty-200.json": {},
+	"regression-null-200.json":  {},
+}
+
+func FuzzDecodeResponse(f *testing.F) {
+	for file, status := range responseCorpus(f) {
+		body, err := os.ReadFile(file)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(status, body)
+	}
+
+	f.Fuzz(func(t *testing.T, status int, body []byte) {
+		_, err := decodeResponse(status, body)
+		if err == nil && len(bytes.TrimSpace(body)) > 0 && !json.Valid(body) {
+			t.Errorf("invalid JSON decoded without error: %q", body)
+		}
+	})
+}
+
+func TestStrictDecodingRequests(t *testing.T) {
+	response := ""
+
+	conn := fakeConnection(t, "7.10.2", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, response)
+	})
+
+	d := Document{Index: "i", Type: "_doc", Id: "1", Fields: map[string]interface{}{"user": "foo"}}
+	response = `{"_index":"i","_type":"_doc","_id":"1","_version":1,"result":"created","_seq_no":0,"_primary_term":1}`
+
+	_, err := conn.Index(d, url.Values{})
+	assertNoError(t, err)
+
+	conn.StrictDecoding = true
+	indexed, err := conn.Index(d, url.Values{})
+	assertNoError(t, err)
+	assertEqual(t, indexed.SeqNo, int64(0))
+	assertEqual(t, indexed.PrimaryTerm, int64(1))
+
+	response = `{"_index":"i","_type":"_doc","_id":"1","_version":1,"_seq_no":3,"_primary_term":1,"found":true,"_source":{"user":"foo"}}`
+	fetched, err := conn.Get("i", "_doc", "1", url.Values{})
+	assertNoError(t, err)
+	assertEqual(t, fetched.SeqNo, int64(3))
+
+	// the responses of RunRaw are decoded strictly too
+	response = `{"tasks":[{"insert_order":1,"priority":"URGENT","source":"create-index [i]","executing":true,"time_in_queue_millis":5,"time_in_queue":"5ms"}]}`
+	_, err = conn.PendingTasks()
+	assertNoError(t, err)
+
+	response = `{"tasks":[{"insert_order":1,"priority":"URGENT","source":"create-index [i]","queued_by":"node"}]}`
+	_, err = conn.PendingTasks()
+	assertEqual(t, err.Error(), `strict decoding: json: unknown field "queued_by"`)
+
+	response = `{"acknowledged":true,"shards_acknowledged":true,"old_index":"i-1","new_index":"i-2","rolled_over":true,"dry_run":false,"conditions":{}}`
+	_, err = conn.Rollover("i", nil, nil)
+	assertNoError(t, err)
+
+	response = `{"took":1,"timed_out":false,"_shards":{"total":1,"successful":1,"skipped":0,"failed":0},` +
+		`"hits":{"total":1,"max_score":1,"hits":[{"_index":"i","_type":"_doc","_id":"1","_score":1,"_source":{"user":"foo"}}]}}`
+	_, err = conn.Search(map[string]interface{}{}, []string{"i"}, []string{})
+	assertNoError(t, err)
+
+	response = `{"took":1,"timed_out":false,"hits":{"total":1,"hits":[{"_index":"i","_id":"1","_ignored":["user"]}]}}`
+	_, err = conn.Search(map[string]interface{}{}, []string{"i"}, []string{})
+	assertEqual(t, err.Error(), `strict decoding: json: unknown field "_ignored"`)
+}
+
+func TestDeprecationHookRequests(t *testing.T) {
+	conn := fakeConnection(t, "7.10.2", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/i/tweet/_search" {
+			w.Header().Add("Warning", `299 Elasticsearch-7.10.2-747e1cc "[types removal] Specifying types in search requests is deprecated." "Mon, 01 Feb 2021 10:00:00 GMT"`)
+			w.Header().Add("Warning", `299 Elasticsearch-7.10.2-747e1cc "Deprecated field [\"inline\"] used, expected [source] instead"`)
+		}
+		fmt.Fprint(w, `{"hits":{"total":0,"hits":[]}}`)
+	})
+
+	deprecations := []Deprecation{}
+	conn.DeprecationHook = func(d []Deprecation) {
+		deprecations = append(deprecations, d...)
+	}
+
+	_, err := conn.Search(map[string]interface{}{}, []string{"i"}, []string{})
+	assertNoError(t, err)
+	assertEqual(t, deprecations, []Deprecation{})
+
+	_, err = conn.Search(map[string]interface{}{}, []string{"i"}, []string{"tweet"})
+	assertNoError(t, err)
+	assertEqual(t, len(deprecations), 2)
+	assertEqual(t, deprecations[0].Method, "POST")
+	assertEqual(t, strings.HasSuffix(deprecations[0].Url, "/i/tweet/_search"), true)
+	assertEqual(t, deprecations[0].Message, "[types removal] Specifying types in search requests is deprecated.")
+	assertEqual(t, deprecations[1].Message, `Deprecated field ["inline"] used, expected [source] instead`)
+
+	assertEqual(t, warningText("not quoted"), "not quoted")
+}
+
+func TestResponseHeaderRequests(t *testing.T) {
+	conn := fakeConnection(t, "7.10.2", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		if r.Method == "PUT" {
+			w.WriteHeader(201)
+			fmt.Fprint(w, `{"_index":"i","_type":"_doc","_id":"1","_version":1,"result":"created"}`)
+			return
+		}
+		fmt.Fprint(w, `{"hits":{"total":0,"hits":[]}}`)
+	})
+
+	response, err := conn.Index(Document{Index: "i", Type: "_doc", Id: "1", Fields: map[string]interface{}{"user": "foo"}}, url.Values{})
+	assertNoError(t, err)
+	assertEqual(t, response.StatusCode, 201)
+	assertEqual(t, response.Header.Get("X-Elastic-Product"), "Elasticsearch")
+
+	response, err = conn.Search(map[string]interface{}{}, []string{"i"}, []string{})
+	assertNoError(t, err)
+	assertEqual(t, response.StatusCode, 200)
+	assertEqual(t, response.Header.Get("Content-Type"), "text/plain; charset=utf-8")
+}
+
+func TestSearchWithType(t *testing.T) {
+	indexName := "testsearchwithtype"
+	docType := "tweet"
+
+	conn := testConnection(t)
+	SkipUnlessSupported(t, conn, FEATURE_SEARCH_TYPE_SCAN)
+	SkipUnlessSupported(t, conn, FEATURE_SEARCH_TYPE_COUNT)
+	conn.DeleteIndex(indexName)
+
+	_, err := conn.CreateIndex(indexName, map[string]interface{}{})
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	for _, id := range []string{"1", "2"} {
+		d := Document{
+			Index: indexName,
+			Type:  docType,
+			Id:    id,
+			Fields: map[string]interface{}{
+				"user": "foo",
+			},
+		}
+
+		_, err = conn.Index(d, url.Values{})
+		assertNoError(t, err)
+	}
+
+	_, err = conn.RefreshIndex(indexName)
+	assertNoError(t, err)
+
+	query := map[string]interface{}{
+		"query": map[string]interface{}{
+			"match_all": map[string]interface{}{},
+		},
+	}
+
+	_, err = conn.SearchWithType(query, []string{indexName}, []string{docType}, SEARCH_TYPE_SCAN, url.Values{})
+	assertError(t, err)
+
+	extraArgs := url.Values{}
+	extraArgs.Set("scroll", "1m")
+
+	response, err := conn.SearchWithType(query, []string{indexName}, []string{docType}, SEARCH_TYPE_SCAN, extraArgs)
+	assertNoError(t, err)
+	assertEqual(t, response.Hits.Total, uint64(2))
+	assertEqual(t, len(response.Hits.Hits), 0)
+	assertEqual(t, response.ScrollId != "", true)
+	assertEqual(t, extraArgs.Get("search_type"), "")
+
+	response, err = conn.SearchWithType(query, []string{indexName}, []string{docType}, SEARCH_TYPE_COUNT, url.Values{})
+	assertNoError(t, err)
+	assertEqual(t, response.Hits.Total, uint64(2))
+	assertEqual(t, len(response.Hits.Hits), 0)
+
+	response, err = conn.SearchWithType(query, []string{indexName}, []string{docType}, SEARCH_TYPE_DFS_QUERY_THEN_FETCH, url.Values{})
+	assertNoError(t, err)
+	assertEqual(t, len(response.Hits.Hits), 2)
+}
+
+func TestSearchHighlight(t *testing.T) {
+	indexName := "testsearchhighlight"
+	docType := "tweet"
+
+	conn := testConnection(t)
+	conn.DeleteIndex(indexName)
+
+	_, err := conn.CreateIndex(indexName, map[string]interface{}{})
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	d := Document{
+		Index: indexName,
+		Type:  docType,
+		Id:    "1",
+		Fields: map[string]interface{}{
+			"message": "some foo message",
+		},
+	}
+
+	_, err = conn.Index(d, url.Values{})
+	assertNoError(t, err)
+
+	_, err = conn.RefreshIndex(indexName)
+	assertNoError(t, err)
+
+	query := map[string]interface{}{
+		"query": map[string]interface{}{
+			"match": map[string]interface{}{
+				"message": "foo",
+			},
+		},
+		"highlight": map[string]interface{}{
+			"fields": map[string]interface{}{
+				"message": map[string]interface{}{},
+			},
+		},
+	}
+
+	response, err := conn.Search(query, []string{indexName}, []string{docType})
+	assertNoError(t, err)
+	assertEqual(t, response.Hits.Hits[0].Highlight, map[string][]string{
+		"message": []string{"some <em>foo</em> message"},
+	})
+}
+
+func TestSearchSortRequests(t *testing.T) {
+	server, conn := newFakeServer(t, "5.6.16")
+	server.answer(200, `{"hits":{"total":2,"hits":[{"_index":"tweets","_type":"tweet","_id":"2","_score":null,"sort":[1463538857,"2"]}]}}`)
+
+	query := qdsl.Search{
+		Sort:        []qdsl.Sort{qdsl.FieldSort{Field: "date", Order: qdsl.ORDER_DESC}, qdsl.FieldSort{Field: "_uid"}},
+		SearchAfter: []interface{}{1463538858, "1"},
+	}
+
+	response, err := conn.Search(query, []string{"tweets"}, []string{})
+	assertNoError(t, err)
+	assertEqual(t, response.Hits.Hits[0].Sort, []interface{}{float64(1463538857), "2"})
+
+	assertEqual(t, server.requests(), []string{
+		`POST /tweets/_search {"search_after":[1463538858,"1"],"sort":[{"date":{"order":"desc"}},{"_uid":{}}]}`,
+	})
+}
+
+func TestSearchOptionsRequests(t *testing.T) {
+	server, conn := newFakeServer(t, "5.6.16")
+	server.answer(200, `{"timed_out":true,"hits":{"total":1,"hits":[{"_index":"tweets","_type":"tweet","_id":"1","_score":0.3,`+
+		`"_source":{"user":"foo"},"_explanation":{"value":0.3,"description":"weight(user:foo)","details":[{"value":0.3,"description":"score"}]}}]}}`)
+
+	query := qdsl.Search{
+		Query:        qdsl.TermQuery{Field: "user", Value: "foo"},
+		From:         10,
+		Size:         5,
+		SourceFilter: []string{"user"},
+		Timeout:      "100ms",
+		Explain:      true,
+	}
+
+	response, err := conn.Search(query, []string{"tweets"}, []string{})
+	assertNoError(t, err)
+	assertEqual(t, response.TimedOut, true)
+	assertEqual(t, response.Hits.Hits[0].Source, map[string]interface{}{"user": "foo"})
+	assertEqual(t, response.Hits.Hits[0].Explanation, &Explanation{
+		Value:       0.3,
+		Description: "weight(user:foo)",
+		Details:     []Explanation{{Value: 0.3, Description: "score"}},
+	})
+
+	assertEqual(t, server.requests(), []string{
+		`POST /tweets/_search {"_source":["user"],"explain":true,"from":10,"query":{"term":{"user":{"value":"foo"}}},"size":5,"timeout":"100ms"}`,
+	})
+}
+
+func TestCompareVersions(t *testing.T) {
+	assertEqual(t, compareVersions("0.90.13", "1.0.0"), -1)
+	assertEqual(t, compareVersions("1.7.5", "1.7.5"), 0)
+	assertEqual(t, compareVersions("1.10.0", "1.7.5"), 1)
+	assertEqual(t, compareVersions("5.0.0-alpha1", "5.0.0"), 0)
+	assertEqual(t, compareVersions("8", "7.17.3"), 1)
+}
+
+func TestSupports(t *testing.T) {
+	conn := NewConnection(ES_HOST, ES_PORT)
+	conn.Version = "1.7.5"
+
+	for feature, expected := range map[string]bool{
+		FEATURE_MORE_LIKE_THIS_API: true,
+		FEATURE_TERM_VECTORS:       true,
+		FEATURE_TASKS_API:          false,
+		FEATURE_OK_FIELD:           false,
+	} {
+		ok, err := conn.Supports(feature)
+		assertNoError(t, err)
+		assertEqual(t, ok, expected)
+	}
+
+	_, err := conn.Supports("foo")
+	assertError(t, err)
+
+	ok, err := conn.InVersions(VersionRange{"1.5.0", "6.0.0"})
+	assertNoError(t, err)
+	assertEqual(t, ok, true)
+
+	conn.Version = "5.6.16"
+	_, err = conn.SearchWithType(nil, []string{"i"}, []string{}, SEARCH_TYPE_COUNT, url.Values{})
+	assertEqual(t, err.Error(), "search_type_count is not supported by elasticsearch 5.6.16")
+
+	d := Document{Index: "i", Type: "t", Id: "1", TTL: "1d", BulkCommand: BULK_COMMAND_INDEX}
+	_, err = conn.Index(d, url.Values{})
+	assertEqual(t, err.Error(), "ttl is not supported by elasticsearch 5.6.16")
+	_, err = conn.BulkSend("i", []Document{d})
+	assertEqual(t, err.Error(), "ttl is not supported by elasticsearch 5.6.16")
+}
+
+// fakeSkipper records the calls of SkipUnlessSupported and SkipUnlessVersion
+type fakeSkipper struct {
+	skipped string
+	failed  bool
+}
+
+func (s *fakeSkipper) Helper()                   {}
+func (s *fakeSkipper) Fatal(args ...interface{}) { s.failed = true }
+func (s *fakeSkipper) Skipf(format string, args ...interface{}) {
+	s.skipped = fmt.Sprintf(format, args...)
+}
+
+func TestSkipUnlessSupported(t *testing.T) {
+	conn := NewConnection(ES_HOST, ES_PORT)
+	conn.Version = "5.6.16"
+
+	s := &fakeSkipper{}
+	SkipUnlessSupported(s, conn, FEATURE_INGEST)
+	assertEqual(t, *s, fakeSkipper{})
+
+	SkipUnlessSupported(s, conn, FEATURE_TTL)
+	assertEqual(t, s.skipped, "ttl is not supported by elasticsearch 5.6.16")
+
+	s = &fakeSkipper{}
+	SkipUnlessVersion(s, conn, VersionRange{From: "6.0.0"})
+	assertEqual(t, s.skipped, "[6.0.0, ) is not supported by elasticsearch 5.6.16")
+
+	s = &fakeSkipper{}
+	SkipUnlessSupported(s, conn, "foo")
+	assertEqual(t, s.failed, true)
+}
+
+func TestInfo(t *testing.T) {
+	conn := testConnection(t)
+
+	response, err := conn.Info()
+	assertNoError(t, err)
+	assertEqual(t, response.ServerVersion.Number != "", true)
+
+	ok, err := conn.Supports(FEATURE_SOURCE_FILTERING)
+	assertNoError(t, err)
+	assertEqual(t, conn.Version, response.ServerVersion.Number)
+	assertEqual(t, ok, Features[FEATURE_SOURCE_FILTERING].Contains(conn.Version))
+}
+
+func TestMappingFields(t *testing.T) {
+	expected := []FieldDescriptor{
+		{DocumentType: "tweet", Path: "message", Type: "string", Analyzer: "english"},
+		{DocumentType: "tweet", Path: "message.raw", Type: "string", Index: "not_analyzed"},
+		{DocumentType: "tweet", Path: "user.id", Type: "long"},
+		{DocumentType: "tweet", Path: "user.name", Type: "string", IndexAnalyzer: "standard", SearchAnalyzer: "simple"},
+	}
+
+	// elasticsearch 0.90
+	fields, err := mappingFields([]byte(`{"tweets":{"tweet":{"properties":{
+		"message":{"type":"multi_field","fields":{
+			"message":{"type":"string","analyzer":"english"},
+			"raw":{"type":"string","index":"not_analyzed"}}},
+		"user":{"properties":{
+			"id":{"type":"long"},
+			"name":{"type":"string","index_analyzer":"standard","search_analyzer":"simple"}}}}}}}`))
+	assertNoError(t, err)
+	assertEqual(t, fields, expected)
+
+	// elasticsearch 1.x
+	fields, err = mappingFields([]byte(`{"tweets":{"mappings":{"tweet":{"properties":{
+		"message":{"type":"string","analyzer":"english","fields":{
+			"raw":{"type":"string","index":"not_analyzed"}}},
+		"user":{"properties":{
+			"id":{"type":"long"},
+			"name":{"type":"string","index_analyzer":"standard","search_analyzer":"simple"}}}}}}}}`))
+	assertNoError(t, err)
+	assertEqual(t, fields, expected)
+
+	// elasticsearch 7.x
+	fields, err = mappingFields([]byte(`{"tweets":{"mappings":{"properties":{
+		"user":{"type":"keyword"}}}}}`))
+	assertNoError(t, err)
+	assertEqual(t, fields, []FieldDescriptor{{DocumentType: "_doc", Path: "user", Type: "keyword"}})
+}
+
+func TestDescribeIndex(t *testing.T) {
+	indexName := "testdescribeindex"
+	docType := "tweet"
+
+	conn := testConnection(t)
+	conn.DeleteIndex(indexName)
+
+	mapping := map[string]interface{}{
+		"settings": map[string]interface{}{
+			"index.number_of_shards":   1,
+			"index.number_of_replicas": 0,
+		},
+	}
+
+	_, err := conn.CreateIndex(indexName, mapping)
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	d := Document{
+		Index: indexName,
+		Type:  docType,
+		Id:    "1",
+		Fields: map[string]interface{}{
+			"user": "foo",
+		},
+	}
+
+	_, err = conn.Index(d, url.Values{})
+	assertNoError(t, err)
+
+	_, err = conn.RefreshIndex(indexName)
+	assertNoError(t, err)
+
+	descriptor, err := conn.DescribeIndex(indexName)
+	assertNoError(t, err)
+
+	assertEqual(t, descriptor.Name, indexName)
+	assertEqual(t, descriptor.Settings["index.number_of_shards"], "1")
+	assertEqual(t, descriptor.DocsCount, 1)
+	assertEqual(t, descriptor.SizeInBytes > 0, true)
+	assertEqual(t, len(descriptor.Fields), 1)
+	assertEqual(t, descriptor.Fields[0].Path, "user")
+	assertEqual(t, descriptor.Fields[0].Type, "string")
+}
+
+func TestAggregations(t *testing.T) {
+	body := []byte(`{"took":1,"hits":{"total":3,"max_score":0,"hits":[]},"aggregations":{
+		"users":{"doc_count_error_upper_bound":0,"sum_other_doc_count":0,"buckets":[
+			{"key":"foo","doc_count":2,"avg_age":{"value":31.5}},
+			{"key":"bar","doc_count":1,"avg_age":{"value":20}}]},
+		"per_day":{"buckets":[{"key_as_string":"2014-01-01","key":1388534400000,"doc_count":3}]},
+		"ranges":{"buckets":{"*-10.0":{"to":10,"doc_count":1},"10.0-*":{"from":10,"doc_count":2}}},
+		"age_stats":{"count":3,"min":20,"max":33,"avg":28.66,"sum":86},
+		"age_percentiles":{"values":{"50.0":30,"99.0":33}},
+		"no_age":{"value":null},
+		"recent":{"doc_count":2,"users":{"buckets":[{"key":"foo","doc_count":2}]}}}}`)
+
+	response, err := decodeResponse(200, body)
+	assertNoError(t, err)
+
+	users := response.Aggregations["users"].Buckets()
+	assertEqual(t, len(users), 2)
+	assertEqual(t, users[0].Key, "foo")
+	assertEqual(t, users[0].KeyAsString, "foo")
+	assertEqual(t, users[0].DocCount, uint64(2))
+
+	avg, ok := users[0].Aggregations["avg_age"].Value()
+	assertEqual(t, ok, true)
+	assertEqual(t, avg, 31.5)
+
+	perDay := response.Aggregations["per_day"].Buckets()
+	assertEqual(t, perDay[0].Key, float64(1388534400000))
+	assertEqual(t, perDay[0].KeyAsString, "2014-01-01")
+
+	ranges := response.Aggregations["ranges"].Buckets()
+	assertEqual(t, ranges[0].Key, "*-10.0")
+	assertEqual(t, ranges[1].DocCount, uint64(2))
+
+	max, ok := response.Aggregations["age_stats"].Metric("max")
+	assertEqual(t, ok, true)
+	assertEqual(t, max, float64(33))
+
+	assertEqual(t, response.Aggregations["age_percentiles"].Values(), map[string]float64{"50.0": 30, "99.0": 33})
+
+	_, ok = response.Aggregations["no_age"].Value()
+	assertEqual(t, ok, false)
+
+	recent := response.Aggregations["recent"]
+	assertEqual(t, recent.DocCount(), uint64(2))
+	assertEqual(t, recent.Aggregation("users").Buckets()[0].Key, "foo")
+	assertEqual(t, recent.Aggregation("missing") == nil, true)
+}
+
+func TestFacets(t *testing.T) {
+	body := []byte(`{"took":1,"hits":{"total":3,"max_score":1,"hits":[]},"facets":{
+		"users":{"_type":"terms","missing":1,"total":3,"other":0,"terms":[{"term":"foo","count":2},{"term":"bar","count":1}]},
+		"age":{"_type":"statistical","count":3,"total":86,"min":20,"max":33,"mean":28.5,"sum_of_squares":2498,"variance":0.5,"std_deviation":0.7},
+		"per_day":{"_type":"date_histogram","entries":[{"time":1388534400000,"count":3,"min":20,"max":33,"total":86,"total_count":3,"mean":28.5}]}}}`)
+
+	response, err := decodeResponse(200, body)
+	assertNoError(t, err)
+
+	assertEqual(t, response.Facets["users"], Facet{
+		Type:    "terms",
+		Missing: 1,
+		Total:   3,
+		Terms:   []FacetTerm{{"foo", 2}, {"bar", 1}},
+	})
+
+	age := response.Facets["age"]
+	assertEqual(t, age.Count, uint64(3))
+	assertEqual(t, age.Total, float64(86))
+	assertEqual(t, age.StdDeviation, 0.7)
+
+	assertEqual(t, response.Facets["per_day"].Entries, []FacetEntry{{
+		Time:       1388534400000,
+		Count:      3,
+		Min:        20,
+		Max:        33,
+		Total:      86,
+		TotalCount: 3,
+		Mean:       28.5,
+	}})
+}
+
+func TestSearchFacets(t *testing.T) {
+	indexName := "testsearchfacets"
+	docType := "tweet"
+
+	conn := testConnection(t)
+	SkipUnlessVersion(t, conn, VersionRange{Until: "2.0.0"})
+	conn.DeleteIndex(indexName)
+
+	_, err := conn.CreateIndex(indexName, map[string]interface{}{})
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	for id, user := range map[string]string{"1": "foo", "2": "foo", "3": "bar"} {
+		d := Document{
+			Index: indexName,
+			Type:  docType,
+			Id:    id,
+			Fields: map[string]interface{}{
+				"user": user,
+			},
+		}
+
+		_, err = conn.Index(d, url.Values{})
+		assertNoError(t, err)
+	}
+
+	_, err = conn.RefreshIndex(indexName)
+	assertNoError(t, err)
+
+	query := map[string]interface{}{
+		"query": map[string]interface{}{
+			"match_all": map[string]interface{}{},
+		},
+		"facets": map[string]interface{}{
+			"users": map[string]interface{}{
+				"terms": map[string]interface{}{
+					"field": "user",
+				},
+			},
+		},
+	}
+
+	response, err := conn.Search(query, []string{indexName}, []string{docType})
+	assertNoError(t, err)
+	assertEqual(t, response.Facets["users"].Terms, []FacetTerm{{"foo", 2}, {"bar", 1}})
+}
+
+func TestMultiGet(t *testing.T) {
+	indexName := "testmultiget"
+	docType := "tweet"
+
+	conn := testConnection(t)
+	SkipUnlessSupported(t, conn, FEATURE_SOURCE_FILTERING)
+	conn.DeleteIndex(indexName)
+
+	_, err := conn.CreateIndex(indexName, map[string]interface{}{})
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	docs := []Document{}
+	for _, id := range []string{"1", "2"} {
+		d := Document{
+			Index: indexName,
+			Type:  docType,
+			Id:    id,
+			Fields: map[string]interface{}{
+				"user":    "foo" + id,
+				"message": "a large message",
+			},
+		}
+
+		_, err = conn.Index(d, url.Values{})
+		assertNoError(t, err)
+
+		docs = append(docs, d)
+	}
+
+	response, err := conn.MultiGet(docs, SourceFilter{Excludes: []string{"message"}}, url.Values{})
+	assertNoError(t, err)
+
+	assertEqual(t, len(response.Docs), 2)
+	assertEqual(t, response.Docs[0].Id, "1")
+	assertEqual(t, response.Docs[0].Source, map[string]interface{}{"user": "foo1"})
+	assertEqual(t, response.Docs[1].Source, map[string]interface{}{"user": "foo2"})
+
+	response, err = conn.MultiGet(docs, SourceFilter{Disabled: true}, url.Values{})
+	assertNoError(t, err)
+	assertEqual(t, response.Docs[0].Source, map[string]interface{}(nil))
+	assertEqual(t, response.Docs[0].SourceExcluded, true)
+}
+
+func TestHitUnmarshal(t *testing.T) {
+	type tweet struct {
+		User    string   `json:"user"`
+		Message string   `json:"message"`
+		Retweet int      `json:"retweets"`
+		Tags    []string `json:"tags"`
+	}
+
+	body := []byte(`{"took":1,"hits":{"total":1,"max_score":1,"hits":[{"_index":"i","_type":"tweet","_id":"1","_score":1,
+		"_source":{"user":"foo","message":"bar","retweets":3,"tags":["a","b"]}}]}}`)
+
+	response, err := decodeResponse(200, body)
+	assertNoError(t, err)
+
+	var tw tweet
+	err = response.Hits.Hits[0].Unmarshal(&tw)
+	assertNoError(t, err)
+	assertEqual(t, tw, tweet{"foo", "bar", 3, []string{"a", "b"}})
+
+	var wrong struct {
+		User int `json:"user"`
+	}
+	assertError(t, response.Hits.Hits[0].Unmarshal(&wrong))
+
+	assertEqual(t, response.Hits.Hits[0].Source, map[string]interface{}{"user": "foo", "message": "bar", "retweets": float64(3), "tags": []interface{}{"a", "b"}})
+	assertEqual(t, string(response.Hits.Hits[0].RawSource), `{"user":"foo","message":"bar","retweets":3,"tags":["a","b"]}`)
+
+	// the _source of a GET response
+	response, err = decodeResponse(200, []byte(`{"_index":"i","_type":"tweet","_id":"1","found":true,"_source":{"user":"foo"}}`))
+	assertNoError(t, err)
+
+	tw = tweet{}
+	assertNoError(t, response.Unmarshal(&tw))
+	assertEqual(t, tw, tweet{User: "foo"})
+
+	assertEqual(t, response.Source, map[string]interface{}{"user": "foo"})
+	assertEqual(t, string(response.RawSource), `{"user":"foo"}`)
+
+	// a Response built by hand has no RawSource
+	tw = tweet{}
+	assertNoError(t, (&Response{Source: map[string]interface{}{"user": "bar"}}).Unmarshal(&tw))
+	assertEqual(t, tw, tweet{User: "bar"})
+
+	// without _source
+	response, err = decodeResponse(200, []byte(`{"_index":"i","_type":"tweet","_id":"1","found":true}`))
+	assertNoError(t, err)
+
+	tw = tweet{User: "unchanged"}
+	assertNoError(t, response.Unmarshal(&tw))
+	assertEqual(t, tw, tweet{User: "unchanged"})
+
+	assertEqual(t, response.Source, map[string]interface{}(nil))
+	assertEqual(t, response.RawSource, json.RawMessage(nil))
+}
+
+func TestTruncateIndex(t *testing.T) {
+	indexName := "testtruncateindex"
+	docType := "tweet"
+
+	conn := testConnection(t)
+	conn.DeleteIndex(indexName)
+
+	mapping := map[string]interface{}{
+		"settings": map[string]interface{}{
+			"index.number_of_shards":   2,
+			"index.number_of_replicas": 0,
+		},
+		"mappings": map[string]interface{}{
+			docType: map[string]interface{}{
+				"properties": map[string]interface{}{
+					"user": map[string]interface{}{
+						"type":  "string",
+						"index": "not_analyzed",
+					},
+				},
+			},
+		},
+	}
+
+	_, err := conn.CreateIndex(indexName, mapping)
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	for _, id := range []string{"1", "2"} {
+		d := Document{
+			Index: indexName,
+			Type:  docType,
+			Id:    id,
+			Fields: map[string]interface{}{
+				"user": "foo",
+			},
+		}
+
+		_, err = conn.Index(d, url.Values{})
+		assertNoError(t, err)
+	}
+
+	_, err = conn.RefreshIndex(indexName)
+	assertNoError(t, err)
+
+	_, err = conn.TruncateIndex(indexName)
+	assertNoError(t, err)
+
+	_, err = conn.RefreshIndex(indexName)
+	assertNoError(t, err)
+
+	descriptor, err := conn.DescribeIndex(indexName)
+	assertNoError(t, err)
+	assertEqual(t, descriptor.DocsCount, 0)
+	assertEqual(t, descriptor.Settings["index.number_of_shards"], "2")
+	assertEqual(t, descriptor.Fields, []FieldDescriptor{
+		{DocumentType: docType, Path: "user", Type: "string", Index: "not_analyzed"},
+	})
+}
+
+type testTweet struct {
+	Id      string  `json:"_id"`
+	Score   float64 `json:"_score"`
+	User    string  `json:"user"`
+	Message string  `json:"message"`
+}
+
+func TestDecodeHits(t *testing.T) {
+	body := []byte(`{"took":4,"timed_out":false,"hits":{"total":2,"max_score":1.5,"hits":[
+		{"_index":"i","_type":"tweet","_id":"1","_score":1.5,"_source":{"user":"foo","message":"bar"}},
+		{"_index":"i","_type":"tweet","_id":"2","_score":0.5,"_source":{"user":"baz"}}]}}`)
+
+	response, err := decodeResponse(200, body)
+	assertNoError(t, err)
+
+	tweets, meta, err := decodeHits[testTweet](response)
+	assertNoError(t, err)
+	assertEqual(t, tweets, []testTweet{
+		{Id: "1", Score: 1.5, User: "foo", Message: "bar"},
+		{Id: "2", Score: 0.5, User: "baz"},
+	})
+	assertEqual(t, meta, SearchMeta{Total: 2, TotalRelation: TOTAL_EQ, MaxScore: 1.5, Took: 4})
+
+	_, _, err = decodeHits[struct{ User int }](response)
+	assertError(t, err)
+}
+
+func TestSearchTotalObject(t *testing.T) {
+	body, err := os.ReadFile(filepath.Join("testdata", "responses", "7.10-search-200.json"))
+	assertNoError(t, err)
+
+	requests := 0
+	conn := fakeConnection(t, "7.10.2", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch {
+		case r.Method == "DELETE":
+			io.WriteString(w, `{"succeeded":true}`)
+		case requests == 1 || strings.HasSuffix(r.URL.Path, "/i/_search"):
+			w.Write(body)
+		default:
+			io.WriteString(w, `{"hits":{"total":{"value":1,"relation":"eq"},"hits":[]}}`)
+		}
+	})
+	conn.StrictDecoding = true
+
+	response, err := conn.Search(nil, []string{"i"}, []string{})
+	assertNoError(t, err)
+	assertEqual(t, response.Hits.Total, uint64(10000))
+	assertEqual(t, response.Hits.TotalRelation, TOTAL_GTE)
+	assertEqual(t, response.Hits.Hits[0].Id, "1")
+
+	_, meta, err := SearchAs[testTweet](conn, nil, []string{"i"}, []string{})
+	assertNoError(t, err)
+	assertEqual(t, meta.TotalRelation, TOTAL_GTE)
+
+	hits := 0
+	err = conn.ScrollStream(nil, []string{"i"}, []string{}, func(hit Hit) error {
+		hits++
+		return nil
+	})
+	assertNoError(t, err)
+	assertEqual(t, hits, 1)
+
+	hitsWithout := Hits{}
+	assertNoError(t, json.Unmarshal([]byte(`{"hits":[]}`), &hitsWithout))
+	assertEqual(t, hitsWithout, Hits{TotalRelation: TOTAL_EQ, Hits: []Hit{}})
+
+	assertError(t, json.Unmarshal([]byte(`{"total":{"value":"many"}}`), &hitsWithout))
+}
+
+func TestShardFailuresRequests(t *testing.T) {
+	responses := []string{
+		`{"took":3,"timed_out":false,"_shards":{"total":2,"successful":1,"failed":1,"failures":[` +
+			`{"index":"i","shard":1,"status":400,"reason":"SearchParseException[[i][1]: from[-1],size[-1]: Parse Failure [No parser for element [foo]]]"}]},` +
+			`"hits":{"total":1,"max_score":1,"hits":[{"_index":"i","_type":"t","_id":"1","_score":1,"_source":{}}]}}`,
+		`{"took":3,"timed_out":false,"_shards":{"total":2,"successful":1,"skipped":0,"failed":1,"failures":[` +
+			`{"shard":1,"index":"i","node":"n1","reason":{"type":"query_shard_exception","reason":"failed to create query","index":"i",` +
+			`"caused_by":{"type":"number_format_exception","reason":"For input string: \"x\""}}}]},` +
+			`"hits":{"total":1,"max_score":1,"hits":[{"_index":"i","_type":"t","_id":"1","_score":1,"_source":{}}]}}`,
+	}
+
+	conn := fakeConnection(t, "1.7.5", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, responses[0])
+		responses = responses[1:]
+	})
+
+	response, err := conn.Search(map[string]interface{}{}, []string{"i"}, []string{})
+	assertNoError(t, err)
+	assertEqual(t, response.Shards, Shard{
+		Total:      2,
+		Successful: 1,
+		Failed:     1,
+		Failures: []ShardFailure{{
+			Index: "i",
+			Shard: 1,
+			Reason: ElasticError{
+				Msg:       "SearchParseException[[i][1]: from[-1],size[-1]: Parse Failure [No parser for element [foo]]]",
+				ErrorType: "SearchParseException",
+				Reason:    "[i][1]: from[-1],size[-1]: Parse Failure [No parser for element [foo]]",
+			},
+		}},
+	})
+
+	conn.Version = "6.8.23"
+	response, err = conn.Search(map[string]interface{}{}, []string{"i"}, []string{})
+	assertNoError(t, err)
+	assertEqual(t, response.Shards.Failed, uint64(1))
+	assertEqual(t, len(response.Hits.Hits), 1)
+
+	failure := response.Shards.Failures[0]
+	assertEqual(t, failure.Node, "n1")
+	assertEqual(t, failure.Reason.ErrorType, "query_shard_exception")
+	assertEqual(t, failure.Reason.Index, "i")
+	assertEqual(t, failure.Reason.CausedBy, &ElasticError{ErrorType: "number_format_exception", Reason: `For input string: "x"`})
+}
+
+func TestSearchTookRequests(t *testing.T) {
+	conn := fakeConnection(t, "5.6.16", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"took":1250,"timed_out":true,"_shards":{"total":5,"successful":5,"failed":0},`+
+			`"hits":{"total":1,"max_score":1,"hits":[{"_index":"i","_type":"t","_id":"1","_score":1,"_source":{"user":"foo"}}]}}`)
+	})
+
+	response, err := conn.Search(map[string]interface{}{}, []string{"i"}, []string{})
+	assertNoError(t, err)
+	assertEqual(t, response.Took, uint64(1250))
+	assertEqual(t, response.TimedOut, true)
+	assertEqual(t, response.Partial(), true)
+
+	page, err := conn.Paginate(map[string]interface{}{}, []string{"i"}, []string{}, 1, 10)
+	assertNoError(t, err)
+	assertEqual(t, page.Took, uint64(1250))
+	assertEqual(t, page.TimedOut, true)
+	assertEqual(t, page.Shards, Shard{Total: 5, Successful: 5})
+
+	_, meta, err := SearchAs[map[string]interface{}](conn, map[string]interface{}{}, []string{"i"}, []string{})
+	assertNoError(t, err)
+	assertEqual(t, meta.Took, uint64(1250))
+	assertEqual(t, meta.TimedOut, true)
+	assertEqual(t, meta.Shards.Total, uint64(5))
+
+	assertEqual(t, (&Response{}).Partial(), false)
+	assertEqual(t, (&Response{Shards: Shard{Total: 2, Successful: 1, Failed: 1}}).Partial(), true)
+}
+
+func TestSearchAs(t *testing.T) {
+	indexName := "testsearchas"
+	docType := "tweet"
+
+	conn := testConnection(t)
+	conn.DeleteIndex(indexName)
+
+	_, err := conn.CreateIndex(indexName, map[string]interface{}{})
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	d := Document{
+		Index: indexName,
+		Type:  docType,
+		Id:    "1",
+		Fields: map[string]interface{}{
+			"user":    "foo",
+			"message": "bar",
+		},
+	}
+
+	_, err = conn.Index(d, url.Values{})
+	assertNoError(t, err)
+
+	_, err = conn.RefreshIndex(indexName)
+	assertNoError(t, err)
+
+	query := map[string]interface{}{
+		"query": map[string]interface{}{
+			"match_all": map[string]interface{}{},
+		},
+	}
+
+	tweets, meta, err := SearchAs[testTweet](conn, query, []string{indexName}, []string{docType})
+	assertNoError(t, err)
+	assertEqual(t, meta.Total, uint64(1))
+	assertEqual(t, tweets, []testTweet{{Id: "1", Score: 1.0, User: "foo", Message: "bar"}})
+}
+
+func TestCloneIndex(t *testing.T) {
+	src := "testcloneindexsrc"
+	dst := "testcloneindexdst"
+	docType := "tweet"
+
+	conn := testConnection(t)
+	conn.DeleteIndex(src)
+	conn.DeleteIndex(dst)
+
+	mapping := map[string]interface{}{
+		"settings": map[string]interface{}{
+			"index.number_of_shards":   1,
+			"index.number_of_replicas": 0,
+		},
+	}
+
+	_, err := conn.CreateIndex(src, mapping)
+	assertNoError(t, err)
+	defer conn.DeleteIndex(src)
+
+	docs := []Document{}
+	for i := 0; i < 1200; i++ {
+		docs = append(docs, Document{
+			Index:       src,
+			Type:        docType,
+			Id:          strconv.Itoa(i),
+			BulkCommand: BULK_COMMAND_INDEX,
+			Fields: map[string]interface{}{
+				"user": "foo",
+			},
+		})
+	}
+
+	_, err = conn.BulkSend(src, docs)
+	assertNoError(t, err)
+
+	_, err = conn.RefreshIndex(src)
+	assertNoError(t, err)
+
+	_, err = conn.CloneIndex(src, dst)
+	assertNoError(t, err)
+	defer conn.DeleteIndex(dst)
+
+	_, err = conn.RefreshIndex(dst)
+	assertNoError(t, err)
+
+	descriptor, err := conn.DescribeIndex(dst)
+	assertNoError(t, err)
+	assertEqual(t, descriptor.DocsCount, 1200)
+	assertEqual(t, descriptor.Settings["index.number_of_shards"], "1")
+
+	// src must be writable again
+	_, err = conn.Index(Document{Index: src, Type: docType, Id: "x", Fields: map[string]interface{}{"user": "bar"}}, url.Values{})
+	assertNoError(t, err)
+}
+
+func TestScrollAll(t *testing.T) {
+	pages := []string{
+		`{"_scroll_id":"s1","hits":{"total":3,"hits":[]}}`,
+		`{"_scroll_id":"s2","hits":{"total":3,"hits":[{"_id":"1"},{"_id":"2"}]}}`,
+		`{"_scroll_id":"s3","hits":{"total":3,"hits":[{"_id":"3"}]}}`,
+		`{"_scroll_id":"s4","hits":{"total":3,"hits":[]}}`,
+	}
+	requests := []string{}
+
+	conn := fakeConnection(t, "1.7.5", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery+" "+string(body))
+		if r.Method == "DELETE" {
+			io.WriteString(w, `{"succeeded":true}`)
+			return
+		}
+		io.WriteString(w, pages[len(requests)-1])
+	})
+
+	ids := []string{}
+	err := conn.ScrollAll(nil, []string{"i"}, []string{}, func(hits []Hit) error {
+		for _, hit := range hits {
+			ids = append(ids, hit.Id)
+		}
+		return nil
+	})
+	assertNoError(t, err)
+	assertEqual(t, ids, []string{"1", "2", "3"})
+	assertEqual(t, requests, []string{
+		"POST /i/_search?scroll=1m&search_type=scan&size=500 null",
+		"POST /_search/scroll?scroll=1m s1",
+		"POST /_search/scroll?scroll=1m s2",
+		"POST /_search/scroll?scroll=1m s3",
+		"DELETE /_search/scroll? s4",
+	})
+
+	pages = []string{
+		`{"_scroll_id":"s1","hits":{"total":1,"hits":[{"_id":"1"}]}}`,
+		`{"_scroll_id":"s2","hits":{"total":1,"hits":[]}}`,
+	}
+	requests = []string{}
+	conn.Version = "5.6.16"
+
+	ids = []string{}
+	err = conn.ScrollAll(nil, []string{"i"}, []string{}, func(hits []Hit) error {
+		for _, hit := range hits {
+			ids = append(ids, hit.Id)
+		}
+		return nil
+	})
+	assertNoError(t, err)
+	assertEqual(t, ids, []string{"1"})
+	assertEqual(t, requests, []string{
+		"POST /i/_search?scroll=1m&size=500&sort=_doc null",
+		`POST /_search/scroll?scroll=1m {"scroll":"1m","scroll_id":"s1"}`,
+		`DELETE /_search/scroll? {"scroll_id":["s2"]}`,
+	})
+
+	// the scroll id of the previous page is kept when a page has none
+	pages = []string{
+		`{"_scroll_id":"s1","hits":{"total":2,"hits":[{"_id":"1"}]}}`,
+		`{"hits":{"total":2,"hits":[{"_id":"2"}]}}`,
+		`{"hits":{"total":2,"hits":[]}}`,
+	}
+	requests = []string{}
+
+	err = conn.ScrollAll(nil, []string{"i"}, []string{}, func(hits []Hit) error { return nil })
+	assertNoError(t, err)
+	assertEqual(t, requests, []string{
+		"POST /i/_search?scroll=1m&size=500&sort=_doc null",
+		`POST /_search/scroll?scroll=1m {"scroll":"1m","scroll_id":"s1"}`,
+		`POST /_search/scroll?scroll=1m {"scroll":"1m","scroll_id":"s1"}`,
+		`DELETE /_search/scroll? {"scroll_id":["s1"]}`,
+	})
+}
+
+func TestClearScrollRequests(t *testing.T) {
+	server, conn := newFakeServer(t, "1.7.5")
+	server.answer(200, `{"succeeded":true,"num_freed":2}`)
+
+	_, err := conn.ClearScroll([]string{"s1", "s2"})
+	assertNoError(t, err)
+
+	conn.Version = "5.6.16"
+	_, err = conn.ClearScroll([]string{"s1", "s2"})
+	assertNoError(t, err)
+
+	assertEqual(t, server.requests(), []string{
+		"DELETE /_search/scroll s1,s2",
+		`DELETE /_search/scroll {"scroll_id":["s1","s2"]}`,
+	})
+}
+
+func TestScrollSliced(t *testing.T) {
+	var lock sync.Mutex
+	requests := []string{}
+
+	conn := fakeConnection(t, "6.8.23", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		lock.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery+" "+string(body))
+		lock.Unlock()
+
+		switch {
+		case r.Method == "DELETE":
+			io.WriteString(w, `{"succeeded":true}`)
+		case r.URL.Path == "/i/_search":
+			var query struct {
+				Slice struct{ Id int }
+			}
+			json.Unmarshal(body, &query)
+			fmt.Fprintf(w, `{"_scroll_id":"s%d","hits":{"hits":[{"_id":"%d"}]}}`, query.Slice.Id, query.Slice.Id)
+		default:
+			io.WriteString(w, `{"hits":{"hits":[]}}`)
+		}
+	})
+
+	ids := []string{}
+	err := conn.ScrollSliced(json.RawMessage(`{"query":{"match_all":{}}}`), []string{"i"}, []string{}, 2, func(hits []Hit) error {
+		lock.Lock()
+		defer lock.Unlock()
+
+		for _, hit := range hits {
+			ids = append(ids, hit.Id)
+		}
+		return nil
+	})
+	assertNoError(t, err)
+
+	sort.Strings(ids)
+	assertEqual(t, ids, []string{"0", "1"})
+
+	sort.Strings(requests)
+	assertEqual(t, requests, []string{
+		`DELETE /_search/scroll? {"scroll_id":["s0"]}`,
+		`DELETE /_search/scroll? {"scroll_id":["s1"]}`,
+		`POST /_search/scroll?scroll=1m {"scroll":"1m","scroll_id":"s0"}`,
+		`POST /_search/scroll?scroll=1m {"scroll":"1m","scroll_id":"s1"}`,
+		`POST /i/_search?scroll=1m&size=500&sort=_doc {"query":{"match_all":{}},"slice":{"id":0,"max":2}}`,
+		`POST /i/_search?scroll=1m&size=500&sort=_doc {"query":{"match_all":{}},"slice":{"id":1,"max":2}}`,
+	})
+
+	// the error of f is returned
+	err = conn.ScrollSliced(nil, []string{"i"}, []string{}, 3, func(hits []Hit) error {
+		return errors.New("full")
+	})
+	assertEqual(t, err.Error(), "full")
+
+	conn.Version = "2.4.6"
+	err = conn.ScrollSliced(nil, []string{"i"}, []string{}, 2, func(hits []Hit) error { return nil })
+	assertEqual(t, err.Error(), "sliced_scroll is not supported by elasticsearch 2.4.6")
+}
+
+func TestScrollStream(t *testing.T) {
+	pages := []string{
+		`{"_scroll_id":"s1","took":3,"hits":{"total":3,"max_score":null,"hits":[{"_id":"1","_source":{"user":"foo"}},{"_id":"2"}]}}`,
+		`{"hits":{"total":3,"hits":[{"_id":"3"}]},"_scroll_id":"s2"}`,
+		`{"_scroll_id":"s3","hits":{"total":3,"hits":[]}}`,
+	}
+	requests := []string{}
+
+	conn := fakeConnection(t, "5.6.16", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery+" "+string(body))
+		if r.Method == "DELETE" {
+			io.WriteString(w, `{"succeeded":true}`)
+			return
+		}
+		if strings.Contains(pages[len(requests)-1], `"error"`) {
+			w.WriteHeader(404)
+		}
+		io.WriteString(w, pages[len(requests)-1])
+	})
+
+	hits := []Hit{}
+	err := conn.ScrollStream(json.RawMessage(`{"query":{"match_all":{}}}`), []string{"i"}, []string{}, func(hit Hit) error {
+		hits = append(hits, hit)
+		return nil
+	})
+	assertNoError(t, err)
+	assertEqual(t, len(hits), 3)
+	assertEqual(t, hits[2].Id, "3")
+	assertEqual(t, hits[0].Source, map[string]interface{}{"user": "foo"})
+	assertEqual(t, requests, []string{
+		`POST /i/_search?scroll=1m&size=500&sort=_doc {"query":{"match_all":{}}}`,
+		`POST /_search/scroll?scroll=1m {"scroll":"1m","scroll_id":"s1"}`,
+		`POST /_search/scroll?scroll=1m {"scroll":"1m","scroll_id":"s2"}`,
+		`DELETE /_search/scroll? {"scroll_id":["s3"]}`,
+	})
+
+	// the error of f stops the scroll, whose context is freed
+	requests = []string{}
+	err = conn.ScrollStream(nil, []string{"i"}, []string{}, func(hit Hit) error {
+		return errors.New("full")
+	})
+	assertEqual(t, err.Error(), "full")
+	assertEqual(t, requests[len(requests)-1], `DELETE /_search/scroll? {"scroll_id":["s1"]}`)
+
+	pages = []string{`{"error":{"type":"index_not_found_exception","reason":"no such index"},"status":404}`}
+	requests = []string{}
+	err = conn.ScrollStream(nil, []string{"i"}, []string{}, func(hit Hit) error { return nil })
+	assertEqual(t, errors.Is(err, ErrNotFound), true)
+}
+
+func TestSearchIds(t *testing.T) {
+	pages := []string{
+		`{"_scroll_id":"s1","hits":{"total":3,"hits":[{"_id":"1","_type":"t"},{"_id":"2","_type":"t"}]}}`,
+		`{"_scroll_id":"s2","hits":{"total":3,"hits":[{"_id":"3","_type":"t"}]}}`,
+		`{"_scroll_id":"s3","hits":{"total":3,"hits":[]}}`,
+	}
+	requests := []string{}
+
+	conn := fakeConnection(t, "5.6.16", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery+" "+string(body))
+		if r.Method == "DELETE" {
+			io.WriteString(w, `{"succeeded":true}`)
+			return
+		}
+		io.WriteString(w, pages[len(requests)-1])
+	})
+
+	ids, err := conn.SearchIds(nil, []string{"i"}, []string{})
+	assertNoError(t, err)
+	assertEqual(t, ids, []string{"1", "2"})
+	assertEqual(t, requests, []string{"POST /i/_search?_source=false null"})
+
+	requests = []string{}
+	ids = []string{}
+	err = conn.ScrollIds(nil, []string{"i"}, []string{}, func(page []string) error {
+		ids = append(ids, page...)
+		return nil
+	})
+	assertNoError(t, err)
+	assertEqual(t, ids, []string{"1", "2", "3"})
+	assertEqual(t, requests, []string{
+		"POST /i/_search?_source=false&scroll=1m&size=500&sort=_doc null",
+		`POST /_search/scroll?scroll=1m {"scroll":"1m","scroll_id":"s1"}`,
+		`POST /_search/scroll?scroll=1m {"scroll":"1m","scroll_id":"s2"}`,
+		`DELETE /_search/scroll? {"scroll_id":["s3"]}`,
+	})
+
+	// the _source can not be left out before 1.0
+	requests = []string{}
+	conn.Version = "0.90.13"
+	_, err = conn.SearchIds(nil, []string{"i"}, []string{})
+	assertNoError(t, err)
+	assertEqual(t, requests, []string{"POST /i/_search? null"})
+}
+
+func TestCloneIndexBlocks(t *testing.T) {
+	requests := []string{}
+
+	conn := fakeConnection(t, "7.10.2", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+string(body))
+		io.WriteString(w, `{"acknowledged":true}`)
+	})
+
+	resp, err := conn.CloneIndex("src", "dst")
+	assertNoError(t, err)
+	assertEqual(t, resp.Acknowledged, true)
+	assertEqual(t, requests, []string{
+		`PUT /src/_settings {"index.blocks.write":true}`,
+		`POST /src/_clone/dst {"settings":{"index.blocks.write":null}}`,
+		`PUT /src/_settings {"index.blocks.write":null}`,
+	})
+}
+
+func TestCloneIndexCopyFailures(t *testing.T) {
+	bulk := `{"took":1,"errors":false,"items":[{"index":{"_id":"1","status":201}},{"index":{"_id":"2","status":201}}]}`
+
+	conn := fakeConnection(t, "5.6.16", func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/src/":
+			io.WriteString(w, `{"src":{"settings":{},"mappings":{}}}`)
+		case r.URL.Path == "/src/_search":
+			io.WriteString(w, `{"_scroll_id":"s1","hits":{"total":2,"hits":[{"_id":"1","_type":"t","_source":{}},{"_id":"2","_type":"t","_source":{}}]}}`)
+		case r.URL.Path == "/dst/_bulk":
+			io.WriteString(w, bulk)
+		case r.URL.Path == "/_search/scroll" && r.Method == "POST":
+			io.WriteString(w, `{"hits":{"total":2,"hits":[]}}`)
+		default:
+			io.WriteString(w, `{"acknowledged":true}`)
+		}
+	})
+
+	_, err := conn.CloneIndex("src", "dst")
+	assertNoError(t, err)
+
+	// the documents rejected by the bulk requests fail the copy
+	bulk = `{"took":1,"errors":true,"items":[{"index":{"_id":"1","status":201}},` +
+		`{"index":{"_id":"2","status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse [age]"}}}]}`
+	_, err = conn.CloneIndex("src", "dst")
+	assertEqual(t, err.Error(), "1 documents could not be copied to dst, 2: mapper_parsing_exception: failed to parse [age]")
+
+	// a Standby backfill skips the documents which already exist
+	bulk = `{"took":1,"errors":true,"items":[{"create":{"_id":"1","status":409,"error":{"type":"version_conflict_engine_exception","reason":"document already exists"}}}]}`
+	assertNoError(t, conn.copyDocuments("src", "dst", BULK_COMMAND_CREATE))
+}
+
+func TestDocumentMetadataRequests(t *testing.T) {
+	d := Document{
+		Index:       "i",
+		Type:        "t",
+		Id:          "1",
+		Routing:     "user1",
+		Parent:      "p1",
+		TTL:         "1d",
+		Version:     1,
+		BulkCommand: BULK_COMMAND_INDEX,
+		Fields:      map[string]interface{}{"user": "foo"},
+	}
+
+	extraArgs := url.Values{"refresh": {"true"}}
+
+	testRequests(t, "1.7.5", []requestCase{
+		{
+			name:     "index",
+			response: `{}`,
+			call: func(t *testing.T, conn *Connection) error {
+				_, err := conn.Index(d, extraArgs)
+				return err
+			},
+			requests: []string{`PUT /i/t/1/?parent=p1&refresh=true&routing=user1&ttl=1d&version=1 {"user":"foo"}`},
+		},
+		{
+			name:     "delete",
+			response: `{}`,
+			call: func(t *testing.T, conn *Connection) error {
+				_, err := conn.Delete(d, extraArgs)
+				return err
+			},
+			requests: []string{"DELETE /i/t/1/?parent=p1&refresh=true&routing=user1&version=1 null"},
+		},
+		{
+			name:     "bulk",
+			response: `{}`,
+			call: func(t *testing.T, conn *Connection) error {
+				_, err := conn.BulkSend("i", []Document{d})
+				return err
+			},
+			requests: []string{"POST /i/_bulk " + `{"index":{"_id":"1","_index":"i","_parent":"p1","_routing":"user1","_ttl":"1d","_type":"t","_version":1}}` + "\n" + `{"user":"foo"}` + "\n"},
+		},
+		{
+			name:     "multi get",
+			response: `{}`,
+			call: func(t *testing.T, conn *Connection) error {
+				_, err := conn.MultiGet([]Document{d}, SourceFilter{}, url.Values{})
+				return err
+			},
+			requests: []string{`POST /_mget {"docs":[{"_id":"1","_index":"i","_routing":"user1","_type":"t"}]}`},
+		},
+		{
+			name:     "search",
+			response: `{}`,
+			call: func(t *testing.T, conn *Connection) error {
+				_, err := conn.SearchWithRouting(nil, []string{"i"}, []string{}, []string{"user1", "user2"})
+				return err
+			},
+			requests: []string{"POST /i/_search?routing=user1%2Cuser2 null"},
+		},
+	})
+
+	assertEqual(t, extraArgs, url.Values{"refresh": {"true"}})
+}
+
+func TestBulkMetadataNames(t *testing.T) {
+	cases := []struct {
+		name     string
+		document Document
+		metadata map[string]string
+	}{
+		{
+			name:     "routing",
+			document: Document{Id: "1", BulkCommand: BULK_COMMAND_DELETE, Routing: "user1"},
+			metadata: map[string]string{
+				"1.7.5":  `{"delete":{"_id":"1","_index":null,"_routing":"user1","_type":""}}`,
+				"6.8.23": `{"delete":{"_id":"1","_index":null,"_routing":"user1","_type":""}}`,
+				"7.10.2": `{"delete":{"_id":"1","_index":null,"_type":"","routing":"user1"}}`,
+			},
+		},
+		{
+			name:     "parent",
+			document: Document{Id: "1", BulkCommand: BULK_COMMAND_DELETE, Parent: "p1"},
+			metadata: map[string]string{
+				"1.7.5":  `{"delete":{"_id":"1","_index":null,"_parent":"p1","_type":""}}`,
+				"6.8.23": `{"delete":{"_id":"1","_index":null,"_parent":"p1","_type":""}}`,
+			},
+		},
+		{
+			name:     "version",
+			document: Document{Id: "1", BulkCommand: BULK_COMMAND_DELETE, Version: 2, VersionType: "external"},
+			metadata: map[string]string{
+				"1.7.5":  `{"delete":{"_id":"1","_index":null,"_type":"","_version":2,"_version_type":"external"}}`,
+				"6.8.23": `{"delete":{"_id":"1","_index":null,"_type":"","_version":2,"_version_type":"external"}}`,
+				"7.10.2": `{"delete":{"_id":"1","_index":null,"_type":"","version":2,"version_type":"external"}}`,
+			},
+		},
+		{
+			name:     "retry on conflict",
+			document: Document{Id: "1", BulkCommand: BULK_COMMAND_UPDATE, RetryOnConflict: 3},
+			metadata: map[string]string{
+				"1.7.5":  `{"update":{"_id":"1","_index":null,"_retry_on_conflict":3,"_type":""}}`,
+				"6.8.23": `{"update":{"_id":"1","_index":null,"_retry_on_conflict":3,"_type":""}}`,
+				"7.10.2": `{"update":{"_id":"1","_index":null,"_type":"","retry_on_conflict":3}}`,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		for version, metadata := range c.metadata {
+			t.Run(c.name+" "+version, func(t *testing.T) {
+				server, conn := newFakeServer(t, version)
+				server.answer(200, `{}`)
+
+				_, err := conn.BulkSend("i", []Document{c.document})
+				assertNoError(t, err)
+
+				payload := ""
+				if c.document.BulkCommand == BULK_COMMAND_UPDATE {
+					payload = "{}\n"
+				}
+				assertEqual(t, server.requests(), []string{"POST /i/_bulk " + metadata + "\n" + payload})
+			})
+		}
+	}
+}
+
+func TestBulkRemovedMetadata(t *testing.T) {
+	server, conn := newFakeServer(t, "7.10.2")
+
+	_, err := conn.BulkSend("i", []Document{{Id: "1", BulkCommand: BULK_COMMAND_DELETE, Parent: "p1"}})
+	assertEqual(t, err.Error(), "parent is not supported by elasticsearch 7.10.2")
+
+	_, err = conn.BulkSend("i", []Document{{Id: "1", BulkCommand: BULK_COMMAND_INDEX, TTL: "1d"}})
+	assertEqual(t, err.Error(), "ttl is not supported by elasticsearch 7.10.2")
+
+	assertEqual(t, len(server.requests()), 0)
+}
+
+func TestRouting(t *testing.T) {
+	indexName := "testrouting"
+	docType := "tweet"
+
+	conn := testConnection(t)
+	conn.DeleteIndex(indexName)
+
+	_, err := conn.CreateIndex(indexName, map[string]interface{}{})
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	d := Document{
+		Index:   indexName,
+		Type:    docType,
+		Id:      "1",
+		Routing: "user1",
+		Fields: map[string]interface{}{
+			"user": "foo",
+		},
+	}
+
+	_, err = conn.Index(d, url.Values{})
+	assertNoError(t, err)
+
+	response, err := conn.Get(indexName, docType, "1", url.Values{"routing": {"user1"}})
+	assertNoError(t, err)
+	assertEqual(t, response.Source, d.Fields)
+
+	_, err = conn.RefreshIndex(indexName)
+	assertNoError(t, err)
+
+	query := map[string]interface{}{
+		"query": map[string]interface{}{
+			"match_all": map[string]interface{}{},
+		},
+	}
+
+	response, err = conn.SearchWithRouting(query, []string{indexName}, []string{docType}, []string{"user1"})
+	assertNoError(t, err)
+	assertEqual(t, response.Hits.Total, uint64(1))
+
+	response, err = conn.Delete(d, url.Values{})
+	assertNoError(t, err)
+	assertEqual(t, response.Found, true)
+}
+
+func TestAllocationRequests(t *testing.T) {
+	testRequests(t, "1.7.5", []requestCase{
+		{
+			name:     "attributes",
+			response: `{"cluster_name":"c","nodes":{"n1":{"name":"node1","attributes":{"rack":"r1"}},"n2":{"name":"node2","attributes":{"rack":"r2"}}}}`,
+			call: func(t *testing.T, conn *Connection) error {
+				attributes, err := conn.NodeAttributes()
+				assertEqual(t, attributes, map[string]map[string]string{
+					"node1": {"rack": "r1"},
+					"node2": {"rack": "r2"},
+				})
+				return err
+			},
+			requests: []string{"GET /_nodes null"},
+		},
+		{
+			name:     "include",
+			response: `{"acknowledged":true}`,
+			call: func(t *testing.T, conn *Connection) error {
+				_, err := conn.SetAllocationFilter("i", ALLOCATION_INCLUDE, "rack", []string{"r1", "r2"})
+				return err
+			},
+			requests: []string{`PUT /i/_settings {"index.routing.allocation.include.rack":"r1,r2"}`},
+		},
+		{
+			name:     "clear exclude",
+			response: `{"acknowledged":true}`,
+			call: func(t *testing.T, conn *Connection) error {
+				_, err := conn.SetAllocationFilter("i", ALLOCATION_EXCLUDE, "rack", nil)
+				return err
+			},
+			requests: []string{`PUT /i/_settings {"index.routing.allocation.exclude.rack":null}`},
+		},
+		{
+			name:     "still relocating",
+			response: `{"cluster_name":"c","status":"green","timed_out":true,"relocating_shards":2}`,
+			call: func(t *testing.T, conn *Connection) error {
+				return conn.WaitForRelocation("i", "1s")
+			},
+			requests: []string{"GET /_cluster/health/i?timeout=1s&wait_for_relocating_shards=0 null"},
+			err:      "2 shards of i are still relocating after 1s",
+		},
+	})
+}
+
+func TestAllocationFilter(t *testing.T) {
+	indexName := "testallocationfilter"
+
+	conn := testConnection(t)
+	conn.DeleteIndex(indexName)
+
+	_, err := conn.CreateIndex(indexName, map[string]interface{}{})
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	attributes, err := conn.NodeAttributes()
+	assertNoError(t, err)
+	assertEqual(t, len(attributes) > 0, true)
+
+	names := []string{}
+	for name := range attributes {
+		names = append(names, name)
+	}
+
+	_, err = conn.SetAllocationFilter(indexName, ALLOCATION_INCLUDE, "_name", names)
+	assertNoError(t, err)
+
+	err = conn.WaitForRelocation(indexName, "30s")
+	assertNoError(t, err)
+
+	descriptor, err := conn.DescribeIndex(indexName)
+	assertNoError(t, err)
+	assertEqual(t, descriptor.Settings["index.routing.allocation.include._name"], strings.Join(names, ","))
+}
+
+func TestParentChild(t *testing.T) {
+	indexName := "testparentchild"
+
+	conn := testConnection(t)
+	SkipUnlessVersion(t, conn, VersionRange{"1.5.0", "6.0.0"})
+	conn.DeleteIndex(indexName)
+
+	mapping := map[string]interface{}{
+		"mappings": map[string]interface{}{
+			"comment": map[string]interface{}{
+				"_parent": map[string]interface{}{
+					"type": "tweet",
+				},
+			},
+		},
+	}
+
+	_, err := conn.CreateIndex(indexName, mapping)
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	docs := []Document{
+		{
+			Index:       indexName,
+			Type:        "tweet",
+			Id:          "1",
+			BulkCommand: BULK_COMMAND_INDEX,
+			Fields:      map[string]interface{}{"message": "foo"},
+		},
+		{
+			Index:       indexName,
+			Type:        "comment",
+			Id:          "2",
+			Parent:      "1",
+			BulkCommand: BULK_COMMAND_INDEX,
+			Fields:      map[string]interface{}{"text": "bar"},
+		},
+	}
+
+	_, err = conn.BulkSend(indexName, docs)
+	assertNoError(t, err)
+
+	_, err = conn.RefreshIndex(indexName)
+	assertNoError(t, err)
+
+	query := map[string]interface{}{
+		"query": map[string]interface{}{
+			"has_child": map[string]interface{}{
+				"type": "comment",
+				"query": map[string]interface{}{
+					"match": map[string]interface{}{"text": "bar"},
+				},
+				"inner_hits": map[string]interface{}{},
+			},
+		},
+	}
+
+	response, err := conn.Search(query, []string{indexName}, []string{"tweet"})
+	assertNoError(t, err)
+	assertEqual(t, response.Hits.Total, uint64(1))
+
+	children := response.Hits.Hits[0].InnerHits["comment"].Hits
+	assertEqual(t, children.Total, uint64(1))
+	assertEqual(t, children.Hits[0].Id, "2")
+	assertEqual(t, children.Hits[0].Source, map[string]interface{}{"text": "bar"})
+
+	_, err = conn.Delete(docs[1], url.Values{})
+	assertNoError(t, err)
+}
+
+func TestBulkResults(t *testing.T) {
+	body, err := os.ReadFile(filepath.Join("testdata", "responses", "0.90-bulk-200.json"))
+	assertNoError(t, err)
+
+	response, err := decodeResponse(200, body)
+	assertNoError(t, err)
+
+	docs := []Document{
+		{Index: "testbulkadd", Type: "tweet", Id: "123", BulkCommand: BULK_COMMAND_INDEX},
+		{Index: "testbulkadd", Type: "tweet", Id: "456", BulkCommand: BULK_COMMAND_DELETE},
+	}
+
+	results, err := response.BulkResults(docs)
+	assertNoError(t, err)
+	assertEqual(t, results, []BulkResult{
+		{
+			Document: docs[0],
+			Command:  BULK_COMMAND_INDEX,
+			Item:     Item{Ok: true, Type: "tweet", Id: "123", Index: "testbulkadd", Version: 1},
+		},
+		{
+			Document: docs[1],
+			Command:  BULK_COMMAND_DELETE,
+			Item:     Item{Ok: true, Type: "tweet", Id: "456", Index: "testbulkadd", Version: 2},
+		},
+	})
+
+	_, err = response.BulkResults(docs[:1])
+	assertEqual(t, err.Error(), "2 items for 1 documents")
+}
+
+func TestValidateField(t *testing.T) {
+	fields := map[string]FieldDescriptor{
+		"user":         {Path: "user", Type: "string"},
+		"age":          {Path: "age", Type: "integer"},
+		"active":       {Path: "active", Type: "boolean"},
+		"created":      {Path: "created", Type: "date"},
+		"location":     {Path: "location", Type: "geo_point"},
+		"address.city": {Path: "address.city", Type: "string"},
+	}
+
+	valid := map[string]interface{}{
+		"user":     "foo",
+		"age":      float64(31),
+		"active":   true,
+		"created":  "2014-01-01",
+		"location": map[string]interface{}{"lat": 1.5, "lon": 2.5},
+		"address":  map[string]interface{}{"city": "Paris"},
+	}
+
+	for name, value := range valid {
+		if err := validateField(fields, name, value); err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+	}
+
+	assertEqual(t, validateField(fields, "age", []interface{}{1, 2}) == nil, true)
+	assertEqual(t, validateField(fields, "user", nil) == nil, true)
+
+	assertEqual(t, validateField(fields, "age", "31"), &ValidationError{Field: "age", Reason: "string value for a integer field"})
+	assertEqual(t, validateField(fields, "tags", "foo"), &ValidationError{Field: "tags", Reason: "not in the mapping"})
+	assertEqual(t, validateField(fields, "address", map[string]interface{}{"zip": 1}), &ValidationError{Field: "address.zip", Reason: "not in the mapping"})
+	assertEqual(t, validateField(fields, "active", []interface{}{true, "no"}), &ValidationError{Field: "active", Reason: "string value for a boolean field"})
+
+	// objects of other map types
+	assertEqual(t, validateField(fields, "address", map[string]string{"city": "Paris"}) == nil, true)
+	assertEqual(t, validateField(fields, "address", map[string]int{"city": 75}), &ValidationError{Field: "address.city", Reason: "int value for a string field"})
+	assertEqual(t, validateField(fields, "address", map[string]string{"zip": "75001"}), &ValidationError{Field: "address.zip", Reason: "not in the mapping"})
+}
+
+func TestValidateDocuments(t *testing.T) {
+	requests := []string{}
+
+	conn := fakeConnection(t, "1.7.5", func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+
+		if r.URL.Path == "/i/_mapping" {
+			io.WriteString(w, `{"i":{"mappings":{"tweet":{"properties":{"user":{"type":"string"}}}}}}`)
+			return
+		}
+		io.WriteString(w, `{"_index":"i"}`)
+	})
+	conn.ValidateDocuments = true
+
+	d := Document{
+		Index:       "i",
+		Type:        "tweet",
+		Id:          "1",
+		BulkCommand: BULK_COMMAND_INDEX,
+		Fields:      map[string]interface{}{"user": "foo"},
+	}
+
+	_, err := conn.Index(d, url.Values{})
+	assertNoError(t, err)
+
+	d.Fields = map[string]interface{}{"user": 1}
+	_, err = conn.Index(d, url.Values{})
+	assertEqual(t, err.Error(), "i/tweet: field user: int value for a string field")
+
+	d.Fields = map[string]interface{}{"usr": "foo"}
+	_, err = conn.BulkSend("i", []Document{d})
+	assertEqual(t, err.Error(), "i/tweet: field usr: not in the mapping")
+
+	// types without a mapping are not checked
+	d.Type = "retweet"
+	_, err = conn.BulkSend("i", []Document{d})
+	assertNoError(t, err)
+
+	assertEqual(t, requests, []string{"GET /i/_mapping", "PUT /i/tweet/1/", "POST /i/_bulk"})
+
+	conn.InvalidateMapping("i")
+	_, err = conn.BulkSend("i", []Document{d})
+	assertNoError(t, err)
+	assertEqual(t, requests[3:], []string{"GET /i/_mapping", "POST /i/_bulk"})
+}
+
+func TestVersionRequests(t *testing.T) {
+	server, conn := newFakeServer(t, "1.7.5")
+	server.answer(200, `{}`)
+
+	d := Document{
+		Index:       "i",
+		Type:        "t",
+		Id:          "1",
+		Version:     2,
+		VersionType: VERSION_TYPE_EXTERNAL,
+		BulkCommand: BULK_COMMAND_INDEX,
+		Fields:      map[string]interface{}{"user": "foo"},
+	}
+
+	_, err := conn.Index(d, url.Values{})
+	assertNoError(t, err)
+	_, err = conn.BulkSend("i", []Document{d})
+	assertNoError(t, err)
+
+	server.answer(409, `{"error":"VersionConflictEngineException[[i][2] [t][1]: version conflict, current [3], provided [2]]","status":409}`)
+	_, err = conn.Delete(d, url.Values{})
+	assertEqual(t, err.Error(), "[409] VersionConflictEngineException[[i][2] [t][1]: version conflict, current [3], provided [2]]")
+
+	var conflict *VersionConflictError
+	assertEqual(t, errors.As(err, &conflict), true)
+	assertEqual(t, conflict.Id, "1")
+	assertEqual(t, conflict.Version, int64(2))
+
+	var searchErr *SearchError
+	assertEqual(t, errors.As(err, &searchErr), true)
+	assertEqual(t, searchErr.StatusCode, uint64(409))
+
+	var elasticErr *ElasticError
+	assertEqual(t, errors.As(err, &elasticErr), true)
+	assertEqual(t, elasticErr.ErrorType, "VersionConflictEngineException")
+
+	assertEqual(t, server.requests(), []string{
+		`PUT /i/t/1/?version=2&version_type=external {"user":"foo"}`,
+		"POST /i/_bulk " + `{"index":{"_id":"1","_index":"i","_type":"t","_version":2,"_version_type":"external"}}` + "\n" + `{"user":"foo"}` + "\n",
+		"DELETE /i/t/1/?version=2&version_type=external null",
+	})
+}
+
+func TestVersionConflict(t *testing.T) {
+	indexName := "testversionconflict"
+	docType := "tweet"
+
+	conn := testConnection(t)
+	conn.DeleteIndex(indexName)
+
+	_, err := conn.CreateIndex(indexName, map[string]interface{}{})
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	d := Document{
+		Index:       indexName,
+		Type:        docType,
+		Id:          "1",
+		Version:     5,
+		VersionType: VERSION_TYPE_EXTERNAL,
+		Fields: map[string]interface{}{
+			"user": "foo",
+		},
+	}
+
+	_, err = conn.Index(d, url.Values{})
+	assertNoError(t, err)
+
+	d.Version = 3
+	_, err = conn.Index(d, url.Values{})
+	_, ok := err.(*VersionConflictError)
+	assertEqual(t, ok, true)
+
+	d.Version = 6
+	_, err = conn.Index(d, url.Values{})
+	assertNoError(t, err)
+}
+
+func TestCreate(t *testing.T) {
+	indexName := "testcreate"
+	docType := "tweet"
+
+	conn := testConnection(t)
+	conn.DeleteIndex(indexName)
+
+	_, err := conn.CreateIndex(indexName, map[string]interface{}{})
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	d := Document{
+		Index: indexName,
+		Type:  docType,
+		Id:    "1",
+		Fields: map[string]interface{}{
+			"user": "foo",
+		},
+	}
+
+	_, err = conn.Create(d, url.Values{})
+	assertNoError(t, err)
+
+	_, err = conn.Create(d, url.Values{})
+	exists, ok := err.(*DocumentExistsError)
+	assertEqual(t, ok, true)
+	assertEqual(t, exists.Id, "1")
+}
+
+func TestCreateRequests(t *testing.T) {
+	server, conn := newFakeServer(t, "1.7.5")
+	server.answer(409, `{"error":"DocumentAlreadyExistsException[[i][2] [t][1]: document already exists]","status":409}`)
+
+	d := Document{
+		Index:  "i",
+		Type:   "t",
+		Id:     "1",
+		Fields: map[string]interface{}{"user": "foo"},
+	}
+
+	extraArgs := url.Values{"refresh": {"true"}}
+
+	_, err := conn.Create(d, extraArgs)
+	assertEqual(t, err.Error(), "[409] DocumentAlreadyExistsException[[i][2] [t][1]: document already exists]")
+
+	var exists *DocumentExistsError
+	assertEqual(t, errors.As(err, &exists), true)
+	assertEqual(t, exists.Index, "i")
+
+	var elasticErr *ElasticError
+	assertEqual(t, errors.As(err, &elasticErr), true)
+	assertEqual(t, elasticErr.ErrorType, "DocumentAlreadyExistsException")
+
+	assertEqual(t, extraArgs, url.Values{"refresh": {"true"}})
+	assertEqual(t, server.requests(), []string{`PUT /i/t/1/?op_type=create&refresh=true {"user":"foo"}`})
+}
+
+func TestWriteResultRequests(t *testing.T) {
+	responses := []string{
+		// 0.90
+		`{"ok":true,"_index":"i","_type":"t","_id":"1","_version":1}`,
+		// 1.x
+		`{"_index":"i","_type":"t","_id":"1","_version":1,"created":true}`,
+		`{"_index":"i","_type":"t","_id":"1","_version":2,"created":false}`,
+		`{"found":true,"_index":"i","_type":"t","_id":"1","_version":3}`,
+		`{"found":false,"_index":"i","_type":"t","_id":"1","_version":4}`,
+		// 7.x
+		`{"_index":"i","_type":"_doc","_id":"1","_version":1,"result":"created","_shards":{"total":2,"successful":1,"failed":0}}`,
+		`{"_index":"i","_type":"_doc","_id":"1","_version":2,"result":"updated","_shards":{"total":2,"successful":1,"failed":0}}`,
+		`{"_index":"i","_type":"_doc","_id":"1","_version":3,"result":"deleted","_shards":{"total":2,"successful":1,"failed":0}}`,
+		`{"_index":"i","_type":"_doc","_id":"1","_version":4,"result":"not_found","_shards":{"total":2,"successful":1,"failed":0}}`,
+	}
+
+	conn := fakeConnection(t, "0.90.13", func(w http.ResponseWriter, r *http.Request) {
+		response := responses[0]
+		responses = responses[1:]
+
+		if strings.Contains(response, "not_found") || strings.Contains(response, `"found":false`) {
+			w.WriteHeader(404)
+		}
+		fmt.Fprint(w, response)
+	})
+
+	d := Document{Index: "i", Type: "t", Id: "1", Fields: map[string]interface{}{"user": "foo"}}
+
+	// the result is unknown
+	response, err := conn.Index(d, url.Values{})
+	assertNoError(t, err)
+	assertEqual(t, response.Ok, true)
+	assertEqual(t, response.Result, "")
+	assertEqual(t, response.Created, false)
+
+	conn.Version = "1.7.5"
+
+	for _, expected := range []string{RESULT_CREATED, RESULT_UPDATED} {
+		response, err := conn.Index(d, url.Values{})
+		assertNoError(t, err)
+		assertEqual(t, response.Ok, true)
+		assertEqual(t, response.Result, expected)
+		assertEqual(t, response.Created, expected == RESULT_CREATED)
+	}
+
+	for _, expected := range []string{RESULT_DELETED, RESULT_NOT_FOUND} {
+		response, err := conn.Delete(d, url.Values{})
+		assertNoError(t, err)
+		assertEqual(t, response.Result, expected)
+		assertEqual(t, response.Found, expected == RESULT_DELETED)
+	}
+
+	conn.Version = "7.10.2"
+	d.Type = "_doc"
+
+	for _, expected := range []string{RESULT_CREATED, RESULT_UPDATED} {
+		response, err := conn.Index(d, url.Values{})
+		assertNoError(t, err)
+		assertEqual(t, response.Ok, true)
+		assertEqual(t, response.Result, expected)
+		assertEqual(t, response.Created, expected == RESULT_CREATED)
+	}
+
+	for _, expected := range []string{RESULT_DELETED, RESULT_NOT_FOUND} {
+		response, err := conn.Delete(d, url.Values{})
+		assertNoError(t, err)
+		assertEqual(t, response.Ok, expected == RESULT_DELETED)
+		assertEqual(t, response.Result, expected)
+		assertEqual(t, response.Found, expected == RESULT_DELETED)
+	}
+}
+
+func TestWriteResultIgnoredError(t *testing.T) {
+	server, conn := newFakeServer(t, "1.7.5")
+	server.answer(503, `{"error":"UnavailableShardsException[[i][0] Primary shard is not active]","status":503}`)
+	conn.ErrorPolicy = &StatusErrorPolicy{Ignored: []uint64{503}}
+
+	d := Document{Index: "i", Type: "t", Id: "1", Fields: map[string]interface{}{"user": "foo"}}
+
+	// nothing was written
+	response, err := conn.Index(d, url.Values{})
+	assertNoError(t, err)
+	assertEqual(t, response.Result, "")
+	assertEqual(t, response.Created, false)
+
+	response, err = conn.Delete(d, url.Values{})
+	assertNoError(t, err)
+	assertEqual(t, response.Result, "")
+	assertEqual(t, response.Found, false)
+}
+
+func TestMappingConflicts(t *testing.T) {
+	body, err := os.ReadFile(filepath.Join("testdata", "responses", "5.6-bulk-200.json"))
+	assertNoError(t, err)
+
+	response, err := decodeResponse(200, body)
+	assertNoError(t, err)
+	assertEqual(t, response.Errors, true)
+	assertEqual(t, response.Items[1]["index"].Status, 400)
+	assertEqual(t, response.Items[1]["index"].Error, BulkError{Type: "mapper_parsing_exception", Reason: "failed to parse [age]"})
+
+	assertEqual(t, response.MappingConflicts(), []MappingConflict{
+		{Index: "test", Type: "doc", Field: "age", Count: 1, Reason: "failed to parse [age]"},
+	})
+
+	response = Response{}
+	err = json.Unmarshal([]byte(`{"items":[
+		{"index":{"_index":"logs","_type":"event","_id":"1","status":400,"error":"MapperParsingException[failed to parse [status]]; nested: NumberFormatException[For input string: \"ok\"]; "}},
+		{"index":{"_index":"logs","_type":"event","_id":"2","status":400,"error":{"type":"illegal_argument_exception","reason":"mapper [host] of different type, current_type [long], merged_type [text]"}}},
+		{"index":{"_index":"logs","_type":"event","_id":"3","status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse field [status] of type [long] in document with id '3'"}}},
+		{"index":{"_index":"logs","_type":"event","_id":"4","status":429,"error":{"type":"es_rejected_execution_exception","reason":"rejected execution"}}},
+		{"index":{"_index":"logs","_type":"event","_id":"5","status":201}}
+	]}`), &response)
+	assertNoError(t, err)
+
+	assertEqual(t, response.MappingConflicts(), []MappingConflict{
+		{Index: "logs", Type: "event", Field: "host", Count: 1, Reason: "mapper [host] of different type, current_type [long], merged_type [text]"},
+		{Index: "logs", Type: "event", Field: "status", Count: 2, Reason: `MapperParsingException[failed to parse [status]]; nested: NumberFormatException[For input string: "ok"]; `},
+	})
+}
+
+func TestMappingConflictHook(t *testing.T) {
+	body, err := os.ReadFile(filepath.Join("testdata", "responses", "5.6-bulk-200.json"))
+	assertNoError(t, err)
+
+	conn := fakeConnection(t, "5.6.16", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	})
+
+	reported := [][]MappingConflict{}
+	conn.MappingConflictHook = func(conflicts []MappingConflict) {
+		reported = append(reported, conflicts)
+	}
+
+	d := Document{
+		Index:       "test",
+		Type:        "doc",
+		Id:          "2",
+		BulkCommand: BULK_COMMAND_INDEX,
+		Fields:      map[string]interface{}{"age": "abc"},
+	}
+
+	_, err = conn.BulkSend("test", []Document{d})
+	assertNoError(t, err)
+
+	assertEqual(t, reported, [][]MappingConflict{
+		{{Index: "test", Type: "doc", Field: "age", Count: 1, Reason: "failed to parse [age]"}},
+	})
+}
+
+func TestGetSource(t *testing.T) {
+	indexName := "testgetsource"
+	docType := "tweet"
+
+	conn := testConnection(t)
+	conn.DeleteIndex(indexName)
+
+	_, err := conn.CreateIndex(indexName, map[string]interface{}{})
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	d := Document{
+		Index: indexName,
+		Type:  docType,
+		Id:    "1",
+		Fields: map[string]interface{}{
+			"user": "foo",
+			"age":  31,
+		},
+	}
+
+	_, err = conn.Index(d, url.Values{})
+	assertNoError(t, err)
+
+	var tweet struct {
+		User string
+		Age  int
+	}
+	err = conn.GetSource(indexName, docType, "1", &tweet, url.Values{})
+	assertNoError(t, err)
+	assertEqual(t, tweet.User, "foo")
+	assertEqual(t, tweet.Age, 31)
+
+	err = conn.GetSource(indexName, docType, "2", &tweet, url.Values{})
+	searchErr, ok := err.(*SearchError)
+	assertEqual(t, ok, true)
+	assertEqual(t, searchErr.StatusCode, uint64(404))
+}
+
+func TestGetSourceRequests(t *testing.T) {
+	server, conn := newFakeServer(t, "1.7.5")
+	server.answer(200, `{"user":"foo"}`)
+
+	source := map[string]interface{}{}
+	err := conn.GetSource("i", "t", "1", &source, url.Values{"routing": {"user1"}})
+	assertNoError(t, err)
+	assertEqual(t, source, map[string]interface{}{"user": "foo"})
+
+	server.answer(404, "")
+	err = conn.GetSource("i", "t", "2", &source, url.Values{})
+	assertEqual(t, err, error(newSearchError(404, "")))
+
+	conn.ErrorPolicy = &StatusErrorPolicy{Ignored: []uint64{404}}
+	source = map[string]interface{}{}
+	err = conn.GetSource("i", "t", "2", &source, url.Values{})
+	assertNoError(t, err)
+	assertEqual(t, source, map[string]interface{}{})
+
+	assertEqual(t, server.requests(), []string{
+		"GET /i/t/1/_source?routing=user1 null",
+		"GET /i/t/2/_source null",
+		"GET /i/t/2/_source null",
+	})
+}
+
+func TestIdGenerators(t *testing.T) {
+	uuid := UUIDGenerator{}.NewId()
+	if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(uuid) {
+		t.Errorf("invalid UUID %s", uuid)
+	}
+
+	assertEqual(t, newULID(time.UnixMilli(1469918176385))[:10], "01ARYZ6S41")
+	ulid := ULIDGenerator{}.NewId()
+	if !regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`).MatchString(ulid) {
+		t.Errorf("invalid ULID %s", ulid)
+	}
+
+	flake := &FlakeGenerator{Node: 3}
+	last := int64(0)
+	for i := 0; i < 5000; i++ {
+		id, err := strconv.ParseInt(flake.NewId(), 10, 64)
+		assertNoError(t, err)
+		if id <= last {
+			t.Fatalf("id %d after %d", id, last)
+		}
+		assertEqual(t, id>>12&0x3ff, int64(3))
+		last = id
+	}
+}
+
+func TestIdGenerator(t *testing.T) {
+	requests := []string{}
+
+	conn := fakeConnection(t, "1.7.5", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+string(body))
+		io.WriteString(w, `{}`)
+	})
+	conn.IdGenerator = &FlakeGenerator{}
+
+	d := Document{
+		Index:       "i",
+		Type:        "t",
+		BulkCommand: BULK_COMMAND_INDEX,
+		Fields:      map[string]interface{}{"user": "foo"},
+	}
+
+	_, err := conn.Index(d, url.Values{})
+	assertNoError(t, err)
+	assertEqual(t, d.Id, nil)
+
+	documents := []Document{d, {Index: "i", Type: "t", Id: "2", BulkCommand: BULK_COMMAND_INDEX}}
+	_, err = conn.BulkSend("i", documents)
+	assertNoError(t, err)
+	assertEqual(t, documents[1].Id, "2")
+
+	id, ok := documents[0].Id.(string)
+	assertEqual(t, ok, true)
+
+	assertEqual(t, strings.HasPrefix(requests[0], "PUT /i/t/"), true)
+	assertEqual(t, strings.Contains(requests[1], `"_id":"`+id+`"`), true)
+}
+
+func TestBulkUpdateRequests(t *testing.T) {
+	server, conn := newFakeServer(t, "1.7.5")
+	server.answer(200, `{}`)
+
+	documents := []Document{
+		{
+			Index:           "i",
+			Type:            "t",
+			Id:              "1",
+			BulkCommand:     BULK_COMMAND_UPDATE,
+			Fields:          map[string]interface{}{"user": "foo"},
+			RetryOnConflict: 3,
+		},
+		{
+			Index:       "i",
+			Type:        "t",
+			Id:          "2",
+			BulkCommand: BULK_COMMAND_UPDATE,
+			Script: map[string]interface{}{
+				"inline": "ctx._source.count += n",
+				"params": map[string]interface{}{"n": 1},
+			},
+		},
+	}
+
+	_, err := conn.BulkSend("i", documents)
+	assertNoError(t, err)
+
+	assertEqual(t, server.requests(), []string{
+		"POST /i/_bulk " +
+			`{"update":{"_id":"1","_index":"i","_retry_on_conflict":3,"_type":"t"}}` + "\n" +
+			`{"doc":{"user":"foo"}}` + "\n" +
+			`{"update":{"_id":"2","_index":"i","_type":"t"}}` + "\n" +
+			`{"script":{"inline":"ctx._source.count += n","params":{"n":1}}}` + "\n",
+	})
+}
+
+func TestBulkUpdate(t *testing.T) {
+	indexName := "testbulkupdate"
+	docType := "tweet"
+
+	conn := testConnection(t)
+	conn.DeleteIndex(indexName)
+
+	_, err := conn.CreateIndex(indexName, map[string]interface{}{})
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	_, err = conn.Index(Document{
+		Index:  indexName,
+		Type:   docType,
+		Id:     "1",
+		Fields: map[string]interface{}{"user": "foo", "age": 31},
+	}, url.Values{})
+	assertNoError(t, err)
+
+	_, err = conn.BulkSend(indexName, []Document{{
+		Index:           indexName,
+		Type:            docType,
+		Id:              "1",
+		BulkCommand:     BULK_COMMAND_UPDATE,
+		Fields:          map[string]interface{}{"user": "bar"},
+		RetryOnConflict: 3,
+	}})
+	assertNoError(t, err)
+
+	response, err := conn.Get(indexName, docType, "1", url.Values{})
+	assertNoError(t, err)
+	assertEqual(t, response.Source, map[string]interface{}{"user": "bar", "age": float64(31)})
+}
+
+func TestBulkCreateResults(t *testing.T) {
+	response := Response{}
+	err := json.Unmarshal([]byte(`{"errors":true,"items":[
+		{"create":{"_index":"i","_type":"t","_id":"1","_version":1,"status":201}},
+		{"create":{"_index":"i","_type":"t","_id":"2","status":409,"error":"DocumentAlreadyExistsException[[i][1] [t][2]: document already exists]"}},
+		{"create":{"_index":"i","_type":"t","_id":"3","error":"DocumentAlreadyExistsException[[i][3] [t][3]: document already exists]"}},
+		{"index":{"_index":"i","_type":"t","_id":"4","_version":2,"status":200}}
+	]}`), &response)
+	assertNoError(t, err)
+
+	docs := []Document{
+		{Index: "i", Type: "t", Id: "1", BulkCommand: BULK_COMMAND_CREATE},
+		{Index: "i", Type: "t", Id: "2", BulkCommand: BULK_COMMAND_CREATE},
+		{Index: "i", Type: "t", Id: "3", BulkCommand: BULK_COMMAND_CREATE},
+		{Index: "i", Type: "t", Id: "4", BulkCommand: BULK_COMMAND_INDEX},
+	}
+
+	results, err := response.BulkResults(docs)
+	assertNoError(t, err)
+
+	exists := []bool{}
+	for _, result := range results {
+		exists = append(exists, result.Exists)
+	}
+	assertEqual(t, exists, []bool{false, true, true, false})
+}
+
+func TestBulkCreate(t *testing.T) {
+	indexName := "testbulkcreate"
+	docType := "tweet"
+
+	conn := testConnection(t)
+	conn.DeleteIndex(indexName)
+
+	_, err := conn.CreateIndex(indexName, map[string]interface{}{})
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	docs := []Document{
+		{
+			Index:       indexName,
+			Type:        docType,
+			Id:          "1",
+			BulkCommand: BULK_COMMAND_CREATE,
+			Fields:      map[string]interface{}{"user": "foo"},
+		},
+	}
+
+	response, err := conn.BulkSend(indexName, docs)
+	assertNoError(t, err)
+	results, err := response.BulkResults(docs)
+	assertNoError(t, err)
+	assertEqual(t, results[0].Exists, false)
+
+	response, err = conn.BulkSend(indexName, docs)
+	assertNoError(t, err)
+	results, err = response.BulkResults(docs)
+	assertNoError(t, err)
+	assertEqual(t, results[0].Exists, true)
+}
+
+func TestBulkFailed(t *testing.T) {
+	body, err := os.ReadFile(filepath.Join("testdata", "responses", "5.6-bulk-200.json"))
+	assertNoError(t, err)
+
+	response, err := decodeResponse(200, body)
+	assertNoError(t, err)
+
+	failed := response.Failed()
+	assertEqual(t, len(failed), 1)
+	assertEqual(t, failed[0].Position, 1)
+	assertEqual(t, failed[0].Command, BULK_COMMAND_INDEX)
+	assertEqual(t, failed[0].Id, "2")
+	assertEqual(t, failed[0].Status, 400)
+	assertEqual(t, failed[0].Error.String(), "mapper_parsing_exception: failed to parse [age]")
+
+	body, err = os.ReadFile(filepath.Join("testdata", "responses", "0.90-bulk-200.json"))
+	assertNoError(t, err)
+
+	response, err = decodeResponse(200, body)
+	assertNoError(t, err)
+	assertEqual(t, response.Failed(), []BulkItem{})
+
+	response = Response{}
+	err = json.Unmarshal([]byte(`{"items":[{"delete":{"_index":"i","_type":"t","_id":"1","error":"IndexMissingException[[i] missing]"}}]}`), &response)
+	assertNoError(t, err)
+	assertEqual(t, response.Failed(), []BulkItem{{
+		Command: BULK_COMMAND_DELETE,
+		Item:    Item{Index: "i", Type: "t", Id: "1", Error: BulkError{Reason: "IndexMissingException[[i] missing]"}},
+	}})
+	assertEqual(t, response.Failed()[0].Error.String(), "IndexMissingException[[i] missing]")
+}
+
+func TestPaginate(t *testing.T) {
+	queries := []string{}
+	total := 25
+
+	conn := fakeConnection(t, "1.7.5", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		queries = append(queries, string(body))
+		fmt.Fprintf(w, `{"hits":{"total":%d,"hits":[{"_id":"1"}]}}`, total)
+	})
+
+	query := map[string]interface{}{"query": map[string]interface{}{"match_all": map[string]interface{}{}}}
+
+	page, err := conn.Paginate(query, []string{"i"}, []string{}, 2, 10)
+	assertNoError(t, err)
+	assertEqual(t, page, Page{
+		Hits:          []Hit{{Id: "1"}},
+		Total:         25,
+		TotalRelation: TOTAL_EQ,
+		Page:          2,
+		PerPage:       10,
+		Pages:         3,
+		HasNext:       true,
+		HasPrevious:   true,
+	})
+
+	page, err = conn.Paginate(query, []string{"i"}, []string{}, 3, 10)
+	assertNoError(t, err)
+	assertEqual(t, page.HasNext, false)
+
+	total = 50000
+	page, err = conn.Paginate(query, []string{"i"}, []string{}, 1, 30)
+	assertNoError(t, err)
+	assertEqual(t, page.Pages, 333)
+
+	_, err = conn.Paginate(query, []string{"i"}, []string{}, 334, 30)
+	assertEqual(t, err.Error(), "page 334 of 30 hits is past the result window of 10000 hits")
+
+	_, err = conn.Paginate(query, []string{"i"}, []string{}, 0, 30)
+	assertEqual(t, err.Error(), "invalid page 0 of 30 hits")
+
+	assertEqual(t, len(query), 1)
+	assertEqual(t, queries[0], `{"from":10,"query":{"match_all":{}},"size":10}`)
+	assertEqual(t, len(queries), 3)
+
+	// the raw queries are paginated too
+	_, err = conn.Paginate(`{"query":{"term":{"user":"foo"}}}`, []string{"i"}, []string{}, 2, 5)
+	assertNoError(t, err)
+	_, err = conn.Paginate(strings.NewReader(`{"size":100}`), []string{"i"}, []string{}, 1, 5)
+	assertNoError(t, err)
+	_, err = conn.Paginate(nil, []string{"i"}, []string{}, 1, 5)
+	assertNoError(t, err)
+	assertEqual(t, queries[3:], []string{
+		`{"from":5,"query":{"term":{"user":"foo"}},"size":5}`,
+		`{"from":0,"size":5}`,
+		`{"from":0,"size":5}`,
+	})
+
+	_, err = conn.Paginate(`{"query":`, []string{"i"}, []string{}, 1, 5)
+	assertError(t, err)
+	assertEqual(t, len(queries), 6)
+}
+
+func TestStandbyRequests(t *testing.T) {
+	requests := []string{}
+
+	conn := fakeConnection(t, "1.7.5", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+string(body))
+
+		if r.URL.Path == "/_alias/tweets" {
+			io.WriteString(w, `{"tweets_v1":{"aliases":{"tweets":{}}}}`)
+			return
+		}
+		io.WriteString(w, `{}`)
+	})
+	conn.IdGenerator = &FlakeGenerator{}
+
+	standby, err := conn.NewStandby("tweets", "tweets_v2", map[string]interface{}{})
+	assertNoError(t, err)
+
+	documents := []Document{{
+		Type:        "tweet",
+		BulkCommand: BULK_COMMAND_INDEX,
+		Fields:      map[string]interface{}{"user": "foo"},
+	}}
+
+	_, err = standby.BulkSend(documents)
+	assertNoError(t, err)
+	id := documents[0].Id.(string)
+
+	indices, err := standby.Promote()
+	assertNoError(t, err)
+	assertEqual(t, indices, []string{"tweets_v1"})
+
+	assertEqual(t, requests, []string{
+		"PUT /tweets_v2/ {}",
+		"POST /tweets/_bulk " + `{"index":{"_id":"` + id + `","_index":"tweets","_type":"tweet"}}` + "\n" + `{"user":"foo"}` + "\n",
+		"POST /tweets_v2/_bulk " + `{"index":{"_id":"` + id + `","_index":"tweets_v2","_type":"tweet"}}` + "\n" + `{"user":"foo"}` + "\n",
+		"GET /_alias/tweets null",
+		`POST /_aliases {"actions":[{"remove":{"alias":"tweets","index":"tweets_v1"}},{"add":{"alias":"tweets","index":"tweets_v2"}}]}`,
+	})
+}
+
+func TestStandbyGeneratedIds(t *testing.T) {
+	requests := []string{}
+
+	conn := fakeConnection(t, "1.7.5", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r.URL.Path+" "+string(body))
+		io.WriteString(w, `{"items":[{"index":{"_index":"tweets","_type":"tweet","_id":"AVx1","_version":1,"status":201}}]}`)
+	})
+
+	standby := &Standby{Conn: conn, Alias: "tweets", Shadow: "tweets_v2"}
+
+	_, err := standby.BulkSend([]Document{{
+		Type:        "tweet",
+		BulkCommand: BULK_COMMAND_INDEX,
+		Fields:      map[string]interface{}{"user": "foo"},
+	}})
+	assertNoError(t, err)
+
+	// the shadow copy has the id elasticsearch generated behind the alias
+	assertEqual(t, requests, []string{
+		"/tweets/_bulk " + `{"index":{"_id":null,"_index":"tweets","_type":"tweet"}}` + "\n" + `{"user":"foo"}` + "\n",
+		"/tweets_v2/_bulk " + `{"index":{"_id":"AVx1","_index":"tweets_v2","_type":"tweet"}}` + "\n" + `{"user":"foo"}` + "\n",
+	})
+}
+
+func TestStandbyShadowFailures(t *testing.T) {
+	conn := fakeConnection(t, "1.7.5", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/tweets_v2/_bulk" {
+			io.WriteString(w, `{"errors":true,"items":[{"index":{"_index":"tweets_v2","_type":"tweet","_id":"1","status":400,`+
+				`"error":"MapperParsingException[failed to parse [user]]"}}]}`)
+			return
+		}
+		io.WriteString(w, `{"items":[{"index":{"_index":"tweets","_type":"tweet","_id":"1","_version":1,"status":201}}]}`)
+	})
+
+	standby := &Standby{Conn: conn, Alias: "tweets", Shadow: "tweets_v2"}
+
+	resp, err := standby.BulkSend([]Document{{
+		Type:        "tweet",
+		Id:          "1",
+		BulkCommand: BULK_COMMAND_INDEX,
+		Fields:      map[string]interface{}{"user": "foo"},
+	}})
+	assertEqual(t, err, errors.New("1 documents could not be written to tweets_v2, 1: MapperParsingException[failed to parse [user]]"))
+	assertEqual(t, resp.Items[0][BULK_COMMAND_INDEX].Index, "tweets")
+}
+
+func TestStandbyProcessors(t *testing.T) {
+	var lock sync.Mutex
+	ids := map[string][]string{}
+
+	conn := fakeConnection(t, "1.7.5", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		lock.Lock()
+		defer lock.Unlock()
+		for _, line := range strings.Split(string(body), "\n") {
+			var action map[string]struct {
+				Id string `json:"_id"`
+			}
+			if json.Unmarshal([]byte(line), &action) == nil && action["index"].Id != "" {
+				ids[r.URL.Path] = append(ids[r.URL.Path], action["index"].Id)
+			}
+		}
+		io.WriteString(w, `{}`)
+	})
+
+	standby := &Standby{Conn: conn, Alias: "tweets", Shadow: "tweets_v2"}
+	doc := func(id string) Document {
+		return Document{Type: "tweet", Id: id, BulkCommand: BULK_COMMAND_INDEX, Fields: map[string]interface{}{"user": "foo"}}
+	}
+
+	ix := standby.NewIndexer(IndexerSettings{Workers: 2, Bulk: BulkProcessorSettings{MaxDocuments: 2}})
+	for i := 0; i < 5; i++ {
+		assertNoError(t, ix.Add(doc(strconv.Itoa(i))))
+	}
+	ix.Close()
+
+	p := standby.NewBulkProcessor(BulkProcessorSettings{})
+	assertNoError(t, p.Add(doc("5")))
+	p.Close()
+
+	for _, path := range []string{"/tweets/_bulk", "/tweets_v2/_bulk"} {
+		sort.Strings(ids[path])
+		assertEqual(t, ids[path], []string{"0", "1", "2", "3", "4", "5"})
+	}
+}
+
+func TestStandby(t *testing.T) {
+	docType := "tweet"
+
+	conn := testConnection(t)
+	conn.DeleteIndex("teststandby_v1")
+	conn.DeleteIndex("teststandby_v2")
+
+	_, err := conn.CreateIndex("teststandby_v1", map[string]interface{}{
+		"aliases": map[string]interface{}{"teststandby": map[string]interface{}{}},
+	})
+	assertNoError(t, err)
+	defer conn.DeleteIndex("teststandby_v1")
+
+	_, err = conn.Index(Document{
+		Index:  "teststandby",
+		Type:   docType,
+		Id:     "1",
+		Fields: map[string]interface{}{"user": "foo"},
+	}, url.Values{})
+	assertNoError(t, err)
+
+	standby, err := conn.NewStandby("teststandby", "teststandby_v2", map[string]interface{}{})
+	assertNoError(t, err)
+	defer conn.DeleteIndex("teststandby_v2")
+
+	_, err = standby.BulkSend([]Document{{
+		Index:       "teststandby",
+		Type:        docType,
+		Id:          "2",
+		BulkCommand: BULK_COMMAND_INDEX,
+		Fields:      map[string]interface{}{"user": "bar"},
+	}})
+	assertNoError(t, err)
+
+	_, err = conn.RefreshIndex("teststandby")
+	assertNoError(t, err)
+
+	err = standby.Backfill()
+	assertNoError(t, err)
+
+	indices, err := standby.Promote()
+	assertNoError(t, err)
+	assertEqual(t, indices, []string{"teststandby_v1"})
+
+	_, err = conn.RefreshIndex("teststandby_v2")
+	assertNoError(t, err)
+
+	response, err := conn.Search(map[string]interface{}{}, []string{"teststandby"}, []string{})
+	assertNoError(t, err)
+	assertEqual(t, response.Hits.Total, uint64(2))
+	assertEqual(t, response.Hits.Hits[0].Index, "teststandby_v2")
+}
+
+func TestBulkStreaming(t *testing.T) {
+	bodies := []string{}
+
+	conn := fakeConnection(t, "1.7.5", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return
+		}
+		bodies = append(bodies, string(body))
+		assertEqual(t, r.ContentLength, int64(-1))
+
+		if len(bodies) == 1 {
+			w.WriteHeader(503)
+			io.WriteString(w, `{"error":"UnavailableShardsException","status":503}`)
+			return
+		}
+		io.WriteString(w, `{}`)
+	})
+	conn.ErrorPolicy = &StatusErrorPolicy{Retryable: []uint64{503}}
+	conn.MaxRetries = 1
+
+	documents := []Document{}
+	for i := 0; i < 1000; i++ {
+		documents = append(documents, Document{
+			Index:       "i",
+			Type:        "t",
+			Id:          strconv.Itoa(i),
+			BulkCommand: BULK_COMMAND_INDEX,
+			Fields:      map[string]interface{}{"n": i},
+		})
+	}
+
+	_, err := conn.BulkSend("i", documents)
+	assertNoError(t, err)
+
+	// the body is encoded again for the retry
+	assertEqual(t, len(bodies), 2)
+	assertEqual(t, bodies[0], bodies[1])
+	assertEqual(t, strings.Count(bodies[0], "\n"), 2000)
+	assertEqual(t, strings.HasSuffix(bodies[0], `{"n":999}`+"\n"), true)
+
+	documents[500].Fields = map[string]interface{}{"n": make(chan int)}
+	_, err = conn.BulkSend("i", documents)
+	assertEqual(t, strings.Contains(err.Error(), "json: unsupported type: chan int"), true)
+	assertEqual(t, len(bodies), 2)
+}
+
+func TestBulkProcessor(t *testing.T) {
+	var lock sync.Mutex
+	requests := 0
+
+	conn := fakeConnection(t, "1.7.5", func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+
+		lock.Lock()
+		requests++
+		lock.Unlock()
+
+		io.WriteString(w, `{}`)
+	})
+
+	doc := func(i int) Document {
+		return Document{
+			Index:       "i",
+			Type:        "t",
+			Id:          strconv.Itoa(i),
+			BulkCommand: BULK_COMMAND_INDEX,
+			Fields:      map[string]interface{}{"user": "foo"},
+		}
+	}
+
+	sizes := []int{}
+	p := conn.NewBulkProcessor("i", BulkProcessorSettings{
+		MaxDocuments: 10,
+		Workers:      3,
+		AfterFlush: func(documents []Document, response Response, err error) {
+			assertNoError(t, err)
+			lock.Lock()
+			sizes = append(sizes, len(documents))
+			lock.Unlock()
+		},
+	})
+
+	for i := 0; i < 25; i++ {
+		assertNoError(t, p.Add(doc(i)))
+	}
+	p.Flush()
+	assertEqual(t, requests, 3)
+
+	assertNoError(t, p.Add(doc(25)))
+	p.Close()
+	p.Close()
+
+	sort.Ints(sizes)
+	assertEqual(t, sizes, []int{1, 5, 10, 10})
+	assertEqual(t, p.Add(doc(26)).Error(), "bulk processor is closed")
+
+	// each document takes 62 bytes
+	sizes = []int{}
+	p = conn.NewBulkProcessor("i", BulkProcessorSettings{
+		MaxBytes: 200,
+		AfterFlush: func(documents []Document, response Response, err error) {
+			sizes = append(sizes, len(documents))
+		},
+	})
+	for i := 0; i < 7; i++ {
+		assertNoError(t, p.Add(doc(i)))
+	}
+	p.Close()
+	assertEqual(t, sizes, []int{3, 3, 1})
+
+	flushed := make(chan int)
+	p = conn.NewBulkProcessor("i", BulkProcessorSettings{
+		FlushInterval: 10 * time.Millisecond,
+		AfterFlush: func(documents []Document, response Response, err error) {
+			flushed <- len(documents)
+		},
+	})
+	defer p.Close()
+
+	assertNoError(t, p.Add(doc(0)))
+	select {
+	case n := <-flushed:
+		assertEqual(t, n, 1)
+	case <-time.After(time.Second):
+		t.Fatal("documents not flushed after FlushInterval")
+	}
+}
+
+func TestIndexer(t *testing.T) {
+	var lock sync.Mutex
+	ids := []string{}
+
+	conn := fakeConnection(t, "1.7.5", func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		io.WriteString(w, `{}`)
+	})
+
+	sizes := []int{}
+	ix := conn.NewIndexer("i", IndexerSettings{
+		Workers:   3,
+		QueueSize: 5,
+		Bulk: BulkProcessorSettings{
+			MaxDocuments: 4,
+			AfterFlush: func(documents []Document, response Response, err error) {
+				assertNoError(t, err)
+				lock.Lock()
+				defer lock.Unlock()
+
+				sizes = append(sizes, len(documents))
+				for _, d := range documents {
+					ids = append(ids, d.Id.(string))
+				}
+			},
+		},
+	})
+
+	for i := 0; i < 25; i++ {
+		assertNoError(t, ix.Add(Document{
+			Index:       "i",
+			Type:        "t",
+			Id:          strconv.Itoa(i),
+			BulkCommand: BULK_COMMAND_INDEX,
+			Fields:      map[string]interface{}{"user": "foo"},
+		}))
+	}
+	ix.Close()
+	ix.Close()
+
+	// every document is sent once, in batches of at most 4
+	sort.Strings(ids)
+	expected := []string{}
+	for i := 0; i < 25; i++ {
+		expected = append(expected, strconv.Itoa(i))
+	}
+	sort.Strings(expected)
+	assertEqual(t, ids, expected)
+
+	for _, size := range sizes {
+		if size > 4 {
+			t.Fatalf("batch of %d documents", size)
+		}
+	}
+
+	assertEqual(t, ix.Add(Document{}).Error(), "indexer is closed")
+}
+
+func TestAuditHook(t *testing.T) {
+	requests := 0
+
+	conn := fakeConnection(t, "1.7.5", func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		requests++
+		io.WriteString(w, `{}`)
+	})
+
+	mutations := []Mutation{}
+	conn.AuditHook = func(m []Mutation) error {
+		mutations = append(mutations, m...)
+		return nil
+	}
+
+	d := Document{
+		Index:       "i",
+		Type:        "t",
+		Id:          "1",
+		BulkCommand: BULK_COMMAND_UPDATE,
+		Fields:      map[string]interface{}{"user": "foo"},
+	}
+
+	_, err := conn.Index(d, url.Values{})
+	assertNoError(t, err)
+	_, err = conn.Create(d, url.Values{})
+	assertNoError(t, err)
+	_, err = conn.Delete(d, url.Values{})
+	assertNoError(t, err)
+	_, err = conn.BulkSend("i", []Document{d})
+	assertNoError(t, err)
+
+	conn.AuditBodies = true
+	_, err = conn.BulkSend("i", []Document{d})
+	assertNoError(t, err)
+
+	commands := []string{}
+	for _, m := range mutations {
+		commands = append(commands, m.Command)
+		assertEqual(t, m.Document.Id, "1")
+		if m.Time.IsZero() {
+			t.Error("mutation without time")
+		}
+	}
+	assertEqual(t, commands, []string{BULK_COMMAND_INDEX, BULK_COMMAND_CREATE, BULK_COMMAND_DELETE, BULK_COMMAND_UPDATE, BULK_COMMAND_UPDATE})
+	assertEqual(t, mutations[3].Document.Fields, map[string]interface{}(nil))
+	assertEqual(t, mutations[4].Document.Fields, d.Fields)
+	assertEqual(t, requests, 5)
+
+	conn.AuditHook = func(m []Mutation) error {
+		return errors.New("audit log unavailable")
+	}
+	_, err = conn.Index(d, url.Values{})
+	assertEqual(t, err.Error(), "audit log unavailable")
+	_, err = conn.BulkSend("i", []Document{d})
+	assertEqual(t, err.Error(), "audit log unavailable")
+	_, err = conn.BulkSendRaw("i", strings.NewReader(`{"delete":{"_id":"1"}}`+"\n"))
+	assertEqual(t, err.Error(), "audit log unavailable")
+	assertEqual(t, requests, 5)
+}
+
+func TestAuditHookBulkSendRaw(t *testing.T) {
+	bodies := []string{}
+
+	conn := fakeConnection(t, "5.6.16", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		io.WriteString(w, `{}`)
+	})
+
+	mutations := []Mutation{}
+	conn.AuditHook = func(m []Mutation) error {
+		mutations = append(mutations, m...)
+		return nil
+	}
+	conn.AuditBodies = true
+
+	ndjson := `{"index":{"_index":"other","_type":"t","_id":"1"}}` + "\n" + `{"user":"foo"}` + "\n" +
+		`{"delete":{"_type":"t","_id":"2"}}` + "\n" +
+		`{"update":{"_type":"t","_id":"3","_routing":"r"}}` + "\n" + `{"doc":{"user":"bar"}}` + "\n"
+
+	_, err := conn.BulkSendRaw("i", strings.NewReader(ndjson))
+	assertNoError(t, err)
+	assertEqual(t, bodies, []string{ndjson})
+
+	documents := []Document{}
+	for _, m := range mutations {
+		documents = append(documents, m.Document)
+	}
+	assertEqual(t, documents, []Document{
+		{Index: "other", Type: "t", Id: "1", BulkCommand: BULK_COMMAND_INDEX, Fields: map[string]interface{}{"user": "foo"}},
+		{Index: "i", Type: "t", Id: "2", BulkCommand: BULK_COMMAND_DELETE},
+		{Index: "i", Type: "t", Id: "3", BulkCommand: BULK_COMMAND_UPDATE, Routing: "r", Fields: map[string]interface{}{"user": "bar"}},
+	})
+
+	_, err = conn.BulkSendRaw("i", strings.NewReader(`{"index":{"_id":"1"}}`+"\n"))
+	assertEqual(t, err.Error(), "bulk line 1 has no source")
+	assertEqual(t, len(bodies), 1)
+}
+
+func TestBulkItemRetries(t *testing.T) {
+	bodies := []string{}
+
+	// the document 2 is rejected twice, the document 3 is invalid
+	answers := []string{
+		`{"errors":true,"items":[{"index":{"_id":"1","status":201}},{"index":{"_id":"2","status":429,"error":{"type":"es_rejected_execution_exception","reason":"rejected execution"}}},{"index":{"_id":"3","status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse [age]"}}}]}`,
+		`{"errors":true,"items":[{"index":{"_id":"2","status":429,"error":{"type":"es_rejected_execution_exception","reason":"rejected execution"}}}]}`,
+		`{"errors":false,"items":[{"index":{"_id":"2","status":201}}]}`,
+	}
+
+	conn := fakeConnection(t, "5.6.16", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		io.WriteString(w, answers[len(bodies)-1])
+	})
+	conn.BulkItemRetries = 3
+	conn.BulkItemBackoff = time.Millisecond
+
+	failed := []BulkResult{}
+	conn.BulkItemFailed = func(results []BulkResult) {
+		failed = append(failed, results...)
+	}
+
+	documents := []Document{}
+	for i := 1; i <= 3; i++ {
+		documents = append(documents, Document{
+			Index:       "i",
+			Type:        "t",
+			Id:          strconv.Itoa(i),
+			BulkCommand: BULK_COMMAND_INDEX,
+			Fields:      map[string]interface{}{"n": i},
+		})
+	}
+
+	response, err := conn.BulkSend("i", documents)
+	assertNoError(t, err)
+
+	assertEqual(t, len(bodies), 3)
+	assertEqual(t, bodies[1], `{"index":{"_id":"2","_index":"i","_type":"t"}}`+"\n"+`{"n":2}`+"\n")
+	assertEqual(t, bodies[2], bodies[1])
+
+	assertEqual(t, response.Items[1]["index"].Status, 201)
+	assertEqual(t, response.Errors, true)
+
+	assertEqual(t, len(failed), 1)
+	assertEqual(t, failed[0].Document.Id, "3")
+	assertEqual(t, failed[0].Item.Status, 400)
+
+	// the retries are given up after BulkItemRetries attempts
+	bodies = []string{}
+	answers = []string{answers[1], answers[1], answers[1]}
+	failed = []BulkResult{}
+	conn.BulkItemRetries = 2
+
+	_, err = conn.BulkSend("i", documents[1:2])
+	assertNoError(t, err)
+	assertEqual(t, len(bodies), 3)
+	assertEqual(t, len(failed), 1)
+	assertEqual(t, failed[0].Item.Status, 429)
+}
+
+func TestSession(t *testing.T) {
+	requests := []string{}
+
+	conn := fakeConnection(t, "1.7.5", func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		requests = append(requests, r.Method+" "+r.URL.String())
+		io.WriteString(w, `{}`)
+	})
+
+	session := conn.NewSession(time.Hour)
+
+	d := Document{Index: "a", Type: "t", Id: "1", BulkCommand: BULK_COMMAND_INDEX}
+
+	_, err := session.Index(d, url.Values{})
+	assertNoError(t, err)
+	_, err = session.BulkSend("b", []Document{{Index: "c", Type: "t", Id: "1", BulkCommand: BULK_COMMAND_DELETE}})
+	assertNoError(t, err)
+
+	_, err = session.Search(nil, []string{"a", "z"}, []string{})
+	assertNoError(t, err)
+	// a is refreshed already
+	_, err = session.Search(nil, []string{"a"}, []string{})
+	assertNoError(t, err)
+	_, err = session.Search(nil, []string{}, []string{})
+	assertNoError(t, err)
+
+	_, err = session.Get("a", "t", "1", url.Values{})
+	assertNoError(t, err)
+
+	// the writes out of the window are visible without a refresh
+	session.Window = 0
+	_, err = session.Delete(d, url.Values{})
+	assertNoError(t, err)
+	_, err = session.Search(nil, []string{"a"}, []string{})
+	assertNoError(t, err)
+
+	assertEqual(t, requests, []string{
+		"PUT /a/t/1/",
+		"POST /b/_bulk",
+		"GET /_aliases",
+		"POST /a/_refresh",
+		"POST /a,z/_search",
+		"GET /_aliases",
+		"POST /a/_search",
+		"POST /b,c/_refresh",
+		"POST /_search",
+		"GET /a/t/1?realtime=true",
+		"DELETE /a/t/1/",
+		"POST /a/_search",
+	})
+}
+
+func TestSessionAliases(t *testing.T) {
+	requests := []string{}
+
+	conn := fakeConnection(t, "7.10.2", func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		requests = append(requests, r.Method+" "+r.URL.String())
+
+		if r.URL.Path == "/_aliases" {
+			io.WriteString(w, `{"tweets_v1":{"aliases":{"tweets":{}}},"users":{"aliases":{}},"logs":{"aliases":{}}}`)
+			return
+		}
+		io.WriteString(w, `{}`)
+	})
+
+	session := conn.NewSession(time.Hour)
+
+	// written through the alias, searched on the index
+	_, err := session.Index(Document{Index: "tweets", Type: "_doc", Id: "1"}, url.Values{})
+	assertNoError(t, err)
+	_, err = session.Search(nil, []string{"tweets_v1"}, []string{})
+	assertNoError(t, err)
+
+	// written to the index, searched through a wildcard expression
+	_, err = session.Index(Document{Index: "users", Type: "_doc", Id: "1"}, url.Values{})
+	assertNoError(t, err)
+	_, err = session.Search(nil, []string{"user*"}, []string{})
+	assertNoError(t, err)
+
+	// the other indices are not refreshed
+	_, err = session.Index(Document{Index: "logs", Type: "_doc", Id: "1"}, url.Values{})
+	assertNoError(t, err)
+	_, err = session.Search(nil, []string{"tweets"}, []string{})
+	assertNoError(t, err)
+
+	assertEqual(t, requests, []string{
+		"PUT /tweets/_doc/1/",
+		"GET /_aliases",
+		"POST /tweets/_refresh",
+		"POST /tweets_v1/_search",
+		"PUT /users/_doc/1/",
+		"GET /_aliases",
+		"POST /users/_refresh",
+		"POST /user%2A/_search",
+		"PUT /logs/_doc/1/",
+		"GET /_aliases",
+		"POST /tweets/_search",
+	})
+}
+
+func TestBulkSendRaw(t *testing.T) {
+	bodies := []string{}
+
+	conn := fakeConnection(t, "1.7.5", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, r.URL.Path+" "+string(body))
+
+		if len(bodies)%2 == 1 {
+			w.WriteHeader(503)
+			io.WriteString(w, `{"error":"UnavailableShardsException","status":503}`)
+			return
+		}
+		io.WriteString(w, `{"items":[{"index":{"_id":"1","status":201}}]}`)
+	})
+	conn.ErrorPolicy = &StatusErrorPolicy{Retryable: []uint64{503}}
+	conn.MaxRetries = 1
+
+	ndjson := `{"index":{"_id":"1","_type":"t"}}` + "\n" + `{"user":"foo"}` + "\n"
+
+	// the reader is sent again from where it was
+	reader := strings.NewReader("skipped" + ndjson)
+	reader.Seek(int64(len("skipped")), io.SeekStart)
+
+	response, err := conn.BulkSendRaw("i", reader)
+	assertNoError(t, err)
+	assertEqual(t, response.Items[0]["index"].Status, 201)
+	assertEqual(t, bodies, []string{"/i/_bulk " + ndjson, "/i/_bulk " + ndjson})
+
+	// not seekable, not retried
+	_, err = conn.BulkSendRaw("i", io.MultiReader(strings.NewReader(ndjson)))
+	assertEqual(t, err, error(newSearchError(503, "UnavailableShardsException")))
+	assertEqual(t, len(bodies), 3)
+}
+
+func TestRawQueries(t *testing.T) {
+	bodies := []string{}
+	searches := 0
+
+	conn := fakeConnection(t, "7.10.2", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, r.Method+" "+r.URL.Path+" "+string(body))
+
+		if strings.HasSuffix(r.URL.Path, "/_search") {
+			searches++
+		}
+		if searches%2 == 1 {
+			w.WriteHeader(503)
+			io.WriteString(w, `{"error":{"type":"unavailable_shards_exception","reason":"unavailable"},"status":503}`)
+			return
+		}
+		io.WriteString(w, `{"acknowledged":true}`)
+	})
+	conn.ErrorPolicy = &StatusErrorPolicy{Retryable: []uint64{503}}
+	conn.MaxRetries = 1
+
+	query := `{"query":{"match_all":{}}}`
+
+	_, err := conn.CreateIndex("i", json.RawMessage(`{"settings":{"number_of_shards":1}}`))
+	assertNoError(t, err)
+
+	_, err = conn.Search(json.RawMessage(query), []string{"i"}, []string{})
+	assertNoError(t, err)
+
+	// sent again from where it was
+	reader := strings.NewReader("skipped" + query)
+	reader.Seek(int64(len("skipped")), io.SeekStart)
+
+	_, err = conn.Search(reader, []string{"i"}, []string{})
+	assertNoError(t, err)
+
+	assertEqual(t, bodies, []string{
+		`PUT /i/ {"settings":{"number_of_shards":1}}`,
+		"POST /i/_search " + query,
+		"POST /i/_search " + query,
+		"POST /i/_search " + query,
+		"POST /i/_search " + query,
+	})
+
+	// not seekable, not retried
+	_, err = conn.Search(io.MultiReader(strings.NewReader(query)), []string{"i"}, []string{})
+	assertError(t, err)
+	assertEqual(t, len(bodies), 6)
+}
+
+func TestSelfCheck(t *testing.T) {
+	requests := []string{}
+
+	conn := fakeConnection(t, "", func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+
+		switch {
+		case r.URL.Path == "/":
+			io.WriteString(w, `{"version":{"number":"5.6.16"}}`)
+		case r.URL.Path == "/tweets/" || r.URL.Path == "/_template/logs":
+			if r.Method == "HEAD" {
+				return
+			}
+			io.WriteString(w, `{"logs":{"template":"logs-*"}}`)
+		case r.URL.Path == "/users/" || r.URL.Path == "/_template/metrics":
+			w.WriteHeader(404)
+			io.WriteString(w, `{}`)
+		case strings.HasPrefix(r.URL.Path, "/readonly/"):
+			w.WriteHeader(403)
+			io.WriteString(w, `{"error":"ClusterBlockException[blocked by: [FORBIDDEN/8/index write (api)];]","status":403}`)
+		default:
+			io.WriteString(w, `{}`)
+		}
+	})
+
+	report := conn.SelfCheck(Requirements{
+		Versions:        VersionRange{"5.0.0", "6.0.0"},
+		Indices:         []string{"tweets", "users"},
+		Templates:       []string{"logs", "metrics"},
+		WritableIndices: []string{"tweets", "readonly"},
+	})
+
+	assertEqual(t, report, SelfCheckReport{
+		Ok: false,
+		Checks: []Check{
+			{Name: "reachable", Ok: true},
+			{Name: "version", Ok: true},
+			{Name: "index tweets", Ok: true},
+			{Name: "index users", Ok: false, Error: "index users does not exist"},
+			{Name: "template logs", Ok: true},
+			{Name: "template metrics", Ok: false, Error: "template metrics does not exist"},
+			{Name: "write tweets", Ok: true},
+			{Name: "write readonly", Ok: false, Error: "[403] ClusterBlockException[blocked by: [FORBIDDEN/8/index write (api)];]"},
+		},
+	})
+
+	assertEqual(t, requests[len(requests)-3][:len("PUT /tweets/selfcheck/goes-selfcheck-")], "PUT /tweets/selfcheck/goes-selfcheck-")
+	assertEqual(t, requests[len(requests)-2][:len("DELETE /tweets/selfcheck/")], "DELETE /tweets/selfcheck/")
+
+	report = conn.SelfCheck(Requirements{Versions: VersionRange{"6.0.0", ""}})
+	assertEqual(t, report.Ok, false)
+	assertEqual(t, report.Checks[1], Check{Name: "version", Error: "elasticsearch 5.6.16 is not supported"})
+
+	body, err := json.Marshal(conn.SelfCheck(Requirements{}))
+	assertNoError(t, err)
+	assertEqual(t, string(body), `{"ok":true,"checks":[{"name":"reachable","ok":true}]}`)
+}
+
+func TestBulkTTL(t *testing.T) {
+	indexName := "testbulkttl"
+	docType := "tweet"
+
+	conn := testConnection(t)
+	SkipUnlessSupported(t, conn, FEATURE_TTL)
+	conn.DeleteIndex(indexName)
+
+	_, err := conn.CreateIndex(indexName, map[string]interface{}{
+		"mappings": map[string]interface{}{
+			docType: map[string]interface{}{
+				"_ttl": map[string]interface{}{"enabled": true},
+			},
+		},
+	})
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	_, err = conn.BulkSend(indexName, []Document{{
+		Index:       indexName,
+		Type:        docType,
+		Id:          "1",
+		TTL:         "1d",
+		BulkCommand: BULK_COMMAND_INDEX,
+		Fields:      map[string]interface{}{"user": "foo"},
+	}})
+	assertNoError(t, err)
+
+	response, err := conn.Get(indexName, docType, "1", url.Values{"fields": {"_ttl"}})
+	assertNoError(t, err)
+
+	ttl, ok := response.Fields["_ttl"].(float64)
+	assertEqual(t, ok, true)
+	assertEqual(t, ttl > 0 && ttl <= 86400000, true)
+}
+
+func TestBulkProcessorHooks(t *testing.T) {
+	body, err := os.ReadFile(filepath.Join("testdata", "responses", "5.6-bulk-200.json"))
+	assertNoError(t, err)
+
+	conn := fakeConnection(t, "5.6.16", func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		w.Write(body)
+	})
+
+	events := []string{}
+	rejected := []Document{}
+
+	p := conn.NewBulkProcessor("test", BulkProcessorSettings{
+		MaxDocuments: 2,
+		BeforeFlush: func(documents []Document) {
+			events = append(events, fmt.Sprintf("before %d", len(documents)))
+		},
+		AfterFlush: func(documents []Document, response Response, err error) {
+			assertNoError(t, err)
+			events = append(events, fmt.Sprintf("after %d", len(documents)))
+
+			// dead letters
+			results, err := response.BulkResults(documents)
+			assertNoError(t, err)
+			for _, result := range results {
+				if result.Item.Status >= 300 {
+					rejected = append(rejected, result.Document)
+				}
+			}
+		},
+	})
+
+	for i := 1; i <= 2; i++ {
+		assertNoError(t, p.Add(Document{
+			Index:       "test",
+			Type:        "doc",
+			Id:          strconv.Itoa(i),
+			BulkCommand: BULK_COMMAND_INDEX,
+			Fields:      map[string]interface{}{"age": i},
+		}))
+	}
+	p.Close()
+
+	assertEqual(t, events, []string{"before 2", "after 2"})
+	assertEqual(t, len(rejected), 1)
+	assertEqual(t, rejected[0].Id, "2")
+}
+
+func TestBulkChunks(t *testing.T) {
+	bodies := []string{}
+
+	conn := fakeConnection(t, "1.7.5", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+
+		items := []string{}
+		for _, line := range strings.Split(strings.TrimSpace(string(body)), "\n") {
+			if strings.HasPrefix(line, `{"index"`) {
+				items = append(items, `{"index":{"status":201}}`)
+			}
+		}
+		fmt.Fprintf(w, `{"took":2,"items":[%s]}`, strings.Join(items, ","))
+	})
+
+	// each document takes 62 bytes
+	conn.MaxBulkBytes = 130
+
+	documents := []Document{}
+	for i := 0; i < 5; i++ {
+		documents = append(documents, Document{
+			Index:       "i",
+			Type:        "t",
+			Id:          strconv.Itoa(i),
+			BulkCommand: BULK_COMMAND_INDEX,
+			Fields:      map[string]interface{}{"user": "foo"},
+		})
+	}
+
+	response, err := conn.BulkSend("i", documents)
+	assertNoError(t, err)
+	assertEqual(t, len(bodies), 3)
+	assertEqual(t, strings.Count(bodies[0], "\n"), 4)
+	assertEqual(t, strings.Count(bodies[2], "\n"), 2)
+	assertEqual(t, len(response.Items), 5)
+	assertEqual(t, response.Took, uint64(6))
+
+	results, err := response.BulkResults(documents)
+	assertNoError(t, err)
+	assertEqual(t, results[4].Item.Status, 201)
+
+	// a document bigger than MaxBulkBytes is sent alone
+	conn.MaxBulkBytes = 10
+	bodies = []string{}
+	_, err = conn.BulkSend("i", documents[:2])
+	assertNoError(t, err)
+	assertEqual(t, len(bodies), 2)
+
+	conn.MaxBulkBytes = 1000
+	bodies = []string{}
+	_, err = conn.BulkSend("i", documents)
+	assertNoError(t, err)
+	assertEqual(t, len(bodies), 1)
+}
+
+func TestMappingTypes(t *testing.T) {
+	mappings, err := mappingTypes([]byte(`{"tweets":{"mappings":{"tweet":{"_source":{"enabled":false},"properties":{
+		"message":{"type":"string","fields":{"raw":{"type":"string","index":"not_analyzed"}}},
+		"user":{"properties":{"id":{"type":"long"},"name":{"type":"string"}}}}}}}}`))
+	assertNoError(t, err)
+
+	tweet := mappings["tweets"]["tweet"]
+	assertEqual(t, tweet["_source"], map[string]interface{}{"enabled": false})
+	assertEqual(t, tweet.PropertyNames(), []string{"message", "user"})
+	assertEqual(t, tweet.Property("user").Type(), "object")
+	assertEqual(t, tweet.Property("user.id").Type(), "long")
+	assertEqual(t, tweet.Property("message.raw")["index"], "not_analyzed")
+	assertEqual(t, tweet.Property("user.email"), Mapping(nil))
+	assertEqual(t, len(tweet.Property("user").Properties()), 2)
+
+	mappings, err = mappingTypes([]byte(`{"logs":{"mappings":{"properties":{"status":{"type":"keyword"}}}}}`))
+	assertNoError(t, err)
+	assertEqual(t, mappings["logs"]["_doc"].Property("status").Type(), "keyword")
+}
+
+func TestMappingRequests(t *testing.T) {
+	mapping := map[string]interface{}{
+		"properties": map[string]interface{}{"user": map[string]interface{}{"type": "string"}},
+	}
+	response := `{"tweets":{"mappings":{"tweet":{"properties":{"user":{"type":"string"}}}}}}`
+
+	testRequests(t, "1.7.5", []requestCase{
+		{
+			name:     "put drops the cached mapping",
+			response: response,
+			call: func(t *testing.T, conn *Connection) error {
+				conn.ValidateDocuments = true
+
+				// the cached mapping used to validate documents is dropped
+				_, err := conn.cachedMapping("tweets")
+				assertNoError(t, err)
+				_, err = conn.PutMapping("tweets", "tweet", mapping)
+				assertEqual(t, len(conn.shared().mappings), 0)
+				return err
+			},
+			requests: []string{
+				"GET /tweets/_mapping null",
+				`PUT /tweets/tweet/_mapping {"tweet":{"properties":{"user":{"type":"string"}}}}`,
+			},
+		},
+		{
+			name:     "put typeless",
+			response: response,
+			call: func(t *testing.T, conn *Connection) error {
+				_, err := conn.PutMapping("logs", "", mapping)
+				return err
+			},
+			requests: []string{`PUT /logs/_mapping {"properties":{"user":{"type":"string"}}}`},
+		},
+		{
+			name:     "get",
+			response: response,
+			call: func(t *testing.T, conn *Connection) error {
+				mappings, err := conn.GetMapping([]string{"tweets"}, []string{"tweet"})
+				assertEqual(t, mappings["tweets"]["tweet"].Property("user").Type(), "string")
+				return err
+			},
+			requests: []string{"GET /tweets/tweet/_mapping null"},
+		},
+	})
+}
+
+func TestMappingMissRequests(t *testing.T) {
+	requests := []string{}
+
+	conn := fakeConnection(t, "7.10.2", func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if r.Method == "GET" {
+			w.WriteHeader(404)
+			io.WriteString(w, `{"error":{"type":"index_not_found_exception","reason":"no such index [logs]","index":"logs"},"status":404}`)
+			return
+		}
+		io.WriteString(w, `{}`)
+	})
+	conn.ValidateDocuments = true
+
+	// the missing index is looked up once
+	d := Document{Index: "logs", Type: "_doc", Fields: map[string]interface{}{"status": "ok"}}
+	for i := 0; i < 3; i++ {
+		_, err := conn.Index(d, url.Values{})
+		assertNoError(t, err)
+	}
+
+	_, err := conn.PutMapping("logs", "", map[string]interface{}{})
+	assertNoError(t, err)
+	_, err = conn.Index(d, url.Values{})
+	assertNoError(t, err)
+
+	assertEqual(t, requests, []string{
+		"GET /logs/_mapping",
+		"POST /logs/_doc/",
+		"POST /logs/_doc/",
+		"POST /logs/_doc/",
+		"PUT /logs/_mapping",
+		"GET /logs/_mapping",
+		"POST /logs/_doc/",
+	})
+}
+
+func TestPutMapping(t *testing.T) {
+	indexName := "testputmapping"
+	docType := "tweet"
+
+	conn := testConnection(t)
+	conn.DeleteIndex(indexName)
+
+	_, err := conn.CreateIndex(indexName, map[string]interface{}{})
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	_, err = conn.PutMapping(indexName, docType, map[string]interface{}{
+		"properties": map[string]interface{}{
+			"age": map[string]interface{}{"type": "long"},
+		},
+	})
+	assertNoError(t, err)
+
+	mappings, err := conn.GetMapping([]string{indexName}, []string{docType})
+	assertNoError(t, err)
+	assertEqual(t, mappings[indexName][docType].Property("age").Type(), "long")
+}
+
+func TestIndexSettingsRequests(t *testing.T) {
+	server, conn := newFakeServer(t, "1.7.5")
+	server.answer(200, `{"tweets_v1":{"settings":{"index.number_of_replicas":"1","index.refresh_interval":"-1"}}}`)
+
+	_, err := conn.UpdateIndexSettings("tweets", map[string]interface{}{
+		"index.refresh_interval":   "-1",
+		"index.number_of_replicas": nil,
+	})
+	assertNoError(t, err)
+
+	settings, err := conn.GetIndexSettings([]string{"tweets"})
+	assertNoError(t, err)
+	assertEqual(t, settings, map[string]map[string]interface{}{
+		"tweets_v1": {"index.number_of_replicas": "1", "index.refresh_interval": "-1"},
+	})
+
+	assertEqual(t, server.requests(), []string{
+		`PUT /tweets/_settings {"index.number_of_replicas":null,"index.refresh_interval":"-1"}`,
+		"GET /tweets/_settings?flat_settings=true null",
+	})
+}
+
+func TestIndexSettings(t *testing.T) {
+	indexName := "testindexsettings"
+
+	conn := testConnection(t)
+	conn.DeleteIndex(indexName)
+
+	_, err := conn.CreateIndex(indexName, map[string]interface{}{})
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	_, err = conn.UpdateIndexSettings(indexName, map[string]interface{}{
+		"index.refresh_interval":   "-1",
+		"index.number_of_replicas": 0,
+	})
+	assertNoError(t, err)
+
+	settings, err := conn.GetIndexSettings([]string{indexName})
+	assertNoError(t, err)
+	assertEqual(t, settings[indexName]["index.refresh_interval"], "-1")
+	assertEqual(t, settings[indexName]["index.number_of_replicas"], "0")
+}
+
+func TestOpenCloseIndex(t *testing.T) {
+	indexName := "testopencloseindex"
+	docType := "tweet"
+
+	conn := testConnection(t)
+	conn.DeleteIndex(indexName)
+
+	_, err := conn.CreateIndex(indexName, map[string]interface{}{})
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	_, err = conn.Index(Document{
+		Index:  indexName,
+		Type:   docType,
+		Id:     "1",
+		Fields: map[string]interface{}{"user": "foo"},
+	}, url.Values{})
+	assertNoError(t, err)
+
+	response, err := conn.CloseIndex(indexName)
+	assertNoError(t, err)
+	assertEqual(t, response.Acknowledged, true)
+
+	_, err = conn.Get(indexName, docType, "1", url.Values{})
+	assertError(t, err)
+
+	response, err = conn.OpenIndex(indexName)
+	assertNoError(t, err)
+	assertEqual(t, response.Acknowledged, true)
+
+	_, err = conn.Health([]string{indexName}, url.Values{"wait_for_status": {"yellow"}, "timeout": {"10s"}})
+	assertNoError(t, err)
+
+	response, err = conn.Get(indexName, docType, "1", url.Values{})
+	assertNoError(t, err)
+	assertEqual(t, response.Found || response.Exists, true)
+}
+
+func TestOpenCloseIndexRequests(t *testing.T) {
+	server, conn := newFakeServer(t, "1.7.5")
+	server.answer(200, `{"acknowledged":true}`)
+
+	response, err := conn.CloseIndex("logs-2013.01")
+	assertNoError(t, err)
+	assertEqual(t, response.Acknowledged, true)
+
+	_, err = conn.OpenIndex("logs-2013.01")
+	assertNoError(t, err)
+
+	assertEqual(t, server.requests(), []string{"POST /logs-2013.01/_close null", "POST /logs-2013.01/_open null"})
+}
+
+func TestExists(t *testing.T) {
+	indexName := "testexists"
+	docType := "tweet"
+
+	conn := testConnection(t)
+	conn.DeleteIndex(indexName)
+
+	exists, err := conn.IndexExists(indexName)
+	assertNoError(t, err)
+	assertEqual(t, exists, false)
+
+	_, err = conn.CreateIndex(indexName, map[string]interface{}{})
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	exists, err = conn.IndexExists(indexName)
+	assertNoError(t, err)
+	assertEqual(t, exists, true)
+
+	exists, err = conn.TypeExists(indexName, docType)
+	assertNoError(t, err)
+	assertEqual(t, exists, false)
+
+	_, err = conn.Index(Document{
+		Index:  indexName,
+		Type:   docType,
+		Id:     "1",
+		Fields: map[string]interface{}{"user": "foo"},
+	}, url.Values{})
+	assertNoError(t, err)
+
+	exists, err = conn.TypeExists(indexName, docType)
+	assertNoError(t, err)
+	assertEqual(t, exists, true)
+}
+
+func TestExistsRequests(t *testing.T) {
+	exists := func(expected bool, check func(conn *Connection) (bool, error)) func(t *testing.T, conn *Connection) error {
+		return func(t *testing.T, conn *Connection) error {
+			ok, err := check(conn)
+			assertEqual(t, ok, expected)
+			return err
+		}
+	}
+
+	testRequests(t, "1.7.5", []requestCase{
+		{
+			name: "index",
+			call: exists(true, func(conn *Connection) (bool, error) {
+				// an ignored 404 does not mean the index exists
+				conn.ErrorPolicy = &StatusErrorPolicy{Ignored: []uint64{404}}
+				return conn.IndexExists("tweets")
+			}),
+			requests: []string{"HEAD /tweets/ null"},
+		},
+		{
+			name:   "missing index",
+			status: 404,
+			call: exists(false, func(conn *Connection) (bool, error) {
+				return conn.IndexExists("missing")
+			}),
+			requests: []string{"HEAD /missing/ null"},
+		},
+		{
+			name:   "forbidden index",
+			status: 403,
+			call: func(t *testing.T, conn *Connection) error {
+				_, err := conn.IndexExists("forbidden")
+				assertEqual(t, err, error(newSearchError(403, "")))
+				return err
+			},
+			requests: []string{"HEAD /forbidden/ null"},
+			err:      "[403] ",
+		},
+		{
+			name: "type",
+			call: exists(true, func(conn *Connection) (bool, error) {
+				return conn.TypeExists("tweets", "tweet")
+			}),
+			requests: []string{"HEAD /tweets/tweet/ null"},
+		},
+		{
+			name:   "missing type since 5.0",
+			status: 404,
+			call: exists(false, func(conn *Connection) (bool, error) {
+				conn.Version = "5.6.16"
+				return conn.TypeExists("tweets", "missing")
+			}),
+			requests: []string{"HEAD /tweets/_mapping/missing null"},
+		},
+	})
+}
+
+func TestAliases(t *testing.T) {
+	indexName := "testaliases"
+	alias := "testaliases_alias"
+
+	conn := testConnection(t)
+	conn.DeleteIndex(indexName)
+
+	_, err := conn.CreateIndex(indexName, map[string]interface{}{})
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	_, err = conn.AddAlias(alias, []string{indexName})
+	assertNoError(t, err)
+
+	aliases, err := conn.GetAliases([]string{indexName})
+	assertNoError(t, err)
+	assertEqual(t, aliases, map[string][]string{indexName: {alias}})
+
+	_, err = conn.RemoveAlias(alias, []string{indexName})
+	assertNoError(t, err)
+
+	aliases, err = conn.GetAliases([]string{indexName})
+	assertNoError(t, err)
+	assertEqual(t, aliases, map[string][]string{indexName: {}})
+}
+
+func TestAliasesRequests(t *testing.T) {
+	testRequests(t, "1.7.5", []requestCase{
+		{
+			name:     "actions",
+			response: `{"acknowledged":true}`,
+			call: func(t *testing.T, conn *Connection) error {
+				_, err := conn.Aliases([]AliasAction{
+					{Action: ALIAS_ACTION_REMOVE, Index: "tweets_v1", Alias: "tweets"},
+					{Action: ALIAS_ACTION_ADD, Index: "tweets_v2", Alias: "tweets"},
+					{
+						Action:  ALIAS_ACTION_ADD,
+						Index:   "tweets_v2",
+						Alias:   "tweets_foo",
+						Filter:  map[string]interface{}{"term": map[string]interface{}{"user": "foo"}},
+						Routing: "foo",
+					},
+				})
+				return err
+			},
+			requests: []string{
+				`POST /_aliases {"actions":[{"remove":{"alias":"tweets","index":"tweets_v1"}},{"add":{"alias":"tweets","index":"tweets_v2"}},{"add":{"alias":"tweets_foo","filter":{"term":{"user":"foo"}},"index":"tweets_v2","routing":"foo"}}]}`,
+			},
+		},
+		{
+			name:     "add",
+			response: `{"acknowledged":true}`,
+			call: func(t *testing.T, conn *Connection) error {
+				_, err := conn.AddAlias("all", []string{"tweets_v2", "users"})
+				return err
+			},
+			requests: []string{`POST /_aliases {"actions":[{"add":{"alias":"all","index":"tweets_v2"}},{"add":{"alias":"all","index":"users"}}]}`},
+		},
+		{
+			name:     "remove",
+			response: `{"acknowledged":true}`,
+			call: func(t *testing.T, conn *Connection) error {
+				_, err := conn.RemoveAlias("all", []string{"users"})
+				return err
+			},
+			requests: []string{`POST /_aliases {"actions":[{"remove":{"alias":"all","index":"users"}}]}`},
+		},
+		{
+			name:     "get",
+			response: `{"tweets_v1":{"aliases":{"tweets":{},"all":{}}},"users":{"aliases":{}}}`,
+			call: func(t *testing.T, conn *Connection) error {
+				aliases, err := conn.GetAliases([]string{"tweets_v1", "users"})
+				assertEqual(t, aliases, map[string][]string{
+					"tweets_v1": {"all", "tweets"},
+					"users":     {},
+				})
+				return err
+			},
+			requests: []string{"GET /tweets_v1,users/_aliases null"},
+		},
+	})
+}
+
+func TestTemplates(t *testing.T) {
+	templateName := "testtemplates"
+	indexName := "testtemplates-1"
+
+	conn := testConnection(t)
+	conn.DeleteIndex(indexName)
+
+	_, err := conn.PutTemplate(templateName, map[string]interface{}{
+		"template": "testtemplates-*",
+		"settings": map[string]interface{}{
+			"index": map[string]interface{}{"number_of_replicas": "0"},
+		},
+	})
+	assertNoError(t, err)
+	defer conn.DeleteTemplate(templateName)
+
+	templates, err := conn.GetTemplate([]string{templateName})
+	assertNoError(t, err)
+	if _, ok := templates[templateName]; !ok {
+		t.Fatalf("template %s not found in %v", templateName, templates)
+	}
+
+	_, err = conn.CreateIndex(indexName, map[string]interface{}{})
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	settings, err := conn.GetIndexSettings([]string{indexName})
+	assertNoError(t, err)
+	assertEqual(t, settings[indexName]["index.number_of_replicas"], "0")
+
+	_, err = conn.DeleteTemplate(templateName)
+	assertNoError(t, err)
+
+	templates, err = conn.GetTemplate([]string{templateName})
+	assertNoError(t, err)
+	assertEqual(t, templates, map[string]map[string]interface{}{})
+}
+
+func TestTemplatesRequests(t *testing.T) {
+	testRequests(t, "1.7.5", []requestCase{
+		{
+			name:     "put",
+			response: `{"acknowledged":true}`,
+			call: func(t *testing.T, conn *Connection) error {
+				_, err := conn.PutTemplate("logs", map[string]interface{}{"template": "logs-*"})
+				return err
+			},
+			requests: []string{`PUT /_template/logs {"template":"logs-*"}`},
+		},
+		{
+			name:     "get",
+			response: `{"logs":{"template":"logs-*","order":0}}`,
+			call: func(t *testing.T, conn *Connection) error {
+				templates, err := conn.GetTemplate([]string{"logs", "metrics"})
+				assertEqual(t, templates, map[string]map[string]interface{}{
+					"logs": {"template": "logs-*", "order": float64(0)},
+				})
+				return err
+			},
+			requests: []string{"GET /_template/logs,metrics null"},
+		},
+		{
+			name:     "get missing",
+			status:   404,
+			response: `{}`,
+			call: func(t *testing.T, conn *Connection) error {
+				templates, err := conn.GetTemplate([]string{"missing"})
+				assertEqual(t, templates, map[string]map[string]interface{}{})
+				return err
+			},
+			requests: []string{"GET /_template/missing null"},
+		},
+		{
+			name:     "delete",
+			response: `{"acknowledged":true}`,
+			call: func(t *testing.T, conn *Connection) error {
+				_, err := conn.DeleteTemplate("logs")
+				return err
+			},
+			requests: []string{"DELETE /_template/logs null"},
+		},
+	})
+}
+
+func TestAnalyze(t *testing.T) {
+	conn := testConnection(t)
+
+	tokens, err := conn.Analyze("", Analyzer{Analyzer: "standard"}, "Hello World")
+	assertNoError(t, err)
+	assertEqual(t, len(tokens), 2)
+	assertEqual(t, tokens[0].Token, "hello")
+	assertEqual(t, tokens[0].StartOffset, 0)
+	assertEqual(t, tokens[0].EndOffset, 5)
+	assertEqual(t, tokens[1].Token, "world")
+	assertEqual(t, tokens[1].Position, tokens[0].Position+1)
+
+	tokens, err = conn.Analyze("", Analyzer{Tokenizer: "whitespace", Filters: []string{"lowercase"}}, "Foo-Bar BAZ")
+	assertNoError(t, err)
+	assertEqual(t, len(tokens), 2)
+	assertEqual(t, tokens[0].Token, "foo-bar")
+	assertEqual(t, tokens[1].Token, "baz")
+}
+
+func TestAnalyzeRequests(t *testing.T) {
+	analyzer := Analyzer{
+		Tokenizer:   "standard",
+		Filters:     []string{"lowercase", "asciifolding"},
+		CharFilters: []string{"html_strip"},
+	}
+	response := `{"tokens":[{"token":"foo","start_offset":0,"end_offset":3,"type":"<ALPHANUM>","position":1}]}`
+
+	testRequests(t, "1.7.5", []requestCase{
+		{
+			name:     "arguments before 5.0",
+			response: response,
+			call: func(t *testing.T, conn *Connection) error {
+				tokens, err := conn.Analyze("tweets", analyzer, "Foo")
+				assertEqual(t, tokens, []Token{{Token: "foo", Type: "<ALPHANUM>", Position: 1, StartOffset: 0, EndOffset: 3}})
+				return err
+			},
+			requests: []string{"GET /tweets/_analyze?char_filters=html_strip&filters=lowercase%2Casciifolding&text=Foo&tokenizer=standard null"},
+		},
+		{
+			name:     "body since 5.0",
+			response: response,
+			call: func(t *testing.T, conn *Connection) error {
+				conn.Version = "5.6.16"
+				_, err := conn.Analyze("", analyzer, "Foo")
+				return err
+			},
+			requests: []string{`GET /_analyze {"char_filter":["html_strip"],"filter":["lowercase","asciifolding"],"text":"Foo","tokenizer":"standard"}`},
+		},
+		{
+			name:     "field",
+			response: response,
+			call: func(t *testing.T, conn *Connection) error {
+				_, err := conn.Analyze("tweets", Analyzer{Field: "user"}, "Foo")
+				return err
+			},
+			requests: []string{`GET /tweets/_analyze {"field":"user","text":"Foo"}`},
+		},
+	})
+}
+
+func TestOptimize(t *testing.T) {
+	indexName := "testoptimize"
+
+	conn := testConnection(t)
+	conn.DeleteIndex(indexName)
+
+	_, err := conn.CreateIndex(indexName, map[string]interface{}{})
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	resp, err := conn.Optimize([]string{indexName}, url.Values{"max_num_segments": {"1"}})
+	assertNoError(t, err)
+	assertEqual(t, resp.Shards.Failed, uint64(0))
+}
+
+func TestOptimizeRequests(t *testing.T) {
+	server, conn := newFakeServer(t, "1.7.5")
+	server.answer(200, `{"_shards":{"total":2,"successful":2,"failed":0}}`)
+
+	resp, err := conn.Optimize([]string{"tweets", "users"}, url.Values{"max_num_segments": {"1"}})
+	assertNoError(t, err)
+	assertEqual(t, resp.Shards.Successful, uint64(2))
+
+	conn.Version = "2.1.0"
+	_, err = conn.Optimize(nil, url.Values{"only_expunge_deletes": {"true"}})
+	assertNoError(t, err)
+
+	assertEqual(t, server.requests(), []string{
+		"POST /tweets,users/_optimize?max_num_segments=1 null",
+		"POST /_forcemerge?only_expunge_deletes=true null",
+	})
+}
+
+func TestFlush(t *testing.T) {
+	indexName := "testflush"
+
+	conn := testConnection(t)
+	conn.DeleteIndex(indexName)
+
+	_, err := conn.CreateIndex(indexName, map[string]interface{}{})
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	resp, err := conn.Flush([]string{indexName}, url.Values{"wait_if_ongoing": {"true"}})
+	assertNoError(t, err)
+	assertEqual(t, resp.Shards.Failed, uint64(0))
+}
+
+func TestFlushRequests(t *testing.T) {
+	server, conn := newFakeServer(t, "1.7.5")
+	server.answer(200, `{"_shards":{"total":2,"successful":2,"failed":0}}`)
+
+	_, err := conn.Flush([]string{"tweets"}, url.Values{"wait_if_ongoing": {"true"}})
+	assertNoError(t, err)
+
+	_, err = conn.Flush(nil, nil)
+	assertNoError(t, err)
+
+	assertEqual(t, server.requests(), []string{
+		"POST /tweets/_flush?wait_if_ongoing=true null",
+		"POST /_flush null",
+	})
+}
+
+func TestClearCache(t *testing.T) {
+	indexName := "testclearcache"
+
+	conn := testConnection(t)
+	conn.DeleteIndex(indexName)
+
+	_, err := conn.CreateIndex(indexName, map[string]interface{}{})
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	resp, err := conn.ClearCache([]string{indexName}, url.Values{"fielddata": {"true"}})
+	assertNoError(t, err)
+	assertEqual(t, resp.Shards.Failed, uint64(0))
+}
+
+func TestClearCacheRequests(t *testing.T) {
+	server, conn := newFakeServer(t, "1.7.5")
+	server.answer(200, `{"_shards":{"total":2,"successful":2,"failed":0}}`)
+
+	_, err := conn.ClearCache([]string{"tweets", "users"}, url.Values{"filter": {"true"}, "fielddata": {"true"}})
+	assertNoError(t, err)
+
+	_, err = conn.ClearCache(nil, nil)
+	assertNoError(t, err)
+
+	assertEqual(t, server.requests(), []string{
+		"POST /tweets,users/_cache/clear?fielddata=true&filter=true null",
+		"POST /_cache/clear null",
+	})
+}
+
+func TestRepositories(t *testing.T) {
+	repositoryName := "testrepositories"
+
+	conn := testConnection(t)
+	location := testSnapshotLocation(t)
+
+	repository := Repository{
+		Type:     "fs",
+		Settings: map[string]interface{}{"location": location},
+	}
+
+	_, err := conn.CreateRepository(repositoryName, repository)
+	assertNoError(t, err)
+	defer conn.DeleteRepository(repositoryName)
+
+	repositories, err := conn.GetRepository([]string{repositoryName})
+	assertNoError(t, err)
+	assertEqual(t, repositories[repositoryName].Type, "fs")
+	assertEqual(t, repositories[repositoryName].Settings["location"], location)
+
+	nodes, err := conn.VerifyRepository(repositoryName)
+	assertNoError(t, err)
+	if len(nodes) == 0 {
+		t.Fatalf("no node verified the repository")
+	}
+
+	_, err = conn.DeleteRepository(repositoryName)
+	assertNoError(t, err)
+}
+
+func TestRepositoriesRequests(t *testing.T) {
+	testRequests(t, "1.7.5", []requestCase{
+		{
+			name:     "create",
+			response: `{"acknowledged":true}`,
+			call: func(t *testing.T, conn *Connection) error {
+				_, err := conn.CreateRepository("backups", Repository{
+					Type:     "fs",
+					Settings: map[string]interface{}{"location": "/mnt/backups", "compress": true},
+				})
+				return err
+			},
+			requests: []string{`PUT /_snapshot/backups {"type":"fs","settings":{"compress":true,"location":"/mnt/backups"}}`},
+		},
+		{
+			name:     "get",
+			response: `{"backups":{"type":"fs","settings":{"location":"/mnt/backups"}},"archives":{"type":"url","settings":{"url":"file:/mnt/archives"}}}`,
+			call: func(t *testing.T, conn *Connection) error {
+				repositories, err := conn.GetRepository(nil)
+				assertEqual(t, repositories, map[string]Repository{
+					"backups":  {Type: "fs", Settings: map[string]interface{}{"location": "/mnt/backups"}},
+					"archives": {Type: "url", Settings: map[string]interface{}{"url": "file:/mnt/archives"}},
+				})
+				return err
+			},
+			requests: []string{"GET /_snapshot null"},
+		},
+		{
+			name:     "verify",
+			response: `{"nodes":{"AbC":{"name":"node2"},"dEf":{"name":"node1"}}}`,
+			call: func(t *testing.T, conn *Connection) error {
+				nodes, err := conn.VerifyRepository("backups")
+				assertEqual(t, nodes, []string{"node1", "node2"})
+				return err
+			},
+			requests: []string{"POST /_snapshot/backups/_verify null"},
+		},
+		{
+			name:     "delete",
+			response: `{"acknowledged":true}`,
+			call: func(t *testing.T, conn *Connection) error {
+				_, err := conn.DeleteRepository("backups")
+				return err
+			},
+			requests: []string{"DELETE /_snapshot/backups null"},
+		},
+	})
+}
+
+// testSnapshotLocation returns a directory of the path.repo setting of the
+// test server
+func testSnapshotLocation(t *testing.T) string {
+	location := os.Getenv("TEST_SNAPSHOT_LOCATION")
+	if location == "" {
+		t.Skip("TEST_SNAPSHOT_LOCATION is not set to a path.repo of the server")
+	}
+
+	return location
+}
+
+func TestSnapshots(t *testing.T) {
+	repositoryName := "testsnapshots"
+	indexName := "testsnapshots"
+
+	conn := testConnection(t)
+	location := testSnapshotLocation(t)
+	conn.DeleteIndex(indexName)
+
+	_, err := conn.CreateRepository(repositoryName, Repository{
+		Type:     "fs",
+		Settings: map[string]interface{}{"location": location},
+	})
+	assertNoError(t, err)
+	defer conn.DeleteRepository(repositoryName)
+
+	_, err = conn.CreateIndex(indexName, map[string]interface{}{})
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	body := map[string]interface{}{"indices": indexName}
+	snapshot, err := conn.CreateSnapshot(repositoryName, "snap1", body, true)
+	assertNoError(t, err)
+	defer conn.DeleteSnapshot(repositoryName, "snap1")
+	assertEqual(t, snapshot.Snapshot, "snap1")
+	assertEqual(t, snapshot.State, "SUCCESS")
+	assertEqual(t, snapshot.Indices, []string{indexName})
+
+	snapshots, err := conn.GetSnapshots(repositoryName, nil)
+	assertNoError(t, err)
+	assertEqual(t, len(snapshots), 1)
+	assertEqual(t, snapshots[0].Snapshot, "snap1")
+
+	statuses, err := conn.SnapshotStatus(repositoryName, []string{"snap1"})
+	assertNoError(t, err)
+	assertEqual(t, len(statuses), 1)
+	assertEqual(t, statuses[0].State, "SUCCESS")
+
+	_, err = conn.CloseIndex(indexName)
+	assertNoError(t, err)
+
+	snapshot, err = conn.RestoreSnapshot(repositoryName, "snap1", body, true)
+	assertNoError(t, err)
+	assertEqual(t, snapshot.Shards.Failed, uint64(0))
+
+	_, err = conn.DeleteSnapshot(repositoryName, "snap1")
+	assertNoError(t, err)
+}
+
+func TestSnapshotsRequests(t *testing.T) {
+	server, conn := newFakeServer(t, "1.7.5")
+
+	server.answer(200, `{"snapshot":{"snapshot":"snap1","indices":["tweets"],"state":"SUCCESS","start_time_in_millis":1000,"end_time_in_millis":3000,"duration_in_millis":2000,"failures":[],"shards":{"total":5,"failed":0,"successful":5}}}`)
+	snapshot, err := conn.CreateSnapshot("backups", "snap1", map[string]interface{}{"indices": "tweets"}, true)
+	assertNoError(t, err)
+	assertEqual(t, snapshot, Snapshot{
+		Snapshot:          "snap1",
+		Indices:           []string{"tweets"},
+		State:             "SUCCESS",
+		StartTimeInMillis: 1000,
+		EndTimeInMillis:   3000,
+		DurationInMillis:  2000,
+		Failures:          []SnapshotFailure{},
+		Shards:            Shard{Total: 5, Successful: 5},
+	})
+
+	server.answer(200, `{"accepted":true}`)
+	snapshot, err = conn.CreateSnapshot("backups", "snap2", nil, false)
+	assertNoError(t, err)
+	assertEqual(t, snapshot, Snapshot{Snapshot: "snap2"})
+
+	snapshot, err = conn.RestoreSnapshot("backups", "snap1", nil, false)
+	assertNoError(t, err)
+	assertEqual(t, snapshot, Snapshot{Snapshot: "snap1"})
+
+	server.answer(200, `{"snapshots":[{"snapshot":"snap1","indices":["tweets"],"state":"PARTIAL","failures":[{"index":"tweets","shard_id":2,"node_id":"AbC","reason":"IndexShardSnapshotFailedException","status":"INTERNAL_SERVER_ERROR"}],"shards":{"total":5,"failed":1,"successful":4}}]}`)
+	snapshots, err := conn.GetSnapshots("backups", nil)
+	assertNoError(t, err)
+	assertEqual(t, len(snapshots), 1)
+	assertEqual(t, snapshots[0].State, "PARTIAL")
+	assertEqual(t, snapshots[0].Failures, []SnapshotFailure{{
+		Index:   "tweets",
+		ShardId: 2,
+		NodeId:  "AbC",
+		Reason:  "IndexShardSnapshotFailedException",
+		Status:  "INTERNAL_SERVER_ERROR",
+	}})
+
+	server.answer(200, `{"snapshots":[{"snapshot":"snap2","repository":"backups","state":"STARTED",
+		"shards_stats":{"initializing":0,"started":1,"finalizing":0,"done":1,"failed":0,"total":2},
+		"stats":{"number_of_files":10,"processed_files":5,"total_size_in_bytes":400,"processed_size_in_bytes":100,"start_time_in_millis":1000,"time_in_millis":50},
+		"indices":{"tweets":{
+			"shards_stats":{"initializing":0,"started":1,"finalizing":0,"done":1,"failed":0,"total":2},
+			"stats":{"number_of_files":10,"processed_files":5,"total_size_in_bytes":400,"processed_size_in_bytes":100,"start_time_in_millis":1000,"time_in_millis":50},
+			"shards":{
+				"0":{"stage":"DONE","stats":{"number_of_files":5,"processed_files":5,"total_size_in_bytes":100,"processed_size_in_bytes":100,"start_time_in_millis":1000,"time_in_millis":20}},
+				"1":{"stage":"STARTED","node":"AbC","stats":{"number_of_files":5,"processed_files":0,"total_size_in_bytes":300,"processed_size_in_bytes":0,"start_time_in_millis":1000,"time_in_millis":50}}
+			}
+		}}
+	}]}`)
+	statuses, err := conn.SnapshotStatus("backups", nil)
+	assertNoError(t, err)
+	assertEqual(t, len(statuses), 1)
+	assertEqual(t, statuses[0].ShardsStats, SnapshotShardsStats{Started: 1, Done: 1, Total: 2})
+	assertEqual(t, statuses[0].Stats.Progress(), 0.25)
+
+	shards := statuses[0].Indices["tweets"].Shards
+	assertEqual(t, shards["0"].Stage, "DONE")
+	assertEqual(t, shards["0"].Stats.Progress(), 1.0)
+	assertEqual(t, shards["1"].Stage, "STARTED")
+	assertEqual(t, shards["1"].NodeId, "AbC")
+	assertEqual(t, shards["1"].Stats.Progress(), 0.0)
+
+	server.answer(200, `{"acknowledged":true}`)
+	_, err = conn.DeleteSnapshot("backups", "snap1")
+	assertNoError(t, err)
+
+	assertEqual(t, server.requests(), []string{
+		`PUT /_snapshot/backups/snap1?wait_for_completion=true {"indices":"tweets"}`,
+		`PUT /_snapshot/backups/snap2?wait_for_completion=false {}`,
+		`POST /_snapshot/backups/snap1/_restore?wait_for_completion=false {}`,
+		"GET /_snapshot/backups/_all null",
+		"GET /_snapshot/backups/_status null",
+		"DELETE /_snapshot/backups/snap1 null",
+	})
+}
+
+func TestRollover(t *testing.T) {
+	alias := "testrollover"
+
+	conn := testConnection(t)
+	SkipUnlessSupported(t, conn, FEATURE_ROLLOVER_API)
+	conn.DeleteIndex(alias + "-000001")
+	conn.DeleteIndex(alias + "-000002")
+
+	_, err := conn.CreateIndex(alias+"-000001", map[string]interface{}{
+		"aliases": map[string]interface{}{alias: map[string]interface{}{}},
+	})
+	assertNoError(t, err)
+	defer conn.DeleteIndex(alias + "-000001")
+	defer conn.DeleteIndex(alias + "-000002")
+
+	result, err := conn.Rollover(alias, map[string]interface{}{"max_docs": 1}, nil)
+	assertNoError(t, err)
+	assertEqual(t, result.RolledOver, false)
+	assertEqual(t, result.OldIndex, alias+"-000001")
+
+	_, err = conn.Index(Document{
+		Index:  alias,
+		Type:   "tweet",
+		Id:     "1",
+		Fields: map[string]interface{}{"user": "foo"},
+	}, url.Values{"refresh": {"true"}})
+	assertNoError(t, err)
+
+	result, err = conn.Rollover(alias, map[string]interface{}{"max_docs": 1}, nil)
+	assertNoError(t, err)
+	assertEqual(t, result.RolledOver, true)
+	assertEqual(t, result.NewIndex, alias+"-000002")
+}
+
+func TestRolloverRequests(t *testing.T) {
+	server, conn := newFakeServer(t, "5.6.16")
+	server.answer(200, `{"acknowledged":true,"shards_acknowledged":true,"old_index":"logs-000001","new_index":"logs-000002","rolled_over":true,"dry_run":false,"conditions":{"[max_age: 7d]":false,"[max_docs: 1000]":true}}`)
+
+	result, err := conn.Rollover("logs", map[string]interface{}{"max_age": "7d", "max_docs": 1000}, map[string]interface{}{
+		"settings": map[string]interface{}{"index.number_of_shards": 2},
+	})
+	assertNoError(t, err)
+	assertEqual(t, result, RolloverResult{
+		Acknowledged:       true,
+		ShardsAcknowledged: true,
+		OldIndex:           "logs-000001",
+		NewIndex:           "logs-000002",
+		RolledOver:         true,
+		Conditions:         map[string]bool{"[max_age: 7d]": false, "[max_docs: 1000]": true},
+	})
+
+	conn.Version = "2.4.6"
+	_, err = conn.Rollover("logs", nil, nil)
+	assertError(t, err)
+
+	assertEqual(t, server.requests(), []string{
+		`POST /logs/_rollover {"conditions":{"max_age":"7d","max_docs":1000},"settings":{"index.number_of_shards":2}}`,
+	})
+}
+
+func TestWarmers(t *testing.T) {
+	indexName := "testwarmers"
+
+	conn := testConnection(t)
+	SkipUnlessSupported(t, conn, FEATURE_WARMERS)
+	conn.DeleteIndex(indexName)
+
+	_, err := conn.CreateIndex(indexName, map[string]interface{}{})
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	query := map[string]interface{}{
+		"query": map[string]interface{}{"match_all": map[string]interface{}{}},
+	}
+
+	_, err = conn.PutWarmer("warmer1", query, []string{indexName}, []string{"tweet"})
+	assertNoError(t, err)
+
+	warmers, err := conn.GetWarmer([]string{indexName}, "warmer1")
+	assertNoError(t, err)
+	assertEqual(t, warmers[indexName]["warmer1"].Types, []string{"tweet"})
+
+	_, err = conn.DeleteWarmer([]string{indexName}, "warmer1")
+	assertNoError(t, err)
+
+	warmers, err = conn.GetWarmer([]string{indexName}, "warmer1")
+	assertNoError(t, err)
+	assertEqual(t, len(warmers[indexName]), 0)
+}
+
+func TestWarmersRequests(t *testing.T) {
+	query := map[string]interface{}{
+		"query": map[string]interface{}{"match_all": map[string]interface{}{}},
+	}
+
+	testRequests(t, "1.7.5", []requestCase{
+		{
+			name:     "put with types",
+			response: `{"acknowledged":true}`,
+			call: func(t *testing.T, conn *Connection) error {
+				_, err := conn.PutWarmer("warmer1", query, []string{"tweets"}, []string{"tweet"})
+				return err
+			},
+			requests: []string{`PUT /tweets/tweet/_warmer/warmer1 {"query":{"match_all":{}}}`},
+		},
+		{
+			name:     "put",
+			response: `{"acknowledged":true}`,
+			call: func(t *testing.T, conn *Connection) error {
+				_, err := conn.PutWarmer("warmer2", query, []string{"tweets", "users"}, nil)
+				return err
+			},
+			requests: []string{`PUT /tweets,users/_warmer/warmer2 {"query":{"match_all":{}}}`},
+		},
+		{
+			name:     "get",
+			response: `{"tweets":{"warmers":{"warmer1":{"types":["tweet"],"source":{"query":{"match_all":{}}}}}}}`,
+			call: func(t *testing.T, conn *Connection) error {
+				warmers, err := conn.GetWarmer([]string{"tweets"}, "")
+				assertEqual(t, warmers, map[string]map[string]Warmer{
+					"tweets": {"warmer1": {Types: []string{"tweet"}, Source: query}},
+				})
+				return err
+			},
+			requests: []string{"GET /tweets/_warmer null"},
+		},
+		{
+			name:     "delete",
+			response: `{"acknowledged":true}`,
+			call: func(t *testing.T, conn *Connection) error {
+				_, err := conn.DeleteWarmer([]string{"tweets"}, "warmer1")
+				return err
+			},
+			requests: []string{"DELETE /tweets/_warmer/warmer1 null"},
+		},
+		{
+			name: "since 5.0",
+			call: func(t *testing.T, conn *Connection) error {
+				conn.Version = "5.6.16"
+				_, err := conn.PutWarmer("warmer1", query, []string{"tweets"}, nil)
+				return err
+			},
+			err: "warmers is not supported by elasticsearch 5.6.16",
+		},
+	})
+}
+
+func TestSegments(t *testing.T) {
+	indexName := "testsegments"
+
+	conn := testConnection(t)
+	conn.DeleteIndex(indexName)
+
+	_, err := conn.CreateIndex(indexName, map[string]interface{}{
+		"settings": map[string]interface{}{"number_of_shards": 1, "number_of_replicas": 0},
+	})
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	_, err = conn.Index(Document{
+		Index:  indexName,
+		Type:   "tweet",
+		Id:     "1",
+		Fields: map[string]interface{}{"user": "foo"},
+	}, url.Values{"refresh": {"true"}})
+	assertNoError(t, err)
+
+	segments, err := conn.Segments([]string{indexName})
+	assertNoError(t, err)
+	assertEqual(t, len(segments[indexName]), 1)
+
+	shard := segments[indexName][0]
+	assertEqual(t, shard.Shard, 0)
+	assertEqual(t, shard.Routing.Primary, true)
+
+	docs := uint64(0)
+	for _, segment := range shard.Segments {
+		docs += segment.NumDocs
+	}
+	assertEqual(t, docs, uint64(1))
+}
+
+func TestSegmentsRequests(t *testing.T) {
+	server, conn := newFakeServer(t, "1.7.5")
+	server.answer(200, `{"_shards":{"total":3,"successful":3,"failed":0},"indices":{"tweets":{"shards":{
+		"1":[{"routing":{"state":"STARTED","primary":true,"node":"AbC"},"num_committed_segments":0,"num_search_segments":0,"segments":{}}],
+		"0":[
+			{"routing":{"state":"STARTED","primary":false,"node":"dEf"},"num_committed_segments":1,"num_search_segments":1,"segments":{}},
+			{"routing":{"state":"STARTED","primary":true,"node":"AbC"},"num_committed_segments":1,"num_search_segments":1,"segments":{
+				"_0":{"generation":0,"num_docs":10,"deleted_docs":2,"size_in_bytes":3000,"memory_in_bytes":400,"committed":true,"search":true,"version":"4.10.4","compound":true}
+			}}
+		]
+	}}}}`)
+
+	segments, err := conn.Segments([]string{"tweets"})
+	assertNoError(t, err)
+
+	shards := segments["tweets"]
+	assertEqual(t, len(shards), 3)
+	assertEqual(t, shards[0].Shard, 0)
+	assertEqual(t, shards[0].Routing, ShardRouting{State: "STARTED", Primary: true, Node: "AbC"})
+	assertEqual(t, shards[0].Segments, map[string]Segment{
+		"_0": {
+			NumDocs:       10,
+			DeletedDocs:   2,
+			SizeInBytes:   3000,
+			MemoryInBytes: 400,
+			Committed:     true,
+			Search:        true,
+			Version:       "4.10.4",
+			Compound:      true,
+		},
+	})
+	assertEqual(t, shards[1].Shard, 0)
+	assertEqual(t, shards[1].Routing.Primary, false)
+	assertEqual(t, shards[2].Shard, 1)
+	assertEqual(t, shards[2].NumCommittedSegments, 0)
+
+	assertEqual(t, server.requests(), []string{"GET /tweets/_segments null"})
+}
+
+func TestRecovery(t *testing.T) {
+	indexName := "testrecovery"
+
+	conn := testConnection(t)
+	conn.DeleteIndex(indexName)
+
+	_, err := conn.CreateIndex(indexName, map[string]interface{}{
+		"settings": map[string]interface{}{"number_of_shards": 1, "number_of_replicas": 0},
+	})
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	_, err = conn.Health([]string{indexName}, url.Values{"wait_for_status": {"yellow"}})
+	assertNoError(t, err)
+
+	recoveries, err := conn.Recovery([]string{indexName}, false)
+	assertNoError(t, err)
+	assertEqual(t, len(recoveries[indexName]), 1)
+	assertEqual(t, recoveries[indexName][0].Stage, "DONE")
+	assertEqual(t, recoveries[indexName][0].Primary, true)
+}
+
+func TestRecoveryRequests(t *testing.T) {
+	server, conn := newFakeServer(t, "2.4.6")
+
+	server.answer(200, `{"tweets":{"shards":[{"id":0,"type":"RELOCATION","stage":"INDEX","primary":true,
+		"start_time_in_millis":1000,"stop_time_in_millis":0,"total_time_in_millis":500,
+		"source":{"id":"AbC","host":"10.0.0.1","transport_address":"10.0.0.1:9300","ip":"10.0.0.1","name":"node1"},
+		"target":{"id":"dEf","host":"10.0.0.2","transport_address":"10.0.0.2:9300","ip":"10.0.0.2","name":"node2"},
+		"index":{"size":{"total_in_bytes":4000,"reused_in_bytes":0,"recovered_in_bytes":1000,"percent":"25.0%"},
+			"files":{"total":10,"reused":0,"recovered":5,"percent":"50.0%"},"total_time_in_millis":400}}]}}`)
+	recoveries, err := conn.Recovery([]string{"tweets"}, true)
+	assertNoError(t, err)
+	assertEqual(t, recoveries, map[string][]ShardRecovery{
+		"tweets": {{
+			Id:                0,
+			Type:              "RELOCATION",
+			Stage:             "INDEX",
+			Primary:           true,
+			StartTimeInMillis: 1000,
+			TotalTimeInMillis: 500,
+			Source:            RecoveryNode{"AbC", "10.0.0.1", "10.0.0.1:9300", "10.0.0.1", "node1"},
+			Target:            RecoveryNode{"dEf", "10.0.0.2", "10.0.0.2:9300", "10.0.0.2", "node2"},
+			Index: RecoveryIndex{
+				Files:             RecoveryProgress{Total: 10, Recovered: 5, Percent: 50},
+				Bytes:             RecoveryProgress{Total: 4000, Recovered: 1000, Percent: 25},
+				TotalTimeInMillis: 400,
+			},
+		}},
+	})
+
+	// elasticsearch 1.x
+	server.answer(200, `{"users":{"shards":[{"id":0,"type":"STORE","stage":"DONE","primary":true,
+		"index":{"files":{"total":3,"reused":3,"recovered":3,"percent":"100.0%"},
+			"bytes":{"total":300,"reused":300,"recovered":300,"percent":"100.0%"},"total_time_in_millis":10}}]}}`)
+	recoveries, err = conn.Recovery(nil, false)
+	assertNoError(t, err)
+	assertEqual(t, recoveries["users"][0].Index.Bytes, RecoveryProgress{300, 300, 300, 100})
+
+	assertEqual(t, server.requests(), []string{
+		"GET /tweets/_recovery?active_only=true null",
+		"GET /_recovery null",
+	})
+}
+
+func TestGetFieldMapping(t *testing.T) {
+	indexName := "testgetfieldmapping"
+	docType := "tweet"
+
+	conn := testConnection(t)
+	conn.DeleteIndex(indexName)
+
+	_, err := conn.CreateIndex(indexName, map[string]interface{}{})
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	_, err = conn.PutMapping(indexName, docType, map[string]interface{}{
+		"properties": map[string]interface{}{
+			"user": map[string]interface{}{
+				"properties": map[string]interface{}{
+					"age": map[string]interface{}{"type": "integer"},
+				},
+			},
+		},
+	})
+	assertNoError(t, err)
+
+	mappings, err := conn.GetFieldMapping([]string{indexName}, []string{docType}, []string{"user.age"})
+	assertNoError(t, err)
+	assertEqual(t, mappings[indexName][docType]["user.age"].Type(), "integer")
+}
+
+func TestGetFieldMappingRequests(t *testing.T) {
+	server, conn := newFakeServer(t, "1.7.5")
+
+	server.answer(200, `{"tweets":{"mappings":{"tweet":{
+		"user.age":{"full_name":"user.age","mapping":{"age":{"type":"integer"}}},
+		"message":{"full_name":"message","mapping":{"message":{"type":"string"}}}
+	}}}}`)
+	mappings, err := conn.GetFieldMapping([]string{"tweets"}, []string{"tweet"}, []string{"user.age", "message"})
+	assertNoError(t, err)
+	assertEqual(t, mappings, map[string]map[string]map[string]Mapping{
+		"tweets": {"tweet": {
+			"user.age": {"type": "integer"},
+			"message":  {"type": "string"},
+		}},
+	})
+
+	// elasticsearch 7.x
+	server.answer(200, `{"users":{"mappings":{
+		"name":{"full_name":"name","mapping":{"name":{"type":"keyword"}}}
+	}}}`)
+	mappings, err = conn.GetFieldMapping([]string{"users"}, nil, []string{"na*"})
+	assertNoError(t, err)
+	assertEqual(t, mappings, map[string]map[string]map[string]Mapping{
+		"users": {"_doc": {"name": {"type": "keyword"}}},
+	})
+
+	assertEqual(t, server.requests(), []string{
+		"GET /tweets/_mapping/tweet/field/user.age,message null",
+		"GET /users/_mapping/field/na* null",
+	})
+}
+
+func TestDeleteMapping(t *testing.T) {
+	indexName := "testdeletemapping"
+	docType := "tweet"
+
+	conn := testConnection(t)
+	SkipUnlessSupported(t, conn, FEATURE_DELETE_MAPPING)
+	conn.DeleteIndex(indexName)
+
+	_, err := conn.CreateIndex(indexName, map[string]interface{}{})
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	_, err = conn.PutMapping(indexName, docType, map[string]interface{}{
+		"properties": map[string]interface{}{
+			"user": map[string]interface{}{"type": "string"},
+		},
+	})
+	assertNoError(t, err)
+
+	resp, err := conn.DeleteMapping(indexName, docType)
+	assertNoError(t, err)
+	assertEqual(t, resp.Acknowledged, true)
+
+	exists, err := conn.TypeExists(indexName, docType)
+	assertNoError(t, err)
+	assertEqual(t, exists, false)
+}
+
+func TestDeleteMappingRequests(t *testing.T) {
+	server, conn := newFakeServer(t, "1.7.5")
+	server.answer(200, `{"acknowledged":true}`)
+
+	resp, err := conn.DeleteMapping("tweets", "tweet")
+	assertNoError(t, err)
+	assertEqual(t, resp.Acknowledged, true)
+
+	conn.Version = "2.4.6"
+	_, err = conn.DeleteMapping("tweets", "tweet")
+	assertError(t, err)
+
+	assertEqual(t, server.requests(), []string{"DELETE /tweets/tweet/_mapping null"})
+}
+
+func TestRefresh(t *testing.T) {
+	indexName := "testrefresh"
+
+	conn := testConnection(t)
+	conn.DeleteIndex(indexName)
+
+	_, err := conn.CreateIndex(indexName, map[string]interface{}{})
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	conn.RefreshWrites = REFRESH_TRUE
+	_, err = conn.BulkSend(indexName, []Document{{
+		Type:        "tweet",
+		Id:          "1",
+		BulkCommand: BULK_COMMAND_INDEX,
+		Fields:      map[string]interface{}{"user": "foo"},
+	}})
+	assertNoError(t, err)
+
+	query := map[string]interface{}{
+		"query": map[string]interface{}{"match_all": map[string]interface{}{}},
+	}
+
+	// the document is searchable without a refresh
+	resp, err := conn.Search(query, []string{indexName}, nil)
+	assertNoError(t, err)
+	assertEqual(t, resp.Hits.Total, uint64(1))
+
+	_, err = conn.Refresh(nil)
+	assertNoError(t, err)
+}
+
+func TestRefreshRequests(t *testing.T) {
+	d := Document{Index: "tweets", Type: "tweet", Id: "1", Fields: map[string]interface{}{"user": "foo"}}
+	deleted := `{"delete":{"_id":"1","_index":null,"_type":"tweet"}}` + "\n"
+
+	testRequests(t, "5.6.16", []requestCase{
+		{
+			name:     "indices",
+			response: `{}`,
+			call: func(t *testing.T, conn *Connection) error {
+				_, err := conn.Refresh([]string{"tweets", "users"})
+				return err
+			},
+			requests: []string{"POST /tweets,users/_refresh null"},
+		},
+		{
+			name:     "all",
+			response: `{}`,
+			call: func(t *testing.T, conn *Connection) error {
+				_, err := conn.Refresh(nil)
+				return err
+			},
+			requests: []string{"POST /_refresh null"},
+		},
+		{
+			name:     "writes",
+			response: `{}`,
+			call: func(t *testing.T, conn *Connection) error {
+				conn.RefreshWrites = REFRESH_WAIT_FOR
+				_, err := conn.Index(d, nil)
+				return err
+			},
+			requests: []string{`PUT /tweets/tweet/1/?refresh=wait_for {"user":"foo"}`},
+		},
+		{
+			name:     "extraArgs win",
+			response: `{}`,
+			call: func(t *testing.T, conn *Connection) error {
+				_, err := conn.Delete(d, url.Values{"refresh": {REFRESH_TRUE}})
+				return err
+			},
+			requests: []string{"DELETE /tweets/tweet/1/?refresh=true null"},
+		},
+		{
+			name:     "bulk",
+			response: `{}`,
+			call: func(t *testing.T, conn *Connection) error {
+				_, err := conn.BulkSend("tweets", []Document{{Type: "tweet", Id: "1", BulkCommand: BULK_COMMAND_DELETE}})
+				return err
+			},
+			requests: []string{"POST /tweets/_bulk?refresh=wait_for " + deleted},
+		},
+		{
+			name:     "raw bulk",
+			response: `{}`,
+			call: func(t *testing.T, conn *Connection) error {
+				_, err := conn.BulkSendRaw("tweets", strings.NewReader(deleted))
+				return err
+			},
+			requests: []string{"POST /tweets/_bulk?refresh=wait_for " + deleted},
+		},
+		{
+			name:     "no refresh",
+			response: `{}`,
+			call: func(t *testing.T, conn *Connection) error {
+				conn.RefreshWrites = ""
+				_, err := conn.Index(d, nil)
+				return err
+			},
+			requests: []string{`PUT /tweets/tweet/1/ {"user":"foo"}`},
+		},
+	})
+}
+
+func TestHealth(t *testing.T) {
+	indexName := "testhealth"
+
+	conn := testConnection(t)
+	conn.DeleteIndex(indexName)
+
+	_, err := conn.CreateIndex(indexName, map[string]interface{}{
+		"settings": map[string]interface{}{"number_of_shards": 2, "number_of_replicas": 0},
+	})
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	err = conn.WaitForStatus([]string{indexName}, HEALTH_GREEN, "10s")
+	assertNoError(t, err)
+
+	health, err := conn.Health([]string{indexName}, nil)
+	assertNoError(t, err)
+	assertEqual(t, health.Status, HEALTH_GREEN)
+	assertEqual(t, health.ActivePrimaryShards, 2)
+	assertEqual(t, health.UnassignedShards, 0)
+}
+
+func TestHealthRequests(t *testing.T) {
+	server, conn := newFakeServer(t, "1.7.5")
+	server.answer(200, `{"cluster_name":"es","status":"yellow","timed_out":false,"number_of_nodes":1,"number_of_data_nodes":1,
+		"active_primary_shards":5,"active_shards":5,"relocating_shards":1,"initializing_shards":2,"unassigned_shards":5}`)
+
+	health, err := conn.Health(nil, nil)
+	assertNoError(t, err)
+	assertEqual(t, health, ClusterHealth{
+		ClusterName:         "es",
+		Status:              HEALTH_YELLOW,
+		NumberOfNodes:       1,
+		NumberOfDataNodes:   1,
+		ActivePrimaryShards: 5,
+		ActiveShards:        5,
+		RelocatingShards:    1,
+		InitializingShards:  2,
+		UnassignedShards:    5,
+	})
+
+	err = conn.WaitForStatus([]string{"tweets"}, HEALTH_YELLOW, "1s")
+	assertNoError(t, err)
+
+	server.answer(408, `{"cluster_name":"es","status":"yellow","timed_out":true,"unassigned_shards":5}`)
+	err = conn.WaitForStatus([]string{"tweets", "users"}, HEALTH_GREEN, "1s")
+	assertEqual(t, err, errors.New("status is still yellow after 1s"))
+
+	assertEqual(t, server.requests(), []string{
+		"GET /_cluster/health null",
+		"GET /_cluster/health/tweets?timeout=1s&wait_for_status=yellow null",
+		"GET /_cluster/health/tweets,users?timeout=1s&wait_for_status=green null",
+	})
+}
+
+func TestClusterState(t *testing.T) {
+	indexName := "testclusterstate"
+
+	conn := testConnection(t)
+	conn.DeleteIndex(indexName)
+
+	_, err := conn.CreateIndex(indexName, map[string]interface{}{
+		"settings": map[string]interface{}{"number_of_shards": 1, "number_of_replicas": 0},
+	})
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	state, err := conn.ClusterState([]string{"metadata", "routing_table"}, []string{indexName})
+	assertNoError(t, err)
+	assertEqual(t, state.Metadata.Indices[indexName].State, "open")
+	assertEqual(t, len(state.RoutingTable.Indices[indexName].Shards["0"]), 1)
+
+	state, err = conn.ClusterState(nil, nil)
+	assertNoError(t, err)
+	if _, ok := state.Nodes[state.MasterNode]; !ok {
+		t.Fatalf("master node %s not found in %v", state.MasterNode, state.Nodes)
+	}
+}
+
+func TestClusterStateRequests(t *testing.T) {
+	testRequests(t, "1.7.5", []requestCase{
+		{
+			name: "state",
+			response: `{"cluster_name":"es","version":42,"master_node":"AbC",
+				"blocks":{},
+				"nodes":{"AbC":{"name":"node1","transport_address":"inet[/10.0.0.1:9300]","attributes":{"rack":"r1"}}},
+				"metadata":{"templates":{},"indices":{"tweets":{"state":"open","settings":{"index":{"number_of_shards":"1"}},"mappings":{},"aliases":["all"]}}},
+				"routing_table":{"indices":{"tweets":{"shards":{"0":[{"state":"RELOCATING","primary":true,"node":"AbC","relocating_node":"dEf","shard":0,"index":"tweets"}]}}}}
+			}`,
+			call: func(t *testing.T, conn *Connection) error {
+				state, err := conn.ClusterState(nil, nil)
+				assertEqual(t, state.ClusterName, "es")
+				assertEqual(t, state.Version, int64(42))
+				assertEqual(t, state.Nodes["AbC"].Name, "node1")
+				assertEqual(t, state.Nodes["AbC"].Attributes, map[string]string{"rack": "r1"})
+				assertEqual(t, state.Metadata.Indices["tweets"].State, "open")
+				assertEqual(t, state.Metadata.Indices["tweets"].Aliases, []string{"all"})
+				assertEqual(t, state.RoutingTable.Indices["tweets"].Shards["0"], []ShardRouting{{
+					State:          "RELOCATING",
+					Primary:        true,
+					Node:           "AbC",
+					RelocatingNode: "dEf",
+					Index:          "tweets",
+				}})
+				return err
+			},
+			requests: []string{"GET /_cluster/state null"},
+		},
+		{
+			name:     "metrics",
+			response: `{}`,
+			call: func(t *testing.T, conn *Connection) error {
+				_, err := conn.ClusterState([]string{"metadata", "blocks"}, nil)
+				return err
+			},
+			requests: []string{"GET /_cluster/state/metadata,blocks null"},
+		},
+		{
+			name:     "indices",
+			response: `{}`,
+			call: func(t *testing.T, conn *Connection) error {
+				_, err := conn.ClusterState(nil, []string{"tweets", "users"})
+				return err
+			},
+			requests: []string{"GET /_cluster/state/_all/tweets,users null"},
+		},
+		{
+			name:     "metrics of indices",
+			response: `{}`,
+			call: func(t *testing.T, conn *Connection) error {
+				_, err := conn.ClusterState([]string{"routing_table"}, []string{"tweets"})
+				return err
+			},
+			requests: []string{"GET /_cluster/state/routing_table/tweets null"},
+		},
+	})
+}
+
+func TestClusterSettings(t *testing.T) {
+	conn := testConnection(t)
+
+	_, err := conn.PutClusterSettings(ClusterSettings{
+		Transient: map[string]interface{}{"indices.recovery.max_bytes_per_sec": "50mb"},
+	})
+	assertNoError(t, err)
+	defer conn.PutClusterSettings(ClusterSettings{
+		Transient: map[string]interface{}{"indices.recovery.max_bytes_per_sec": nil},
+	})
+
+	settings, err := conn.GetClusterSettings()
+	assertNoError(t, err)
+	assertEqual(t, settings.Transient["indices.recovery.max_bytes_per_sec"], "50mb")
+}
+
+func TestClusterSettingsRequests(t *testing.T) {
+	server, conn := newFakeServer(t, "1.7.5")
+
+	server.answer(200, `{"acknowledged":true,"persistent":{},"transient":{"cluster.routing.allocation.enable":"none"}}`)
+	resp, err := conn.PutClusterSettings(ClusterSettings{
+		Transient: map[string]interface{}{"cluster.routing.allocation.enable": "none"},
+	})
+	assertNoError(t, err)
+	assertEqual(t, resp.Acknowledged, true)
+
+	server.answer(200, `{"persistent":{"cluster.routing.allocation.enable":"all"},"transient":{"indices.recovery.max_bytes_per_sec":"50mb"}}`)
+	settings, err := conn.GetClusterSettings()
+	assertNoError(t, err)
+	assertEqual(t, settings, ClusterSettings{
+		Persistent: map[string]interface{}{"cluster.routing.allocation.enable": "all"},
+		Transient:  map[string]interface{}{"indices.recovery.max_bytes_per_sec": "50mb"},
+	})
+
+	assertEqual(t, server.requests(), []string{
+		`PUT /_cluster/settings {"transient":{"cluster.routing.allocation.enable":"none"}}`,
+		"GET /_cluster/settings?flat_settings=true null",
+	})
+}
+
+func TestNodes(t *testing.T) {
+	conn := testConnection(t)
+
+	nodes, err := conn.NodesInfo(nil, []string{"jvm"})
+	assertNoError(t, err)
+	if len(nodes) == 0 {
+		t.Fatalf("no node found")
+	}
+
+	ids := []string{}
+	for id, node := range nodes {
+		ids = append(ids, id)
+		if node.Jvm == nil {
+			t.Fatalf("no jvm info for node %s", id)
+		}
+	}
+
+	stats, err := conn.NodesStats(ids, []string{"jvm", "indices"})
+	assertNoError(t, err)
+	assertEqual(t, len(stats), len(nodes))
+
+	for id, node := range stats {
+		if node.Jvm.Mem.HeapUsedInBytes == 0 {
+			t.Fatalf("no heap stats for node %s", id)
+		}
+	}
+}
+
+func TestNodesRequests(t *testing.T) {
+	server, conn := newFakeServer(t, "1.7.5")
+
+	server.answer(200, `{"cluster_name":"es","nodes":{"AbC":{"name":"node1","host":"es1","ip":"10.0.0.1","version":"1.7.5",
+		"attributes":{"rack":"r1"},"jvm":{"version":"1.8.0"}}}}`)
+	nodes, err := conn.NodesInfo(nil, []string{"jvm"})
+	assertNoError(t, err)
+	assertEqual(t, nodes["AbC"].Name, "node1")
+	assertEqual(t, nodes["AbC"].Ip, "10.0.0.1")
+	assertEqual(t, nodes["AbC"].Version, "1.7.5")
+	assertEqual(t, nodes["AbC"].Jvm, map[string]interface{}{"version": "1.8.0"})
+
+	attributes, err := conn.NodeAttributes()
+	assertNoError(t, err)
+	assertEqual(t, attributes, map[string]map[string]string{"node1": {"rack": "r1"}})
+
+	server.answer(200, `{"cluster_name":"es","nodes":{"AbC":{"name":"node1","timestamp":1000,
+		"indices":{"docs":{"count":10,"deleted":1},"store":{"size_in_bytes":3000},"segments":{"count":4,"memory_in_bytes":500}},
+		"os":{"mem":{"total_in_bytes":8000,"free_in_bytes":2000,"used_in_bytes":6000,"free_percent":25,"used_percent":75}},
+		"process":{"open_file_descriptors":200,"max_file_descriptors":65535,"cpu":{"percent":12,"total_in_millis":9000}},
+		"jvm":{"uptime_in_millis":5000,"mem":{"heap_used_in_bytes":100,"heap_used_percent":10,"heap_max_in_bytes":1000},
+			"threads":{"count":40,"peak_count":50},
+			"gc":{"collectors":{"young":{"collection_count":7,"collection_time_in_millis":70}}}}
+	}}}`)
+	stats, err := conn.NodesStats([]string{"AbC", "dEf"}, []string{"indices", "os", "process", "jvm"})
+	assertNoError(t, err)
+
+	node := stats["AbC"]
+	assertEqual(t, node.Name, "node1")
+	assertEqual(t, node.Indices.Docs.Count, uint64(10))
+	assertEqual(t, node.Indices.Store.SizeInBytes, uint64(3000))
+	assertEqual(t, node.Indices.Segments.MemoryInBytes, uint64(500))
+	assertEqual(t, node.Os.Mem.UsedPercent, 75)
+	assertEqual(t, node.Process.OpenFileDescriptors, int64(200))
+	assertEqual(t, node.Process.Cpu.Percent, 12)
+	assertEqual(t, node.Jvm.Mem.HeapUsedPercent, 10)
+	assertEqual(t, node.Jvm.Threads.Count, 40)
+	assertEqual(t, node.Jvm.Gc.Collectors["young"].CollectionCount, uint64(7))
+
+	_, err = conn.NodesStats(nil, nil)
+	assertNoError(t, err)
+
+	_, err = conn.NodesInfo([]string{"AbC"}, nil)
+	assertNoError(t, err)
+
+	assertEqual(t, server.requests(), []string{
+		"GET /_nodes/_all/jvm null",
+		"GET /_nodes null",
+		"GET /_nodes/AbC,dEf/stats/indices,os,process,jvm null",
+		"GET /_nodes/stats null",
+		"GET /_nodes/AbC null",
+	})
+}
+
+func TestHotThreads(t *testing.T) {
+	conn := testConnection(t)
+
+	threads, err := conn.HotThreads(nil, url.Values{"threads": {"1"}})
+	assertNoError(t, err)
+	if len(threads) == 0 {
+		t.Fatalf("no node found")
+	}
+}
+
+func TestHotThreadsRequests(t *testing.T) {
+	server, conn := newFakeServer(t, "2.4.6")
+
+	server.answer(200, "::: {node1}{AbC}{10.0.0.1}{10.0.0.1:9300}\n   Hot threads at 2016-01-01T00:00:00Z:\n\n   12.3% cpu usage by thread 'search'\n\n"+
+		"::: {node2}{dEf}{10.0.0.2}{10.0.0.2:9300}\n   Hot threads at 2016-01-01T00:00:00Z:\n\n")
+	threads, err := conn.HotThreads([]string{"AbC", "dEf"}, url.Values{"threads": {"1"}})
+	assertNoError(t, err)
+	assertEqual(t, threads, map[string]string{
+		"node1": "::: {node1}{AbC}{10.0.0.1}{10.0.0.1:9300}\n   Hot threads at 2016-01-01T00:00:00Z:\n\n   12.3% cpu usage by thread 'search'\n\n",
+		"node2": "::: {node2}{dEf}{10.0.0.2}{10.0.0.2:9300}\n   Hot threads at 2016-01-01T00:00:00Z:\n\n",
+	})
+
+	server.answer(500, "boom")
+	_, err = conn.HotThreads([]string{"missing"}, nil)
+	assertEqual(t, err, error(newSearchError(500, "boom")))
+
+	server.answer(200, "")
+	_, err = conn.HotThreads(nil, nil)
+	assertNoError(t, err)
+
+	assertEqual(t, server.requests(), []string{
+		"GET /_nodes/AbC,dEf/hot_threads?threads=1 null",
+		"GET /_nodes/missing/hot_threads null",
+		"GET /_nodes/hot_threads null",
+	})
+
+	// elasticsearch 1.x
+	assertEqual(t, splitHotThreads("::: [node1][AbC][es1][inet[/10.0.0.1:9300]]\n   0.0% cpu\n"), map[string]string{
+		"node1": "::: [node1][AbC][es1][inet[/10.0.0.1:9300]]\n   0.0% cpu\n",
+	})
+}
+
+func TestPendingTasks(t *testing.T) {
+	conn := testConnection(t)
+
+	_, err := conn.PendingTasks()
+	assertNoError(t, err)
+}
+
+func TestPendingTasksRequests(t *testing.T) {
+	server, conn := newFakeServer(t, "1.7.5")
+	server.answer(200, `{"tasks":[{"insert_order":101,"priority":"URGENT","source":"create-index [tweets], cause [api]","time_in_queue_millis":86,"time_in_queue":"86ms"}]}`)
+
+	tasks, err := conn.PendingTasks()
+	assertNoError(t, err)
+	assertEqual(t, tasks, []PendingTask{{
+		InsertOrder:       101,
+		Priority:          "URGENT",
+		Source:            "create-index [tweets], cause [api]",
+		TimeInQueueMillis: 86,
+		TimeInQueue:       "86ms",
+	}})
+
+	assertEqual(t, server.requests(), []string{"GET /_cluster/pending_tasks null"})
+}
+
+func TestTasks(t *testing.T) {
+	conn := testConnection(t)
+	SkipUnlessSupported(t, conn, FEATURE_TASKS_API)
+
+	tasks, err := conn.ListTasks(url.Values{"actions": {"cluster:monitor/tasks/lists*"}, "detailed": {"true"}})
+	assertNoError(t, err)
+
+	// the task listing the tasks
+	if len(tasks) == 0 {
+		t.Fatalf("no task found")
+	}
+}
+
+func TestTasksRequests(t *testing.T) {
+	testRequests(t, "5.6.16", []requestCase{
+		{
+			name: "list",
+			response: `{"nodes":{"AbC":{"name":"node1","tasks":{
+				"AbC:42":{"node":"AbC","id":42,"type":"transport","action":"indices:data/write/reindex","description":"reindex from [a] to [b]",
+					"start_time_in_millis":1000,"running_time_in_nanos":5000,"cancellable":true,
+					"status":{"total":100,"created":40}},
+				"AbC:43":{"node":"AbC","id":43,"type":"transport","action":"indices:data/write/bulk","parent_task_id":"AbC:42"}
+			}}}}`,
+			call: func(t *testing.T, conn *Connection) error {
+				tasks, err := conn.ListTasks(url.Values{"actions": {"*reindex"}, "detailed": {"true"}})
+				assertEqual(t, tasks, map[string]Task{
+					"AbC:42": {
+						Node:               "AbC",
+						Id:                 42,
+						Type:               "transport",
+						Action:             "indices:data/write/reindex",
+						Description:        "reindex from [a] to [b]",
+						StartTimeInMillis:  1000,
+						RunningTimeInNanos: 5000,
+						Cancellable:        true,
+						Status:             map[string]interface{}{"total": float64(100), "created": float64(40)},
+					},
+					"AbC:43": {
+						Node:         "AbC",
+						Id:           43,
+						Type:         "transport",
+						Action:       "indices:data/write/bulk",
+						ParentTaskId: "AbC:42",
+					},
+				})
+				return err
+			},
+			requests: []string{"GET /_tasks?actions=%2Areindex&detailed=true null"},
+		},
+		{
+			name:     "cancel",
+			response: `{"nodes":{}}`,
+			call: func(t *testing.T, conn *Connection) error {
+				_, err := conn.CancelTask("AbC:42")
+				return err
+			},
+			requests: []string{"POST /_tasks/AbC:42/_cancel null"},
+		},
+		{
+			name: "list of elasticsearch 2.2",
+			call: func(t *testing.T, conn *Connection) error {
+				conn.Version = "2.2.0"
+				_, err := conn.ListTasks(nil)
+				return err
+			},
+			err: "tasks_api is not supported by elasticsearch 2.2.0",
+		},
+		{
+			name: "cancel of elasticsearch 2.2",
+			call: func(t *testing.T, conn *Connection) error {
+				_, err := conn.CancelTask("AbC:42")
+				return err
+			},
+			err: "tasks_api is not supported by elasticsearch 2.2.0",
+		},
+	})
+}
+
+func TestCat(t *testing.T) {
+	indexName := "testcat"
+
+	conn := testConnection(t)
+	conn.DeleteIndex(indexName)
+
+	_, err := conn.CreateIndex(indexName, map[string]interface{}{
+		"settings": map[string]interface{}{"number_of_shards": 2, "number_of_replicas": 0},
+	})
+	assertNoError(t, err)
+	defer conn.DeleteIndex(indexName)
+
+	indices, err := conn.CatIndices([]string{indexName})
+	assertNoError(t, err)
+	assertEqual(t, len(indices), 1)
+	assertEqual(t, indices[0].Index, indexName)
+	assertEqual(t, indices[0].Pri, 2)
+
+	shards, err := conn.CatShards([]string{indexName})
+	assertNoError(t, err)
+	assertEqual(t, len(shards), 2)
+
+	nodes, err := conn.CatNodes()
+	assertNoError(t, err)
+	if len(nodes) == 0 {
+		t.Fatalf("no node found")
+	}
+
+	_, err = conn.CatAllocation(nil)
+	assertNoError(t, err)
+}
+
+func TestCatRequests(t *testing.T) {
+	server, conn := newFakeServer(t, "5.6.16")
+
+	server.answer(200, `[{"health":"yellow","status":"open","index":"tweets","uuid":"u1","pri":"5","rep":"1","docs.count":"10","docs.deleted":"2","store.size":"3000","pri.store.size":"1500"}]`)
+	indices, err := conn.CatIndices(nil)
+	assertNoError(t, err)
+	assertEqual(t, indices, []CatIndex{{
+		Health:       "yellow",
+		Status:       "open",
+		Index:        "tweets",
+		Uuid:         "u1",
+		Pri:          5,
+		Rep:          1,
+		DocsCount:    10,
+		DocsDeleted:  2,
+		StoreSize:    3000,
+		PriStoreSize: 1500,
+	}})
+
+	server.answer(200, `[{"index":"tweets","shard":"0","prirep":"p","state":"STARTED","docs":"10","store":"1500","ip":"10.0.0.1","node":"node1"},
+		{"index":"tweets","shard":"0","prirep":"r","state":"UNASSIGNED","docs":null,"store":null,"ip":null,"node":null}]`)
+	shards, err := conn.CatShards([]string{"tweets"})
+	assertNoError(t, err)
+	assertEqual(t, shards, []CatShard{
+		{Index: "tweets", Shard: 0, Prirep: "p", State: "STARTED", Docs: 10, Store: 1500, Ip: "10.0.0.1", Node: "node1"},
+		{Index: "tweets", Shard: 0, Prirep: "r", State: "UNASSIGNED"},
+	})
+
+	server.answer(200, `[{"name":"node1","ip":"10.0.0.1","heap.percent":"45","ram.percent":"90","node.role":"mdi","master":"*"}]`)
+	nodes, err := conn.CatNodes()
+	assertNoError(t, err)
+	assertEqual(t, nodes, []CatNode{{Name: "node1", Ip: "10.0.0.1", HeapPercent: 45, RamPercent: 90, NodeRole: "mdi", Master: "*"}})
+
+	server.answer(200, `[{"shards":"5","disk.indices":"1500","disk.used":"4000","disk.avail":"6000","disk.total":"10000","disk.percent":"40","host":"10.0.0.1","ip":"10.0.0.1","node":"node1"},
+		{"shards":"5","disk.indices":null,"disk.used":null,"disk.avail":null,"disk.total":null,"disk.percent":null,"host":null,"ip":null,"node":"UNASSIGNED"}]`)
+	allocations, err := conn.CatAllocation([]string{"node1"})
+	assertNoError(t, err)
+	assertEqual(t, allocations, []CatAllocation{
+		{Shards: 5, DiskIndices: 1500, DiskUsed: 4000, DiskAvail: 6000, DiskTotal: 10000, DiskPercent: 40, Host: "10.0.0.1", Ip: "10.0.0.1", Node: "node1"},
+		{Shards: 5, Node: "UNASSIGNED"},
+	})
+
+	server.answer(200, `[{"node_name":"node1","name":"bulk","active":"2","queue":"10","rejected":"3"}]`)
+	pools, err := conn.CatThreadPool([]string{"bulk"})
+	assertNoError(t, err)
+	assertEqual(t, pools, []CatThreadPool{{NodeName: "node1", Name: "bulk", Active: 2, Queue: 10, Rejected: 3}})
+
+	assertEqual(t, server.requests(), []string{
+		"GET /_cat/indices?bytes=b&format=json null",
+		"GET /_cat/shards/tweets?bytes=b&format=json null",
+		"GET /_cat/nodes?bytes=b&format=json&h=name%2Cip%2Cheap.percent%2Cram.percent%2Cnode.role%2Cmaster null",
+		"GET /_cat/allocation/node1?bytes=b&format=json null",
+		"GET /_cat/thread_pool/bulk?bytes=b&format=json&h=node_name%2Cname%2Cactive%2Cqueue%2Crejected null",
+	})
+}
+
+func TestPipelines(t *testing.T) {
+	pipelineId := "testpipelines"
+	indexName := "testpipelines"
+
+	conn := testConnection(t)
+	SkipUnlessSupported(t, conn, FEATURE_INGEST)
+	conn.DeleteIndex(indexName)
+
+	_, err := conn.PutPipeline(pipelineId, map[string]interface{}{
+		"processors": []interface{}{
+			map[string]interface{}{"set": map[string]interface{}{"field": "source", "value": "goes"}},
+		},
+	})
+	assertNoError(t, err)
+	defer conn.DeletePipeline(pipelineId)
+
+	pipelines, err := conn.GetPipeline([]string{pipelineId})
+	assertNoError(t, err)
+	if _, ok := pipelines[pipelineId]; !ok {
+		t.Fatalf("pipeline %s not found in %v", pipelineId, pipelines)
+	}
+
+	results, err := conn.SimulatePipeline(pipelineId, nil, []Document{{Fields: map[string]interface{}{"user": "foo"}}})
+	assertNoError(t, err)
+	assertEqual(t, results[0].Source, map[string]interface{}{"user": "foo", "source": "goes"})
+
+	defer conn.DeleteIndex(indexName)
+	_, err = conn.Index(Document{
+		Index:    indexName,
+		Type:     "tweet",
+		Id:       "1",
+		Pipeline: pipelineId,
+		Fields:   map[string]interface{}{"user": "foo"},
+	}, nil)
+	assertNoError(t, err)
+
+	resp, err := conn.Get(indexName, "tweet", "1", nil)
+	assertNoError(t, err)
+	assertEqual(t, resp.Source["source"], "goes")
+
+	_, err = conn.DeletePipeline(pipelineId)
+	assertNoError(t, err)
+
+	pipelines, err = conn.GetPipeline([]string{pipelineId})
+	assertNoError(t, err)
+	assertEqual(t, pipelines, map[string]map[string]interface{}{})
+}
+
+func TestPipelinesRequests(t *testing.T) {
+	documents := []Document{
+		{Index: "tweets", Type: "tweet", Id: "1", Fields: map[string]interface{}{"user": "foo"}},
+		{Fields: map[string]interface{}{}},
+	}
+
+	testRequests(t, "5.6.16", []requestCase{
+		{
+			name:     "put",
+			response: `{"acknowledged":true}`,
+			call: func(t *testing.T, conn *Connection) error {
+				_, err := conn.PutPipeline("p1", map[string]interface{}{"description": "set source", "processors": []interface{}{}})
+				return err
+			},
+			requests: []string{`PUT /_ingest/pipeline/p1 {"description":"set source","processors":[]}`},
+		},
+		{
+			name:     "get",
+			response: `{"p1":{"description":"set source","processors":[]}}`,
+			call: func(t *testing.T, conn *Connection) error {
+				pipelines, err := conn.GetPipeline(nil)
+				assertEqual(t, pipelines, map[string]map[string]interface{}{
+					"p1": {"description": "set source", "processors": []interface{}{}},
+				})
+				return err
+			},
+			requests: []string{"GET /_ingest/pipeline null"},
+		},
+		{
+			name:     "get missing",
+			status:   404,
+			response: `{}`,
+			call: func(t *testing.T, conn *Connection) error {
+				pipelines, err := conn.GetPipeline([]string{"missing"})
+				assertEqual(t, pipelines, map[string]map[string]interface{}{})
+				return err
+			},
+			requests: []string{"GET /_ingest/pipeline/missing null"},
+		},
+		{
+			name: "simulate",
+			response: `{"docs":[
+				{"doc":{"_index":"tweets","_type":"tweet","_id":"1","_source":{"user":"foo","source":"goes"},"_ingest":{"timestamp":"2017-01-01T00:00:00Z"}}},
+				{"error":{"root_cause":[{"type":"illegal_argument_exception","reason":"field [user] not present"}],"type":"illegal_argument_exception","reason":"field [user] not present"}}
+			]}`,
+			call: func(t *testing.T, conn *Connection) error {
+				results, err := conn.SimulatePipeline("p1", nil, documents)
+				assertEqual(t, results, []PipelineResult{
+					{
+						Index:  "tweets",
+						Type:   "tweet",
+						Id:     "1",
+						Source: map[string]interface{}{"user": "foo", "source": "goes"},
+						Ingest: map[string]interface{}{"timestamp": "2017-01-01T00:00:00Z"},
+					},
+					{Error: &BulkError{Type: "illegal_argument_exception", Reason: "field [user] not present"}},
+				})
+				return err
+			},
+			requests: []string{`POST /_ingest/pipeline/p1/_simulate {"docs":[{"_id":"1","_index":"tweets","_source":{"user":"foo"},"_type":"tweet"},{"_source":{}}]}`},
+		},
+		{
+			name:     "simulate a pipeline",
+			response: `{"docs":[]}`,
+			call: func(t *testing.T, conn *Connection) error {
+				_, err := conn.SimulatePipeline("", map[string]interface{}{"processors": []interface{}{}}, documents[1:])
+				return err
+			},
+			requests: []string{`POST /_ingest/pipeline/_simulate {"docs":[{"_source":{}}],"pipeline":{"processors":[]}}`},
+		},
+		{
+			name:     "index",
+			response: `{}`,
+			call: func(t *testing.T, conn *Connection) error {
+				_, err := conn.Index(Document{Index: "tweets", Type: "tweet", Id: "1", Pipeline: "p1", Fields: map[string]interface{}{"user": "foo"}}, nil)
+				return err
+			},
+			requests: []string{`PUT /tweets/tweet/1/?pipeline=p1 {"user":"foo"}`},
+		},
+		{
+			name:     "bulk",
+			response: `{}`,
+			call: func(t *testing.T, conn *Connection) error {
+				_, err := conn.BulkSend("tweets", []Document{{Type: "tweet", Id: "1", BulkCommand: BULK_COMMAND_INDEX, Pipeline: "p1", Fields: map[string]interface{}{"user": "foo"}}})
+				return err
+			},
+			requests: []string{`POST /tweets/_bulk {"index":{"_id":"1","_index":null,"_type":"tweet","pipeline":"p1"}}` + "\n" + `{"user":"foo"}` + "\n"},
+		},
+		{
+			name:     "delete",
+			response: `{"acknowledged":true}`,
+			call: func(t *testing.T, conn *Connection) error {
+				_, err := conn.DeletePipeline("p1")
+				return err
+			},
+			requests: []string{"DELETE /_ingest/pipeline/p1 null"},
+		},
+		{
+			name: "put of elasticsearch 2.4",
+			call: func(t *testing.T, conn *Connection) error {
+				conn.Version = "2.4.6"
+				_, err := conn.PutPipeline("p1", nil)
+				return err
+			},
+			err: "ingest is not supported by elasticsearch 2.4.6",
+		},
+	})
 }
@@ -0,0 +1,94 @@
+// Copyright 2013 Belogik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goes
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Alphabet of the ULIDs, Crockford's base32
+const ulidAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// Start of the FlakeGenerator timestamps, in milliseconds (Twitter's epoch)
+const flakeEpoch = 1288834974657
+
+// assignId sets the id of d with the IdGenerator of the connection when d has
+// none
+func (c *Connection) assignId(d *Document) {
+	if d.Id == nil && c.IdGenerator != nil {
+		d.Id = c.IdGenerator.NewId()
+	}
+}
+
+// NewId returns a random UUID such as 0f8fad5b-d9cb-469f-a165-70867728950e
+func (g UUIDGenerator) NewId() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// NewId returns a ULID such as 01ARZ3NDEKTSV4RRFFQ69G5FAV
+func (g ULIDGenerator) NewId() string {
+	return newULID(time.Now())
+}
+
+// newULID builds a ULID from the milliseconds of t and 80 random bits
+func newULID(t time.Time) string {
+	b := make([]byte, 16)
+	rand.Read(b[6:])
+
+	ms := uint64(t.UnixNano() / int64(time.Millisecond))
+	binary.BigEndian.PutUint16(b[0:2], uint16(ms>>32))
+	binary.BigEndian.PutUint32(b[2:6], uint32(ms))
+
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+
+	// 26 characters of 5 bits encode the 128 bits, the last one first
+	id := make([]byte, 26)
+	for i := len(id) - 1; i >= 0; i-- {
+		id[i] = ulidAlphabet[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+
+	return string(id)
+}
+
+// NewId returns the next id of the node, ids increase over time
+func (g *FlakeGenerator) NewId() string {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	now := time.Now().UnixNano()/int64(time.Millisecond) - flakeEpoch
+	if now < g.last {
+		// the clock went backwards, keep on with the last timestamp
+		now = g.last
+	}
+
+	if now == g.last {
+		g.sequence = (g.sequence + 1) & 0xfff
+		if g.sequence == 0 {
+			// 4096 ids in this millisecond, wait for the next one
+			for now <= g.last {
+				time.Sleep(100 * time.Microsecond)
+				now = time.Now().UnixNano()/int64(time.Millisecond) - flakeEpoch
+			}
+		}
+	} else {
+		g.sequence = 0
+	}
+	g.last = now
+
+	return strconv.FormatInt(now<<22|(g.Node&0x3ff)<<12|g.sequence, 10)
+}
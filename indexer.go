@@ -0,0 +1,83 @@
+// Copyright 2013 Belogik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goes
+
+import (
+	"errors"
+)
+
+// NewIndexer starts an Indexer sending documents to index from Workers
+// goroutines, each one with its own bulk buffer. It has to be closed to send
+// the last documents.
+func (c *Connection) NewIndexer(index string, settings IndexerSettings) *Indexer {
+	return newIndexer(settings, func(bulk BulkProcessorSettings) *BulkProcessor {
+		return c.NewBulkProcessor(index, bulk)
+	})
+}
+
+// newIndexer starts an Indexer whose workers buffer the documents in the
+// processors started by newProcessor
+func newIndexer(settings IndexerSettings, newProcessor func(settings BulkProcessorSettings) *BulkProcessor) *Indexer {
+	if settings.Workers < 1 {
+		settings.Workers = 1
+	}
+
+	// each worker sends its own _bulk requests
+	bulk := settings.Bulk
+	bulk.Workers = 1
+
+	ix := &Indexer{
+		settings:  settings,
+		documents: make(chan Document, settings.QueueSize),
+	}
+
+	for i := 0; i < settings.Workers; i++ {
+		ix.working.Add(1)
+		go ix.work(newProcessor(bulk))
+	}
+
+	return ix
+}
+
+// Add queues a document for the workers, it blocks while the queue is full
+func (ix *Indexer) Add(d Document) error {
+	ix.lock.RLock()
+	defer ix.lock.RUnlock()
+
+	if ix.closed {
+		return errors.New("indexer is closed")
+	}
+
+	ix.documents <- d
+	return nil
+}
+
+// Close sends the queued and the buffered documents and stops the workers,
+// documents can not be added anymore
+func (ix *Indexer) Close() {
+	ix.lock.Lock()
+	if ix.closed {
+		ix.lock.Unlock()
+		return
+	}
+	ix.closed = true
+	close(ix.documents)
+	ix.lock.Unlock()
+
+	ix.working.Wait()
+}
+
+// work buffers the queued documents until the indexer is closed
+func (ix *Indexer) work(p *BulkProcessor) {
+	defer ix.working.Done()
+	defer p.Close()
+
+	for d := range ix.documents {
+		// only a document which can not be encoded is refused
+		if err := p.Add(d); err != nil && ix.settings.Bulk.AfterFlush != nil {
+			ix.settings.Bulk.AfterFlush([]Document{d}, Response{}, err)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright 2013 Belogik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goes
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// Represents the mapping of a type or of a field as returned by GetMapping
+type Mapping map[string]interface{}
+
+// PutMapping creates or updates the mapping of a type, mapping is the body of
+// the type ({"properties": ...}). Since elasticsearch 7.0 documentType has to
+// be empty.
+func (c *Connection) PutMapping(index string, documentType string, mapping interface{}) (Response, error) {
+	r := Request{
+		Conn:      c,
+		Query:     mapping,
+		IndexList: []string{index},
+		method:    "PUT",
+		api:       "_mapping",
+	}
+
+	if documentType != "" {
+		r.TypeList = []string{documentType}
+		r.Query = map[string]interface{}{documentType: mapping}
+	}
+
+	defer c.InvalidateMapping(index)
+
+	return r.Run()
+}
+
+// DeleteMapping deletes a type and its documents from an index, the
+// mapping of a type can not be deleted since elasticsearch 2.0
+func (c *Connection) DeleteMapping(index string, documentType string) (Response, error) {
+	if err := c.require(FEATURE_DELETE_MAPPING); err != nil {
+		return Response{}, err
+	}
+
+	r := Request{
+		Conn:      c,
+		IndexList: []string{index},
+		TypeList:  []string{documentType},
+		method:    "DELETE",
+		api:       "_mapping",
+	}
+
+	defer c.InvalidateMapping(index)
+
+	return r.Run()
+}
+
+// GetMapping fetches the mappings of the types of typeList (every type when
+// empty) in the indices of indexList, by index and type. Since elasticsearch
+// 7.0 the mapping of an index is under the "_doc" type.
+func (c *Connection) GetMapping(indexList []string, typeList []string) (map[string]map[string]Mapping, error) {
+	r := Request{
+		Conn:      c,
+		IndexList: indexList,
+		TypeList:  typeList,
+		method:    "GET",
+		api:       "_mapping",
+	}
+
+	raw, err := r.RunRaw()
+	if err != nil {
+		return nil, err
+	}
+
+	return mappingTypes(raw)
+}
+
+// GetFieldMapping fetches the mappings of fields, by their dotted path or a
+// wildcard expression, in the types of typeList (every type when empty) of
+// the indices of indexList, by index, type and dotted path. Since
+// elasticsearch 7.0 the fields are under the "_doc" type.
+func (c *Connection) GetFieldMapping(indexList []string, typeList []string, fields []string) (map[string]map[string]map[string]Mapping, error) {
+	api := "_mapping/"
+	if len(typeList) > 0 {
+		api += strings.Join(typeList, ",") + "/"
+	}
+
+	r := Request{
+		Conn:      c,
+		IndexList: indexList,
+		method:    "GET",
+		api:       api + "field/" + strings.Join(fields, ","),
+	}
+
+	raw, err := r.RunRaw()
+	if err != nil || raw == nil {
+		return nil, err
+	}
+
+	indices := map[string]struct {
+		Mappings map[string]json.RawMessage
+	}{}
+	if err := c.decode(raw, &indices); err != nil {
+		return nil, err
+	}
+
+	mappings := map[string]map[string]map[string]Mapping{}
+	for index, v := range indices {
+		types := map[string]map[string]fieldMapping{}
+		for key, value := range v.Mappings {
+			// since elasticsearch 7.0 there are no types anymore
+			f := fieldMapping{}
+			if err := json.Unmarshal(value, &f); err == nil && f.FullName != "" {
+				if types["_doc"] == nil {
+					types["_doc"] = map[string]fieldMapping{}
+				}
+				types["_doc"][key] = f
+				continue
+			}
+
+			typeFields := map[string]fieldMapping{}
+			if err := json.Unmarshal(value, &typeFields); err != nil {
+				return nil, err
+			}
+			types[key] = typeFields
+		}
+
+		mappings[index] = map[string]map[string]Mapping{}
+		for documentType, typeFields := range types {
+			mappings[index][documentType] = map[string]Mapping{}
+			for _, f := range typeFields {
+				// the mapping is keyed by the last part of the dotted path
+				for _, mapping := range f.Mapping {
+					mappings[index][documentType][f.FullName] = mapping
+				}
+			}
+		}
+	}
+
+	return mappings, nil
+}
+
+// Represents a field as returned by the field mapping API
+type fieldMapping struct {
+	FullName string `json:"full_name"`
+	Mapping  map[string]Mapping
+}
+
+// mappingTypes decodes the body of a _mapping response, whose layout depends
+// on the version of elasticsearch, by index and type
+func mappingTypes(raw []byte) (map[string]map[string]Mapping, error) {
+	indices := map[string]map[string]interface{}{}
+	if err := json.Unmarshal(raw, &indices); err != nil {
+		return nil, err
+	}
+
+	mappings := map[string]map[string]Mapping{}
+	for index, types := range indices {
+		// since elasticsearch 1.0 the types are under a "mappings" key
+		if m, ok := types["mappings"].(map[string]interface{}); ok {
+			types = m
+		}
+
+		// since elasticsearch 7.0 there are no types anymore
+		if _, ok := types["properties"].(map[string]interface{}); ok {
+			types = map[string]interface{}{"_doc": types}
+		}
+
+		mappings[index] = map[string]Mapping{}
+		for documentType, t := range types {
+			mapping, _ := t.(map[string]interface{})
+			mappings[index][documentType] = mapping
+		}
+	}
+
+	return mappings, nil
+}
+
+// Type returns the type of a field, object for the fields with properties
+// and no explicit type
+func (m Mapping) Type() string {
+	if t, ok := m["type"].(string); ok {
+		return t
+	}
+
+	return "object"
+}
+
+// Properties returns the fields of a type or of an object field by name
+func (m Mapping) Properties() map[string]Mapping {
+	return mappingMap(m["properties"])
+}
+
+// Fields returns the sub fields of a multi field by name
+func (m Mapping) Fields() map[string]Mapping {
+	return mappingMap(m["fields"])
+}
+
+// PropertyNames returns the sorted names of the fields of a type or of an
+// object field
+func (m Mapping) PropertyNames() []string {
+	properties := m.Properties()
+
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Property returns the mapping of a field by its dotted path (user.name,
+// message.raw ...), nil if there is no such field
+func (m Mapping) Property(path string) Mapping {
+	current := m
+
+	for _, name := range strings.Split(path, ".") {
+		next, ok := current.Properties()[name]
+		if !ok {
+			next, ok = current.Fields()[name]
+		}
+		if !ok {
+			return nil
+		}
+		current = next
+	}
+
+	return current
+}
+
+// mappingMap converts a decoded JSON object of mappings
+func mappingMap(raw interface{}) map[string]Mapping {
+	m, _ := raw.(map[string]interface{})
+
+	mappings := make(map[string]Mapping, len(m))
+	for name, value := range m {
+		if mapping, ok := value.(map[string]interface{}); ok {
+			mappings[name] = mapping
+		}
+	}
+
+	return mappings
+}
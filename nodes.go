@@ -0,0 +1,132 @@
+// Copyright 2013 Belogik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// NodesInfo fetches the information (settings, os, process, jvm, plugins ...)
+// of the nodes of nodeList, every node when empty, by node id. Only the
+// metrics are fetched when they are not empty.
+func (c *Connection) NodesInfo(nodeList []string, metrics []string) (map[string]Node, error) {
+	r := Request{
+		Conn:   c,
+		method: "GET",
+		api:    nodesApi(nodeList, "", metrics),
+	}
+
+	resp, err := r.Run()
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Nodes, nil
+}
+
+// NodesStats fetches the statistics (indices, os, process, jvm ...) of the
+// nodes of nodeList, every node when empty, by node id. Only the metrics are
+// fetched when they are not empty.
+func (c *Connection) NodesStats(nodeList []string, metrics []string) (map[string]NodeStats, error) {
+	r := Request{
+		Conn:   c,
+		method: "GET",
+		api:    nodesApi(nodeList, "stats", metrics),
+	}
+
+	raw, err := r.RunRaw()
+	if err != nil || raw == nil {
+		return nil, err
+	}
+
+	stats := struct {
+		Nodes       map[string]NodeStats
+		ClusterName string          `json:"cluster_name"`
+		Summary     json.RawMessage `json:"_nodes"`
+	}{}
+	err = c.decode(raw, &stats)
+
+	return stats.Nodes, err
+}
+
+// nodesApi returns the path of a _nodes API, a metric could be taken for a
+// node id without _all
+func nodesApi(nodeList []string, api string, metrics []string) string {
+	path := "_nodes"
+
+	if len(nodeList) > 0 {
+		path += "/" + strings.Join(nodeList, ",")
+	} else if api == "" && len(metrics) > 0 {
+		path += "/_all"
+	}
+
+	if api != "" {
+		path += "/" + api
+	}
+
+	if len(metrics) > 0 {
+		path += "/" + strings.Join(metrics, ",")
+	}
+
+	return path
+}
+
+// HotThreads fetches the busiest threads of the nodes of nodeList, every node
+// when empty, as the plain text reported by elasticsearch by node name. The
+// params (threads, interval, type ...) are sent as URL arguments.
+func (c *Connection) HotThreads(nodeList []string, params url.Values) (map[string]string, error) {
+	r := Request{
+		Conn:      c,
+		ExtraArgs: params,
+		method:    "GET",
+		api:       nodesApi(nodeList, "hot_threads", nil),
+	}
+
+	var text string
+	err := r.run(func(statusCode int, header http.Header, body []byte) error {
+		if statusCode >= 400 {
+			return newSearchError(statusCode, string(body))
+		}
+
+		text = string(body)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return splitHotThreads(text), nil
+}
+
+// splitHotThreads splits the output of the hot threads API by node. The
+// report of each node starts with a line like
+// ::: {name}{id}{address} (::: [name][id][address] before elasticsearch 2.0).
+func splitHotThreads(text string) map[string]string {
+	threads := map[string]string{}
+
+	name := ""
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if header := strings.TrimPrefix(line, "::: "); header != line && len(header) > 1 {
+			closing := "}"
+			if header[0] == '[' {
+				closing = "]"
+			}
+
+			name = header[1:]
+			if i := strings.Index(name, closing); i >= 0 {
+				name = name[:i]
+			}
+		}
+
+		if name != "" {
+			threads[name] += line
+		}
+	}
+
+	return threads
+}
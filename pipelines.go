@@ -0,0 +1,139 @@
+// Copyright 2013 Belogik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goes
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// PutPipeline creates or replaces the ingest pipeline called id, pipeline is
+// its definition ({"description": ..., "processors": [...]}). Documents go
+// through it when their Pipeline is set.
+func (c *Connection) PutPipeline(id string, pipeline interface{}) (Response, error) {
+	if err := c.require(FEATURE_INGEST); err != nil {
+		return Response{}, err
+	}
+
+	r := Request{
+		Conn:   c,
+		Query:  pipeline,
+		method: "PUT",
+		api:    "_ingest/pipeline/" + id,
+	}
+
+	return r.Run()
+}
+
+// GetPipeline fetches the definitions of the ingest pipelines of idList, all
+// of them when empty, by id. Missing pipelines are not returned.
+func (c *Connection) GetPipeline(idList []string) (map[string]map[string]interface{}, error) {
+	if err := c.require(FEATURE_INGEST); err != nil {
+		return nil, err
+	}
+
+	r := Request{
+		Conn:   c,
+		method: "GET",
+		api:    "_ingest/pipeline",
+	}
+
+	if len(idList) > 0 {
+		r.api += "/" + strings.Join(idList, ",")
+	}
+
+	raw, err := r.RunRaw()
+	if searchErr, ok := searchError(err); ok && searchErr.StatusCode == 404 {
+		raw, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pipelines := map[string]map[string]interface{}{}
+	if len(raw) > 0 {
+		err = json.Unmarshal(raw, &pipelines)
+	}
+
+	return pipelines, err
+}
+
+// DeletePipeline deletes the ingest pipeline called id
+func (c *Connection) DeletePipeline(id string) (Response, error) {
+	if err := c.require(FEATURE_INGEST); err != nil {
+		return Response{}, err
+	}
+
+	r := Request{
+		Conn:   c,
+		method: "DELETE",
+		api:    "_ingest/pipeline/" + id,
+	}
+
+	return r.Run()
+}
+
+// SimulatePipeline runs documents through the ingest pipeline called id, or
+// through the pipeline definition when id is empty, without indexing them.
+// The results are in the order of documents.
+func (c *Connection) SimulatePipeline(id string, pipeline interface{}, documents []Document) ([]PipelineResult, error) {
+	if err := c.require(FEATURE_INGEST); err != nil {
+		return nil, err
+	}
+
+	docs := make([]map[string]interface{}, 0, len(documents))
+	for _, doc := range documents {
+		d := map[string]interface{}{"_source": doc.Fields}
+		if doc.Index != nil {
+			d["_index"] = doc.Index
+		}
+		if doc.Type != "" {
+			d["_type"] = doc.Type
+		}
+		if doc.Id != nil {
+			d["_id"] = doc.Id
+		}
+		docs = append(docs, d)
+	}
+
+	query := map[string]interface{}{"docs": docs}
+
+	r := Request{
+		Conn:   c,
+		Query:  query,
+		method: "POST",
+		api:    "_ingest/pipeline/_simulate",
+	}
+
+	if id != "" {
+		r.api = "_ingest/pipeline/" + id + "/_simulate"
+	} else {
+		query["pipeline"] = pipeline
+	}
+
+	raw, err := r.RunRaw()
+	if err != nil || raw == nil {
+		return nil, err
+	}
+
+	simulation := struct {
+		Docs []struct {
+			Doc   PipelineResult
+			Error *BulkError
+		}
+	}{}
+	if err := c.decode(raw, &simulation); err != nil {
+		return nil, err
+	}
+
+	results := make([]PipelineResult, 0, len(simulation.Docs))
+	for _, d := range simulation.Docs {
+		result := d.Doc
+		result.Error = d.Error
+		results = append(results, result)
+	}
+
+	return results, nil
+}
@@ -0,0 +1,188 @@
+// Copyright 2013 Belogik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package presets provides analysis settings for common languages and use
+// cases. They are merged and given to goes.Connection.CreateIndex:
+//
+//	english, err := presets.Language("english")
+//	if err != nil {
+//		return err
+//	}
+//	analysis := presets.Merge(english, presets.Autocomplete(2, 15))
+//	conn.CreateIndex("tweets", analysis.Index(mappings))
+//
+// The analyzers are then referenced by name in the mappings.
+package presets
+
+import "fmt"
+
+// Languages with a stemmer and a list of stopwords in elasticsearch
+var Languages = []string{
+	"arabic", "armenian", "basque", "brazilian", "bulgarian", "catalan",
+	"czech", "danish", "dutch", "english", "finnish", "french", "galician",
+	"german", "greek", "hindi", "hungarian", "indonesian", "italian",
+	"latvian", "norwegian", "portuguese", "romanian", "russian", "spanish",
+	"swedish", "turkish",
+}
+
+// Languages whose articles are elided ("l'avion")
+var elisions = map[string][]string{
+	"catalan": {"d", "l", "m", "n", "s", "t"},
+	"french":  {"l", "m", "t", "qu", "n", "s", "j", "d", "c", "jusqu", "quoiqu", "lorsqu", "puisqu"},
+	"italian": {"c", "l", "all", "dall", "dell", "nell", "sull", "coll", "pell", "gl", "agl", "dagl", "degl", "negl", "sugl", "un", "m", "t", "s", "v", "d"},
+}
+
+// Represents the "analysis" section of the settings of an index, by kind
+// (analyzer, tokenizer, filter, char_filter) and name
+type Analysis map[string]map[string]interface{}
+
+// Merge combines several presets, the last one wins when two of them define
+// something with the same name
+func Merge(presets ...Analysis) Analysis {
+	merged := Analysis{}
+	for _, preset := range presets {
+		for kind, definitions := range preset {
+			if merged[kind] == nil {
+				merged[kind] = map[string]interface{}{}
+			}
+			for name, definition := range definitions {
+				merged[kind][name] = definition
+			}
+		}
+	}
+
+	return merged
+}
+
+// Index returns the body of a CreateIndex call with the analysis settings and
+// mappings, which may be nil
+func (a Analysis) Index(mappings interface{}) map[string]interface{} {
+	index := map[string]interface{}{
+		"settings": map[string]interface{}{
+			"analysis": a,
+		},
+	}
+
+	if mappings != nil {
+		index["mappings"] = mappings
+	}
+
+	return index
+}
+
+// Language returns an analyzer named after language which lowercases the
+// words, removes the stopwords and stems the remaining words. It fails if
+// language is not in Languages.
+func Language(language string) (Analysis, error) {
+	if !isLanguage(language) {
+		return nil, fmt.Errorf("presets: unknown language %s", language)
+	}
+
+	stop := language + "_stop"
+	stemmer := language + "_stemmer"
+
+	filters := []string{"lowercase", stop, stemmer}
+	analysis := Analysis{
+		"filter": {
+			stop: map[string]interface{}{
+				"type":      "stop",
+				"stopwords": "_" + language + "_",
+			},
+			stemmer: map[string]interface{}{
+				"type":     "stemmer",
+				"language": language,
+			},
+		},
+	}
+
+	if articles, ok := elisions[language]; ok {
+		elision := language + "_elision"
+		analysis["filter"][elision] = map[string]interface{}{
+			"type":     "elision",
+			"articles": articles,
+		}
+		filters = append([]string{elision}, filters...)
+	}
+
+	analysis["analyzer"] = map[string]interface{}{
+		language: map[string]interface{}{
+			"type":      "custom",
+			"tokenizer": "standard",
+			"filter":    filters,
+		},
+	}
+
+	return analysis, nil
+}
+
+// isLanguage checks if language is in Languages
+func isLanguage(language string) bool {
+	for _, l := range Languages {
+		if l == language {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Email returns an analyzer named "email" which keeps email addresses and
+// URLs as single lowercased tokens
+func Email() Analysis {
+	return Analysis{
+		"analyzer": {
+			"email": map[string]interface{}{
+				"type":      "custom",
+				"tokenizer": "uax_url_email",
+				"filter":    []string{"lowercase"},
+			},
+		},
+	}
+}
+
+// PathHierarchy returns an analyzer named "path" which indexes a path with
+// all its parents, /a/b/c gives /a, /a/b and /a/b/c
+func PathHierarchy(delimiter string) Analysis {
+	return Analysis{
+		"tokenizer": {
+			"path": map[string]interface{}{
+				"type":      "path_hierarchy",
+				"delimiter": delimiter,
+			},
+		},
+		"analyzer": {
+			"path": map[string]interface{}{
+				"type":      "custom",
+				"tokenizer": "path",
+			},
+		},
+	}
+}
+
+// Autocomplete returns an analyzer named "autocomplete" which indexes the
+// prefixes of the words, from minGram to maxGram characters, and an analyzer
+// named "autocomplete_search" to use as the search_analyzer of the field
+func Autocomplete(minGram int, maxGram int) Analysis {
+	return Analysis{
+		"filter": {
+			"autocomplete_edge_ngram": map[string]interface{}{
+				"type":     "edge_ngram",
+				"min_gram": minGram,
+				"max_gram": maxGram,
+			},
+		},
+		"analyzer": {
+			"autocomplete": map[string]interface{}{
+				"type":      "custom",
+				"tokenizer": "standard",
+				"filter":    []string{"lowercase", "autocomplete_edge_ngram"},
+			},
+			"autocomplete_search": map[string]interface{}{
+				"type":      "custom",
+				"tokenizer": "standard",
+				"filter":    []string{"lowercase"},
+			},
+		},
+	}
+}
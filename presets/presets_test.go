@@ -0,0 +1,86 @@
+// Copyright 2013 Belogik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package presets
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func assertEqual(t *testing.T, obtained interface{}, expected interface{}) {
+	t.Helper()
+	if !reflect.DeepEqual(obtained, expected) {
+		t.Errorf("obtained %#v, expected %#v", obtained, expected)
+	}
+}
+
+func TestLanguage(t *testing.T) {
+	analysis, err := Language("english")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, analysis["analyzer"]["english"], map[string]interface{}{
+		"type":      "custom",
+		"tokenizer": "standard",
+		"filter":    []string{"lowercase", "english_stop", "english_stemmer"},
+	})
+	assertEqual(t, analysis["filter"]["english_stop"], map[string]interface{}{
+		"type":      "stop",
+		"stopwords": "_english_",
+	})
+
+	analysis, err = Language("french")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, analysis["analyzer"]["french"].(map[string]interface{})["filter"], []string{"french_elision", "lowercase", "french_stop", "french_stemmer"})
+
+	analysis, err = Language("klingon")
+	assertEqual(t, analysis, Analysis(nil))
+	assertEqual(t, err.Error(), "presets: unknown language klingon")
+}
+
+func TestMerge(t *testing.T) {
+	german, err := Language("german")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	analysis := Merge(german, Email(), PathHierarchy("/"), Autocomplete(2, 15))
+
+	names := map[string][]string{}
+	for kind, definitions := range analysis {
+		for name := range definitions {
+			names[kind] = append(names[kind], name)
+		}
+	}
+
+	assertEqual(t, len(names["analyzer"]), 5)
+	assertEqual(t, len(names["filter"]), 3)
+	assertEqual(t, len(names["tokenizer"]), 1)
+
+	body, err := json.Marshal(Email().Index(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, string(body), `{"settings":{"analysis":{"analyzer":{"email":{"filter":["lowercase"],"tokenizer":"uax_url_email","type":"custom"}}}}}`)
+
+	mappings := map[string]interface{}{"tweet": map[string]interface{}{}}
+	assertEqual(t, Email().Index(mappings)["mappings"], mappings)
+}
+
+func TestSearchBox(t *testing.T) {
+	query := SearchBox("elasticsaerch clie", map[string]float64{"title": 3, "body": 1, "tags": 0.5})
+
+	body, err := json.Marshal(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqual(t, string(body), `{"bool":{"minimum_should_match":1,"should":[`+
+		`{"multi_match":{"fields":["body","tags^0.5","title^3"],"fuzziness":"AUTO","minimum_should_match":"2\u003c75%","prefix_length":1,"query":"elasticsaerch clie"}},`+
+		`{"multi_match":{"fields":["body","tags^0.5","title^3"],"query":"elasticsaerch clie","type":"phrase_prefix"}}]}}`)
+}
@@ -0,0 +1,54 @@
+// Copyright 2013 Belogik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package presets
+
+import (
+	"sort"
+	"strconv"
+)
+
+// SearchBox returns a query for text typed by users in a search box, to use
+// as the "query" of a search:
+//
+//	query := presets.SearchBox("elasticsaerch clie", map[string]float64{"title": 3, "body": 1})
+//	conn.Search(map[string]interface{}{"query": query}, indexList, typeList)
+//
+// It matches the words with typos (fuzziness AUTO, the first letter has to be
+// right), requires most of the words to match and also matches the last word
+// as a prefix while it is typed. fields gives the boost of each field.
+func SearchBox(text string, fields map[string]float64) map[string]interface{} {
+	boosted := make([]string, 0, len(fields))
+	for field, boost := range fields {
+		if boost != 0 && boost != 1 {
+			field += "^" + strconv.FormatFloat(boost, 'f', -1, 64)
+		}
+		boosted = append(boosted, field)
+	}
+	sort.Strings(boosted)
+
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"should": []interface{}{
+				map[string]interface{}{
+					"multi_match": map[string]interface{}{
+						"query":                text,
+						"fields":               boosted,
+						"fuzziness":            "AUTO",
+						"prefix_length":        1,
+						"minimum_should_match": "2<75%",
+					},
+				},
+				map[string]interface{}{
+					"multi_match": map[string]interface{}{
+						"query":  text,
+						"fields": boosted,
+						"type":   "phrase_prefix",
+					},
+				},
+			},
+			"minimum_should_match": 1,
+		},
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright 2013 Belogik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goes
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// NewBulkProcessor starts a BulkProcessor sending documents to index with
+// BulkSend, it has to be closed to send the last documents
+func (c *Connection) NewBulkProcessor(index string, settings BulkProcessorSettings) *BulkProcessor {
+	return newBulkProcessor(settings, func(documents []Document) (Response, error) {
+		return c.BulkSend(index, documents)
+	})
+}
+
+// newBulkProcessor starts a BulkProcessor sending its batches with bulkSend
+func newBulkProcessor(settings BulkProcessorSettings, bulkSend func(documents []Document) (Response, error)) *BulkProcessor {
+	if settings.Workers < 1 {
+		settings.Workers = 1
+	}
+
+	p := &BulkProcessor{
+		bulkSend: bulkSend,
+		settings: settings,
+		batches:  make(chan []Document),
+		stop:     make(chan struct{}),
+	}
+	p.flushed = sync.NewCond(&p.lock)
+
+	for i := 0; i < settings.Workers; i++ {
+		p.working.Add(1)
+		go p.work()
+	}
+
+	if settings.FlushInterval > 0 {
+		p.ticking.Add(1)
+		go p.tick()
+	}
+
+	return p
+}
+
+// Add buffers a document, the documents are sent when MaxDocuments or
+// MaxBytes is reached, a document bigger than MaxBytes is sent alone. Add
+// blocks while every worker is busy.
+func (p *BulkProcessor) Add(d Document) error {
+	size := 0
+	if p.settings.MaxBytes > 0 {
+		counter := &byteCounter{}
+		// the longest metadata names, the size is an upper bound
+		if err := writeBulk(counter, []Document{d}, "_"); err != nil {
+			return err
+		}
+		size = counter.n
+	}
+
+	p.lock.Lock()
+	if p.closed {
+		p.lock.Unlock()
+		return errors.New("bulk processor is closed")
+	}
+
+	batches := [][]Document{}
+
+	// the buffer is sent first when d would not fit in
+	if p.settings.MaxBytes > 0 && len(p.documents) > 0 && p.size+size > p.settings.MaxBytes {
+		batches = append(batches, p.take())
+	}
+
+	p.documents = append(p.documents, d)
+	p.size += size
+
+	if (p.settings.MaxDocuments > 0 && len(p.documents) >= p.settings.MaxDocuments) ||
+		(p.settings.MaxBytes > 0 && p.size >= p.settings.MaxBytes) {
+		batches = append(batches, p.take())
+	}
+	p.lock.Unlock()
+
+	for _, batch := range batches {
+		p.send(batch)
+	}
+
+	return nil
+}
+
+// Flush sends the buffered documents and waits until every _bulk request
+// sent so far is done
+func (p *BulkProcessor) Flush() {
+	p.lock.Lock()
+	batch := p.take()
+	p.lock.Unlock()
+
+	p.send(batch)
+
+	p.lock.Lock()
+	for p.inFlight > 0 {
+		p.flushed.Wait()
+	}
+	p.lock.Unlock()
+}
+
+// Close sends the buffered documents and stops the workers, documents can not
+// be added anymore
+func (p *BulkProcessor) Close() {
+	p.lock.Lock()
+	if p.closed {
+		p.lock.Unlock()
+		return
+	}
+	p.closed = true
+	p.lock.Unlock()
+
+	close(p.stop)
+	p.ticking.Wait()
+
+	p.Flush()
+
+	close(p.batches)
+	p.working.Wait()
+}
+
+// take empties the buffer and returns its documents, p.lock has to be held
+func (p *BulkProcessor) take() []Document {
+	batch := p.documents
+	p.documents = nil
+	p.size = 0
+
+	if len(batch) > 0 {
+		p.inFlight++
+	}
+
+	return batch
+}
+
+// send hands a batch over to the workers
+func (p *BulkProcessor) send(batch []Document) {
+	if len(batch) > 0 {
+		p.batches <- batch
+	}
+}
+
+// work sends the batches until the processor is closed
+func (p *BulkProcessor) work() {
+	defer p.working.Done()
+
+	for batch := range p.batches {
+		if p.settings.BeforeFlush != nil {
+			p.settings.BeforeFlush(batch)
+		}
+
+		response, err := p.bulkSend(batch)
+		if p.settings.AfterFlush != nil {
+			p.settings.AfterFlush(batch, response, err)
+		}
+
+		p.lock.Lock()
+		p.inFlight--
+		p.flushed.Broadcast()
+		p.lock.Unlock()
+	}
+}
+
+// tick flushes the buffer every FlushInterval
+func (p *BulkProcessor) tick() {
+	defer p.ticking.Done()
+
+	ticker := time.NewTicker(p.settings.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.lock.Lock()
+			batch := p.take()
+			p.lock.Unlock()
+
+			p.send(batch)
+		}
+	}
+}
+
+// byteCounter is an io.Writer counting the bytes written to it
+type byteCounter struct {
+	n int
+}
+
+func (c *byteCounter) Write(b []byte) (int, error) {
+	c.n += len(b)
+	return len(b), nil
+}
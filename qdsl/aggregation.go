@@ -0,0 +1,261 @@
+// Copyright 2013 Belogik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package qdsl
+
+import "encoding/json"
+
+// Aggregation is implemented by every aggregation of the package, the results
+// are read from goes.Response.Aggregations by the same names
+type Aggregation interface {
+	// Source returns the aggregation as sent to elasticsearch
+	Source() map[string]interface{}
+}
+
+// Represents a terms aggregation, a bucket for each of the Size (10 when 0)
+// most frequent terms of Field. Order is like {"_count": "desc"} or
+// {"_term": "asc"}.
+type TermsAgg struct {
+	Field       string
+	Size        int
+	MinDocCount int
+	Order       map[string]string
+	Missing     interface{}
+
+	// Sub aggregations computed in each bucket, by name
+	Aggs map[string]Aggregation
+}
+
+// Represents a date_histogram aggregation, a bucket for each Interval (1d,
+// month ...) of Field. Since 7.2 Interval is deprecated for CalendarInterval
+// (1d, month ...) or FixedInterval (90m, 30d ...).
+type DateHistogramAgg struct {
+	Field            string
+	Interval         string
+	CalendarInterval string
+	FixedInterval    string
+	Format           string
+	TimeZone         string
+	MinDocCount      int
+
+	// Sub aggregations computed in each bucket, by name
+	Aggs map[string]Aggregation
+}
+
+// Represents a histogram aggregation, a bucket for each Interval of the
+// numeric Field
+type HistogramAgg struct {
+	Field       string
+	Interval    float64
+	MinDocCount int
+
+	// Sub aggregations computed in each bucket, by name
+	Aggs map[string]Aggregation
+}
+
+// Represents a range aggregation, a bucket for each of the Ranges of Field
+type RangeAgg struct {
+	Field  string
+	Ranges []AggRange
+
+	// Sub aggregations computed in each bucket, by name
+	Aggs map[string]Aggregation
+}
+
+// Represents a range of a RangeAgg, From is inclusive and To exclusive. An
+// unset bound is unbounded.
+type AggRange struct {
+	Key  string
+	From interface{}
+	To   interface{}
+}
+
+// Represents a filter aggregation, a single bucket with the documents
+// matching Filter, every document when nil
+type FilterAgg struct {
+	Filter Query
+
+	// Sub aggregations computed in the bucket, by name
+	Aggs map[string]Aggregation
+}
+
+// Represents a single value metric aggregation (avg, sum, min, max,
+// cardinality, value_count) or a multi value one (stats, extended_stats)
+// computed on Field, or on Script. Documents without a value are ignored
+// unless Missing is set.
+type MetricAgg struct {
+	Type    string
+	Field   string
+	Script  interface{}
+	Missing interface{}
+}
+
+// Represents a percentiles aggregation, the default Percents are 1, 5, 25,
+// 50, 75, 95 and 99
+type PercentilesAgg struct {
+	Field    string
+	Percents []float64
+}
+
+// Represents a top_hits aggregation, the Size (3 when 0) best hits of each
+// bucket
+type TopHitsAgg struct {
+	Size int
+
+	// The _source of the hits, like false or a list of fields
+	SourceFilter interface{}
+}
+
+// AvgAgg returns an avg aggregation of field
+func AvgAgg(field string) MetricAgg { return MetricAgg{Type: "avg", Field: field} }
+
+// SumAgg returns a sum aggregation of field
+func SumAgg(field string) MetricAgg { return MetricAgg{Type: "sum", Field: field} }
+
+// MinAgg returns a min aggregation of field
+func MinAgg(field string) MetricAgg { return MetricAgg{Type: "min", Field: field} }
+
+// MaxAgg returns a max aggregation of field
+func MaxAgg(field string) MetricAgg { return MetricAgg{Type: "max", Field: field} }
+
+// StatsAgg returns a stats aggregation (count, min, max, avg, sum) of field
+func StatsAgg(field string) MetricAgg { return MetricAgg{Type: "stats", Field: field} }
+
+// CardinalityAgg returns a cardinality aggregation, the approximate number of
+// distinct values of field
+func CardinalityAgg(field string) MetricAgg { return MetricAgg{Type: "cardinality", Field: field} }
+
+// ValueCountAgg returns a value_count aggregation of field
+func ValueCountAgg(field string) MetricAgg { return MetricAgg{Type: "value_count", Field: field} }
+
+// Source returns the terms aggregation
+func (a TermsAgg) Source() map[string]interface{} {
+	params := map[string]interface{}{"field": a.Field}
+	setInt(params, "size", a.Size)
+	setInt(params, "min_doc_count", a.MinDocCount)
+	if len(a.Order) > 0 {
+		params["order"] = a.Order
+	}
+	if a.Missing != nil {
+		params["missing"] = a.Missing
+	}
+
+	return aggSource("terms", params, a.Aggs)
+}
+
+// Source returns the date_histogram aggregation
+func (a DateHistogramAgg) Source() map[string]interface{} {
+	params := map[string]interface{}{"field": a.Field}
+	setString(params, "interval", a.Interval)
+	setString(params, "calendar_interval", a.CalendarInterval)
+	setString(params, "fixed_interval", a.FixedInterval)
+	setString(params, "format", a.Format)
+	setString(params, "time_zone", a.TimeZone)
+	setInt(params, "min_doc_count", a.MinDocCount)
+
+	return aggSource("date_histogram", params, a.Aggs)
+}
+
+// Source returns the histogram aggregation
+func (a HistogramAgg) Source() map[string]interface{} {
+	params := map[string]interface{}{"field": a.Field}
+	setFloat(params, "interval", a.Interval)
+	setInt(params, "min_doc_count", a.MinDocCount)
+
+	return aggSource("histogram", params, a.Aggs)
+}
+
+// Source returns the range aggregation
+func (a RangeAgg) Source() map[string]interface{} {
+	ranges := make([]interface{}, 0, len(a.Ranges))
+	for _, r := range a.Ranges {
+		bounds := map[string]interface{}{}
+		setString(bounds, "key", r.Key)
+		if r.From != nil {
+			bounds["from"] = r.From
+		}
+		if r.To != nil {
+			bounds["to"] = r.To
+		}
+		ranges = append(ranges, bounds)
+	}
+
+	params := map[string]interface{}{"field": a.Field, "ranges": ranges}
+
+	return aggSource("range", params, a.Aggs)
+}
+
+// Source returns the filter aggregation
+func (a FilterAgg) Source() map[string]interface{} {
+	filter := a.Filter
+	if filter == nil {
+		filter = MatchAllQuery{}
+	}
+
+	return aggSource("filter", filter.Source(), a.Aggs)
+}
+
+// Source returns the metric aggregation
+func (a MetricAgg) Source() map[string]interface{} {
+	params := map[string]interface{}{}
+	setString(params, "field", a.Field)
+	if a.Script != nil {
+		params["script"] = a.Script
+	}
+	if a.Missing != nil {
+		params["missing"] = a.Missing
+	}
+
+	return aggSource(a.Type, params, nil)
+}
+
+// Source returns the percentiles aggregation
+func (a PercentilesAgg) Source() map[string]interface{} {
+	params := map[string]interface{}{"field": a.Field}
+	if len(a.Percents) > 0 {
+		params["percents"] = a.Percents
+	}
+
+	return aggSource("percentiles", params, nil)
+}
+
+// Source returns the top_hits aggregation
+func (a TopHitsAgg) Source() map[string]interface{} {
+	params := map[string]interface{}{}
+	setInt(params, "size", a.Size)
+	if a.SourceFilter != nil {
+		params["_source"] = a.SourceFilter
+	}
+
+	return aggSource("top_hits", params, nil)
+}
+
+func (a TermsAgg) MarshalJSON() ([]byte, error)         { return json.Marshal(a.Source()) }
+func (a DateHistogramAgg) MarshalJSON() ([]byte, error) { return json.Marshal(a.Source()) }
+func (a HistogramAgg) MarshalJSON() ([]byte, error)     { return json.Marshal(a.Source()) }
+func (a RangeAgg) MarshalJSON() ([]byte, error)         { return json.Marshal(a.Source()) }
+func (a FilterAgg) MarshalJSON() ([]byte, error)        { return json.Marshal(a.Source()) }
+func (a MetricAgg) MarshalJSON() ([]byte, error)        { return json.Marshal(a.Source()) }
+func (a PercentilesAgg) MarshalJSON() ([]byte, error)   { return json.Marshal(a.Source()) }
+func (a TopHitsAgg) MarshalJSON() ([]byte, error)       { return json.Marshal(a.Source()) }
+
+// aggSource returns an aggregation of type kind with its sub aggregations
+func aggSource(kind string, params map[string]interface{}, aggs map[string]Aggregation) map[string]interface{} {
+	agg := map[string]interface{}{kind: params}
+	if len(aggs) > 0 {
+		agg["aggs"] = aggSources(aggs)
+	}
+
+	return agg
+}
+
+// aggSources returns the sources of aggregations by name
+func aggSources(aggs map[string]Aggregation) map[string]interface{} {
+	sources := make(map[string]interface{}, len(aggs))
+	for name, agg := range aggs {
+		sources[name] = agg.Source()
+	}
+
+	return sources
+}
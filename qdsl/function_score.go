@@ -0,0 +1,185 @@
+// Copyright 2013 Belogik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package qdsl
+
+import "encoding/json"
+
+// ScoreFunction is implemented by the functions of a FunctionScoreQuery
+type ScoreFunction interface {
+	// Source returns the function as sent to elasticsearch
+	Source() map[string]interface{}
+}
+
+// Represents a function_score query, modifying the score of the documents
+// matching Query (every document when nil) with Functions. ScoreMode
+// (multiply, sum, avg, first, max, min) combines the functions and BoostMode
+// (multiply, replace, sum, avg, max, min) combines the result with the score
+// of the query.
+type FunctionScoreQuery struct {
+	Query     Query
+	Functions []ScoreFunction
+	ScoreMode string
+	BoostMode string
+	MaxBoost  float64
+	Boost     float64
+
+	// Excludes the documents with a lower score
+	MinScore float64
+}
+
+// Represents a function multiplying the score by Weight. Like for every
+// function, only the documents matching Filter are scored when it is set.
+type WeightFunction struct {
+	Filter Query
+	Weight float64
+}
+
+// Represents a field_value_factor function, computing the score from the
+// numeric Field as Modifier(Factor * value). Modifier is none, log, log1p,
+// log2p, ln, ln1p, ln2p, square, sqrt or reciprocal.
+type FieldValueFactorFunction struct {
+	Filter   Query
+	Weight   float64
+	Field    string
+	Factor   float64
+	Modifier string
+
+	// Value of the documents without Field, they fail to be scored otherwise
+	Missing interface{}
+}
+
+// Represents a decay function, scoring the documents by the distance of Field
+// to Origin. Type is gauss, linear or exp, the score is Decay (0.5 when 0) at
+// Offset + Scale from Origin. Scale and Offset are like 10km for a geo_point,
+// 2d for a date and numbers for a numeric field.
+type DecayFunction struct {
+	Filter Query
+	Weight float64
+	Type   string
+	Field  string
+	Origin interface{}
+	Scale  interface{}
+	Offset interface{}
+	Decay  float64
+
+	// Distance used for multi valued fields, min, max, avg or sum
+	MultiValueMode string
+}
+
+// Represents a script_score function, computing the score with Script
+type ScriptScoreFunction struct {
+	Filter Query
+	Weight float64
+	Script interface{}
+}
+
+// Represents a random_score function, the score is the same for the same
+// Seed when it is set
+type RandomScoreFunction struct {
+	Filter Query
+	Weight float64
+	Seed   interface{}
+}
+
+// Source returns the function_score query
+func (q FunctionScoreQuery) Source() map[string]interface{} {
+	params := map[string]interface{}{}
+	if q.Query != nil {
+		params["query"] = q.Query.Source()
+	}
+	if len(q.Functions) > 0 {
+		functions := make([]interface{}, 0, len(q.Functions))
+		for _, f := range q.Functions {
+			functions = append(functions, f.Source())
+		}
+		params["functions"] = functions
+	}
+	setString(params, "score_mode", q.ScoreMode)
+	setString(params, "boost_mode", q.BoostMode)
+	setFloat(params, "max_boost", q.MaxBoost)
+	setFloat(params, "min_score", q.MinScore)
+	setBoost(params, q.Boost)
+
+	return map[string]interface{}{"function_score": params}
+}
+
+// Source returns the weight function
+func (f WeightFunction) Source() map[string]interface{} {
+	return functionSource(map[string]interface{}{}, f.Filter, f.Weight)
+}
+
+// Source returns the field_value_factor function
+func (f FieldValueFactorFunction) Source() map[string]interface{} {
+	params := map[string]interface{}{"field": f.Field}
+	setFloat(params, "factor", f.Factor)
+	setString(params, "modifier", f.Modifier)
+	if f.Missing != nil {
+		params["missing"] = f.Missing
+	}
+
+	function := map[string]interface{}{"field_value_factor": params}
+
+	return functionSource(function, f.Filter, f.Weight)
+}
+
+// Source returns the decay function
+func (f DecayFunction) Source() map[string]interface{} {
+	params := map[string]interface{}{}
+	if f.Origin != nil {
+		params["origin"] = f.Origin
+	}
+	if f.Scale != nil {
+		params["scale"] = f.Scale
+	}
+	if f.Offset != nil {
+		params["offset"] = f.Offset
+	}
+	setFloat(params, "decay", f.Decay)
+
+	decay := map[string]interface{}{f.Field: params}
+	setString(decay, "multi_value_mode", f.MultiValueMode)
+
+	function := map[string]interface{}{f.Type: decay}
+
+	return functionSource(function, f.Filter, f.Weight)
+}
+
+// Source returns the script_score function
+func (f ScriptScoreFunction) Source() map[string]interface{} {
+	function := map[string]interface{}{
+		"script_score": map[string]interface{}{"script": f.Script},
+	}
+
+	return functionSource(function, f.Filter, f.Weight)
+}
+
+// Source returns the random_score function
+func (f RandomScoreFunction) Source() map[string]interface{} {
+	params := map[string]interface{}{}
+	if f.Seed != nil {
+		params["seed"] = f.Seed
+	}
+
+	function := map[string]interface{}{"random_score": params}
+
+	return functionSource(function, f.Filter, f.Weight)
+}
+
+func (q FunctionScoreQuery) MarshalJSON() ([]byte, error)       { return json.Marshal(q.Source()) }
+func (f WeightFunction) MarshalJSON() ([]byte, error)           { return json.Marshal(f.Source()) }
+func (f FieldValueFactorFunction) MarshalJSON() ([]byte, error) { return json.Marshal(f.Source()) }
+func (f DecayFunction) MarshalJSON() ([]byte, error)            { return json.Marshal(f.Source()) }
+func (f ScriptScoreFunction) MarshalJSON() ([]byte, error)      { return json.Marshal(f.Source()) }
+func (f RandomScoreFunction) MarshalJSON() ([]byte, error)      { return json.Marshal(f.Source()) }
+
+// functionSource sets the filter and the weight common to every function
+func functionSource(function map[string]interface{}, filter Query, weight float64) map[string]interface{} {
+	if filter != nil {
+		function["filter"] = filter.Source()
+	}
+	setFloat(function, "weight", weight)
+
+	return function
+}
@@ -0,0 +1,120 @@
+// Copyright 2013 Belogik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package qdsl
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Represents a geo_point, it is sent as {"lat": ..., "lon": ...} and can be
+// read from the object, "lat,lon" and [lon, lat] formats
+type GeoPoint struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// Represents a geo_distance query, matching the documents with a point of
+// Field within Distance (like 12km) of Point. DistanceType is arc or plane.
+type GeoDistanceQuery struct {
+	Field        string
+	Point        GeoPoint
+	Distance     string
+	DistanceType string
+}
+
+// Represents a geo_bounding_box query, matching the documents with a point of
+// Field in the box
+type GeoBoundingBoxQuery struct {
+	Field       string
+	TopLeft     GeoPoint
+	BottomRight GeoPoint
+}
+
+// Represents a geo_polygon query, matching the documents with a point of
+// Field in the polygon of Points
+type GeoPolygonQuery struct {
+	Field  string
+	Points []GeoPoint
+}
+
+// String returns the point in the "lat,lon" format
+func (p GeoPoint) String() string {
+	return strconv.FormatFloat(p.Lat, 'f', -1, 64) + "," + strconv.FormatFloat(p.Lon, 'f', -1, 64)
+}
+
+// UnmarshalJSON reads the point from an object, a "lat,lon" string or a
+// [lon, lat] array
+func (p *GeoPoint) UnmarshalJSON(data []byte) error {
+	var object struct {
+		Lat float64 `json:"lat"`
+		Lon float64 `json:"lon"`
+	}
+	var coordinates []float64
+	var latLon string
+
+	if err := json.Unmarshal(data, &object); err == nil {
+		p.Lat, p.Lon = object.Lat, object.Lon
+		return nil
+	}
+
+	if err := json.Unmarshal(data, &coordinates); err == nil {
+		if len(coordinates) != 2 {
+			return fmt.Errorf("invalid geo_point %s", data)
+		}
+		p.Lon, p.Lat = coordinates[0], coordinates[1]
+		return nil
+	}
+
+	if err := json.Unmarshal(data, &latLon); err != nil {
+		return fmt.Errorf("invalid geo_point %s", data)
+	}
+
+	parts := strings.Split(latLon, ",")
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid geo_point %s", data)
+	}
+
+	lat, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return fmt.Errorf("invalid geo_point %s", data)
+	}
+
+	lon, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil {
+		return fmt.Errorf("invalid geo_point %s", data)
+	}
+
+	p.Lat, p.Lon = lat, lon
+	return nil
+}
+
+// Source returns the geo_distance query
+func (q GeoDistanceQuery) Source() map[string]interface{} {
+	params := map[string]interface{}{"distance": q.Distance, q.Field: q.Point}
+	setString(params, "distance_type", q.DistanceType)
+
+	return map[string]interface{}{"geo_distance": params}
+}
+
+// Source returns the geo_bounding_box query
+func (q GeoBoundingBoxQuery) Source() map[string]interface{} {
+	box := map[string]interface{}{"top_left": q.TopLeft, "bottom_right": q.BottomRight}
+
+	return map[string]interface{}{"geo_bounding_box": map[string]interface{}{q.Field: box}}
+}
+
+// Source returns the geo_polygon query
+func (q GeoPolygonQuery) Source() map[string]interface{} {
+	polygon := map[string]interface{}{"points": q.Points}
+
+	return map[string]interface{}{"geo_polygon": map[string]interface{}{q.Field: polygon}}
+}
+
+func (q GeoDistanceQuery) MarshalJSON() ([]byte, error)    { return json.Marshal(q.Source()) }
+func (q GeoBoundingBoxQuery) MarshalJSON() ([]byte, error) { return json.Marshal(q.Source()) }
+func (q GeoPolygonQuery) MarshalJSON() ([]byte, error)     { return json.Marshal(q.Source()) }
@@ -0,0 +1,84 @@
+// Copyright 2013 Belogik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package qdsl
+
+import "encoding/json"
+
+// Number of fragments of a highlighted field returned whole
+const NO_FRAGMENTS = -1
+
+// Represents the highlighting of a Search, the fragments are in
+// goes.Hit.Highlight. The options apply to every field unless the field sets
+// its own. Type is unified, plain or fvh.
+type Highlight struct {
+	Fields map[string]HighlightField
+
+	// Size of the fragments in characters (100 when 0) and maximum number of
+	// fragments (5 when 0) by field
+	FragmentSize      int
+	NumberOfFragments int
+
+	// Tags around the highlighted terms, <em> and </em> when empty
+	PreTags  []string
+	PostTags []string
+
+	Type string
+
+	// Only highlights the fields the query matched on
+	RequireFieldMatch bool
+}
+
+// Represents the highlighting options of a field
+type HighlightField struct {
+	FragmentSize      int
+	NumberOfFragments int
+	Type              string
+}
+
+// Source returns the highlight section of a search
+func (h Highlight) Source() map[string]interface{} {
+	fields := make(map[string]interface{}, len(h.Fields))
+	for name, field := range h.Fields {
+		fields[name] = field.Source()
+	}
+
+	params := map[string]interface{}{"fields": fields}
+	setFragments(params, h.FragmentSize, h.NumberOfFragments)
+	if len(h.PreTags) > 0 {
+		params["pre_tags"] = h.PreTags
+	}
+	if len(h.PostTags) > 0 {
+		params["post_tags"] = h.PostTags
+	}
+	setString(params, "type", h.Type)
+	if h.RequireFieldMatch {
+		params["require_field_match"] = true
+	}
+
+	return params
+}
+
+// Source returns the highlighting options of the field
+func (f HighlightField) Source() map[string]interface{} {
+	params := map[string]interface{}{}
+	setFragments(params, f.FragmentSize, f.NumberOfFragments)
+	setString(params, "type", f.Type)
+
+	return params
+}
+
+func (h Highlight) MarshalJSON() ([]byte, error)      { return json.Marshal(h.Source()) }
+func (f HighlightField) MarshalJSON() ([]byte, error) { return json.Marshal(f.Source()) }
+
+// setFragments sets the fragment options in params, NO_FRAGMENTS is sent as 0
+func setFragments(params map[string]interface{}, size int, number int) {
+	setInt(params, "fragment_size", size)
+
+	if number == NO_FRAGMENTS {
+		params["number_of_fragments"] = 0
+	} else {
+		setInt(params, "number_of_fragments", number)
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright 2013 Belogik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package qdsl
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func assertJSON(t *testing.T, obtained interface{}, expected string) {
+	t.Helper()
+	b, err := json.Marshal(obtained)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if string(b) != expected {
+		t.Errorf("obtained %s, expected %s", b, expected)
+	}
+}
+
+func TestQueries(t *testing.T) {
+	assertJSON(t, MatchAllQuery{}, `{"match_all":{}}`)
+	assertJSON(t, TermQuery{Field: "user", Value: "foo", Boost: 2}, `{"term":{"user":{"boost":2,"value":"foo"}}}`)
+	assertJSON(t, TermsQuery{Field: "tags", Values: []interface{}{"a", 1}}, `{"terms":{"tags":["a",1]}}`)
+	assertJSON(t, MatchQuery{Field: "message", Query: "quick fox", Operator: "and"}, `{"match":{"message":{"operator":"and","query":"quick fox"}}}`)
+	assertJSON(t, MultiMatchQuery{Query: "fox", Fields: []string{"title^3", "body"}, Type: "best_fields"},
+		`{"multi_match":{"fields":["title^3","body"],"query":"fox","type":"best_fields"}}`)
+	assertJSON(t, RangeQuery{Field: "date", Gte: "now-1d", Lt: 10, Format: "epoch_millis"},
+		`{"range":{"date":{"format":"epoch_millis","gte":"now-1d","lt":10}}}`)
+	assertJSON(t, ExistsQuery{Field: "user"}, `{"exists":{"field":"user"}}`)
+	assertJSON(t, PrefixQuery{Field: "user", Value: "fo"}, `{"prefix":{"user":{"value":"fo"}}}`)
+	assertJSON(t, WildcardQuery{Field: "user", Value: "f*o"}, `{"wildcard":{"user":{"value":"f*o"}}}`)
+	assertJSON(t, IdsQuery{Values: []string{"1", "2"}}, `{"ids":{"values":["1","2"]}}`)
+	assertJSON(t, QueryStringQuery{Query: "user:foo AND bar", DefaultOperator: "AND"},
+		`{"query_string":{"default_operator":"AND","query":"user:foo AND bar"}}`)
+	assertJSON(t, NestedQuery{Path: "comments", Query: TermQuery{Field: "comments.author", Value: "foo"}, ScoreMode: "max"},
+		`{"nested":{"path":"comments","query":{"term":{"comments.author":{"value":"foo"}}},"score_mode":"max"}}`)
+	assertJSON(t, ConstantScoreQuery{Filter: TermQuery{Field: "user", Value: "foo"}, Boost: 1.5},
+		`{"constant_score":{"boost":1.5,"filter":{"term":{"user":{"value":"foo"}}}}}`)
+}
+
+func TestBoolQuery(t *testing.T) {
+	query := BoolQuery{
+		Must:               []Query{MatchQuery{Field: "message", Query: "fox"}},
+		Should:             []Query{TermQuery{Field: "user", Value: "foo"}, TermQuery{Field: "user", Value: "bar"}},
+		MustNot:            []Query{ExistsQuery{Field: "deleted"}},
+		Filter:             []Query{RangeQuery{Field: "date", Gte: "now-1d"}},
+		MinimumShouldMatch: 1,
+	}
+
+	assertJSON(t, query, `{"bool":{`+
+		`"filter":[{"range":{"date":{"gte":"now-1d"}}}],`+
+		`"minimum_should_match":1,`+
+		`"must":[{"match":{"message":{"query":"fox"}}}],`+
+		`"must_not":[{"exists":{"field":"deleted"}}],`+
+		`"should":[{"term":{"user":{"value":"foo"}}},{"term":{"user":{"value":"bar"}}}]}}`)
+
+	// the clauses are plain maps
+	must := query.Source()["bool"].(map[string]interface{})["must"].([]interface{})
+	if _, ok := must[0].(map[string]interface{}); !ok {
+		t.Errorf("clause %#v is not a map", must[0])
+	}
+}
+
+func TestSearch(t *testing.T) {
+	assertJSON(t, Search{}, `{}`)
+
+	assertJSON(t, Search{
+		Query:      BoolQuery{Must: []Query{MatchAllQuery{}}},
+		PostFilter: TermQuery{Field: "user", Value: "foo"},
+		From:       20,
+		Size:       10,
+		MinScore:   0.5,
+	}, `{"from":20,"min_score":0.5,"post_filter":{"term":{"user":{"value":"foo"}}},"query":{"bool":{"must":[{"match_all":{}}]}},"size":10}`)
+
+	assertJSON(t, Search{Size: NO_HITS}, `{"size":0}`)
+
+	assertJSON(t, Search{SourceFilter: []string{"user"}, Timeout: "100ms", Explain: true},
+		`{"_source":["user"],"explain":true,"timeout":"100ms"}`)
+	assertJSON(t, Search{SourceFilter: false}, `{"_source":false}`)
+
+	// queries can be used in hand written bodies
+	assertJSON(t, map[string]interface{}{"query": TermQuery{Field: "user", Value: "foo"}}, `{"query":{"term":{"user":{"value":"foo"}}}}`)
+}
+
+func TestAggregations(t *testing.T) {
+	assertJSON(t, AvgAgg("price"), `{"avg":{"field":"price"}}`)
+	assertJSON(t, CardinalityAgg("user"), `{"cardinality":{"field":"user"}}`)
+	assertJSON(t, MetricAgg{Type: "sum", Script: "doc['price'].value * 2", Missing: 0},
+		`{"sum":{"missing":0,"script":"doc['price'].value * 2"}}`)
+	assertJSON(t, PercentilesAgg{Field: "load", Percents: []float64{50, 99.9}}, `{"percentiles":{"field":"load","percents":[50,99.9]}}`)
+	assertJSON(t, TopHitsAgg{Size: 1, SourceFilter: []string{"title"}}, `{"top_hits":{"_source":["title"],"size":1}}`)
+	assertJSON(t, HistogramAgg{Field: "price", Interval: 50}, `{"histogram":{"field":"price","interval":50}}`)
+	assertJSON(t, HistogramAgg{Field: "price"}, `{"histogram":{"field":"price"}}`)
+	assertJSON(t, DateHistogramAgg{Field: "date", CalendarInterval: "month"}, `{"date_histogram":{"calendar_interval":"month","field":"date"}}`)
+	assertJSON(t, DateHistogramAgg{Field: "date", FixedInterval: "90m"}, `{"date_histogram":{"field":"date","fixed_interval":"90m"}}`)
+	assertJSON(t, RangeAgg{Field: "price", Ranges: []AggRange{{To: 50}, {Key: "high", From: 50}}},
+		`{"range":{"field":"price","ranges":[{"to":50},{"from":50,"key":"high"}]}}`)
+	assertJSON(t, FilterAgg{Filter: TermQuery{Field: "user", Value: "foo"}, Aggs: map[string]Aggregation{"total": SumAgg("price")}},
+		`{"aggs":{"total":{"sum":{"field":"price"}}},"filter":{"term":{"user":{"value":"foo"}}}}`)
+	assertJSON(t, FilterAgg{}, `{"filter":{"match_all":{}}}`)
+
+	terms := TermsAgg{
+		Field: "user",
+		Size:  5,
+		Order: map[string]string{"_count": "asc"},
+		Aggs: map[string]Aggregation{
+			"per_day": DateHistogramAgg{
+				Field:    "date",
+				Interval: "1d",
+				Aggs:     map[string]Aggregation{"max_price": MaxAgg("price")},
+			},
+		},
+	}
+	assertJSON(t, terms, `{"aggs":{"per_day":{"aggs":{"max_price":{"max":{"field":"price"}}},"date_histogram":{"field":"date","interval":"1d"}}},`+
+		`"terms":{"field":"user","order":{"_count":"asc"},"size":5}}`)
+
+	assertJSON(t, Search{Size: NO_HITS, Aggs: map[string]Aggregation{"users": TermsAgg{Field: "user"}}},
+		`{"aggs":{"users":{"terms":{"field":"user"}}},"size":0}`)
+}
+
+func TestSorts(t *testing.T) {
+	assertJSON(t, FieldSort{Field: "_score"}, `{"_score":{}}`)
+	assertJSON(t, FieldSort{Field: "price", Order: ORDER_ASC, Mode: "avg", Missing: "_last", UnmappedType: "long"},
+		`{"price":{"missing":"_last","mode":"avg","order":"asc","unmapped_type":"long"}}`)
+	assertJSON(t, FieldSort{
+		Field:        "offer.price",
+		Order:        ORDER_DESC,
+		NestedPath:   "offer",
+		NestedFilter: TermQuery{Field: "offer.color", Value: "blue"},
+	}, `{"offer.price":{"nested_filter":{"term":{"offer.color":{"value":"blue"}}},"nested_path":"offer","order":"desc"}}`)
+	assertJSON(t, ScriptSort{Script: "doc['price'].value * 2", Type: "number", Order: ORDER_ASC},
+		`{"_script":{"order":"asc","script":"doc['price'].value * 2","type":"number"}}`)
+
+	assertJSON(t, Search{
+		Sort:        []Sort{FieldSort{Field: "date", Order: ORDER_DESC}, FieldSort{Field: "_id"}},
+		SearchAfter: []interface{}{1463538857, "654323"},
+	}, `{"search_after":[1463538857,"654323"],"sort":[{"date":{"order":"desc"}},{"_id":{}}]}`)
+}
+
+func TestFunctionScoreQuery(t *testing.T) {
+	assertJSON(t, WeightFunction{Filter: TermQuery{Field: "user", Value: "foo"}, Weight: 2},
+		`{"filter":{"term":{"user":{"value":"foo"}}},"weight":2}`)
+	assertJSON(t, FieldValueFactorFunction{Field: "likes", Factor: 1.2, Modifier: "log1p", Missing: 1},
+		`{"field_value_factor":{"factor":1.2,"field":"likes","missing":1,"modifier":"log1p"}}`)
+	assertJSON(t, DecayFunction{Type: "gauss", Field: "location", Origin: "52.3,4.9", Scale: "2km", Offset: "0km", Decay: 0.33, MultiValueMode: "min"},
+		`{"gauss":{"location":{"decay":0.33,"offset":"0km","origin":"52.3,4.9","scale":"2km"},"multi_value_mode":"min"}}`)
+	assertJSON(t, ScriptScoreFunction{Script: map[string]interface{}{"source": "Math.log(2 + doc['likes'].value)"}, Weight: 0.5},
+		`{"script_score":{"script":{"source":"Math.log(2 + doc['likes'].value)"}},"weight":0.5}`)
+	assertJSON(t, RandomScoreFunction{Seed: 10}, `{"random_score":{"seed":10}}`)
+
+	query := FunctionScoreQuery{
+		Query: MatchQuery{Field: "message", Query: "fox"},
+		Functions: []ScoreFunction{
+			WeightFunction{Filter: TermQuery{Field: "user", Value: "foo"}, Weight: 3},
+			DecayFunction{Type: "exp", Field: "date", Scale: "10d"},
+		},
+		ScoreMode: "sum",
+		BoostMode: "multiply",
+		MaxBoost:  10,
+		MinScore:  1,
+	}
+	assertJSON(t, query, `{"function_score":{"boost_mode":"multiply",`+
+		`"functions":[{"filter":{"term":{"user":{"value":"foo"}}},"weight":3},{"exp":{"date":{"scale":"10d"}}}],`+
+		`"max_boost":10,"min_score":1,"query":{"match":{"message":{"query":"fox"}}},"score_mode":"sum"}}`)
+
+	assertJSON(t, FunctionScoreQuery{Functions: []ScoreFunction{RandomScoreFunction{}}}, `{"function_score":{"functions":[{"random_score":{}}]}}`)
+}
+
+func TestGeoQueries(t *testing.T) {
+	amsterdam := GeoPoint{Lat: 52.37, Lon: 4.89}
+
+	assertJSON(t, amsterdam, `{"lat":52.37,"lon":4.89}`)
+	assertJSON(t, GeoDistanceQuery{Field: "location", Point: amsterdam, Distance: "12km", DistanceType: "plane"},
+		`{"geo_distance":{"distance":"12km","distance_type":"plane","location":{"lat":52.37,"lon":4.89}}}`)
+	assertJSON(t, GeoBoundingBoxQuery{Field: "location", TopLeft: GeoPoint{Lat: 53, Lon: 4}, BottomRight: GeoPoint{Lat: 52, Lon: 5.5}},
+		`{"geo_bounding_box":{"location":{"bottom_right":{"lat":52,"lon":5.5},"top_left":{"lat":53,"lon":4}}}}`)
+	assertJSON(t, GeoPolygonQuery{Field: "location", Points: []GeoPoint{{Lat: 53, Lon: 4}, {Lat: 52, Lon: 4}, {Lat: 52, Lon: 5}}},
+		`{"geo_polygon":{"location":{"points":[{"lat":53,"lon":4},{"lat":52,"lon":4},{"lat":52,"lon":5}]}}}`)
+
+	if s := amsterdam.String(); s != "52.37,4.89" {
+		t.Errorf("obtained %s, expected 52.37,4.89", s)
+	}
+
+	for _, data := range []string{`{"lat":52.37,"lon":4.89}`, `"52.37, 4.89"`, `[4.89,52.37]`} {
+		var p GeoPoint
+		if err := json.Unmarshal([]byte(data), &p); err != nil {
+			t.Errorf("unexpected error %s for %s", err, data)
+		}
+		if p != amsterdam {
+			t.Errorf("obtained %v for %s, expected %v", p, data, amsterdam)
+		}
+	}
+
+	for _, data := range []string{`"52.37"`, `[4.89]`, `"u173zq"`, `true`} {
+		var p GeoPoint
+		if err := json.Unmarshal([]byte(data), &p); err == nil {
+			t.Errorf("expected an error for %s", data)
+		}
+	}
+}
+
+func TestEscapeQueryString(t *testing.T) {
+	for text, expected := range map[string]string{
+		"foo bar":              "foo bar",
+		"c++ && (go || rust)":  `c\+\+ \&\& \(go \|\| rust\)`,
+		`title:"a/b" ~2 *`:     `title\:\"a\/b\" \~2 \*`,
+		`{1 TO 5] ^3 !x -y =z`: `\{1 TO 5\] \^3 \!x \-y \=z`,
+		`a\b? <c>`:             `a\\b\? c`,
+		"héllo":                "héllo",
+	} {
+		if escaped := EscapeQueryString(text); escaped != expected {
+			t.Errorf("obtained %s for %s, expected %s", escaped, text, expected)
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	assertJSON(t, Highlight{Fields: map[string]HighlightField{"message": {}}}, `{"fields":{"message":{}}}`)
+
+	highlight := Highlight{
+		Fields: map[string]HighlightField{
+			"title":   {NumberOfFragments: NO_FRAGMENTS},
+			"message": {FragmentSize: 50, NumberOfFragments: 2, Type: "plain"},
+		},
+		FragmentSize:      150,
+		NumberOfFragments: 3,
+		PreTags:           []string{"[["},
+		PostTags:          []string{"]]"},
+		Type:              "unified",
+		RequireFieldMatch: true,
+	}
+	assertJSON(t, highlight, `{"fields":{"message":{"fragment_size":50,"number_of_fragments":2,"type":"plain"},"title":{"number_of_fragments":0}},`+
+		`"fragment_size":150,"number_of_fragments":3,"post_tags":["]]"],"pre_tags":["[["],"require_field_match":true,"type":"unified"}`)
+
+	assertJSON(t, Search{Query: MatchQuery{Field: "message", Query: "foo"}, Highlight: &Highlight{Fields: map[string]HighlightField{"message": {}}}},
+		`{"highlight":{"fields":{"message":{}}},"query":{"match":{"message":{"query":"foo"}}}}`)
+}
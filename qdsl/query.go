@@ -0,0 +1,364 @@
+// Copyright 2013 Belogik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package qdsl builds the queries of the elasticsearch query DSL instead of
+// nesting map[string]interface{} by hand:
+//
+//	query := qdsl.BoolQuery{
+//		Must:   []qdsl.Query{qdsl.MatchQuery{Field: "message", Query: "elasticsearch"}},
+//		Filter: []qdsl.Query{qdsl.RangeQuery{Field: "date", Gte: "now-1d"}},
+//	}
+//	conn.Search(qdsl.Search{Query: query, Size: 20}, indexList, typeList)
+//
+// The queries are encoded to JSON by their Source, they can also be used
+// anywhere in a hand written body.
+package qdsl
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Query is implemented by every query of the package
+type Query interface {
+	// Source returns the query as sent to elasticsearch
+	Source() map[string]interface{}
+}
+
+// Represents a match_all query, matching every document
+type MatchAllQuery struct {
+	Boost float64
+}
+
+// Represents a term query, matching the documents whose field contains the
+// exact term Value (not analyzed)
+type TermQuery struct {
+	Field string
+	Value interface{}
+	Boost float64
+}
+
+// Represents a terms query, matching the documents whose field contains any
+// of the exact terms Values
+type TermsQuery struct {
+	Field  string
+	Values []interface{}
+	Boost  float64
+}
+
+// Represents a match query, matching the documents whose field contains the
+// analyzed Query. Operator is "or" (the default) or "and".
+type MatchQuery struct {
+	Field              string
+	Query              interface{}
+	Operator           string
+	Fuzziness          string
+	MinimumShouldMatch string
+	Analyzer           string
+	Boost              float64
+}
+
+// Represents a multi_match query, a match query on several fields which can
+// be boosted like title^3. Type is best_fields (the default), most_fields,
+// cross_fields, phrase or phrase_prefix.
+type MultiMatchQuery struct {
+	Query              interface{}
+	Fields             []string
+	Type               string
+	Operator           string
+	Fuzziness          string
+	MinimumShouldMatch string
+	Boost              float64
+}
+
+// Represents a bool query combining other queries. Filter clauses do not
+// contribute to the score (elasticsearch 2.0+).
+type BoolQuery struct {
+	Must               []Query
+	Should             []Query
+	MustNot            []Query
+	Filter             []Query
+	MinimumShouldMatch interface{}
+	Boost              float64
+}
+
+// Represents a range query, Gt, Gte, Lt and Lte are numbers, strings or date
+// math expressions (now-1d ...), unbounded when nil
+type RangeQuery struct {
+	Field    string
+	Gt       interface{}
+	Gte      interface{}
+	Lt       interface{}
+	Lte      interface{}
+	Format   string
+	TimeZone string
+	Boost    float64
+}
+
+// Represents an exists query, matching the documents with a value in Field
+type ExistsQuery struct {
+	Field string
+}
+
+// Represents a prefix query, matching the documents whose field contains a
+// term starting with Value
+type PrefixQuery struct {
+	Field string
+	Value string
+	Boost float64
+}
+
+// Represents a wildcard query, Value can contain * and ?
+type WildcardQuery struct {
+	Field string
+	Value string
+	Boost float64
+}
+
+// Represents an ids query, matching the documents by _id
+type IdsQuery struct {
+	Values []string
+}
+
+// Represents a query_string query, in the Lucene query syntax. User input is
+// escaped with EscapeQueryString.
+type QueryStringQuery struct {
+	Query           string
+	DefaultField    string
+	Fields          []string
+	DefaultOperator string
+	Boost           float64
+}
+
+// Represents a nested query, matching the documents with a nested object of
+// Path matching Query. ScoreMode is avg (the default), sum, min, max or none.
+type NestedQuery struct {
+	Path      string
+	Query     Query
+	ScoreMode string
+}
+
+// Represents a constant_score query, giving the score Boost to the documents
+// matching Filter
+type ConstantScoreQuery struct {
+	Filter Query
+	Boost  float64
+}
+
+// Source returns the match_all query
+func (q MatchAllQuery) Source() map[string]interface{} {
+	params := map[string]interface{}{}
+	setBoost(params, q.Boost)
+
+	return map[string]interface{}{"match_all": params}
+}
+
+// Source returns the term query
+func (q TermQuery) Source() map[string]interface{} {
+	params := map[string]interface{}{"value": q.Value}
+	setBoost(params, q.Boost)
+
+	return map[string]interface{}{"term": map[string]interface{}{q.Field: params}}
+}
+
+// Source returns the terms query
+func (q TermsQuery) Source() map[string]interface{} {
+	params := map[string]interface{}{q.Field: q.Values}
+	setBoost(params, q.Boost)
+
+	return map[string]interface{}{"terms": params}
+}
+
+// Source returns the match query
+func (q MatchQuery) Source() map[string]interface{} {
+	params := map[string]interface{}{"query": q.Query}
+	setString(params, "operator", q.Operator)
+	setString(params, "fuzziness", q.Fuzziness)
+	setString(params, "minimum_should_match", q.MinimumShouldMatch)
+	setString(params, "analyzer", q.Analyzer)
+	setBoost(params, q.Boost)
+
+	return map[string]interface{}{"match": map[string]interface{}{q.Field: params}}
+}
+
+// Source returns the multi_match query
+func (q MultiMatchQuery) Source() map[string]interface{} {
+	params := map[string]interface{}{"query": q.Query, "fields": q.Fields}
+	setString(params, "type", q.Type)
+	setString(params, "operator", q.Operator)
+	setString(params, "fuzziness", q.Fuzziness)
+	setString(params, "minimum_should_match", q.MinimumShouldMatch)
+	setBoost(params, q.Boost)
+
+	return map[string]interface{}{"multi_match": params}
+}
+
+// Source returns the bool query
+func (q BoolQuery) Source() map[string]interface{} {
+	params := map[string]interface{}{}
+	setQueries(params, "must", q.Must)
+	setQueries(params, "should", q.Should)
+	setQueries(params, "must_not", q.MustNot)
+	setQueries(params, "filter", q.Filter)
+	if q.MinimumShouldMatch != nil {
+		params["minimum_should_match"] = q.MinimumShouldMatch
+	}
+	setBoost(params, q.Boost)
+
+	return map[string]interface{}{"bool": params}
+}
+
+// Source returns the range query
+func (q RangeQuery) Source() map[string]interface{} {
+	params := map[string]interface{}{}
+	for key, value := range map[string]interface{}{"gt": q.Gt, "gte": q.Gte, "lt": q.Lt, "lte": q.Lte} {
+		if value != nil {
+			params[key] = value
+		}
+	}
+	setString(params, "format", q.Format)
+	setString(params, "time_zone", q.TimeZone)
+	setBoost(params, q.Boost)
+
+	return map[string]interface{}{"range": map[string]interface{}{q.Field: params}}
+}
+
+// Source returns the exists query
+func (q ExistsQuery) Source() map[string]interface{} {
+	return map[string]interface{}{"exists": map[string]interface{}{"field": q.Field}}
+}
+
+// Source returns the prefix query
+func (q PrefixQuery) Source() map[string]interface{} {
+	params := map[string]interface{}{"value": q.Value}
+	setBoost(params, q.Boost)
+
+	return map[string]interface{}{"prefix": map[string]interface{}{q.Field: params}}
+}
+
+// Source returns the wildcard query
+func (q WildcardQuery) Source() map[string]interface{} {
+	params := map[string]interface{}{"value": q.Value}
+	setBoost(params, q.Boost)
+
+	return map[string]interface{}{"wildcard": map[string]interface{}{q.Field: params}}
+}
+
+// Source returns the ids query
+func (q IdsQuery) Source() map[string]interface{} {
+	return map[string]interface{}{"ids": map[string]interface{}{"values": q.Values}}
+}
+
+// Source returns the query_string query
+func (q QueryStringQuery) Source() map[string]interface{} {
+	params := map[string]interface{}{"query": q.Query}
+	setString(params, "default_field", q.DefaultField)
+	if len(q.Fields) > 0 {
+		params["fields"] = q.Fields
+	}
+	setString(params, "default_operator", q.DefaultOperator)
+	setBoost(params, q.Boost)
+
+	return map[string]interface{}{"query_string": params}
+}
+
+// Source returns the nested query
+func (q NestedQuery) Source() map[string]interface{} {
+	params := map[string]interface{}{"path": q.Path, "query": source(q.Query)}
+	setString(params, "score_mode", q.ScoreMode)
+
+	return map[string]interface{}{"nested": params}
+}
+
+// Source returns the constant_score query
+func (q ConstantScoreQuery) Source() map[string]interface{} {
+	params := map[string]interface{}{"filter": source(q.Filter)}
+	setBoost(params, q.Boost)
+
+	return map[string]interface{}{"constant_score": params}
+}
+
+func (q MatchAllQuery) MarshalJSON() ([]byte, error)      { return json.Marshal(q.Source()) }
+func (q TermQuery) MarshalJSON() ([]byte, error)          { return json.Marshal(q.Source()) }
+func (q TermsQuery) MarshalJSON() ([]byte, error)         { return json.Marshal(q.Source()) }
+func (q MatchQuery) MarshalJSON() ([]byte, error)         { return json.Marshal(q.Source()) }
+func (q MultiMatchQuery) MarshalJSON() ([]byte, error)    { return json.Marshal(q.Source()) }
+func (q BoolQuery) MarshalJSON() ([]byte, error)          { return json.Marshal(q.Source()) }
+func (q RangeQuery) MarshalJSON() ([]byte, error)         { return json.Marshal(q.Source()) }
+func (q ExistsQuery) MarshalJSON() ([]byte, error)        { return json.Marshal(q.Source()) }
+func (q PrefixQuery) MarshalJSON() ([]byte, error)        { return json.Marshal(q.Source()) }
+func (q WildcardQuery) MarshalJSON() ([]byte, error)      { return json.Marshal(q.Source()) }
+func (q IdsQuery) MarshalJSON() ([]byte, error)           { return json.Marshal(q.Source()) }
+func (q QueryStringQuery) MarshalJSON() ([]byte, error)   { return json.Marshal(q.Source()) }
+func (q NestedQuery) MarshalJSON() ([]byte, error)        { return json.Marshal(q.Source()) }
+func (q ConstantScoreQuery) MarshalJSON() ([]byte, error) { return json.Marshal(q.Source()) }
+
+// EscapeQueryString escapes the special characters of the query_string and
+// simple_query_string syntax in text, to search it literally. < and > can not
+// be escaped and are removed.
+func EscapeQueryString(text string) string {
+	var escaped strings.Builder
+
+	for _, r := range text {
+		switch r {
+		case '<', '>':
+			continue
+		case '+', '-', '=', '&', '|', '!', '(', ')', '{', '}', '[', ']', '^', '"', '~', '*', '?', ':', '\\', '/':
+			escaped.WriteRune('\\')
+		}
+		escaped.WriteRune(r)
+	}
+
+	return escaped.String()
+}
+
+// source returns the source of q, nil when there is no query
+func source(q Query) interface{} {
+	if q == nil {
+		return nil
+	}
+
+	return q.Source()
+}
+
+// setQueries sets the sources of queries in params, unless there is none
+func setQueries(params map[string]interface{}, key string, queries []Query) {
+	if len(queries) == 0 {
+		return
+	}
+
+	sources := make([]interface{}, 0, len(queries))
+	for _, q := range queries {
+		sources = append(sources, q.Source())
+	}
+	params[key] = sources
+}
+
+// setString sets value in params, unless it is empty
+func setString(params map[string]interface{}, key string, value string) {
+	if value != "" {
+		params[key] = value
+	}
+}
+
+// setInt sets value in params, unless it is 0
+func setInt(params map[string]interface{}, key string, value int) {
+	if value != 0 {
+		params[key] = value
+	}
+}
+
+// setFloat sets value in params, unless it is 0
+func setFloat(params map[string]interface{}, key string, value float64) {
+	if value != 0 {
+		params[key] = value
+	}
+}
+
+// setBoost sets the boost in params, unless it is 0
+func setBoost(params map[string]interface{}, boost float64) {
+	if boost != 0 {
+		params["boost"] = boost
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2013 Belogik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package qdsl
+
+import "encoding/json"
+
+// Size of a Search returning no hits, e.g. to only compute aggregations
+const NO_HITS = -1
+
+// Represents the body of a search, given as the query of
+// goes.Connection.Search. Every field left to its zero value is omitted.
+type Search struct {
+	Query Query
+
+	// Filters the hits after the aggregations are computed
+	PostFilter Query
+
+	// Number of hits to skip and to return, elasticsearch returns the first
+	// 10 hits when they are 0
+	From int
+	Size int
+
+	MinScore float64
+
+	// Sorts of the hits, by score when empty
+	Sort []Sort
+
+	// Returns the hits after the one with these sort values (goes.Hit.Sort),
+	// From must be 0 (elasticsearch 5.0+)
+	SearchAfter []interface{}
+
+	// The _source of the hits, like false, a list of fields or
+	// {"includes": [...], "excludes": [...]}
+	SourceFilter interface{}
+
+	// Returns the hits found so far when it expires, like 100ms, the
+	// response is then TimedOut
+	Timeout string
+
+	// Highlights the matches in the hits
+	Highlight *Highlight
+
+	// Sets the goes.Hit.Explanation of each hit
+	Explain bool
+
+	// Aggregations by name, the results are in goes.Response.Aggregations
+	Aggs map[string]Aggregation
+}
+
+// Source returns the body of the search
+func (s Search) Source() map[string]interface{} {
+	body := map[string]interface{}{}
+
+	if s.Query != nil {
+		body["query"] = s.Query.Source()
+	}
+
+	if s.PostFilter != nil {
+		body["post_filter"] = s.PostFilter.Source()
+	}
+
+	if s.From != 0 {
+		body["from"] = s.From
+	}
+
+	if s.Size == NO_HITS {
+		body["size"] = 0
+	} else if s.Size != 0 {
+		body["size"] = s.Size
+	}
+
+	if s.MinScore != 0 {
+		body["min_score"] = s.MinScore
+	}
+
+	if len(s.Sort) > 0 {
+		sorts := make([]interface{}, 0, len(s.Sort))
+		for _, sort := range s.Sort {
+			sorts = append(sorts, sort.Source())
+		}
+		body["sort"] = sorts
+	}
+
+	if len(s.SearchAfter) > 0 {
+		body["search_after"] = s.SearchAfter
+	}
+
+	if s.SourceFilter != nil {
+		body["_source"] = s.SourceFilter
+	}
+
+	if s.Timeout != "" {
+		body["timeout"] = s.Timeout
+	}
+
+	if s.Highlight != nil {
+		body["highlight"] = s.Highlight.Source()
+	}
+
+	if s.Explain {
+		body["explain"] = true
+	}
+
+	if len(s.Aggs) > 0 {
+		body["aggs"] = aggSources(s.Aggs)
+	}
+
+	return body
+}
+
+func (s Search) MarshalJSON() ([]byte, error) { return json.Marshal(s.Source()) }
@@ -0,0 +1,73 @@
+// Copyright 2013 Belogik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package qdsl
+
+import "encoding/json"
+
+const (
+	ORDER_ASC  = "asc"
+	ORDER_DESC = "desc"
+)
+
+// Sort is implemented by the sorts of the package, the values a hit was
+// sorted by are in goes.Hit.Sort
+type Sort interface {
+	// Source returns the sort as sent to elasticsearch
+	Source() map[string]interface{}
+}
+
+// Represents a sort on Field, or on the score when Field is _score. Mode
+// (min, max, avg, sum, median) picks the value of multi valued fields and
+// Missing (_last, _first or a value) is used for the documents without one.
+type FieldSort struct {
+	Field   string
+	Order   string
+	Mode    string
+	Missing interface{}
+
+	// Type of the field for the indices where it is not mapped
+	UnmappedType string
+
+	// Sorts on a field of the nested objects at NestedPath, only the ones
+	// matching NestedFilter when it is set
+	NestedPath   string
+	NestedFilter Query
+}
+
+// Represents a sort on the value computed by Script, Type is number or
+// string
+type ScriptSort struct {
+	Script interface{}
+	Type   string
+	Order  string
+}
+
+// Source returns the field sort
+func (s FieldSort) Source() map[string]interface{} {
+	params := map[string]interface{}{}
+	setString(params, "order", s.Order)
+	setString(params, "mode", s.Mode)
+	setString(params, "unmapped_type", s.UnmappedType)
+	setString(params, "nested_path", s.NestedPath)
+	if s.Missing != nil {
+		params["missing"] = s.Missing
+	}
+	if s.NestedFilter != nil {
+		params["nested_filter"] = s.NestedFilter.Source()
+	}
+
+	return map[string]interface{}{s.Field: params}
+}
+
+// Source returns the script sort
+func (s ScriptSort) Source() map[string]interface{} {
+	params := map[string]interface{}{"script": s.Script, "type": s.Type}
+	setString(params, "order", s.Order)
+
+	return map[string]interface{}{"_script": params}
+}
+
+func (s FieldSort) MarshalJSON() ([]byte, error)  { return json.Marshal(s.Source()) }
+func (s ScriptSort) MarshalJSON() ([]byte, error) { return json.Marshal(s.Source()) }
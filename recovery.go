@@ -0,0 +1,88 @@
+// Copyright 2013 Belogik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goes
+
+import (
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Recovery fetches the recoveries of the shards of the indices in indexList,
+// all of them when indexList is empty, by index. Only the recoveries in
+// progress are fetched when activeOnly is true.
+func (c *Connection) Recovery(indexList []string, activeOnly bool) (map[string][]ShardRecovery, error) {
+	r := Request{
+		Conn:      c,
+		IndexList: indexList,
+		method:    "GET",
+		api:       "_recovery",
+	}
+
+	if activeOnly {
+		r.ExtraArgs = url.Values{"active_only": {"true"}}
+	}
+
+	raw, err := r.RunRaw()
+	if err != nil || raw == nil {
+		return nil, err
+	}
+
+	indices := map[string]struct {
+		Shards []ShardRecovery
+	}{}
+	if err := c.decode(raw, &indices); err != nil {
+		return nil, err
+	}
+
+	recoveries := make(map[string][]ShardRecovery, len(indices))
+	for index, v := range indices {
+		recoveries[index] = v.Shards
+	}
+
+	return recoveries, nil
+}
+
+// UnmarshalJSON decodes the files and bytes of the recovery of an index,
+// the bytes were not reported in size before elasticsearch 2.0
+func (i *RecoveryIndex) UnmarshalJSON(data []byte) error {
+	type progress struct {
+		Total     uint64
+		Reused    uint64
+		Recovered uint64
+		Percent   string
+	}
+
+	raw := struct {
+		Files progress
+		Bytes progress
+		Size  struct {
+			TotalInBytes     uint64 `json:"total_in_bytes"`
+			ReusedInBytes    uint64 `json:"reused_in_bytes"`
+			RecoveredInBytes uint64 `json:"recovered_in_bytes"`
+			Percent          string
+		}
+		TotalTimeInMillis uint64 `json:"total_time_in_millis"`
+	}{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	i.Files = RecoveryProgress{raw.Files.Total, raw.Files.Reused, raw.Files.Recovered, parsePercent(raw.Files.Percent)}
+	i.Bytes = RecoveryProgress{raw.Bytes.Total, raw.Bytes.Reused, raw.Bytes.Recovered, parsePercent(raw.Bytes.Percent)}
+	if raw.Size.Percent != "" {
+		i.Bytes = RecoveryProgress{raw.Size.TotalInBytes, raw.Size.ReusedInBytes, raw.Size.RecoveredInBytes, parsePercent(raw.Size.Percent)}
+	}
+	i.TotalTimeInMillis = raw.TotalTimeInMillis
+
+	return nil
+}
+
+// parsePercent converts a percentage like 42.5% to 42.5
+func parsePercent(s string) float64 {
+	percent, _ := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	return percent
+}
@@ -0,0 +1,153 @@
+// Copyright 2013 Belogik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goes
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Default wait before sending failed bulk items again
+const defaultBulkItemBackoff = 100 * time.Millisecond
+
+// Default wait before sending a retryable request again, and its cap
+const (
+	defaultRetryBackoff    = 100 * time.Millisecond
+	defaultMaxRetryBackoff = 5 * time.Second
+)
+
+// retryBackoff returns the wait before sending a request again after it
+// failed attempt+1 times
+func (c *Connection) retryBackoff(attempt int) time.Duration {
+	backoff := c.RetryBackoff
+	if backoff == 0 {
+		backoff = defaultRetryBackoff
+	}
+
+	max := c.MaxRetryBackoff
+	if max == 0 {
+		max = defaultMaxRetryBackoff
+	}
+
+	for i := 0; i < attempt && backoff < max; i++ {
+		backoff *= 2
+	}
+
+	if backoff > max {
+		return max
+	}
+	return backoff
+}
+
+// sleep waits for d, it returns false when the context of the request is done
+// before
+func (req *Request) sleep(d time.Duration) bool {
+	if req.ctx == nil {
+		time.Sleep(d)
+		return true
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-req.ctx.Done():
+		return false
+	}
+}
+
+// retryBulkItems sends again with r the documents whose items of response
+// failed temporarily, up to BulkItemRetries times, and reports the documents
+// which still failed to BulkItemFailed
+func (c *Connection) retryBulkItems(r Request, documents []Document, response Response) (Response, error) {
+	if len(response.Items) != len(documents) {
+		return response, fmt.Errorf("%d items for %d documents", len(response.Items), len(documents))
+	}
+
+	backoff := c.BulkItemBackoff
+	if backoff == 0 {
+		backoff = defaultBulkItemBackoff
+	}
+
+	for attempt := 0; attempt < c.BulkItemRetries; attempt++ {
+		positions := []int{}
+		for _, failed := range response.Failed() {
+			if failed.isTemporary() {
+				positions = append(positions, failed.Position)
+			}
+		}
+
+		if len(positions) == 0 {
+			break
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+
+		retried := make([]Document, len(positions))
+		for i, position := range positions {
+			retried[i] = documents[position]
+		}
+
+		if err := c.audit("", retried...); err != nil {
+			return response, err
+		}
+
+		r.bulkDocuments = retried
+		retry, err := r.Run()
+		if err != nil {
+			return response, err
+		}
+
+		c.reportMappingConflicts(retry)
+
+		if len(retry.Items) != len(positions) {
+			return response, fmt.Errorf("%d items for %d documents", len(retry.Items), len(positions))
+		}
+
+		for i, position := range positions {
+			response.Items[position] = retry.Items[i]
+		}
+	}
+
+	failed := response.Failed()
+	response.Errors = len(failed) > 0
+
+	if c.BulkItemFailed != nil && len(failed) > 0 {
+		results, err := response.BulkResults(documents)
+		if err != nil {
+			return response, err
+		}
+
+		permanent := make([]BulkResult, 0, len(failed))
+		for _, f := range failed {
+			permanent = append(permanent, results[f.Position])
+		}
+		c.BulkItemFailed(permanent)
+	}
+
+	return response, nil
+}
+
+// isTemporary checks if the item failed because the cluster was overloaded or
+// a shard unavailable
+func (item BulkItem) isTemporary() bool {
+	switch item.Status {
+	case 429, 503:
+		return true
+	}
+
+	switch item.Error.Type {
+	case "es_rejected_execution_exception", "unavailable_shards_exception":
+		return true
+	}
+
+	// elasticsearch 0.90 does not send the status of the items
+	return strings.HasPrefix(item.Error.Reason, "EsRejectedExecutionException") ||
+		strings.HasPrefix(item.Error.Reason, "UnavailableShardsException")
+}
@@ -0,0 +1,109 @@
+// Copyright 2013 Belogik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goes
+
+import (
+	"fmt"
+)
+
+// SelfCheck verifies that the server is reachable and meets requirements,
+// usually when a service starts. Nothing else is checked when the server can
+// not be reached.
+func (c *Connection) SelfCheck(requirements Requirements) SelfCheckReport {
+	report := SelfCheckReport{Ok: true}
+
+	add := func(name string, err error) {
+		check := Check{Name: name, Ok: err == nil}
+		if err != nil {
+			check.Error = err.Error()
+			report.Ok = false
+		}
+		report.Checks = append(report.Checks, check)
+	}
+
+	info, err := c.Info()
+	add("reachable", err)
+	if err != nil {
+		return report
+	}
+
+	version := info.ServerVersion.Number
+	if requirements.Versions.From != "" || requirements.Versions.Until != "" {
+		err = nil
+		if !requirements.Versions.Contains(version) {
+			err = fmt.Errorf("elasticsearch %s is not supported", version)
+		}
+		add("version", err)
+	}
+
+	for _, index := range requirements.Indices {
+		add("index "+index, c.checkIndex(index))
+	}
+
+	for _, template := range requirements.Templates {
+		add("template "+template, c.checkTemplate(template))
+	}
+
+	documentType := requirements.WriteType
+	if documentType == "" {
+		documentType = "selfcheck"
+		if compareVersions(version, "6.2.0") >= 0 {
+			documentType = "_doc"
+		}
+	}
+
+	for _, index := range requirements.WritableIndices {
+		add("write "+index, c.checkWrite(index, documentType))
+	}
+
+	return report
+}
+
+// checkIndex returns an error if the index or alias does not exist
+func (c *Connection) checkIndex(index string) error {
+	exists, err := c.IndexExists(index)
+	if err == nil && !exists {
+		err = fmt.Errorf("index %s does not exist", index)
+	}
+
+	return err
+}
+
+// checkTemplate returns an error if the index template does not exist
+func (c *Connection) checkTemplate(template string) error {
+	templates, err := c.GetTemplate([]string{template})
+	if err != nil {
+		return err
+	}
+
+	if _, ok := templates[template]; !ok {
+		return fmt.Errorf("template %s does not exist", template)
+	}
+
+	return nil
+}
+
+// checkWrite indexes then deletes a temporary document in index, without
+// the validation and the hooks of Index and Delete
+func (c *Connection) checkWrite(index string, documentType string) error {
+	r := Request{
+		Conn:      c,
+		Query:     map[string]interface{}{"selfcheck": true},
+		IndexList: []string{index},
+		TypeList:  []string{documentType},
+		method:    "PUT",
+		id:        "goes-selfcheck-" + newOpaqueId(),
+	}
+
+	if _, err := r.Run(); err != nil {
+		return err
+	}
+
+	r.Query = nil
+	r.method = "DELETE"
+
+	_, err := r.Run()
+	return err
+}
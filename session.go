@@ -0,0 +1,205 @@
+// Copyright 2013 Belogik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goes
+
+import (
+	"net/url"
+	"path"
+	"sort"
+	"time"
+)
+
+// NewSession starts a Session, window is usually the refresh_interval of the
+// indices (1s by default)
+func (c *Connection) NewSession(window time.Duration) *Session {
+	return &Session{
+		Conn:   c,
+		Window: window,
+		writes: map[string]time.Time{},
+	}
+}
+
+// Index indexes a Document like Connection.Index
+func (s *Session) Index(d Document, extraArgs url.Values) (Response, error) {
+	defer s.written(d.Index.(string))
+	return s.Conn.Index(d, extraArgs)
+}
+
+// Delete deletes a Document like Connection.Delete
+func (s *Session) Delete(d Document, extraArgs url.Values) (Response, error) {
+	defer s.written(d.Index.(string))
+	return s.Conn.Delete(d, extraArgs)
+}
+
+// BulkSend sends documents like Connection.BulkSend
+func (s *Session) BulkSend(index string, documents []Document) (Response, error) {
+	response, err := s.Conn.BulkSend(index, documents)
+
+	s.written(index)
+	for _, doc := range documents {
+		if docIndex, ok := doc.Index.(string); ok {
+			s.written(docIndex)
+		}
+	}
+
+	return response, err
+}
+
+// Get gets a typed document by its id like Connection.Get, from the
+// transaction log if it was not refreshed yet
+func (s *Session) Get(index string, documentType string, id string, extraArgs url.Values) (Response, error) {
+	args := copyValues(extraArgs)
+	args.Set("realtime", "true")
+
+	return s.Conn.Get(index, documentType, id, args)
+}
+
+// Search refreshes the indices of indexList written to during the window,
+// every index written to when indexList is empty, and executes a search query
+// like Connection.Search. The aliases and wildcard expressions of indexList
+// and of the writes are resolved to find which writes it sees.
+func (s *Session) Search(query interface{}, indexList []string, typeList []string) (Response, error) {
+	if err := s.refresh(indexList); err != nil {
+		return Response{}, err
+	}
+
+	return s.Conn.Search(query, indexList, typeList)
+}
+
+// written records a write to index which has just been done, it will be
+// visible after the window
+func (s *Session) written(index string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.writes[index] = time.Now()
+}
+
+// refresh refreshes the indices of indexList with writes which may not be
+// visible yet
+func (s *Session) refresh(indexList []string) error {
+	start := time.Now()
+
+	s.lock.Lock()
+	stale := []string{}
+	others := []string{}
+	for index, last := range s.writes {
+		if start.Sub(last) >= s.Window {
+			delete(s.writes, index)
+			continue
+		}
+
+		if len(indexList) == 0 || contains(indexList, index) {
+			stale = append(stale, index)
+		} else {
+			others = append(others, index)
+		}
+	}
+	s.lock.Unlock()
+
+	// the other writes may be seen through an alias or a wildcard expression
+	if len(others) > 0 {
+		seen, err := s.seenWrites(indexList, others)
+		if err != nil {
+			return err
+		}
+		stale = append(stale, seen...)
+	}
+
+	if len(stale) == 0 {
+		return nil
+	}
+	sort.Strings(stale)
+
+	if _, err := s.Conn.Refresh(stale); err != nil {
+		return err
+	}
+
+	// the writes sent during the refresh may not be visible
+	s.lock.Lock()
+	for _, index := range stale {
+		if !s.writes[index].After(start) {
+			delete(s.writes, index)
+		}
+	}
+	s.lock.Unlock()
+
+	return nil
+}
+
+// seenWrites returns the names of written whose indices are searched by
+// indexList once their aliases and wildcard expressions are resolved
+func (s *Session) seenWrites(indexList []string, written []string) ([]string, error) {
+	aliases, err := s.Conn.GetAliases(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	searched := map[string]bool{}
+	for _, name := range indexList {
+		for _, index := range concreteIndices(name, aliases) {
+			searched[index] = true
+		}
+	}
+
+	seen := []string{}
+	for _, name := range written {
+		for _, index := range concreteIndices(name, aliases) {
+			if searched[index] {
+				seen = append(seen, name)
+				break
+			}
+		}
+	}
+
+	return seen, nil
+}
+
+// concreteIndices returns the indices name stands for, an index, an alias or
+// a wildcard expression, given the aliases of every index. A name matching
+// nothing, like an index not created yet, stands for itself.
+func concreteIndices(name string, aliases map[string][]string) []string {
+	indices := []string{}
+	for index, names := range aliases {
+		if matchIndex(name, index) {
+			indices = append(indices, index)
+			continue
+		}
+
+		for _, alias := range names {
+			if matchIndex(name, alias) {
+				indices = append(indices, index)
+				break
+			}
+		}
+	}
+
+	if len(indices) == 0 {
+		return []string{name}
+	}
+	return indices
+}
+
+// matchIndex checks if the index or alias name is matched by pattern, a name
+// or a wildcard expression
+func matchIndex(pattern string, name string) bool {
+	if pattern == "_all" || pattern == name {
+		return true
+	}
+
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+// contains checks if values contains value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,234 @@
+// Copyright 2013 Belogik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goes
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CreateRepository creates or updates the snapshot repository called name:
+//
+//	conn.CreateRepository("backups", Repository{
+//		Type:     "fs",
+//		Settings: map[string]interface{}{"location": "/mnt/backups"},
+//	})
+func (c *Connection) CreateRepository(name string, repository Repository) (Response, error) {
+	r := Request{
+		Conn:   c,
+		Query:  repository,
+		method: "PUT",
+		api:    "_snapshot/" + name,
+	}
+
+	return r.Run()
+}
+
+// GetRepository fetches the snapshot repositories called names, all of them
+// when names is empty, by name
+func (c *Connection) GetRepository(names []string) (map[string]Repository, error) {
+	r := Request{
+		Conn:   c,
+		method: "GET",
+		api:    "_snapshot",
+	}
+
+	if len(names) > 0 {
+		r.api += "/" + strings.Join(names, ",")
+	}
+
+	raw, err := r.RunRaw()
+	if err != nil {
+		return nil, err
+	}
+
+	repositories := map[string]Repository{}
+	if len(raw) > 0 {
+		err = c.decode(raw, &repositories)
+	}
+
+	return repositories, err
+}
+
+// DeleteRepository deletes the snapshot repository called name, the snapshots
+// it holds are left untouched
+func (c *Connection) DeleteRepository(name string) (Response, error) {
+	r := Request{
+		Conn:   c,
+		method: "DELETE",
+		api:    "_snapshot/" + name,
+	}
+
+	return r.Run()
+}
+
+// VerifyRepository checks that every node can write to the snapshot
+// repository called name and returns the sorted names of the nodes
+func (c *Connection) VerifyRepository(name string) ([]string, error) {
+	r := Request{
+		Conn:   c,
+		method: "POST",
+		api:    "_snapshot/" + name + "/_verify",
+	}
+
+	resp, err := r.Run()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make([]string, 0, len(resp.Nodes))
+	for _, node := range resp.Nodes {
+		nodes = append(nodes, node.Name)
+	}
+	sort.Strings(nodes)
+
+	return nodes, nil
+}
+
+// CreateSnapshot snapshots indices into the repository. The body selects the
+// indices and options (indices, ignore_unavailable, include_global_state ...),
+// every index is snapshotted when it is nil. When wait is false, the snapshot
+// runs in the background and only its name is returned, see SnapshotStatus.
+func (c *Connection) CreateSnapshot(repository string, name string, body interface{}, wait bool) (Snapshot, error) {
+	// elasticsearch does not accept a null body
+	if body == nil {
+		body = map[string]interface{}{}
+	}
+
+	r := Request{
+		Conn:      c,
+		Query:     body,
+		ExtraArgs: url.Values{"wait_for_completion": {strconv.FormatBool(wait)}},
+		method:    "PUT",
+		api:       "_snapshot/" + repository + "/" + name,
+	}
+
+	return r.snapshot(name)
+}
+
+// RestoreSnapshot restores the indices of a snapshot of the repository. The
+// body selects the indices and options (indices, rename_pattern,
+// rename_replacement ...), every index is restored when it is nil. The
+// restored indices must not exist or be closed. When wait is false, the
+// restore runs in the background and only the name of the snapshot is
+// returned.
+func (c *Connection) RestoreSnapshot(repository string, name string, body interface{}, wait bool) (Snapshot, error) {
+	// elasticsearch does not accept a null body
+	if body == nil {
+		body = map[string]interface{}{}
+	}
+
+	r := Request{
+		Conn:      c,
+		Query:     body,
+		ExtraArgs: url.Values{"wait_for_completion": {strconv.FormatBool(wait)}},
+		method:    "POST",
+		api:       "_snapshot/" + repository + "/" + name + "/_restore",
+	}
+
+	return r.snapshot(name)
+}
+
+// GetSnapshots fetches the snapshots called names of the repository, all of
+// them when names is empty
+func (c *Connection) GetSnapshots(repository string, names []string) ([]Snapshot, error) {
+	if len(names) == 0 {
+		names = []string{"_all"}
+	}
+
+	r := Request{
+		Conn:   c,
+		method: "GET",
+		api:    "_snapshot/" + repository + "/" + strings.Join(names, ","),
+	}
+
+	raw, err := r.RunRaw()
+	if err != nil || raw == nil {
+		return nil, err
+	}
+
+	snapshots := struct {
+		Snapshots []Snapshot
+	}{}
+	err = c.decode(raw, &snapshots)
+
+	return snapshots.Snapshots, err
+}
+
+// SnapshotStatus fetches the progress of the snapshots called names of the
+// repository, of every running snapshot of the repository when names is empty
+func (c *Connection) SnapshotStatus(repository string, names []string) ([]SnapshotStatus, error) {
+	r := Request{
+		Conn:   c,
+		method: "GET",
+		api:    "_snapshot/" + repository + "/_status",
+	}
+
+	if len(names) > 0 {
+		r.api = "_snapshot/" + repository + "/" + strings.Join(names, ",") + "/_status"
+	}
+
+	raw, err := r.RunRaw()
+	if err != nil || raw == nil {
+		return nil, err
+	}
+
+	statuses := struct {
+		Snapshots []SnapshotStatus
+	}{}
+	err = c.decode(raw, &statuses)
+
+	return statuses.Snapshots, err
+}
+
+// DeleteSnapshot deletes a snapshot of the repository, or aborts it if it is
+// running
+func (c *Connection) DeleteSnapshot(repository string, name string) (Response, error) {
+	r := Request{
+		Conn:   c,
+		method: "DELETE",
+		api:    "_snapshot/" + repository + "/" + name,
+	}
+
+	return r.Run()
+}
+
+// Progress returns the fraction of the bytes already processed, between 0
+// and 1
+func (s SnapshotStats) Progress() float64 {
+	if s.TotalSizeInBytes == 0 {
+		return 0
+	}
+
+	return float64(s.ProcessedSizeInBytes) / float64(s.TotalSizeInBytes)
+}
+
+// snapshot executes a snapshot or a restore Request and returns the snapshot
+// of the response, or a Snapshot with only a name when the request does not
+// wait for completion
+func (req *Request) snapshot(name string) (Snapshot, error) {
+	raw, err := req.RunRaw()
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	resp := struct {
+		Snapshot *Snapshot
+		Accepted bool
+	}{}
+	if len(raw) > 0 {
+		if err := req.Conn.decode(raw, &resp); err != nil {
+			return Snapshot{}, err
+		}
+	}
+
+	if resp.Snapshot == nil {
+		return Snapshot{Snapshot: name}, nil
+	}
+
+	return *resp.Snapshot, nil
+}
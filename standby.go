@@ -0,0 +1,108 @@
+// Copyright 2013 Belogik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goes
+
+import (
+	"fmt"
+)
+
+// NewStandby creates the index shadow from definition, the body of a
+// CreateIndex call with the new settings and mappings. The writes then have to
+// go through the Standby, its BulkSend or the BulkProcessor and Indexer it
+// starts, until Promote is called:
+//
+//	standby, err := conn.NewStandby("tweets", "tweets_v2", definition)
+//	standby.BulkSend(documents) // as long as the migration lasts
+//	standby.Backfill()
+//	standby.Promote()
+func (c *Connection) NewStandby(alias string, shadow string, definition interface{}) (*Standby, error) {
+	if _, err := c.CreateIndex(shadow, definition); err != nil {
+		return nil, err
+	}
+
+	return &Standby{Conn: c, Alias: alias, Shadow: shadow}, nil
+}
+
+// BulkSend sends documents to the indices behind the alias, then to the
+// shadow index. The Response of the alias is returned, and an error when some
+// documents could not be written to the shadow index. Documents without an
+// Index are sent to the alias.
+func (s *Standby) BulkSend(documents []Document) (Response, error) {
+	for i := range documents {
+		if documents[i].Index == nil {
+			documents[i].Index = s.Alias
+		}
+	}
+
+	resp, err := s.Conn.BulkSend(s.Alias, documents)
+	if err != nil {
+		return resp, err
+	}
+
+	// BulkSend has set the generated ids in documents, the ids generated by
+	// elasticsearch are taken from the items so that Backfill does not copy
+	// these documents a second time
+	shadowed := make([]Document, len(documents))
+	for i, doc := range documents {
+		doc.Index = s.Shadow
+		if doc.Id == nil && len(resp.Items) == len(documents) {
+			for _, item := range resp.Items[i] {
+				if item.Id != "" {
+					doc.Id = item.Id
+				}
+			}
+		}
+		shadowed[i] = doc
+	}
+
+	shadowResp, err := s.Conn.BulkSend(s.Shadow, shadowed)
+	if err != nil {
+		return resp, err
+	}
+
+	if failed := shadowResp.Failed(); len(failed) > 0 {
+		return resp, fmt.Errorf("%d documents could not be written to %s, %s: %s", len(failed), s.Shadow, failed[0].Id, failed[0].Error.String())
+	}
+
+	return resp, nil
+}
+
+// NewBulkProcessor starts a BulkProcessor sending its documents with the
+// BulkSend of the Standby, to the alias and to the shadow index
+func (s *Standby) NewBulkProcessor(settings BulkProcessorSettings) *BulkProcessor {
+	return newBulkProcessor(settings, s.BulkSend)
+}
+
+// NewIndexer starts an Indexer sending its documents with the BulkSend of the
+// Standby, to the alias and to the shadow index
+func (s *Standby) NewIndexer(settings IndexerSettings) *Indexer {
+	return newIndexer(settings, s.NewBulkProcessor)
+}
+
+// Backfill copies into the shadow index the documents indexed behind the
+// alias before the Standby was created. Documents already written through the
+// Standby are not overwritten, but documents deleted while Backfill runs may
+// be copied back.
+func (s *Standby) Backfill() error {
+	return s.Conn.copyDocuments(s.Alias, s.Shadow, BULK_COMMAND_CREATE)
+}
+
+// Promote atomically points the alias to the shadow index instead of its
+// current indices, which are returned so they can be deleted
+func (s *Standby) Promote() ([]string, error) {
+	indices, err := s.Conn.aliasIndices(s.Alias)
+	if err != nil {
+		return nil, err
+	}
+
+	actions := aliasActions(ALIAS_ACTION_REMOVE, s.Alias, indices)
+	actions = append(actions, AliasAction{Action: ALIAS_ACTION_ADD, Index: s.Shadow, Alias: s.Alias})
+
+	if _, err := s.Conn.Aliases(actions); err != nil {
+		return nil, err
+	}
+
+	return indices, nil
+}
@@ -5,7 +5,14 @@
 package goes
 
 import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
 	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Represents a Connection object to elasticsearch
@@ -15,6 +22,174 @@ type Connection struct {
 
 	// The port to use
 	Port string
+
+	// Sends the requests, DefaultClient when nil. The connections sharing a
+	// client share its idle TCP connections.
+	Client *http.Client
+
+	// Finds the addresses of Host instead of the resolver of the system,
+	// the requests are then sent by a client shared by the connections with
+	// the same Resolver, which has to be comparable. Ignored when Client is
+	// set.
+	Resolver Resolver
+
+	// Decides how failed requests are handled, DefaultErrorPolicy is used
+	// when nil
+	ErrorPolicy ErrorPolicy
+
+	// How many times a request classified as ERROR_RETRYABLE is sent again
+	MaxRetries int
+
+	// Wait before sending a request again, doubled after each attempt up to
+	// MaxRetryBackoff, 100ms when 0
+	RetryBackoff time.Duration
+
+	// Longest wait between two attempts of a request, 5s when 0
+	MaxRetryBackoff time.Duration
+
+	// Cancel the server side tasks of a SearchContext call when its context
+	// is done, SearchContext fails with ErrUnsupported before elasticsearch
+	// 6.2 whose tasks do not have the X-Opaque-Id header
+	CancelTasks bool
+
+	// The version of the elasticsearch server (1.7.5, 5.6.16 ...), fetched by
+	// Supports when empty
+	Version string
+
+	// Called by Index, Create, Delete, BulkSend and BulkSendRaw with the
+	// writes they are about to send, to keep an audit trail. The writes are
+	// not sent when it fails.
+	AuditHook func(mutations []Mutation) error
+
+	// Keep the Fields and the Script of the documents in the mutations given
+	// to AuditHook, only the metadata is kept otherwise
+	AuditBodies bool
+
+	// Maximum size of the body of a _bulk request (http.max_content_length
+	// is 100mb by default), BulkSend splits bigger batches. 0 disables it.
+	MaxBulkBytes int
+
+	// Number of times BulkSend sends again the documents whose items failed
+	// because the cluster was overloaded (429) or a shard unavailable (503)
+	BulkItemRetries int
+
+	// Wait before sending the failed documents again, doubled after each
+	// attempt, 100ms when 0
+	BulkItemBackoff time.Duration
+
+	// Called by BulkSend with the documents whose items still failed after
+	// the retries
+	BulkItemFailed func(results []BulkResult)
+
+	// Called by BulkSend with the mapping conflicts found in the response,
+	// to diagnose documents whose fields drifted from the mapping
+	MappingConflictHook func(conflicts []MappingConflict)
+
+	// Called with the deprecation warnings elasticsearch sends with a
+	// response (5.0+), to find the deprecated APIs and queries in use before
+	// an upgrade removes them
+	DeprecationHook func(deprecations []Deprecation)
+
+	// Generates the ids of the documents indexed by Index, Create and
+	// BulkSend without an Id, elasticsearch generates them when nil
+	IdGenerator IdGenerator
+
+	// Fail the requests whose Response has fields the structs of the
+	// package do not model, to catch the changes of new versions of
+	// elasticsearch in tests instead of silently losing data
+	StrictDecoding bool
+
+	// Check the fields of the documents sent by Index and BulkSend against
+	// the mapping of their index, which is fetched once and cached
+	ValidateDocuments bool
+
+	// Refresh URL argument of Index, Create, Delete, BulkSend and BulkSendRaw
+	// unless given in their extraArgs, REFRESH_TRUE or REFRESH_WAIT_FOR to
+	// read the writes right away. No refresh is requested when empty.
+	RefreshWrites string
+
+	// The *connectionState, allocated on first use and shared by the copies
+	// of the Connection
+	state atomic.Value
+}
+
+// connectionState holds the locks and the caches of a Connection behind a
+// pointer, so that copying a Connection does not copy its locks
+type connectionState struct {
+	// Held while Version is fetched
+	versionLock sync.Mutex
+
+	// Cached mappings by index, type and field path
+	mappings     map[string]map[string]map[string]FieldDescriptor
+	mappingsLock sync.Mutex
+}
+
+// Represents how Run handles a failed request
+type ErrorClass int
+
+// An ErrorPolicy classifies failed requests using the HTTP status and the
+// error message returned by elasticsearch
+type ErrorPolicy interface {
+	Classify(statusCode uint64, msg string) ErrorClass
+}
+
+// An IdGenerator generates document ids on the client, they are then known
+// before elasticsearch answers and the same id is sent again on retries
+type IdGenerator interface {
+	NewId() string
+}
+
+// Represents an IdGenerator of random (version 4) UUIDs
+type UUIDGenerator struct{}
+
+// Represents an IdGenerator of ULIDs, which sort by creation time
+type ULIDGenerator struct{}
+
+// Represents an IdGenerator of 64 bits ids made of a timestamp, a node number
+// and a sequence, like Twitter's Snowflake. Each client has to use a
+// different Node, between 0 and 1023.
+type FlakeGenerator struct {
+	Node int64
+
+	lock     sync.Mutex
+	last     int64
+	sequence int64
+}
+
+// A Resolver finds the addresses of a host, *net.Resolver is one
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// Represents a Resolver caching the addresses it finds. The addresses of a
+// host are still used after TTL while it can not be resolved again.
+type CachingResolver struct {
+	// Resolves the hosts which are not cached, net.DefaultResolver when nil
+	Resolver Resolver
+
+	// How long the addresses are cached, 1 minute when 0
+	TTL time.Duration
+
+	lock  sync.Mutex
+	hosts map[string]resolvedHost
+}
+
+// Represents the addresses of a host cached by a CachingResolver
+type resolvedHost struct {
+	addrs   []string
+	expires time.Time
+}
+
+// Represents an ErrorPolicy based on lists of HTTP statuses and exception
+// names (IndexMissingException, VersionConflictEngineException ...)
+type StatusErrorPolicy struct {
+	Retryable           []uint64
+	RetryableExceptions []string
+
+	// Ignored errors return a zero Response and no error, for example to
+	// treat a 404 as "not found" rather than as a failure
+	Ignored           []uint64
+	IgnoredExceptions []string
 }
 
 // Represents a Request to elasticsearch
@@ -22,7 +197,8 @@ type Request struct {
 	// Which connection will be used
 	Conn *Connection
 
-	// A search query
+	// A search query. Strings, []byte, json.RawMessage and io.Reader are sent
+	// as is, anything else is encoded to JSON
 	Query interface{}
 
 	// Which index to search into
@@ -37,14 +213,23 @@ type Request struct {
 	// Which api keyword (_search, _bulk, etc) to use
 	api string
 
-	// Bulk data
-	bulkData []byte
+	// Documents sent to the _bulk API
+	bulkDocuments []Document
+
+	// Body sent to the _bulk API as is, instead of bulkDocuments
+	bulkBody io.Reader
 
 	// A list of extra URL arguments
 	ExtraArgs url.Values
 
 	// Used for the id field when indexing a document
 	id string
+
+	// Aborts the request when done
+	ctx context.Context
+
+	// Sent as the X-Opaque-Id header to find the tasks started by the request
+	opaqueId string
 }
 
 // Represents a Response from elasticsearch
@@ -57,25 +242,74 @@ type Response struct {
 	TimedOut     bool  `json:"timed_out"`
 	Shards       Shard `json:"_shards"`
 	Hits         Hits
+	ScrollId     string `json:"_scroll_id"`
 	Index        string `json:"_index"`
 	Id           string `json:"_id"`
 	Type         string `json:"_type"`
 	Version      int    `json:"_version"`
 	Found        bool
 
+	// Sequence number and primary term of the document written or fetched
+	// since 6.0
+	SeqNo       int64 `json:"_seq_no"`
+	PrimaryTerm int64 `json:"_primary_term"`
+
+	// Status and headers of the HTTP response, like 201 when a document is
+	// created
+	StatusCode int         `json:"-"`
+	Header     http.Header `json:"-"`
+
+	// Used by the index and delete APIs, one of the RESULT_* constants.
+	// Created and Found are set from it whatever the version.
+	Result  string
+	Created bool
+
+	// Used by the _search API, by aggregation name
+	Aggregations map[string]Aggregation `json:"aggregations"`
+
+	// Used by the _search API, by facet name
+	Facets map[string]Facet `json:"facets"`
+
 	// Used by the _stats API
 	All All `json:"_all"`
 
 	// Used by the _bulk API
-	Items []map[string]Item `json:"items,omitempty"`
+	Items  []map[string]Item `json:"items,omitempty"`
+	Errors bool
 
-	// Used by the GET API
-	Exists bool
-	Source map[string]interface{} `json:"_source"`
-	Fields map[string]interface{} `json:"fields"`
+	// Used by the GET API, RawSource is the _source as sent, which Unmarshal
+	// decodes without going through Source
+	Exists    bool
+	Source    map[string]interface{} `json:"_source"`
+	RawSource json.RawMessage        `json:"-"`
+	Fields    map[string]interface{} `json:"fields"`
+
+	// Set when the _source was not requested (SourceFilter.Disabled), a nil
+	// Source then does not mean the document has no _source
+	SourceExcluded bool `json:"-"`
 
 	// Used by the _status API
 	Indices map[string]IndexStatus
+
+	// Used by the _tasks API
+	Nodes map[string]Node
+
+	// Used by the / API
+	Name          string
+	ClusterName   string        `json:"cluster_name"`
+	ServerVersion ServerVersion `json:"version"`
+
+	// Used by the _termvectors API
+	TermVectors map[string]TermVector `json:"term_vectors"`
+
+	// Used by the _mget and _mtermvectors APIs
+	Docs []Response `json:"docs"`
+}
+
+// Represents the version of an elasticsearch server
+type ServerVersion struct {
+	Number        string
+	LuceneVersion string `json:"lucene_version"`
 }
 
 // Represents a document to send to elasticsearch
@@ -86,6 +320,56 @@ type Document struct {
 	Id          interface{}
 	BulkCommand string
 	Fields      map[string]interface{}
+
+	// Custom routing value, the _id is used by elasticsearch when empty
+	Routing string
+
+	// Id of the parent document, for types with a _parent mapping
+	Parent string
+
+	// Time to live of the document, like 1d, for types with a _ttl mapping
+	// (elasticsearch before 5.0)
+	TTL string
+
+	// Expected version of the document for optimistic concurrency control,
+	// not checked when 0
+	Version int64
+
+	// How Version is compared to the stored version, one of the
+	// VERSION_TYPE_* constants, internal when empty
+	VersionType string
+
+	// Script run by BULK_COMMAND_UPDATE, Fields is then the partial document
+	// merged into the stored one
+	Script interface{}
+
+	// Number of times BULK_COMMAND_UPDATE is retried on a version conflict
+	RetryOnConflict int
+
+	// Ingest pipeline run on the document before it is indexed
+	// (elasticsearch 5.0+)
+	Pipeline string
+}
+
+// Represents which parts of the _source are returned by a Get or a Search
+type SourceFilter struct {
+	// Do not return the _source at all
+	Disabled bool
+
+	// Fields (wildcards are allowed) to return, everything when empty
+	Includes []string
+
+	// Fields (wildcards are allowed) to leave out
+	Excludes []string
+}
+
+// Represents a field of a document which does not match the mapping of its
+// index, returned when Connection.ValidateDocuments is set
+type ValidationError struct {
+	Index  string
+	Type   string
+	Field  string
+	Reason string
 }
 
 // Represents the "items" field in a _bulk response
@@ -95,6 +379,68 @@ type Item struct {
 	Id      string `json:"_id"`
 	Index   string `json:"_index"`
 	Version int    `json:"_version"`
+
+	// Set when the command failed for this document
+	Status int       `json:"status"`
+	Error  BulkError `json:"error"`
+}
+
+// Represents the error of a bulk item, elasticsearch sends a string before
+// 5.0 which is stored in Reason
+type BulkError struct {
+	Type   string
+	Reason string
+}
+
+// Represents a deprecation warning sent in a Warning header of the response
+// to a request
+type Deprecation struct {
+	Method  string
+	Url     string
+	Message string
+}
+
+// Represents a write given to Connection.AuditHook before it is sent
+type Mutation struct {
+	Time time.Time
+
+	// One of the BULK_COMMAND_* constants
+	Command  string
+	Document Document
+}
+
+// Represents an item of a _bulk Response with the bulk command and the
+// position of the document in the request
+type BulkItem struct {
+	Position int
+	Command  string
+	Item
+}
+
+// Represents the documents of bulk requests rejected because a field did not
+// match the mapping of their index
+type MappingConflict struct {
+	Index string
+	Type  string
+	Field string
+
+	// Number of rejected documents
+	Count int
+
+	// Reason given for the first rejected document
+	Reason string
+}
+
+// Represents a document sent to the _bulk API and the item of the response
+// which concerns it
+type BulkResult struct {
+	Document Document
+	Command  string
+	Item     Item
+
+	// Set when BULK_COMMAND_CREATE failed because a document with the same id
+	// exists
+	Exists bool
 }
 
 // Represents the "_all" field when calling the _stats API
@@ -112,6 +458,9 @@ type StatPrimary struct {
 	// primary/docs:
 	Count   int
 	Deleted int
+
+	// primary/store:
+	SizeInBytes int `json:"size_in_bytes"`
 }
 
 // Represents the "shard" struct as returned by elasticsearch
@@ -119,6 +468,22 @@ type Shard struct {
 	Total      uint64
 	Successful uint64
 	Failed     uint64
+
+	// Shards a search skipped because they could not match (elasticsearch
+	// 6.0+)
+	Skipped uint64
+
+	// Why the Failed shards failed, the results only come from the
+	// Successful ones
+	Failures []ShardFailure
+}
+
+// Represents the failure of a shard
+type ShardFailure struct {
+	Index  string
+	Shard  int
+	Node   string
+	Reason ElasticError
 }
 
 // Represent a hit returned by a search
@@ -129,19 +494,310 @@ type Hit struct {
 	Score  float64                `json:"_score"`
 	Source map[string]interface{} `json:"_source"`
 	Fields map[string]interface{} `json:"fields"`
+
+	// The _source as sent, which Unmarshal decodes without going through
+	// Source
+	RawSource json.RawMessage `json:"-"`
+
+	// Highlighted fragments by field name, set when highlighting is requested
+	Highlight map[string][]string `json:"highlight"`
+
+	// Matching children or parent documents by name, set when inner_hits are
+	// requested in a has_child or a has_parent query
+	InnerHits map[string]InnerHits `json:"inner_hits"`
+
+	// Values the hit was sorted by, set when the search is sorted. They are
+	// given as search_after to get the next hits.
+	Sort []interface{} `json:"sort"`
+
+	// How the score was computed, set when the search is explained
+	Explanation *Explanation `json:"_explanation"`
+}
+
+// Represents the computation of a score, Value is computed from the Details
+type Explanation struct {
+	Value       float64
+	Description string
+	Details     []Explanation
+}
+
+// Represents the inner hits of a hit
+type InnerHits struct {
+	Hits Hits
+}
+
+// Represents a facet as returned by a search, the fields which are set depend
+// on the Type of the facet
+type Facet struct {
+	Type string `json:"_type"`
+
+	// terms facet
+	Missing uint64
+	Other   uint64
+	Terms   []FacetTerm
+
+	// statistical facet, Total is the number of terms for a terms facet
+	Count        uint64
+	Total        float64
+	Min          float64
+	Max          float64
+	Mean         float64
+	SumOfSquares float64 `json:"sum_of_squares"`
+	Variance     float64
+	StdDeviation float64 `json:"std_deviation"`
+
+	// histogram and date_histogram facets
+	Entries []FacetEntry
+}
+
+// Represents a term of a terms facet, Term is a float64 for numeric fields
+type FacetTerm struct {
+	Term  interface{}
+	Count uint64
+}
+
+// Represents an entry of a histogram (Key) or a date_histogram (Time) facet.
+// The statistics are only set when a value field is used.
+type FacetEntry struct {
+	Key        int64
+	Time       int64
+	Count      uint64
+	Min        float64
+	Max        float64
+	Total      float64
+	TotalCount uint64 `json:"total_count"`
+	Mean       float64
 }
 
 // Represent the hits structure as returned by elasticsearch
 type Hits struct {
 	Total uint64
+
+	// How Total relates to the number of matching documents, TOTAL_EQ or
+	// TOTAL_GTE when elasticsearch 7.0+ stopped counting them
+	TotalRelation string
+
 	// max_score may contain the "null" value
 	MaxScore interface{} `json:"max_score"`
 	Hits     []Hit
 }
 
+// Represents the metadata of a search decoded by SearchAs
+type SearchMeta struct {
+	Total         uint64
+	TotalRelation string
+	MaxScore      float64
+	Took          uint64
+	TimedOut      bool
+	Shards        Shard
+	ScrollId      string
+}
+
+// Represents an index which receives the same writes as the indices behind an
+// alias until it replaces them, to migrate to a new mapping without downtime
+type Standby struct {
+	Conn   *Connection
+	Alias  string
+	Shadow string
+}
+
+// Represents an action of an Aliases call, Action is one of ALIAS_ACTION_ADD
+// or ALIAS_ACTION_REMOVE. Filter and Routing are only used to add an alias.
+type AliasAction struct {
+	Action  string
+	Index   string
+	Alias   string
+	Filter  interface{}
+	Routing string
+}
+
+// Represents the result of a Rollover, Conditions tells which conditions
+// were met
+type RolloverResult struct {
+	Acknowledged       bool
+	ShardsAcknowledged bool   `json:"shards_acknowledged"`
+	OldIndex           string `json:"old_index"`
+	NewIndex           string `json:"new_index"`
+	RolledOver         bool   `json:"rolled_over"`
+	DryRun             bool   `json:"dry_run"`
+	Conditions         map[string]bool
+}
+
+// Represents when a BulkProcessor sends its documents, every setting left to
+// 0 is ignored
+type BulkProcessorSettings struct {
+	// Number of documents
+	MaxDocuments int
+
+	// Size of the body of the _bulk request
+	MaxBytes int
+
+	// Time since the last automatic flush
+	FlushInterval time.Duration
+
+	// Number of _bulk requests sent at the same time, 1 when 0
+	Workers int
+
+	// Called before each _bulk request with the documents to send
+	BeforeFlush func(documents []Document)
+
+	// Called after each _bulk request with the documents which were sent,
+	// Response.BulkResults gives the documents which were rejected
+	AfterFlush func(documents []Document, response Response, err error)
+}
+
+// Represents a buffer of documents sent with BulkSend once it is full or at a
+// regular interval
+type BulkProcessor struct {
+	bulkSend func(documents []Document) (Response, error)
+	settings BulkProcessorSettings
+
+	lock      sync.Mutex
+	documents []Document
+	size      int
+	inFlight  int
+	flushed   *sync.Cond
+	closed    bool
+
+	batches chan []Document
+	stop    chan struct{}
+	ticking sync.WaitGroup
+	working sync.WaitGroup
+}
+
+// Represents how an Indexer sends its documents
+type IndexerSettings struct {
+	// Number of goroutines, each one with its own bulk buffer, 1 when 0
+	Workers int
+
+	// Number of documents waiting for a worker before Add blocks
+	QueueSize int
+
+	// When each worker sends its buffer, Workers is ignored. The hooks are
+	// called from every worker at the same time.
+	Bulk BulkProcessorSettings
+}
+
+// Represents a pool of workers sending the documents added to it with
+// BulkSend
+type Indexer struct {
+	settings IndexerSettings
+
+	lock      sync.RWMutex
+	closed    bool
+	documents chan Document
+	working   sync.WaitGroup
+}
+
+// Represents a sequence of requests which reads its own writes: the indices it
+// recently wrote to are refreshed before it searches them
+type Session struct {
+	Conn *Connection
+
+	// Time after which a write is expected to be visible thanks to the
+	// refresh_interval of the index
+	Window time.Duration
+
+	lock sync.Mutex
+
+	// Last write by index
+	writes map[string]time.Time
+}
+
+// Represents what a service needs from elasticsearch, verified by SelfCheck
+type Requirements struct {
+	// Versions of elasticsearch the service works with, any when empty
+	Versions VersionRange
+
+	// Indices or aliases which have to exist
+	Indices []string
+
+	// Index templates which have to exist
+	Templates []string
+
+	// Indices in which a temporary document is indexed then deleted
+	WritableIndices []string
+
+	// Type of the temporary document, "_doc" from elasticsearch 6.2 and
+	// "selfcheck" before when empty
+	WriteType string
+}
+
+// Represents the result of SelfCheck, ready to be returned by a health endpoint
+type SelfCheckReport struct {
+	Ok     bool    `json:"ok"`
+	Checks []Check `json:"checks"`
+}
+
+// Represents a requirement verified by SelfCheck
+type Check struct {
+	Name  string `json:"name"`
+	Ok    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// Represents a page of hits returned by Paginate
+type Page struct {
+	Hits          []Hit
+	Total         uint64
+	TotalRelation string
+	Page          int
+	PerPage       int
+
+	// Number of pages which can be fetched
+	Pages       int
+	HasNext     bool
+	HasPrevious bool
+
+	// Milliseconds the search took, the hits are partial when it TimedOut or
+	// some Shards failed
+	Took     uint64
+	TimedOut bool
+	Shards   Shard
+}
+
 type SearchError struct {
 	Msg        string
 	StatusCode uint64
+
+	// The error parsed from Msg, given to errors.As by Unwrap
+	elastic *ElasticError
+}
+
+// Represents an error answered by elasticsearch, Msg is the error as sent and
+// the other fields are parsed from it when it has the usual format. The calls
+// return a SearchError, the ElasticError is found behind it with errors.As.
+type ElasticError struct {
+	HTTPStatus int
+	Msg        string
+
+	// Like index_not_found_exception, or IndexMissingException before 2.0
+	ErrorType string
+	Reason    string
+
+	// Index the error is about, when there is one
+	Index string
+
+	// Error which caused this one, when elasticsearch reports it
+	CausedBy *ElasticError
+}
+
+// Represents the rejection by Index or Delete of a document whose version does
+// not match the stored one, the write can be retried with a fresh version
+type VersionConflictError struct {
+	Index   interface{}
+	Type    string
+	Id      interface{}
+	Version int64
+	*ElasticError
+}
+
+// Represents the rejection by Create of a document whose id is already taken
+type DocumentExistsError struct {
+	Index interface{}
+	Type  string
+	Id    interface{}
+	*ElasticError
 }
 
 // Represent the status for a given index for the _status command
@@ -159,3 +815,511 @@ type IndexStatus struct {
 
 	// TODO: add shards support later, we do not need it for the moment
 }
+
+// Represents the segments of a copy of a shard as returned by Segments
+type ShardSegments struct {
+	Shard                int
+	Routing              ShardRouting
+	NumCommittedSegments int `json:"num_committed_segments"`
+	NumSearchSegments    int `json:"num_search_segments"`
+
+	// Segments by name
+	Segments map[string]Segment
+}
+
+// Represents where a copy of a shard is allocated, Index and Shard are only
+// set in a ClusterState
+type ShardRouting struct {
+	State          string
+	Primary        bool
+	Node           string
+	RelocatingNode string `json:"relocating_node"`
+	Index          string
+	Shard          int
+}
+
+// Represents a Lucene segment. A segment is Committed once it is fsynced to
+// disk and Search once it is visible to searches.
+type Segment struct {
+	Generation    int
+	NumDocs       uint64 `json:"num_docs"`
+	DeletedDocs   uint64 `json:"deleted_docs"`
+	SizeInBytes   uint64 `json:"size_in_bytes"`
+	MemoryInBytes uint64 `json:"memory_in_bytes"`
+	Committed     bool
+	Search        bool
+	Version       string
+	Compound      bool
+}
+
+// Represents the recovery of a copy of a shard as returned by Recovery. The
+// Type is one of GATEWAY (STORE before elasticsearch 2.0), SNAPSHOT, REPLICA
+// or RELOCATION and the Stage one of INIT, INDEX, START (VERIFY_INDEX and
+// TRANSLOG from 2.0), FINALIZE or DONE.
+type ShardRecovery struct {
+	Id                int
+	Type              string
+	Stage             string
+	Primary           bool
+	StartTimeInMillis uint64 `json:"start_time_in_millis"`
+	StopTimeInMillis  uint64 `json:"stop_time_in_millis"`
+	TotalTimeInMillis uint64 `json:"total_time_in_millis"`
+	Source            RecoveryNode
+	Target            RecoveryNode
+	Index             RecoveryIndex
+}
+
+// Represents the source or the target node of a recovery
+type RecoveryNode struct {
+	Id               string
+	Host             string
+	TransportAddress string `json:"transport_address"`
+	Ip               string
+	Name             string
+}
+
+// Represents the files and bytes copied by a recovery
+type RecoveryIndex struct {
+	Files             RecoveryProgress
+	Bytes             RecoveryProgress
+	TotalTimeInMillis uint64
+}
+
+// Represents the progress of a recovery, Percent is between 0 and 100
+type RecoveryProgress struct {
+	Total     uint64
+	Reused    uint64
+	Recovered uint64
+	Percent   float64
+}
+
+// Represents a node as returned by the _nodes and _tasks APIs
+type Node struct {
+	Name             string
+	TransportAddress string `json:"transport_address"`
+	Host             string
+	Ip               string
+	Version          string
+	Attributes       map[string]string
+
+	// Used by the _nodes API, depending on the requested metrics
+	Settings map[string]interface{}
+	Os       map[string]interface{}
+	Process  map[string]interface{}
+	Jvm      map[string]interface{}
+
+	// Used by the _tasks API
+	Tasks map[string]Task
+}
+
+// Represents the statistics of a node as returned by NodesStats, only the
+// requested metrics are set
+type NodeStats struct {
+	Name             string
+	TransportAddress string `json:"transport_address"`
+	Host             string
+	Timestamp        uint64
+	Indices          NodeIndicesStats
+	Os               NodeOsStats
+	Process          NodeProcessStats
+	Jvm              NodeJvmStats
+}
+
+// Represents the statistics of the shards allocated to a node
+type NodeIndicesStats struct {
+	Docs struct {
+		Count   uint64
+		Deleted uint64
+	}
+	Store struct {
+		SizeInBytes uint64 `json:"size_in_bytes"`
+	}
+	Indexing struct {
+		IndexTotal        uint64 `json:"index_total"`
+		IndexTimeInMillis uint64 `json:"index_time_in_millis"`
+		DeleteTotal       uint64 `json:"delete_total"`
+	}
+	Search struct {
+		QueryTotal        uint64 `json:"query_total"`
+		QueryTimeInMillis uint64 `json:"query_time_in_millis"`
+		FetchTotal        uint64 `json:"fetch_total"`
+	}
+	Fielddata struct {
+		MemorySizeInBytes uint64 `json:"memory_size_in_bytes"`
+		Evictions         uint64
+	}
+	Segments struct {
+		Count         uint64
+		MemoryInBytes uint64 `json:"memory_in_bytes"`
+	}
+}
+
+// Represents the memory statistics of the operating system of a node
+type NodeOsStats struct {
+	Mem struct {
+		TotalInBytes uint64 `json:"total_in_bytes"`
+		FreeInBytes  uint64 `json:"free_in_bytes"`
+		UsedInBytes  uint64 `json:"used_in_bytes"`
+		FreePercent  int    `json:"free_percent"`
+		UsedPercent  int    `json:"used_percent"`
+	}
+}
+
+// Represents the statistics of the process of a node
+type NodeProcessStats struct {
+	OpenFileDescriptors int64 `json:"open_file_descriptors"`
+	MaxFileDescriptors  int64 `json:"max_file_descriptors"`
+	Cpu                 struct {
+		Percent       int
+		TotalInMillis uint64 `json:"total_in_millis"`
+	}
+}
+
+// Represents the statistics of the JVM of a node, the garbage Collectors
+// (young, old ...) by name
+type NodeJvmStats struct {
+	UptimeInMillis uint64 `json:"uptime_in_millis"`
+	Mem            struct {
+		HeapUsedInBytes      uint64 `json:"heap_used_in_bytes"`
+		HeapUsedPercent      int    `json:"heap_used_percent"`
+		HeapCommittedInBytes uint64 `json:"heap_committed_in_bytes"`
+		HeapMaxInBytes       uint64 `json:"heap_max_in_bytes"`
+		NonHeapUsedInBytes   uint64 `json:"non_heap_used_in_bytes"`
+	}
+	Threads struct {
+		Count     int
+		PeakCount int `json:"peak_count"`
+	}
+	Gc struct {
+		Collectors map[string]struct {
+			CollectionCount        uint64 `json:"collection_count"`
+			CollectionTimeInMillis uint64 `json:"collection_time_in_millis"`
+		}
+	}
+}
+
+// Represents the health of a cluster as returned by the _cluster/health API
+type ClusterHealth struct {
+	ClusterName         string `json:"cluster_name"`
+	Status              string
+	TimedOut            bool `json:"timed_out"`
+	NumberOfNodes       int  `json:"number_of_nodes"`
+	NumberOfDataNodes   int  `json:"number_of_data_nodes"`
+	ActivePrimaryShards int  `json:"active_primary_shards"`
+	ActiveShards        int  `json:"active_shards"`
+	RelocatingShards    int  `json:"relocating_shards"`
+	InitializingShards  int  `json:"initializing_shards"`
+	UnassignedShards    int  `json:"unassigned_shards"`
+}
+
+// Represents the settings of a cluster, Transient settings are lost when the
+// cluster restarts
+type ClusterSettings struct {
+	Persistent map[string]interface{} `json:"persistent,omitempty"`
+	Transient  map[string]interface{} `json:"transient,omitempty"`
+}
+
+// Represents the state of a cluster as returned by ClusterState, only the
+// requested metrics are set
+type ClusterState struct {
+	ClusterName string `json:"cluster_name"`
+	Version     int64
+	StateUuid   string `json:"state_uuid"`
+	MasterNode  string `json:"master_node"`
+
+	// Blocks of the cluster and of the indices (read_only ...) by level
+	Blocks map[string]interface{}
+
+	// Nodes by id
+	Nodes map[string]Node
+
+	Metadata     ClusterMetadata
+	RoutingTable ClusterRoutingTable `json:"routing_table"`
+}
+
+// Represents the metadata of a cluster, its settings, templates and indices
+type ClusterMetadata struct {
+	ClusterUuid string `json:"cluster_uuid"`
+	Templates   map[string]map[string]interface{}
+	Indices     map[string]IndexMetadata
+}
+
+// Represents the metadata of an index, its State is open or close
+type IndexMetadata struct {
+	State    string
+	Settings map[string]interface{}
+	Mappings map[string]interface{}
+	Aliases  []string
+}
+
+// Represents the allocation of the shards of the indices of a cluster
+type ClusterRoutingTable struct {
+	Indices map[string]IndexRoutingTable
+}
+
+// Represents the allocation of the shards of an index, the copies of each
+// shard by shard number
+type IndexRoutingTable struct {
+	Shards map[string][]ShardRouting
+}
+
+// Represents a cluster state change queued on the master node, the Priority
+// is one of IMMEDIATE, URGENT, HIGH, NORMAL, LOW or LANGUID
+type PendingTask struct {
+	InsertOrder       uint64 `json:"insert_order"`
+	Priority          string
+	Source            string
+	TimeInQueueMillis uint64 `json:"time_in_queue_millis"`
+	TimeInQueue       string `json:"time_in_queue"`
+	Executing         bool
+}
+
+// Represents a row of _cat/indices, the sizes are in bytes
+type CatIndex struct {
+	Health       string
+	Status       string
+	Index        string
+	Uuid         string
+	Pri          int    `json:"pri,string"`
+	Rep          int    `json:"rep,string"`
+	DocsCount    uint64 `json:"docs.count,string"`
+	DocsDeleted  uint64 `json:"docs.deleted,string"`
+	StoreSize    uint64 `json:"store.size,string"`
+	PriStoreSize uint64 `json:"pri.store.size,string"`
+}
+
+// Represents a row of _cat/shards, Prirep is p for a primary and r for a
+// replica. The Docs and the Store (in bytes) of unassigned shards are 0.
+type CatShard struct {
+	Index  string
+	Shard  int    `json:"shard,string"`
+	Prirep string `json:"prirep"`
+	State  string
+	Docs   uint64 `json:"docs,string"`
+	Store  uint64 `json:"store,string"`
+	Ip     string
+	Node   string
+}
+
+// Represents a row of _cat/nodes, Master is * for the elected master and
+// NodeRole holds the roles (m, d, i ...) of the node
+type CatNode struct {
+	Name        string
+	Ip          string
+	HeapPercent int    `json:"heap.percent,string"`
+	RamPercent  int    `json:"ram.percent,string"`
+	NodeRole    string `json:"node.role"`
+	Master      string
+}
+
+// Represents a row of _cat/allocation, the sizes are in bytes. The Node of the
+// unassigned shards is UNASSIGNED.
+type CatAllocation struct {
+	Shards      int    `json:"shards,string"`
+	DiskIndices uint64 `json:"disk.indices,string"`
+	DiskUsed    uint64 `json:"disk.used,string"`
+	DiskAvail   uint64 `json:"disk.avail,string"`
+	DiskTotal   uint64 `json:"disk.total,string"`
+	DiskPercent int    `json:"disk.percent,string"`
+	Host        string
+	Ip          string
+	Node        string
+}
+
+// Represents a row of _cat/thread_pool, a thread pool of a node
+type CatThreadPool struct {
+	NodeName string `json:"node_name"`
+	Name     string
+	Active   int    `json:"active,string"`
+	Queue    int    `json:"queue,string"`
+	Rejected uint64 `json:"rejected,string"`
+}
+
+// Represents a document transformed by SimulatePipeline, only Error is set
+// when the pipeline failed
+type PipelineResult struct {
+	Index  string                 `json:"_index"`
+	Type   string                 `json:"_type"`
+	Id     string                 `json:"_id"`
+	Source map[string]interface{} `json:"_source"`
+
+	// Metadata added by the ingest node (timestamp ...)
+	Ingest map[string]interface{} `json:"_ingest"`
+
+	Error *BulkError
+}
+
+// Represents a task running on a node
+type Task struct {
+	Node               string
+	Id                 uint64
+	Type               string
+	Action             string
+	Description        string
+	StartTimeInMillis  uint64 `json:"start_time_in_millis"`
+	RunningTimeInNanos uint64 `json:"running_time_in_nanos"`
+	Cancellable        bool
+	Headers            map[string]string
+
+	// Id (node:id) of the task which started this one
+	ParentTaskId string `json:"parent_task_id"`
+
+	// Progress of the task, reported by some actions (reindex,
+	// delete_by_query ...) when detailed is requested
+	Status map[string]interface{}
+}
+
+// Represents the term vector of a field as returned by the _termvectors API
+type TermVector struct {
+	FieldStatistics FieldStatistics `json:"field_statistics"`
+	Terms           map[string]TermStatistics
+}
+
+// Represents the statistics of a field in a term vector
+type FieldStatistics struct {
+	SumDocFreq uint64 `json:"sum_doc_freq"`
+	DocCount   uint64 `json:"doc_count"`
+	SumTtf     uint64 `json:"sum_ttf"`
+}
+
+// Represents the statistics of a term in a term vector, DocFreq and Ttf are
+// only set when term_statistics is requested
+type TermStatistics struct {
+	DocFreq  uint64 `json:"doc_freq"`
+	Ttf      uint64 `json:"ttf"`
+	TermFreq uint64 `json:"term_freq"`
+	Tokens   []Token
+}
+
+// Represents an occurrence of a term, Token and Type are only set by Analyze
+type Token struct {
+	Token       string
+	Type        string
+	Position    int
+	StartOffset int `json:"start_offset"`
+	EndOffset   int `json:"end_offset"`
+	Payload     string
+}
+
+// Represents the analysis chain used by Analyze, either an Analyzer or a
+// Tokenizer with Filters and CharFilters. The analyzer of Field is used when
+// Field is set.
+type Analyzer struct {
+	Analyzer    string
+	Tokenizer   string
+	Filters     []string
+	CharFilters []string
+	Field       string
+}
+
+// Represents a warmer as returned by GetWarmer, Source is the search
+type Warmer struct {
+	Types  []string
+	Source map[string]interface{}
+}
+
+// Represents a snapshot repository, Settings depend on the Type (fs, url,
+// s3 ...)
+type Repository struct {
+	Type     string                 `json:"type"`
+	Settings map[string]interface{} `json:"settings,omitempty"`
+}
+
+// Represents a snapshot as returned by the _snapshot API. The State
+// (IN_PROGRESS, SUCCESS, PARTIAL, FAILED ...) is empty when the snapshot or
+// restore did not wait for completion. A restore only sets Snapshot, Indices
+// and Shards.
+type Snapshot struct {
+	Snapshot          string
+	Indices           []string
+	State             string
+	StartTimeInMillis uint64 `json:"start_time_in_millis"`
+	EndTimeInMillis   uint64 `json:"end_time_in_millis"`
+	DurationInMillis  uint64 `json:"duration_in_millis"`
+	Failures          []SnapshotFailure
+	Shards            Shard
+}
+
+// Represents the failure of a shard in a snapshot
+type SnapshotFailure struct {
+	Index   string
+	ShardId int    `json:"shard_id"`
+	NodeId  string `json:"node_id"`
+	Reason  string
+	Status  string
+}
+
+// Represents the progress of a snapshot as returned by SnapshotStatus
+type SnapshotStatus struct {
+	Snapshot    string
+	Repository  string
+	State       string
+	ShardsStats SnapshotShardsStats `json:"shards_stats"`
+	Stats       SnapshotStats
+	Indices     map[string]SnapshotIndexStatus
+}
+
+// Represents the progress of the snapshot of an index, Shards are keyed by
+// shard number
+type SnapshotIndexStatus struct {
+	ShardsStats SnapshotShardsStats `json:"shards_stats"`
+	Stats       SnapshotStats
+	Shards      map[string]SnapshotShardStatus
+}
+
+// Represents the progress of the snapshot of a shard, Stage is one of INIT,
+// STARTED, FINALIZE, DONE or FAILURE
+type SnapshotShardStatus struct {
+	Stage  string
+	Stats  SnapshotStats
+	NodeId string `json:"node"`
+	Reason string
+}
+
+// Represents the number of shards by stage of a snapshot
+type SnapshotShardsStats struct {
+	Initializing int
+	Started      int
+	Finalizing   int
+	Done         int
+	Failed       int
+	Total        int
+}
+
+// Represents the files and bytes processed by a snapshot
+type SnapshotStats struct {
+	NumberOfFiles        uint64 `json:"number_of_files"`
+	ProcessedFiles       uint64 `json:"processed_files"`
+	TotalSizeInBytes     uint64 `json:"total_size_in_bytes"`
+	ProcessedSizeInBytes uint64 `json:"processed_size_in_bytes"`
+	StartTimeInMillis    uint64 `json:"start_time_in_millis"`
+	TimeInMillis         uint64 `json:"time_in_millis"`
+}
+
+// Represents an index as returned by DescribeIndex
+type IndexDescriptor struct {
+	Name string
+
+	// Flat settings (index.number_of_shards ...)
+	Settings map[string]interface{}
+
+	// Fields of every type of the index
+	Fields []FieldDescriptor
+
+	// Primary shards statistics
+	DocsCount   int
+	DocsDeleted int
+	SizeInBytes int
+}
+
+// Represents a field of a mapping, Path is the dotted path of the field
+// (user.name, message.raw ...)
+type FieldDescriptor struct {
+	DocumentType   string
+	Path           string
+	Type           string
+	Index          string
+	Analyzer       string
+	IndexAnalyzer  string
+	SearchAnalyzer string
+}
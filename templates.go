@@ -0,0 +1,67 @@
+// Copyright 2013 Belogik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goes
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// PutTemplate creates or replaces the index template called name. The
+// template holds the pattern of the names of the indices it applies to and the
+// settings and mappings they get when created:
+//
+//	conn.PutTemplate("logs", map[string]interface{}{
+//		"template": "logs-*",
+//		"settings": map[string]interface{}{"number_of_shards": 1},
+//		"mappings": mappings,
+//	})
+func (c *Connection) PutTemplate(name string, template interface{}) (Response, error) {
+	r := Request{
+		Conn:   c,
+		Query:  template,
+		method: "PUT",
+		api:    "_template/" + name,
+	}
+
+	return r.Run()
+}
+
+// GetTemplate fetches the index templates called names, all of them when names
+// is empty, by name. Missing templates are not returned.
+func (c *Connection) GetTemplate(names []string) (map[string]map[string]interface{}, error) {
+	r := Request{
+		Conn:   c,
+		method: "GET",
+		api:    "_template/" + strings.Join(names, ","),
+	}
+
+	raw, err := r.RunRaw()
+	if searchErr, ok := searchError(err); ok && searchErr.StatusCode == 404 {
+		raw, err = []byte("{}"), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// elasticsearch 1.x answers {} for missing templates
+	templates := map[string]map[string]interface{}{}
+	if len(raw) > 0 {
+		err = json.Unmarshal(raw, &templates)
+	}
+
+	return templates, err
+}
+
+// DeleteTemplate deletes the index template called name
+func (c *Connection) DeleteTemplate(name string) (Response, error) {
+	r := Request{
+		Conn:   c,
+		method: "DELETE",
+		api:    "_template/" + name,
+	}
+
+	return r.Run()
+}
@@ -0,0 +1,174 @@
+// Copyright 2013 Belogik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goes
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+func (err *ValidationError) Error() string {
+	return fmt.Sprintf("%s/%s: field %s: %s", err.Index, err.Type, err.Field, err.Reason)
+}
+
+// InvalidateMapping drops the mapping of an index cached to validate documents,
+// it has to be called when the mapping is changed
+func (c *Connection) InvalidateMapping(index string) {
+	state := c.shared()
+	state.mappingsLock.Lock()
+	defer state.mappingsLock.Unlock()
+
+	delete(state.mappings, index)
+}
+
+// validateDocument checks the fields of d against the mapping of its type in
+// index. Documents of types without a mapping are not checked.
+func (c *Connection) validateDocument(index string, d Document) error {
+	mapping, err := c.cachedMapping(index)
+	if err != nil {
+		return err
+	}
+
+	fields, ok := mapping[d.Type]
+	if !ok {
+		return nil
+	}
+
+	for name, value := range d.Fields {
+		if err := validateField(fields, name, value); err != nil {
+			err.Index = index
+			err.Type = d.Type
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateField checks the value of the field at path against the fields of a
+// mapping
+func validateField(fields map[string]FieldDescriptor, path string, value interface{}) *ValidationError {
+	if value == nil {
+		return nil
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		for i := 0; i < v.Len(); i++ {
+			if err := validateField(fields, path, v.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	f, ok := fields[path]
+
+	// objects are maps with string keys, of any type of value
+	if v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String && !ok {
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := validateField(fields, path+"."+iter.Key().String(), iter.Value().Interface()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if !ok {
+		return &ValidationError{Field: path, Reason: "not in the mapping"}
+	}
+
+	if !matchesType(f.Type, v) {
+		return &ValidationError{Field: path, Reason: fmt.Sprintf("%T value for a %s field", value, f.Type)}
+	}
+
+	return nil
+}
+
+// matchesType checks if a value can be stored in a field of type fieldType,
+// unknown types accept anything
+func matchesType(fieldType string, v reflect.Value) bool {
+	isNumber := false
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		isNumber = true
+	}
+
+	if _, ok := v.Interface().(json.Number); ok {
+		isNumber = true
+	}
+
+	switch fieldType {
+	case "string", "text", "keyword":
+		return v.Kind() == reflect.String
+	case "long", "integer", "short", "byte", "double", "float", "half_float", "scaled_float":
+		return isNumber
+	case "boolean":
+		return v.Kind() == reflect.Bool
+	case "date":
+		return isNumber || v.Kind() == reflect.String
+	}
+
+	return true
+}
+
+// cachedMapping returns the fields of the mapping of an index by type and
+// path, the mapping is fetched on first use. A missing index is cached
+// without any type until InvalidateMapping is called.
+func (c *Connection) cachedMapping(index string) (map[string]map[string]FieldDescriptor, error) {
+	state := c.shared()
+	state.mappingsLock.Lock()
+	defer state.mappingsLock.Unlock()
+
+	if mapping, ok := state.mappings[index]; ok {
+		return mapping, nil
+	}
+
+	r := Request{
+		Conn:      c,
+		IndexList: []string{index},
+		method:    "GET",
+		api:       "_mapping",
+	}
+
+	mapping := map[string]map[string]FieldDescriptor{}
+
+	raw, err := r.RunRaw()
+	if searchErr, ok := searchError(err); ok && searchErr.StatusCode == 404 {
+		// the index will be created with a dynamic mapping
+		state.cacheMapping(index, mapping)
+		return mapping, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fields, err := mappingFields(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range fields {
+		if mapping[f.DocumentType] == nil {
+			mapping[f.DocumentType] = map[string]FieldDescriptor{}
+		}
+		mapping[f.DocumentType][f.Path] = f
+	}
+
+	state.cacheMapping(index, mapping)
+	return mapping, nil
+}
+
+// cacheMapping stores the mapping of an index, mappingsLock has to be held
+func (s *connectionState) cacheMapping(index string, mapping map[string]map[string]FieldDescriptor) {
+	if s.mappings == nil {
+		s.mappings = map[string]map[string]map[string]FieldDescriptor{}
+	}
+	s.mappings[index] = mapping
+}
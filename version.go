@@ -0,0 +1,249 @@
+// Copyright 2013 Belogik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	FEATURE_MORE_LIKE_THIS_API = "more_like_this_api"
+	FEATURE_STATUS_API         = "status_api"
+	FEATURE_TERM_VECTORS       = "term_vectors"
+	FEATURE_SOURCE_FILTERING   = "source_filtering"
+	FEATURE_SOURCE_INCLUDES    = "source_includes"
+	FEATURE_SEARCH_TYPE_SCAN   = "search_type_scan"
+	FEATURE_SEARCH_TYPE_COUNT  = "search_type_count"
+	FEATURE_TASKS_API          = "tasks_api"
+	FEATURE_OPAQUE_ID          = "opaque_id"
+	FEATURE_OK_FIELD           = "ok_field"
+	FEATURE_DELETE_QUERY_API   = "delete_query_api"
+	FEATURE_DELETE_BY_QUERY    = "delete_by_query_api"
+	FEATURE_CLONE_API          = "clone_api"
+	FEATURE_TTL                = "ttl"
+	FEATURE_PARENT             = "parent"
+	FEATURE_TYPES_EXISTS_API   = "types_exists_api"
+	FEATURE_ANALYZE_BODY       = "analyze_body"
+	FEATURE_FORCEMERGE_API     = "forcemerge_api"
+	FEATURE_ROLLOVER_API       = "rollover_api"
+	FEATURE_WARMERS            = "warmers"
+	FEATURE_DELETE_MAPPING     = "delete_mapping"
+	FEATURE_INGEST             = "ingest"
+	FEATURE_SLICED_SCROLL      = "sliced_scroll"
+
+	FEATURE_WAIT_FOR_NO_RELOCATING_SHARDS = "wait_for_no_relocating_shards"
+	FEATURE_BULK_PLAIN_METADATA           = "bulk_plain_metadata"
+)
+
+// ErrUnsupported is matched with errors.Is by the errors of the calls needing
+// a feature the elasticsearch server does not support
+var ErrUnsupported = errors.New("not supported")
+
+// Represents the versions of elasticsearch supporting a feature, From is
+// inclusive and Until exclusive. An empty bound is unbounded.
+type VersionRange struct {
+	From  string
+	Until string
+}
+
+// Features lists the versions supporting each feature
+var Features = map[string]VersionRange{
+	FEATURE_MORE_LIKE_THIS_API: {"", "2.0.0"},
+	FEATURE_STATUS_API:         {"", "2.0.0"},
+	FEATURE_TERM_VECTORS:       {"1.0.0", ""},
+	FEATURE_SOURCE_FILTERING:   {"1.0.0", ""},
+	FEATURE_SOURCE_INCLUDES:    {"6.6.0", ""},
+	FEATURE_SEARCH_TYPE_SCAN:   {"", "5.0.0"},
+	FEATURE_SEARCH_TYPE_COUNT:  {"", "5.0.0"},
+	FEATURE_TASKS_API:          {"2.3.0", ""},
+	FEATURE_OPAQUE_ID:          {"6.2.0", ""},
+	FEATURE_OK_FIELD:           {"", "1.0.0"},
+	FEATURE_DELETE_QUERY_API:   {"", "2.0.0"},
+	FEATURE_DELETE_BY_QUERY:    {"5.0.0", ""},
+	FEATURE_CLONE_API:          {"7.4.0", ""},
+	FEATURE_TTL:                {"", "5.0.0"},
+	FEATURE_PARENT:             {"", "7.0.0"},
+	FEATURE_TYPES_EXISTS_API:   {"5.0.0", ""},
+	FEATURE_ANALYZE_BODY:       {"5.0.0", ""},
+	FEATURE_FORCEMERGE_API:     {"2.1.0", ""},
+	FEATURE_ROLLOVER_API:       {"5.0.0", ""},
+	FEATURE_WARMERS:            {"", "5.0.0"},
+	FEATURE_DELETE_MAPPING:     {"", "2.0.0"},
+	FEATURE_INGEST:             {"5.0.0", ""},
+	FEATURE_SLICED_SCROLL:      {"5.0.0", ""},
+
+	FEATURE_WAIT_FOR_NO_RELOCATING_SHARDS: {"5.0.0", ""},
+	FEATURE_BULK_PLAIN_METADATA:           {"7.0.0", ""},
+}
+
+// Contains checks if version is in the range
+func (r VersionRange) Contains(version string) bool {
+	if r.From != "" && compareVersions(version, r.From) < 0 {
+		return false
+	}
+
+	if r.Until != "" && compareVersions(version, r.Until) >= 0 {
+		return false
+	}
+
+	return true
+}
+
+// Supports checks if the elasticsearch server supports feature. The version of
+// the server is fetched on the first call unless Version is set.
+func (c *Connection) Supports(feature string) (bool, error) {
+	r, ok := Features[feature]
+	if !ok {
+		return false, fmt.Errorf("unknown feature %s", feature)
+	}
+
+	return c.InVersions(r)
+}
+
+// InVersions checks if the version of the elasticsearch server is in r, for
+// the features which are not in Features
+func (c *Connection) InVersions(r VersionRange) (bool, error) {
+	version, err := c.serverVersion()
+	if err != nil {
+		return false, err
+	}
+
+	return r.Contains(version), nil
+}
+
+// require returns an error if feature is not supported by the server. Nothing
+// is checked when the version of the server can not be found, the server will
+// report the error itself.
+func (c *Connection) require(feature string) error {
+	return c.requireContext(context.Background(), feature)
+}
+
+// requireContext is require, the version of the server being fetched with ctx
+func (c *Connection) requireContext(ctx context.Context, feature string) error {
+	r, ok := Features[feature]
+	if !ok {
+		return fmt.Errorf("unknown feature %s", feature)
+	}
+
+	version, err := c.serverVersionContext(ctx)
+	if err == nil && !r.Contains(version) {
+		return fmt.Errorf("%s is %w by elasticsearch %s", feature, ErrUnsupported, version)
+	}
+
+	return nil
+}
+
+// Skipper is the part of testing.TB used to skip the tests a server does not
+// support
+type Skipper interface {
+	Helper()
+	Fatal(args ...interface{})
+	Skipf(format string, args ...interface{})
+}
+
+// SkipUnlessSupported skips the test t when the server of c does not support
+// feature, so a test suite runs against every version of elasticsearch
+func SkipUnlessSupported(t Skipper, c *Connection, feature string) {
+	t.Helper()
+
+	r, ok := Features[feature]
+	if !ok {
+		t.Fatal(fmt.Errorf("unknown feature %s", feature))
+	}
+
+	skipUnless(t, c, r, feature)
+}
+
+// SkipUnlessVersion skips the test t when the version of the server of c is
+// not in r
+func SkipUnlessVersion(t Skipper, c *Connection, r VersionRange) {
+	t.Helper()
+
+	skipUnless(t, c, r, fmt.Sprintf("[%s, %s)", r.From, r.Until))
+}
+
+// skipUnless skips the test t when the version of the server of c is not in
+// r, what describes what is not supported
+func skipUnless(t Skipper, c *Connection, r VersionRange, what string) {
+	t.Helper()
+
+	version, err := c.serverVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !r.Contains(version) {
+		t.Skipf("%s is not supported by elasticsearch %s", what, version)
+	}
+}
+
+// serverVersion returns Version, fetching it first if needed
+func (c *Connection) serverVersion() (string, error) {
+	return c.serverVersionContext(context.Background())
+}
+
+// serverVersionContext is serverVersion, Version being fetched with ctx
+func (c *Connection) serverVersionContext(ctx context.Context) (string, error) {
+	state := c.shared()
+	state.versionLock.Lock()
+	defer state.versionLock.Unlock()
+
+	if c.Version != "" {
+		return c.Version, nil
+	}
+
+	r := Request{
+		Conn:   c,
+		method: "GET",
+		ctx:    ctx,
+	}
+
+	resp, err := r.Run()
+	if err != nil {
+		return "", err
+	}
+
+	c.Version = resp.ServerVersion.Number
+	return c.Version, nil
+}
+
+// compareVersions compares two versions like 1.7.5 or 5.0.0-alpha1 and returns
+// -1, 0 or 1 if a is lower, equal or greater than b. Pre-release suffixes are
+// ignored.
+func compareVersions(a string, b string) int {
+	pa := versionParts(a)
+	pb := versionParts(b)
+
+	for i := range pa {
+		if pa[i] < pb[i] {
+			return -1
+		}
+
+		if pa[i] > pb[i] {
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// versionParts returns the major, minor and patch numbers of a version
+func versionParts(version string) [3]int {
+	parts := [3]int{}
+
+	if i := strings.IndexAny(version, "-+"); i >= 0 {
+		version = version[:i]
+	}
+
+	for i, p := range strings.SplitN(version, ".", 3) {
+		parts[i], _ = strconv.Atoi(p)
+	}
+
+	return parts
+}
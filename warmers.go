@@ -0,0 +1,83 @@
+// Copyright 2013 Belogik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goes
+
+// PutWarmer creates or replaces the warmer called name, a search run on the
+// new segments of the indices of indexList before they become searchable.
+// The search is restricted to typeList when it is not empty. Warmers were
+// removed in elasticsearch 5.0.
+func (c *Connection) PutWarmer(name string, query interface{}, indexList []string, typeList []string) (Response, error) {
+	if err := c.require(FEATURE_WARMERS); err != nil {
+		return Response{}, err
+	}
+
+	r := Request{
+		Conn:      c,
+		Query:     query,
+		IndexList: indexList,
+		TypeList:  typeList,
+		method:    "PUT",
+		api:       "_warmer/" + name,
+	}
+
+	return r.Run()
+}
+
+// GetWarmer fetches the warmers called name of the indices of indexList by
+// index then by name. Every warmer is fetched when name is empty, name can
+// also be a wildcard expression.
+func (c *Connection) GetWarmer(indexList []string, name string) (map[string]map[string]Warmer, error) {
+	if err := c.require(FEATURE_WARMERS); err != nil {
+		return nil, err
+	}
+
+	r := Request{
+		Conn:      c,
+		IndexList: indexList,
+		method:    "GET",
+		api:       "_warmer",
+	}
+
+	if name != "" {
+		r.api += "/" + name
+	}
+
+	raw, err := r.RunRaw()
+	if err != nil {
+		return nil, err
+	}
+
+	indices := map[string]struct {
+		Warmers map[string]Warmer
+	}{}
+	if len(raw) > 0 {
+		if err := c.decode(raw, &indices); err != nil {
+			return nil, err
+		}
+	}
+
+	warmers := make(map[string]map[string]Warmer, len(indices))
+	for index, v := range indices {
+		warmers[index] = v.Warmers
+	}
+
+	return warmers, nil
+}
+
+// DeleteWarmer deletes the warmers called name of the indices of indexList
+func (c *Connection) DeleteWarmer(indexList []string, name string) (Response, error) {
+	if err := c.require(FEATURE_WARMERS); err != nil {
+		return Response{}, err
+	}
+
+	r := Request{
+		Conn:      c,
+		IndexList: indexList,
+		method:    "DELETE",
+		api:       "_warmer/" + name,
+	}
+
+	return r.Run()
+}